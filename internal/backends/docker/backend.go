@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"strings"
 
 	"github.com/docker/docker/api/types/container"
@@ -17,13 +18,13 @@ import (
 
 type Backend struct {
 	Docker        *client.Client
-	Config        config.Config
+	Config        *config.Config
 	Logger        *slog.Logger
 	FunctionsRepo core.FunctionsRepo
 	Pal           *pal.Pal
 }
 
-// Register creates a new function's template, scaler, and garbage collector(TODO).
+// Register creates a new function's template and scaler.
 func (b Backend) Register(ctx context.Context, function core.FunctionDefinition) error {
 	err := b.createFunctionTemplate(ctx, function)
 	if err != nil {
@@ -45,7 +46,7 @@ func (b Backend) Deregister(ctx context.Context, function core.FunctionDefinitio
 		return err //nolint:wrapcheck
 	}
 
-	// TODO: we only delete the definition, the containers should be stopped and deleted by the
+	// We only delete the definition, the scaler and the instances are stopped and deleted by the
 	// garbage collector.
 
 	b.Logger.Info("Function deregistered", "function", function)
@@ -59,14 +60,16 @@ func (b Backend) createScaler(ctx context.Context, function core.FunctionDefinit
 		Cmd:   []string{core.ComponentNameScaler},
 		Env: core.MapToEnvList(map[string]string{
 			core.EnvNameFunctionName: function.Name(),
-			core.EnvNameNatsURL:      b.Config.NATSURL,
+			core.EnvNameNatsURL:      b.Config.ContainerNATSURL(core.HostNameDockerHost),
 		}),
 		Labels: map[string]string{
 			core.LabelNameComponent: core.ComponentNameScaler,
+			core.LabelNameFunction:  function.Name(),
 		},
 	}
 
 	hostConfig := &container.HostConfig{
+		ExtraHosts: []string{core.ExtraHostDockerHost},
 		Binds: []string{
 			"/var/run/docker.sock:/var/run/docker.sock", // TODO: configurable
 		},
@@ -74,7 +77,7 @@ func (b Backend) createScaler(ctx context.Context, function core.FunctionDefinit
 	}
 	networkingConfig := &network.NetworkingConfig{
 		EndpointsConfig: map[string]*network.EndpointSettings{
-			"nats": {}, // TODO: get from config
+			core.NetworkNameNATS: {},
 		},
 	}
 
@@ -161,6 +164,11 @@ func (b Backend) AddInstance(ctx context.Context, function core.FunctionDefiniti
 		return "", fmt.Errorf("failed to inject dependencies into function pod: %w", err)
 	}
 
+	err = pod.Init(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize function pod: %w", err)
+	}
+
 	err = pod.Start(ctx)
 	if err != nil {
 		return "", fmt.Errorf("failed to start function pod: %w", err)
@@ -174,15 +182,27 @@ func (b Backend) AddInstance(ctx context.Context, function core.FunctionDefiniti
 func (b Backend) StopInstance(ctx context.Context, instanceID string) error {
 	b.Logger.Info("Killing function instance", "instanceID", instanceID)
 
-	return (&FunctionPod{uuid: instanceID, Docker: b.Docker}).Stop(ctx)
+	pod := &FunctionPod{uuid: instanceID}
+
+	err := b.Pal.InjectInto(ctx, pod)
+	if err != nil {
+		return fmt.Errorf("failed to inject dependencies into function pod: %w", err)
+	}
+
+	err = pod.Init(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to initialize function pod: %w", err)
+	}
+
+	return pod.Stop(ctx)
 }
 
-func (b Backend) StartGateway(ctx context.Context) (string, error) {
+func (b Backend) StartGateway(ctx context.Context, config core.ServiceConfig) (string, error) {
 	containerConfig := &container.Config{
 		Image: core.ImageNameFID,
 		Cmd:   []string{core.ComponentNameGateway},
-		Env: core.MapToEnvList(map[string]string{
-			core.EnvNameNatsURL: b.Config.NATSURL,
+		Env: core.MapToEnvList(config.Env, map[string]string{
+			core.EnvNameNatsURL: b.Config.ContainerNATSURL(core.HostNameDockerHost),
 		}),
 		Labels: map[string]string{
 			core.LabelNameComponent: core.ComponentNameGateway,
@@ -193,20 +213,13 @@ func (b Backend) StartGateway(ctx context.Context) (string, error) {
 	}
 
 	hostConfig := &container.HostConfig{
+		ExtraHosts: []string{core.ExtraHostDockerHost},
 		// AutoRemove: true,
-		PortBindings: nat.PortMap{
-			// TODO: configurable
-			core.PortTCP80: {
-				{
-					HostPort: "8081",
-					HostIP:   "0.0.0.0",
-				},
-			},
-		},
+		PortBindings: portBindings(config),
 	}
 	networkingConfig := &network.NetworkingConfig{
 		EndpointsConfig: map[string]*network.EndpointSettings{
-			"nats": {}, // TODO: get from config
+			core.NetworkNameNATS: {},
 		},
 	}
 
@@ -234,12 +247,12 @@ func (b Backend) StartGateway(ctx context.Context) (string, error) {
 	return resp.ID, nil
 }
 
-func (b Backend) StartInfoServer(ctx context.Context) (string, error) {
+func (b Backend) StartInfoServer(ctx context.Context, config core.ServiceConfig) (string, error) {
 	containerConfig := &container.Config{
 		Image: core.ImageNameFID,
 		Cmd:   []string{core.ComponentNameInfoServer},
 		Env: core.MapToEnvList(map[string]string{
-			core.EnvNameNatsURL: b.Config.NATSURL,
+			core.EnvNameNatsURL: b.Config.ContainerNATSURL(core.HostNameDockerHost),
 		}),
 		Labels: map[string]string{
 			core.LabelNameComponent: core.ComponentNameInfoServer,
@@ -250,23 +263,16 @@ func (b Backend) StartInfoServer(ctx context.Context) (string, error) {
 	}
 
 	hostConfig := &container.HostConfig{
+		ExtraHosts: []string{core.ExtraHostDockerHost},
 		Binds: []string{
 			"/var/run/docker.sock:/var/run/docker.sock", // TODO: configurable
 		},
 		// AutoRemove: true,
-		PortBindings: nat.PortMap{
-			// TODO: configurable
-			core.PortTCP80: {
-				{
-					HostPort: "8080",
-					HostIP:   "0.0.0.0",
-				},
-			},
-		},
+		PortBindings: portBindings(config),
 	}
 	networkingConfig := &network.NetworkingConfig{
 		EndpointsConfig: map[string]*network.EndpointSettings{
-			"nats": {}, // TODO: get from config
+			core.NetworkNameNATS: {},
 		},
 	}
 
@@ -293,3 +299,68 @@ func (b Backend) StartInfoServer(ctx context.Context) (string, error) {
 
 	return resp.ID, nil
 }
+
+func (b Backend) StartGarbageCollector(ctx context.Context) (string, error) {
+	containerConfig := &container.Config{
+		Image: core.ImageNameFID,
+		Cmd:   []string{core.ComponentNameGarbageCollector},
+		Env: core.MapToEnvList(map[string]string{
+			core.EnvNameNatsURL: b.Config.ContainerNATSURL(core.HostNameDockerHost),
+		}),
+		Labels: map[string]string{
+			core.LabelNameComponent: core.ComponentNameGarbageCollector,
+		},
+	}
+
+	hostConfig := &container.HostConfig{
+		ExtraHosts: []string{core.ExtraHostDockerHost},
+		Binds: []string{
+			"/var/run/docker.sock:/var/run/docker.sock", // TODO: configurable
+		},
+		// AutoRemove: true,
+	}
+	networkingConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			core.NetworkNameNATS: {},
+		},
+	}
+
+	resp, err := b.Docker.ContainerCreate(
+		ctx, containerConfig, hostConfig,
+		networkingConfig, nil, core.ContainerNameGarbageCollector,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "Conflict. The container name") {
+			b.Logger.Info("Garbage collector container already exists")
+
+			return "", core.ErrContainerAlreadyExists
+		}
+
+		return "", fmt.Errorf("failed to create garbage collector container: %w", err)
+	}
+
+	err = b.Docker.ContainerStart(ctx, resp.ID, container.StartOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to start garbage collector container: %w", err)
+	}
+
+	b.Logger.Info("Garbage collector container created and started")
+
+	return resp.ID, nil
+}
+
+// portBindings publishes the service's port 80 on the configured host port.
+func portBindings(config core.ServiceConfig) nat.PortMap {
+	if config.Port == 0 {
+		return nil
+	}
+
+	return nat.PortMap{
+		core.PortTCP80: {
+			{
+				HostPort: strconv.Itoa(config.Port),
+				HostIP:   "0.0.0.0",
+			},
+		},
+	}
+}
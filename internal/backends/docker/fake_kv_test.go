@@ -0,0 +1,54 @@
+package docker_test
+
+import (
+	"context"
+	"sync"
+
+	"github.com/zhulik/fid/internal/core"
+)
+
+// interruptibleKV wraps a KV, watches of its buckets can be stopped with interrupt as if the connection
+// to the broker was lost.
+type interruptibleKV struct {
+	core.KV
+
+	mu         sync.Mutex
+	interrupts []context.CancelFunc
+}
+
+func (k *interruptibleKV) CreateBucketWithConfig(ctx context.Context, config core.BucketConfig) (core.KVBucket, error) {
+	bucket, err := k.KV.CreateBucketWithConfig(ctx, config)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return &interruptibleBucket{KVBucket: bucket, kv: k}, nil
+}
+
+// interrupt stops all running watches.
+func (k *interruptibleKV) interrupt() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, cancel := range k.interrupts {
+		cancel()
+	}
+
+	k.interrupts = nil
+}
+
+type interruptibleBucket struct {
+	core.KVBucket
+
+	kv *interruptibleKV
+}
+
+func (b *interruptibleBucket) Watch(ctx context.Context, filters ...string) (<-chan core.KVEvent, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	b.kv.mu.Lock()
+	b.kv.interrupts = append(b.kv.interrupts, cancel)
+	b.kv.mu.Unlock()
+
+	return b.KVBucket.Watch(ctx, filters...) //nolint:wrapcheck
+}
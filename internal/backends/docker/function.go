@@ -7,12 +7,25 @@ import (
 )
 
 type Function struct {
-	Name_    string            `json:"name"`
-	Image_   string            `json:"image"`
-	Timeout_ time.Duration     `json:"timeout"`
-	MinScale int               `json:"minScale"`
-	MaxScale int               `json:"maxScale"`
-	Env_     map[string]string `json:"env"`
+	Name_               string            `json:"name"`
+	Image_              string            `json:"image"`
+	Timeout_            time.Duration     `json:"timeout"`
+	MinScale            int               `json:"minScale"`
+	MaxScale            int               `json:"maxScale"`
+	Concurrency         int               `json:"concurrency"`
+	IdleTimeout         time.Duration     `json:"idleTimeout"`
+	Retries             int               `json:"retries"`
+	RetryBackoff        time.Duration     `json:"retryBackoff"`
+	MaxRetryBackoff     time.Duration     `json:"maxRetryBackoff"`
+	MaxConcurrency      int               `json:"maxConcurrency"`
+	ReservedConcurrency int               `json:"reservedConcurrency"`
+	MaxQueueLength      int               `json:"maxQueueLength"`
+	RateLimit           core.RateLimit    `json:"rateLimit"`
+	CallerRateLimit     core.RateLimit    `json:"callerRateLimit"`
+	Stream              core.StreamConfig `json:"stream"`
+	Routes_             []core.Route      `json:"routes"`
+	Auth                core.AuthConfig   `json:"auth"`
+	Env_                map[string]string `json:"env"`
 }
 
 func (f Function) Image() string {
@@ -37,7 +50,39 @@ func (f Function) Timeout() time.Duration {
 
 func (f Function) ScalingConfig() core.ScalingConfig {
 	return core.ScalingConfig{
-		Min: f.MinScale,
-		Max: f.MaxScale,
+		Min:         f.MinScale,
+		Max:         f.MaxScale,
+		Concurrency: max(f.Concurrency, core.DefaultConcurrency),
+		IdleTimeout: f.IdleTimeout,
 	}
 }
+
+func (f Function) RetryConfig() core.RetryConfig {
+	return core.RetryConfig{
+		Retries:    f.Retries,
+		Backoff:    f.RetryBackoff,
+		MaxBackoff: f.MaxRetryBackoff,
+	}
+}
+
+func (f Function) LimitsConfig() core.LimitsConfig {
+	return core.LimitsConfig{
+		MaxConcurrency:      f.MaxConcurrency,
+		ReservedConcurrency: f.ReservedConcurrency,
+		MaxQueueLength:      f.MaxQueueLength,
+		RateLimit:           f.RateLimit,
+		CallerRateLimit:     f.CallerRateLimit,
+	}
+}
+
+func (f Function) StreamConfig() core.StreamConfig {
+	return f.Stream
+}
+
+func (f Function) Routes() []core.Route {
+	return f.Routes_
+}
+
+func (f Function) AuthConfig() core.AuthConfig {
+	return f.Auth
+}
@@ -1,16 +1,21 @@
 package docker
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/zhulik/fid/internal/core"
 )
 
 type FunctionInstance struct {
-	ID_           string
-	LastExecuted_ time.Time
-	Busy_         bool
-	Function_     core.FunctionDefinition
+	ID_            string
+	StartedAt_     time.Time
+	LastExecuted_  time.Time
+	LastHeartbeat_ time.Time
+	InFlight_      int
+	Failed_        bool
+	InitFailed_    bool
+	Function_      core.FunctionDefinition
 }
 
 func NewFunctionInstance(id string, function core.FunctionDefinition, values map[string]core.KVEntry) FunctionInstance {
@@ -19,14 +24,34 @@ func NewFunctionInstance(id string, function core.FunctionDefinition, values map
 		Function_: function,
 	}
 
+	if entry, ok := values[presenceKey(function.Name(), id)]; ok {
+		instance.StartedAt_ = deserializeTime(entry.Value)
+	}
+
 	// if lastExecuted record exist - parse it and assign
 	if entry, ok := values[lastExecutedKey(function.Name(), id)]; ok {
 		instance.LastExecuted_ = deserializeTime(entry.Value)
 	}
 
-	// If no idle flag - mark as busy
-	if _, ok := values[idleKey(function.Name(), id)]; !ok {
-		instance.Busy_ = true
+	if entry, ok := values[heartbeatKey(function.Name(), id)]; ok {
+		instance.LastHeartbeat_ = deserializeTime(entry.Value)
+	}
+
+	// If no in-flight counter - consider all slots taken
+	instance.InFlight_ = function.ScalingConfig().Concurrency
+	if entry, ok := values[inFlightKey(function.Name(), id)]; ok {
+		if inFlight, err := strconv.Atoi(string(entry.Value)); err == nil {
+			instance.InFlight_ = inFlight
+		}
+	}
+
+	if _, ok := values[initErrorKey(function.Name(), id)]; ok {
+		instance.Failed_ = true
+		instance.InitFailed_ = true
+	}
+
+	if _, ok := values[unhealthyKey(function.Name(), id)]; ok {
+		instance.Failed_ = true
 	}
 
 	return instance
@@ -36,14 +61,30 @@ func (f FunctionInstance) ID() string {
 	return f.ID_
 }
 
+func (f FunctionInstance) StartedAt() time.Time {
+	return f.StartedAt_
+}
+
 func (f FunctionInstance) LastExecuted() time.Time {
 	return f.LastExecuted_
 }
 
+func (f FunctionInstance) LastHeartbeat() time.Time {
+	return f.LastHeartbeat_
+}
+
 func (f FunctionInstance) Function() core.FunctionDefinition {
 	return f.Function_
 }
 
-func (f FunctionInstance) Busy() bool {
-	return f.Busy_
+func (f FunctionInstance) InFlight() int {
+	return f.InFlight_
+}
+
+func (f FunctionInstance) Failed() bool {
+	return f.Failed_
+}
+
+func (f FunctionInstance) InitFailed() bool {
+	return f.InitFailed_
 }
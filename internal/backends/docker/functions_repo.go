@@ -29,12 +29,27 @@ func (r *FunctionsRepo) Init(ctx context.Context) error {
 
 func (r FunctionsRepo) Upsert(ctx context.Context, function core.FunctionDefinition) error {
 	backendFunction := Function{
-		Name_:    function.Name(),
-		Image_:   function.Image(),
-		Timeout_: function.Timeout(),
-		MinScale: function.ScalingConfig().Min,
-		MaxScale: function.ScalingConfig().Max,
-		Env_:     function.Env(),
+		Name_:       function.Name(),
+		Image_:      function.Image(),
+		Timeout_:    function.Timeout(),
+		MinScale:    function.ScalingConfig().Min,
+		MaxScale:    function.ScalingConfig().Max,
+		Concurrency: function.ScalingConfig().Concurrency,
+		IdleTimeout: function.ScalingConfig().IdleTimeout,
+		Env_:        function.Env(),
+
+		Retries:         function.RetryConfig().Retries,
+		RetryBackoff:    function.RetryConfig().Backoff,
+		MaxRetryBackoff: function.RetryConfig().MaxBackoff,
+
+		MaxConcurrency:      function.LimitsConfig().MaxConcurrency,
+		ReservedConcurrency: function.LimitsConfig().ReservedConcurrency,
+		MaxQueueLength:      function.LimitsConfig().MaxQueueLength,
+		RateLimit:           function.LimitsConfig().RateLimit,
+		CallerRateLimit:     function.LimitsConfig().CallerRateLimit,
+		Stream:              function.StreamConfig(),
+		Routes_:             function.Routes(),
+		Auth:                function.AuthConfig(),
 	}
 
 	bytes, err := json.Marshal(backendFunction)
@@ -0,0 +1,257 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/pal"
+)
+
+// gracePeriod protects pods and instance records which are being created right now from being collected.
+const gracePeriod = time.Minute
+
+// podState is a pod assembled from the containers and networks labelled with the same instance ID.
+type podState struct {
+	function          string
+	createdAt         time.Time
+	runtimeAPIRunning bool
+}
+
+// GarbageCollector reconciles docker resources and the instances repo:
+//   - removes pods whose runtime API is not running anymore;
+//   - removes pods and scalers of deregistered functions;
+//   - deletes instance records which do not have a pod.
+type GarbageCollector struct {
+	Docker        *client.Client
+	Logger        *slog.Logger
+	KV            core.KV
+	FunctionsRepo core.FunctionsRepo
+	InstancesRepo core.InstancesRepo
+	Pal           *pal.Pal
+}
+
+func (g GarbageCollector) Collect(ctx context.Context) error {
+	g.Logger.Debug("Collecting garbage...")
+
+	functions, err := g.FunctionsRepo.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list functions: %w", err)
+	}
+
+	registered := lo.SliceToMap(functions, func(fn core.FunctionDefinition) (string, bool) {
+		return fn.Name(), true
+	})
+
+	pods, err := g.listPods(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = g.collectPods(ctx, pods, registered)
+	if err != nil {
+		return err
+	}
+
+	err = g.collectScalers(ctx, registered)
+	if err != nil {
+		return err
+	}
+
+	return g.collectInstanceRecords(ctx, pods)
+}
+
+func (g GarbageCollector) collectPods(ctx context.Context, pods map[string]*podState, registered map[string]bool) error { //nolint:lll
+	var errs []error
+
+	for id, pod := range pods {
+		logger := g.Logger.With("podID", id, "function", pod.function)
+
+		switch {
+		case time.Since(pod.createdAt) < gracePeriod:
+			continue
+		case !registered[pod.function]:
+			logger.Info("Removing pod of a deregistered function")
+		case !pod.runtimeAPIRunning:
+			logger.Info("Removing pod with dead runtime API")
+		default:
+			continue
+		}
+
+		err := g.removePod(ctx, id, pod)
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		delete(pods, id)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (g GarbageCollector) removePod(ctx context.Context, id string, pod *podState) error {
+	function := Function{Name_: pod.function}
+
+	fnPod := &FunctionPod{uuid: id, Function: function}
+
+	err := g.Pal.InjectInto(ctx, fnPod)
+	if err != nil {
+		return fmt.Errorf("failed to inject dependencies into function pod: %w", err)
+	}
+
+	err = fnPod.Init(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to initialize function pod: %w", err)
+	}
+
+	err = fnPod.Stop(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to remove pod %s: %w", id, err)
+	}
+
+	// The runtime API deletes its record on graceful shutdown, but a dead one cannot.
+	err = g.InstancesRepo.Delete(ctx, function, id)
+	if err != nil && !errors.Is(err, core.ErrInstanceNotFound) {
+		return fmt.Errorf("failed to delete instance record %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// collectScalers removes scaler containers of deregistered functions.
+func (g GarbageCollector) collectScalers(ctx context.Context, registered map[string]bool) error {
+	containers, err := g.Docker.ContainerList(ctx, container.ListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("label", fmt.Sprintf("%s=%s", core.LabelNameComponent, core.ComponentNameScaler)),
+			filters.Arg("label", core.LabelNameFunction),
+		),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list scaler containers: %w", err)
+	}
+
+	for _, cont := range containers {
+		function := cont.Labels[core.LabelNameFunction]
+		if registered[function] {
+			continue
+		}
+
+		g.Logger.Info("Removing scaler of a deregistered function", "function", function)
+
+		err = g.Docker.ContainerRemove(ctx, cont.ID, container.RemoveOptions{Force: true})
+		if err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("failed to remove scaler container of %s: %w", function, err)
+		}
+	}
+
+	return nil
+}
+
+// collectInstanceRecords deletes instance records which do not have a corresponding pod.
+func (g GarbageCollector) collectInstanceRecords(ctx context.Context, pods map[string]*podState) error {
+	bucket, err := g.KV.Bucket(ctx, core.BucketNameInstances)
+	if err != nil {
+		return fmt.Errorf("failed to get instances bucket: %w", err)
+	}
+
+	// Records of instances with expired leases do not have presence keys, so all records are listed.
+	keys, err := bucket.Keys(ctx, allKeys("*", "*"))
+	if err != nil {
+		return fmt.Errorf("failed to list instances: %w", err)
+	}
+
+	ids := lo.Uniq(lo.Map(keys, func(key string, _ int) lo.Tuple2[string, string] {
+		return lo.T2(parseKey(key))
+	}))
+
+	for _, functionAndID := range ids {
+		functionName, id := functionAndID.Unpack()
+
+		if _, ok := pods[id]; ok {
+			continue
+		}
+
+		function := Function{Name_: functionName}
+
+		instance, err := g.InstancesRepo.Get(ctx, function, id)
+		if err != nil {
+			if errors.Is(err, core.ErrInstanceNotFound) {
+				continue
+			}
+
+			return fmt.Errorf("failed to get instance %s: %w", id, err)
+		}
+
+		if time.Since(instance.StartedAt()) < gracePeriod {
+			continue
+		}
+
+		g.Logger.Info("Deleting stale instance record", "function", functionName, "instanceID", id)
+
+		err = g.InstancesRepo.Delete(ctx, function, id)
+		if err != nil && !errors.Is(err, core.ErrInstanceNotFound) {
+			return fmt.Errorf("failed to delete instance record %s: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+// listPods builds pods from containers and networks labelled with an instance ID. A pod is also listed when
+// only some of its parts exist, for instance, a network left behind by a failed pod creation.
+func (g GarbageCollector) listPods(ctx context.Context) (map[string]*podState, error) {
+	args := filters.NewArgs(filters.Arg("label", core.LabelNameInstance))
+
+	containers, err := g.Docker.ContainerList(ctx, container.ListOptions{All: true, Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	networks, err := g.Docker.NetworkList(ctx, network.ListOptions{Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks: %w", err)
+	}
+
+	pods := map[string]*podState{}
+
+	pod := func(labels map[string]string, createdAt time.Time) *podState {
+		id := labels[core.LabelNameInstance]
+
+		state, ok := pods[id]
+		if !ok {
+			state = &podState{function: labels[core.LabelNameFunction], createdAt: createdAt}
+			pods[id] = state
+		}
+
+		if createdAt.After(state.createdAt) {
+			state.createdAt = createdAt
+		}
+
+		return state
+	}
+
+	for _, cont := range containers {
+		state := pod(cont.Labels, time.Unix(cont.Created, 0))
+
+		if cont.Labels[core.LabelNameComponent] == core.ComponentNameRuntimeAPI && cont.State == "running" {
+			state.runtimeAPIRunning = true
+		}
+	}
+
+	for _, net := range networks {
+		pod(net.Labels, net.Created)
+	}
+
+	return pods, nil
+}
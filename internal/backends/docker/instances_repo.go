@@ -6,11 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/samber/lo"
 	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/pkg/json"
 )
 
 // Key structure "<function-name>.<instance-uuid>"
@@ -23,7 +25,7 @@ type InstancesRepo struct { //nolint:recvcheck
 }
 
 func (r *InstancesRepo) Init(ctx context.Context) error {
-	bucket, err := r.KV.CreateBucket(ctx, core.BucketNameInstances)
+	bucket, err := r.KV.CreateBucketWithConfig(ctx, core.BucketConfigInstances)
 	if err != nil {
 		return fmt.Errorf("failed to create instances bucket: %w", err)
 	}
@@ -54,13 +56,14 @@ func (r InstancesRepo) List(ctx context.Context, function core.FunctionDefinitio
 	return instances, nil
 }
 
+// Count counts alive instances.
 func (r InstancesRepo) Count(ctx context.Context, function core.FunctionDefinition) (int, error) {
-	count, err := r.bucket.Count(ctx, presenceKey(function.Name(), "*"))
+	instances, err := r.List(ctx, function)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count functions instances: %w", err)
 	}
 
-	return count, nil
+	return lo.CountBy(instances, core.IsAlive), nil
 }
 
 func (r InstancesRepo) Get(
@@ -107,8 +110,12 @@ func (r InstancesRepo) Delete(ctx context.Context, function core.FunctionDefinit
 	return nil
 }
 
+// Add registers the instance, its presence and heartbeat records are the instance's lease. All records
+// of the instance expire with the lease unless Heartbeat renews it.
 func (r InstancesRepo) Add(ctx context.Context, function core.FunctionDefinition, id string) error {
-	_, err := r.bucket.Create(ctx, presenceKey(function.Name(), id), []byte{}) // TODO: put something in?
+	now := serializeTime(time.Now())
+
+	_, err := r.bucket.CreateWithTTL(ctx, presenceKey(function.Name(), id), now, core.InstanceLeaseTTL)
 	if err != nil {
 		if errors.Is(err, core.ErrKeyExists) {
 			return fmt.Errorf("%w: %s", core.ErrInstanceAlreadyExists, id)
@@ -117,7 +124,46 @@ func (r InstancesRepo) Add(ctx context.Context, function core.FunctionDefinition
 		return fmt.Errorf("failed to create instance: %w", err)
 	}
 
-	return r.SetBusy(ctx, function, id, false)
+	err = r.bucket.PutWithTTL(ctx, heartbeatKey(function.Name(), id), now, core.InstanceLeaseTTL)
+	if err != nil {
+		return fmt.Errorf("failed to record heartbeat: %w", err)
+	}
+
+	return r.SetInFlight(ctx, function, id, 0)
+}
+
+// Heartbeat records the heartbeat and puts the instance's records again, so they expire together with
+// the lease. An expired lease is not taken again: the instance may have been removed as dead already, so
+// core.ErrInstanceLeaseExpired is returned. The instance's records must not be changed concurrently, the
+// runtime API serializes its updates.
+func (r InstancesRepo) Heartbeat(ctx context.Context, function core.FunctionDefinition, id string) error {
+	list, err := r.bucket.All(ctx, allKeys(function.Name(), id))
+	if err != nil {
+		return fmt.Errorf("failed to get instance records: %w", err)
+	}
+
+	records := groupByKey(list)
+
+	if _, ok := records[presenceKey(function.Name(), id)]; !ok {
+		return fmt.Errorf("%w: %s", core.ErrInstanceLeaseExpired, id)
+	}
+
+	delete(records, heartbeatKey(function.Name(), id))
+
+	for key, record := range records {
+		err = r.bucket.PutWithTTL(ctx, key, record.Value, core.InstanceLeaseTTL)
+		if err != nil {
+			return fmt.Errorf("failed to renew instance lease: %w", err)
+		}
+	}
+
+	err = r.bucket.PutWithTTL(ctx, heartbeatKey(function.Name(), id), serializeTime(time.Now()),
+		core.InstanceLeaseTTL)
+	if err != nil {
+		return fmt.Errorf("failed to record heartbeat: %w", err)
+	}
+
+	return nil
 }
 
 func (r InstancesRepo) SetLastExecuted(
@@ -126,7 +172,8 @@ func (r InstancesRepo) SetLastExecuted(
 	id string,
 	timestamp time.Time,
 ) error {
-	err := r.bucket.Put(ctx, lastExecutedKey(function.Name(), id), serializeTime(timestamp))
+	err := r.bucket.PutWithTTL(ctx, lastExecutedKey(function.Name(), id), serializeTime(timestamp),
+		core.InstanceLeaseTTL)
 	if err != nil {
 		return fmt.Errorf("failed to update last executed time: %w", err)
 	}
@@ -134,36 +181,117 @@ func (r InstancesRepo) SetLastExecuted(
 	return nil
 }
 
-func (r InstancesRepo) SetBusy(ctx context.Context, function core.FunctionDefinition, id string, busy bool) error {
-	var err error
-	if busy {
-		err = r.bucket.Delete(ctx, idleKey(function.Name(), id))
-	} else {
-		err = r.bucket.Put(ctx, idleKey(function.Name(), id), []byte{}) // TODO: put something in?
+func (r InstancesRepo) SetInFlight(
+	ctx context.Context,
+	function core.FunctionDefinition,
+	id string,
+	inFlight int,
+) error {
+	err := r.bucket.PutWithTTL(ctx, inFlightKey(function.Name(), id), []byte(strconv.Itoa(inFlight)),
+		core.InstanceLeaseTTL)
+	if err != nil {
+		return fmt.Errorf("failed to update in-flight invocations: %w", err)
+	}
+
+	return nil
+}
+
+// CountAvailable counts free invocation slots of alive instances.
+func (r InstancesRepo) CountAvailable(ctx context.Context, function core.FunctionDefinition) (int, error) {
+	instances, err := r.List(ctx, function)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count available slots: %w", err)
+	}
+
+	return lo.SumBy(instances, func(instance core.FunctionInstance) int {
+		if !core.IsAlive(instance) {
+			return 0
+		}
+
+		return core.AvailableSlots(instance)
+	}), nil
+}
+
+func (r InstancesRepo) SetInitError(
+	ctx context.Context,
+	function core.FunctionDefinition,
+	id string,
+	payload []byte,
+) error {
+	err := r.bucket.PutWithTTL(ctx, initErrorKey(function.Name(), id), payload, core.InstanceLeaseTTL)
+	if err != nil {
+		return fmt.Errorf("failed to store init error: %w", err)
+	}
+
+	initError, err := json.Marshal(core.InitError{
+		InstanceID: id,
+		Payload:    payload,
+		Timestamp:  time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal init error: %w", err)
 	}
 
+	// Instance records are deleted when the instance stops, the last error is kept on the function level.
+	err = r.bucket.Put(ctx, lastInitErrorKey(function.Name()), initError)
 	if err != nil {
-		return fmt.Errorf("failed to update busy status: %w", err)
+		return fmt.Errorf("failed to store last init error: %w", err)
 	}
 
 	return nil
 }
 
-func (r InstancesRepo) CountIdle(ctx context.Context, function core.FunctionDefinition) (int, error) {
-	count, err := r.bucket.Count(ctx, idleKey(function.Name(), "*"))
+func (r InstancesRepo) LastInitError(ctx context.Context, function core.FunctionDefinition) (*core.InitError, error) {
+	bytes, err := r.bucket.Get(ctx, lastInitErrorKey(function.Name()))
 	if err != nil {
-		return 0, fmt.Errorf("failed to count idle instances: %w", err)
+		if errors.Is(err, core.ErrKeyNotFound) {
+			return nil, nil //nolint:nilnil
+		}
+
+		return nil, fmt.Errorf("failed to get last init error: %w", err)
 	}
 
-	return count, nil
+	initError, err := json.Unmarshal[core.InitError](bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal last init error: %w", err)
+	}
+
+	return &initError, nil
+}
+
+func (r InstancesRepo) SetUnhealthy(ctx context.Context, function core.FunctionDefinition, id string) error {
+	err := r.bucket.PutWithTTL(ctx, unhealthyKey(function.Name(), id), serializeTime(time.Now()),
+		core.InstanceLeaseTTL)
+	if err != nil {
+		return fmt.Errorf("failed to mark instance unhealthy: %w", err)
+	}
+
+	return nil
 }
 
 func lastExecutedKey(functionName, instanceID string) string {
 	return fmt.Sprintf("%s.%s.lastExecuted", functionName, instanceID)
 }
 
-func idleKey(functionName, instanceID string) string {
-	return fmt.Sprintf("%s.%s.idle", functionName, instanceID)
+func heartbeatKey(functionName, instanceID string) string {
+	return fmt.Sprintf("%s.%s.heartbeat", functionName, instanceID)
+}
+
+func inFlightKey(functionName, instanceID string) string {
+	return fmt.Sprintf("%s.%s.inFlight", functionName, instanceID)
+}
+
+func initErrorKey(functionName, instanceID string) string {
+	return fmt.Sprintf("%s.%s.initError", functionName, instanceID)
+}
+
+func unhealthyKey(functionName, instanceID string) string {
+	return fmt.Sprintf("%s.%s.unhealthy", functionName, instanceID)
+}
+
+// lastInitErrorKey has only two tokens, so it does not match instance keys filters.
+func lastInitErrorKey(functionName string) string {
+	return fmt.Sprintf("%s.lastInitError", functionName)
 }
 
 func presenceKey(functionName, instanceID string) string {
@@ -192,7 +320,12 @@ func serializeTime(t time.Time) []byte {
 }
 
 // deserializeTime extracts a unix timestamp in nanoseconds from []byte and returns it as time.Time.
+// Returns zero time if data is not a serialized timestamp.
 func deserializeTime(data []byte) time.Time {
+	if len(data) != 8 { //nolint:mnd
+		return time.Time{}
+	}
+
 	nanos := int64(binary.LittleEndian.Uint64(data)) //nolint:gosec
 
 	return time.Unix(0, nanos)
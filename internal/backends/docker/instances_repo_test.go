@@ -1,6 +1,7 @@
 package docker_test
 
 import (
+	"encoding/binary"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -8,7 +9,6 @@ import (
 	"github.com/samber/lo"
 	"github.com/zhulik/fid/internal/backends/docker"
 	"github.com/zhulik/fid/internal/core"
-	ikv "github.com/zhulik/fid/internal/kv"
 	"github.com/zhulik/fid/testhelpers"
 	"github.com/zhulik/pal"
 )
@@ -26,18 +26,12 @@ var function = docker.Function{
 var _ = Describe("InstancesRepo", Serial, func() {
 	var p *pal.Pal
 	var repo *docker.InstancesRepo
-	var kv core.KV
 
 	BeforeEach(func(ctx SpecContext) {
-		p = testhelpers.NewPal(ctx,
-			ikv.Provide(),
+		p = testhelpers.NewMemoryPal(ctx,
 			pal.Provide(&docker.InstancesRepo{}),
 		)
 
-		kv = lo.Must(pal.Invoke[core.KV](ctx, p))
-
-		DeferCleanup(func(ctx SpecContext) { kv.DeleteBucket(ctx, core.BucketNameInstances) }) //nolint:errcheck
-
 		repo = lo.Must(pal.Invoke[*docker.InstancesRepo](ctx, p))
 	})
 
@@ -52,6 +46,15 @@ var _ = Describe("InstancesRepo", Serial, func() {
 				Expect(instance.ID()).To(Equal(instanceID))
 			})
 
+			It("records the start time", func(ctx SpecContext) {
+				err := repo.Add(ctx, function, instanceID)
+				Expect(err).ToNot(HaveOccurred())
+
+				instance, err := repo.Get(ctx, function, instanceID)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(instance.StartedAt()).To(BeTemporally("~", time.Now(), time.Second))
+			})
+
 			Context("when instance already exists", func() {
 				BeforeEach(func(ctx SpecContext) {
 					lo.Must0(repo.Add(ctx, function, instanceID))
@@ -65,6 +68,50 @@ var _ = Describe("InstancesRepo", Serial, func() {
 		})
 	})
 
+	Describe("Heartbeat", func() {
+		BeforeEach(func(ctx SpecContext) {
+			lo.Must0(repo.Add(ctx, function, instanceID))
+		})
+
+		It("records the heartbeat keeping the start time", func(ctx SpecContext) {
+			instance := lo.Must(repo.Get(ctx, function, instanceID))
+			Expect(instance.LastHeartbeat()).To(Equal(instance.StartedAt()))
+
+			time.Sleep(10 * time.Millisecond)
+
+			err := repo.Heartbeat(ctx, function, instanceID)
+			Expect(err).ToNot(HaveOccurred())
+
+			heartbeaten := lo.Must(repo.Get(ctx, function, instanceID))
+			Expect(heartbeaten.StartedAt()).To(Equal(instance.StartedAt()))
+			Expect(heartbeaten.LastHeartbeat()).To(BeTemporally(">", instance.LastHeartbeat()))
+			Expect(core.IsAlive(heartbeaten)).To(BeTrue())
+		})
+
+		It("keeps the instance's records", func(ctx SpecContext) {
+			lo.Must0(repo.SetInFlight(ctx, function, instanceID, 1))
+
+			Expect(repo.Heartbeat(ctx, function, instanceID)).To(Succeed())
+
+			instance := lo.Must(repo.Get(ctx, function, instanceID))
+			Expect(instance.InFlight()).To(Equal(1))
+		})
+
+		Context("when the lease has expired", func() {
+			BeforeEach(func(ctx SpecContext) {
+				lo.Must0(repo.Delete(ctx, function, instanceID))
+			})
+
+			It("returns an error without taking the lease again", func(ctx SpecContext) {
+				err := repo.Heartbeat(ctx, function, instanceID)
+				Expect(err).To(MatchError(core.ErrInstanceLeaseExpired))
+
+				_, err = repo.Get(ctx, function, instanceID)
+				Expect(err).To(MatchError(core.ErrInstanceNotFound))
+			})
+		})
+	})
+
 	Describe("SetLastExecuted", func() {
 		Describe("SetLastExecuted", func() {
 			lastExecuted := time.Now()
@@ -83,27 +130,27 @@ var _ = Describe("InstancesRepo", Serial, func() {
 			})
 		})
 
-		Describe("SetBusy", func() {
+		Describe("SetInFlight", func() {
 			BeforeEach(func(ctx SpecContext) {
 				lo.Must0(repo.Add(ctx, function, instanceID))
 			})
 
-			It("updates the busy status", func(ctx SpecContext) {
-				err := repo.SetBusy(ctx, function, instanceID, true)
+			It("updates the in-flight invocations", func(ctx SpecContext) {
+				err := repo.SetInFlight(ctx, function, instanceID, 1)
 				Expect(err).ToNot(HaveOccurred())
 
 				instance, err := repo.Get(ctx, function, instanceID)
 				Expect(err).ToNot(HaveOccurred())
-				Expect(instance.Busy()).To(BeTrue())
+				Expect(instance.InFlight()).To(Equal(1))
 			})
 		})
 
-		Describe("CountIdle", func() {
+		Describe("CountAvailable", func() {
 			Context("when no instances exist", func() {
 				It("returns 0", func(ctx SpecContext) {
-					idle, err := repo.CountIdle(ctx, function)
+					available, err := repo.CountAvailable(ctx, function)
 					Expect(err).ToNot(HaveOccurred())
-					Expect(idle).To(BeZero())
+					Expect(available).To(BeZero())
 				})
 			})
 
@@ -113,39 +160,115 @@ var _ = Describe("InstancesRepo", Serial, func() {
 					lo.Must0(repo.Add(ctx, function, instanceID1))
 				})
 
-				Context("when all instances are busy", func() {
+				Context("when all slots are taken", func() {
 					BeforeEach(func(ctx SpecContext) {
-						lo.Must0(repo.SetBusy(ctx, function, instanceID, true))
-						lo.Must0(repo.SetBusy(ctx, function, instanceID1, true))
+						lo.Must0(repo.SetInFlight(ctx, function, instanceID, 1))
+						lo.Must0(repo.SetInFlight(ctx, function, instanceID1, 1))
 					})
 
-					It("returns the number of idle instances", func(ctx SpecContext) {
-						idle, err := repo.CountIdle(ctx, function)
+					It("returns 0", func(ctx SpecContext) {
+						available, err := repo.CountAvailable(ctx, function)
 						Expect(err).ToNot(HaveOccurred())
-						Expect(idle).To(BeZero())
+						Expect(available).To(BeZero())
 					})
 				})
 
-				Context("when some instances are busy", func() {
+				Context("when some slots are taken", func() {
+					BeforeEach(func(ctx SpecContext) {
+						lo.Must0(repo.SetInFlight(ctx, function, instanceID, 1))
+					})
+
+					It("returns the number of free slots", func(ctx SpecContext) {
+						available, err := repo.CountAvailable(ctx, function)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(available).To(Equal(1))
+					})
+				})
+
+				Context("when the function handles multiple invocations per instance", func() {
+					concurrentFunction := docker.Function{Name_: functionName, Concurrency: 3}
+
 					BeforeEach(func(ctx SpecContext) {
-						lo.Must0(repo.SetBusy(ctx, function, instanceID, true))
+						lo.Must0(repo.SetInFlight(ctx, concurrentFunction, instanceID, 2))
 					})
 
-					It("returns the number of idle instances", func(ctx SpecContext) {
-						idle, err := repo.CountIdle(ctx, function)
+					It("returns the number of free slots", func(ctx SpecContext) {
+						available, err := repo.CountAvailable(ctx, concurrentFunction)
 						Expect(err).ToNot(HaveOccurred())
-						Expect(idle).To(Equal(1))
+						Expect(available).To(Equal(4))
 					})
 				})
 			})
+		})
+	})
+
+	Describe("SetInitError", func() {
+		BeforeEach(func(ctx SpecContext) {
+			lo.Must0(repo.Add(ctx, function, instanceID))
+		})
+
+		It("marks the instance as failed", func(ctx SpecContext) {
+			err := repo.SetInitError(ctx, function, instanceID, []byte(`{"errorMessage":"boom"}`))
+			Expect(err).ToNot(HaveOccurred())
+
+			instance, err := repo.Get(ctx, function, instanceID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instance.Failed()).To(BeTrue())
+		})
+
+		It("does not affect the instances list", func(ctx SpecContext) {
+			lo.Must0(repo.SetInitError(ctx, function, instanceID, []byte(`{"errorMessage":"boom"}`)))
+
+			instances, err := repo.List(ctx, function)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instances).To(HaveLen(1))
+		})
+	})
+
+	Describe("SetUnhealthy", func() {
+		BeforeEach(func(ctx SpecContext) {
+			lo.Must0(repo.Add(ctx, function, instanceID))
+		})
+
+		It("marks the instance as failed", func(ctx SpecContext) {
+			err := repo.SetUnhealthy(ctx, function, instanceID)
+			Expect(err).ToNot(HaveOccurred())
+
+			instance, err := repo.Get(ctx, function, instanceID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instance.Failed()).To(BeTrue())
+		})
+
+		It("does not report an init error", func(ctx SpecContext) {
+			lo.Must0(repo.SetUnhealthy(ctx, function, instanceID))
+
+			Expect(repo.LastInitError(ctx, function)).To(BeNil())
+		})
+	})
+
+	Describe("LastInitError", func() {
+		Context("when there were no init errors", func() {
+			It("returns nil", func(ctx SpecContext) {
+				initError, err := repo.LastInitError(ctx, function)
 
-			It("updates the busy status", func(ctx SpecContext) {
-				err := repo.SetBusy(ctx, function, instanceID, true)
 				Expect(err).ToNot(HaveOccurred())
+				Expect(initError).To(BeNil())
+			})
+		})
+
+		Context("when an instance reported an init error", func() {
+			BeforeEach(func(ctx SpecContext) {
+				lo.Must0(repo.Add(ctx, function, instanceID))
+				lo.Must0(repo.SetInitError(ctx, function, instanceID, []byte(`{"errorMessage":"boom"}`)))
+				lo.Must0(repo.Delete(ctx, function, instanceID))
+			})
+
+			It("returns the error even if the instance is gone", func(ctx SpecContext) {
+				initError, err := repo.LastInitError(ctx, function)
 
-				idle, err := repo.CountIdle(ctx, function)
 				Expect(err).ToNot(HaveOccurred())
-				Expect(idle).To(BeZero())
+				Expect(initError.InstanceID).To(Equal(instanceID))
+				Expect(initError.Payload).To(Equal([]byte(`{"errorMessage":"boom"}`)))
 			})
 		})
 	})
@@ -192,7 +315,7 @@ var _ = Describe("InstancesRepo", Serial, func() {
 				lo.Must0(repo.Add(ctx, function, instanceID))
 				lo.Must0(repo.Add(ctx, function, instanceID1))
 
-				lo.Must0(repo.SetBusy(ctx, function, instanceID1, true))
+				lo.Must0(repo.SetInFlight(ctx, function, instanceID1, 1))
 				lo.Must0(repo.SetLastExecuted(ctx, function, instanceID1, lastExecuted))
 			})
 
@@ -203,13 +326,13 @@ var _ = Describe("InstancesRepo", Serial, func() {
 				Expect(instances).To(HaveLen(2))
 				Expect(instances[0].ID()).To(Equal(instanceID))
 				Expect(instances[0].Function()).To(Equal(function))
-				Expect(instances[0].Busy()).To(BeFalse())
+				Expect(instances[0].InFlight()).To(BeZero())
 
 				Expect(instances[0].LastExecuted()).To(Equal(time.Time{}))
 
 				Expect(instances[1].ID()).To(Equal(instanceID1))
 				Expect(instances[1].Function()).To(Equal(function))
-				Expect(instances[1].Busy()).To(BeTrue())
+				Expect(instances[1].InFlight()).To(Equal(1))
 
 				Expect(instances[1].LastExecuted()).To(BeTemporally("~", lastExecuted, 10*time.Millisecond))
 			})
@@ -237,6 +360,23 @@ var _ = Describe("InstancesRepo", Serial, func() {
 				Expect(err).ToNot(HaveOccurred())
 				Expect(count).To(Equal(1))
 			})
+
+			Context("when the heartbeat is stale", func() {
+				BeforeEach(func(ctx SpecContext) {
+					bucket := lo.Must(lo.Must(pal.Invoke[core.KV](ctx, p)).Bucket(ctx, core.BucketNameInstances))
+
+					heartbeat := binary.LittleEndian.AppendUint64(nil,
+						uint64(time.Now().Add(-core.InstanceLeaseTTL-time.Second).UnixNano())) //nolint:gosec
+					lo.Must0(bucket.Put(ctx, functionName+"."+instanceID+".heartbeat", heartbeat))
+				})
+
+				It("does not count the instance", func(ctx SpecContext) {
+					count, err := repo.Count(ctx, function)
+
+					Expect(err).ToNot(HaveOccurred())
+					Expect(count).To(BeZero())
+				})
+			})
 		})
 	})
 
@@ -0,0 +1,264 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/config"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/pkg/json"
+)
+
+// rewatchInterval is how long InstancesView waits before retrying a failed watch.
+const rewatchInterval = time.Second
+
+// InstancesView is core.InstancesView built from the instances bucket written by InstancesRepo. When
+// the function name is configured, only the function's records are watched. If the watch stops, the
+// view is rebuilt from a new one, it's reported unhealthy until then.
+type InstancesView struct {
+	Logger *slog.Logger
+	Config *config.Config
+	KV     core.KV
+
+	mu sync.RWMutex
+	// records holds instance records by function name and instance ID.
+	records        map[string]map[string]map[string]core.KVEntry
+	lastInitErrors map[string]*core.InitError
+
+	bucket  core.KVBucket
+	filters []string
+	stale   atomic.Bool
+
+	cancel context.CancelFunc
+}
+
+func (v *InstancesView) Init(ctx context.Context) error {
+	bucket, err := v.KV.CreateBucketWithConfig(ctx, core.BucketConfigInstances)
+	if err != nil {
+		return fmt.Errorf("failed to create instances bucket: %w", err)
+	}
+
+	v.bucket = bucket
+
+	if v.Config.FunctionName != "" {
+		v.filters = append(v.filters, v.Config.FunctionName+".>")
+	}
+
+	// The watch outlives Init, it's stopped on shutdown.
+	watchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	v.cancel = cancel
+
+	events, err := v.watch(watchCtx, ctx)
+	if err != nil {
+		cancel()
+
+		return err
+	}
+
+	go v.follow(watchCtx, events)
+
+	v.Logger.Info("Instances view synced")
+
+	return nil
+}
+
+func (v *InstancesView) HealthCheck(_ context.Context) error {
+	if v.stale.Load() {
+		return fmt.Errorf("instances view is stale: %w", core.ErrWatchStopped)
+	}
+
+	return nil
+}
+
+func (v *InstancesView) Shutdown(_ context.Context) error {
+	v.cancel()
+
+	return nil
+}
+
+func (v *InstancesView) List(function core.FunctionDefinition) []core.FunctionInstance {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	instances := make([]core.FunctionInstance, 0, len(v.records[function.Name()]))
+
+	for id, records := range v.records[function.Name()] {
+		instance := NewFunctionInstance(id, function, records)
+
+		// Records left by instances which died without deregistering are removed by the garbage collector.
+		if !core.IsAlive(instance) {
+			continue
+		}
+
+		instances = append(instances, instance)
+	}
+
+	return instances
+}
+
+func (v *InstancesView) Count(function core.FunctionDefinition) int {
+	return len(v.List(function))
+}
+
+func (v *InstancesView) CountAvailable(function core.FunctionDefinition) int {
+	return lo.SumBy(v.List(function), core.AvailableSlots)
+}
+
+func (v *InstancesView) LastInitError(function core.FunctionDefinition) *core.InitError {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	return v.lastInitErrors[function.Name()]
+}
+
+// watch starts a watch which lasts until ctx is done and rebuilds the view from the records which exist
+// when it starts, syncCtx limits the time it takes.
+func (v *InstancesView) watch(ctx, syncCtx context.Context) (<-chan core.KVEvent, error) {
+	events, err := v.bucket.Watch(ctx, v.filters...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch instances: %w", err)
+	}
+
+	err = v.sync(syncCtx, events)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// follow applies the changes of the instances. When the watch stops before ctx is done, the view is
+// rebuilt from a new watch, changes made in between are not lost.
+func (v *InstancesView) follow(ctx context.Context, events <-chan core.KVEvent) {
+	for {
+		for event := range events {
+			v.apply(event)
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		v.stale.Store(true)
+		v.Logger.Warn("Instances watch stopped, resyncing")
+
+		var err error
+
+		events, err = v.watch(ctx, ctx)
+		for err != nil {
+			v.Logger.Error("Failed to resync instances", "error", err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(rewatchInterval):
+			}
+
+			events, err = v.watch(ctx, ctx)
+		}
+
+		v.stale.Store(false)
+		v.Logger.Info("Instances view resynced")
+	}
+}
+
+// sync replaces the view with the records which existed when the watch started.
+func (v *InstancesView) sync(ctx context.Context, events <-chan core.KVEvent) error {
+	var existing []core.KVEvent
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to sync instances: %w", ctx.Err())
+		case event, ok := <-events:
+			if !ok {
+				return fmt.Errorf("failed to sync instances: %w", core.ErrWatchStopped)
+			}
+
+			if event.Type != core.KVEventSynced {
+				existing = append(existing, event)
+
+				continue
+			}
+
+			v.mu.Lock()
+			defer v.mu.Unlock()
+
+			v.records = map[string]map[string]map[string]core.KVEntry{}
+			v.lastInitErrors = map[string]*core.InitError{}
+
+			for _, event := range existing {
+				v.applyEvent(event)
+			}
+
+			return nil
+		}
+	}
+}
+
+func (v *InstancesView) apply(event core.KVEvent) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.applyEvent(event)
+}
+
+func (v *InstancesView) applyEvent(event core.KVEvent) {
+	parts := strings.Split(event.Key, ".")
+
+	switch {
+	case len(parts) == 2 && event.Key == lastInitErrorKey(parts[0]):
+		v.applyLastInitError(parts[0], event)
+	case len(parts) == 3: //nolint:mnd
+		v.applyRecord(parts[0], parts[1], event)
+	}
+}
+
+func (v *InstancesView) applyRecord(functionName, id string, event core.KVEvent) {
+	instances, ok := v.records[functionName]
+	if !ok {
+		instances = map[string]map[string]core.KVEntry{}
+		v.records[functionName] = instances
+	}
+
+	records, ok := instances[id]
+	if !ok {
+		records = map[string]core.KVEntry{}
+		instances[id] = records
+	}
+
+	if event.Type == core.KVEventDelete {
+		delete(records, event.Key)
+
+		if len(records) == 0 {
+			delete(instances, id)
+		}
+
+		return
+	}
+
+	records[event.Key] = core.KVEntry{Key: event.Key, Value: event.Value}
+}
+
+func (v *InstancesView) applyLastInitError(functionName string, event core.KVEvent) {
+	if event.Type == core.KVEventDelete {
+		delete(v.lastInitErrors, functionName)
+
+		return
+	}
+
+	initError, err := json.Unmarshal[core.InitError](event.Value)
+	if err != nil {
+		v.Logger.Error("Failed to unmarshal last init error", "function", functionName, "error", err)
+
+		return
+	}
+
+	v.lastInitErrors[functionName] = &initError
+}
@@ -0,0 +1,88 @@
+package docker_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/testhelpers"
+	"github.com/zhulik/pal"
+)
+
+var _ = Describe("InstancesView", Serial, func() {
+	var repo *docker.InstancesRepo
+	var view *docker.InstancesView
+	var kv *interruptibleKV
+
+	BeforeEach(func(ctx SpecContext) {
+		p := testhelpers.NewMemoryPal(ctx,
+			pal.Provide(&docker.InstancesRepo{}),
+		)
+
+		repo = lo.Must(pal.Invoke[*docker.InstancesRepo](ctx, p))
+
+		// Records which exist before the view is created are picked up on init.
+		lo.Must0(repo.Add(ctx, function, instanceID))
+
+		view = &docker.InstancesView{}
+		lo.Must0(pal.InjectInto(ctx, p, view))
+
+		kv = &interruptibleKV{KV: view.KV}
+		view.KV = kv
+
+		lo.Must0(view.Init(ctx))
+
+		DeferCleanup(view.Shutdown)
+	})
+
+	It("follows the changes of the instances", func(ctx SpecContext) {
+		Expect(view.Count(function)).To(Equal(1))
+		Expect(view.CountAvailable(function)).To(Equal(1))
+
+		lo.Must0(repo.Add(ctx, function, instanceID1))
+		lo.Must0(repo.SetInFlight(ctx, function, instanceID1, 1))
+		lo.Must0(repo.Delete(ctx, function, instanceID))
+
+		Eventually(func() []string {
+			return lo.Map(view.List(function), func(instance core.FunctionInstance, _ int) string {
+				return instance.ID()
+			})
+		}).Should(ConsistOf(instanceID1))
+
+		Expect(view.CountAvailable(function)).To(Equal(0))
+		Expect(view.List(function)[0].InFlight()).To(Equal(1))
+	})
+
+	It("follows the last init error", func(ctx SpecContext) {
+		Expect(view.LastInitError(function)).To(BeNil())
+
+		lo.Must0(repo.SetInitError(ctx, function, instanceID, []byte("boom")))
+
+		Eventually(func() *core.InitError {
+			return view.LastInitError(function)
+		}).ShouldNot(BeNil())
+
+		Expect(view.LastInitError(function).Payload).To(Equal([]byte("boom")))
+		Eventually(func() bool {
+			return view.List(function)[0].Failed()
+		}).Should(BeTrue())
+	})
+
+	Context("when the watch stops", func() {
+		It("rebuilds the view from a new watch", func(ctx SpecContext) {
+			kv.interrupt()
+
+			lo.Must0(repo.Add(ctx, function, instanceID1))
+			lo.Must0(repo.Delete(ctx, function, instanceID))
+
+			Eventually(func() []string {
+				return lo.Map(view.List(function), func(instance core.FunctionInstance, _ int) string {
+					return instance.ID()
+				})
+			}).Should(ConsistOf(instanceID1))
+
+			Expect(view.HealthCheck(ctx)).To(Succeed())
+		})
+	})
+})
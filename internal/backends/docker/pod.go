@@ -24,7 +24,7 @@ const (
 type FunctionPod struct {
 	uuid string // Of the "pod"
 
-	Config config.Config
+	Config *config.Config
 	Docker *client.Client
 	Logger *slog.Logger
 
@@ -35,12 +35,15 @@ type FunctionPod struct {
 }
 
 func (p *FunctionPod) Init(ctx context.Context) error {
+	if p.uuid == "" {
+		p.uuid = uuid.NewString()
+	}
+
 	p.Logger = p.Logger.With(
 		"podID", p.uuid,
 		"function", p.Function,
 	)
 
-	p.uuid = uuid.NewString()
 	p.runtimeAPIContainerName = fmt.Sprintf("%s-%s", p.uuid, core.ComponentNameRuntimeAPI)
 	p.functionContainerName = fmt.Sprintf("%s-%s", p.uuid, core.ComponentNameFunction)
 
@@ -61,7 +64,9 @@ func (p *FunctionPod) Start(ctx context.Context) error {
 		}
 	}()
 
-	_, err = p.Docker.NetworkCreate(ctx, p.uuid, network.CreateOptions{})
+	_, err = p.Docker.NetworkCreate(ctx, p.uuid, network.CreateOptions{
+		Labels: p.labels(core.ComponentNameFunction),
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create network: %w", err)
 	}
@@ -79,41 +84,58 @@ func (p *FunctionPod) Start(ctx context.Context) error {
 	return nil
 }
 
+// Stop stops and removes the pod's containers and deletes its network. The function container is
+// stopped first so the runtime API can deregister the instance during its graceful shutdown.
 func (p *FunctionPod) Stop(ctx context.Context) error {
-	fnStopErr := p.Docker.ContainerStop(ctx, p.functionContainerName, container.StopOptions{})
-	if fnStopErr != nil {
-		if client.IsErrNotFound(fnStopErr) {
-			p.Logger.Info("Function container '%s' does not exist, ignoring.")
+	fnStopErr := p.removeContainer(ctx, p.functionContainerName)
+	apiStopErr := p.removeContainer(ctx, p.runtimeAPIContainerName)
 
-			fnStopErr = nil
+	netDeleteErr := p.Docker.NetworkRemove(ctx, p.uuid)
+	if netDeleteErr != nil {
+		if client.IsErrNotFound(netDeleteErr) {
+			netDeleteErr = nil
 		} else {
-			fnStopErr = fmt.Errorf("failed to stop container '%s': %w", p.functionContainerName, fnStopErr)
+			netDeleteErr = fmt.Errorf("failed to delete network '%s': %w", p.uuid, netDeleteErr)
 		}
 	}
 
-	apiStopErr := p.Docker.ContainerStop(ctx, p.runtimeAPIContainerName, container.StopOptions{})
-	if apiStopErr != nil {
-		if client.IsErrNotFound(apiStopErr) {
-			p.Logger.Info("Runtime API container '%s' does not exist, ignoring.")
+	if fnStopErr != nil || apiStopErr != nil || netDeleteErr != nil {
+		return errors.Join(fnStopErr, apiStopErr, netDeleteErr)
+	}
+
+	return nil
+}
 
-			fnStopErr = nil
-		} else {
-			apiStopErr = fmt.Errorf("failed to stop container '%s': %w", p.runtimeAPIContainerName, apiStopErr)
+func (p *FunctionPod) removeContainer(ctx context.Context, name string) error {
+	err := p.Docker.ContainerStop(ctx, name, container.StopOptions{})
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			p.Logger.Info("Container does not exist, ignoring.", "container", name)
+
+			return nil
 		}
-	}
 
-	netDeleteErr := p.Docker.NetworkRemove(ctx, p.uuid)
-	if netDeleteErr != nil {
-		netDeleteErr = fmt.Errorf("failed to delete network '%s': %w", p.uuid, netDeleteErr)
+		return fmt.Errorf("failed to stop container '%s': %w", name, err)
 	}
 
-	if fnStopErr != nil || apiStopErr != nil || netDeleteErr != nil {
-		return errors.Join(fnStopErr, apiStopErr, netDeleteErr)
+	err = p.Docker.ContainerRemove(ctx, name, container.RemoveOptions{})
+	if err != nil && !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to remove container '%s': %w", name, err)
 	}
 
 	return nil
 }
 
+// labels returns labels for pod's resources, they are used by the garbage collector to find the pod's
+// parts.
+func (p *FunctionPod) labels(component string) map[string]string {
+	return map[string]string{
+		core.LabelNameComponent: component,
+		core.LabelNameFunction:  p.Function.Name(),
+		core.LabelNameInstance:  p.uuid,
+	}
+}
+
 func (p *FunctionPod) createRuntimeAPI(ctx context.Context) error {
 	containerConfig := &container.Config{
 		Image: core.ImageNameFID,
@@ -121,14 +143,13 @@ func (p *FunctionPod) createRuntimeAPI(ctx context.Context) error {
 		Env: core.MapToEnvList(map[string]string{
 			core.EnvNameFunctionName:          p.Function.Name(),
 			core.EnvNameInstanceID:            p.uuid,
-			core.EnvNameNatsURL:               p.Config.NATSURL,
+			core.EnvNameNatsURL:               p.Config.ContainerNATSURL(core.HostNameDockerHost),
 			core.EnvNameFunctionContainerName: p.functionContainerName,
 		}),
-		Labels: map[string]string{
-			core.LabelNameComponent: core.ComponentNameRuntimeAPI,
-		},
+		Labels: p.labels(core.ComponentNameRuntimeAPI),
 	}
 	hostConfig := &container.HostConfig{
+		ExtraHosts: []string{core.ExtraHostDockerHost},
 		Binds: []string{
 			"/var/run/docker.sock:/var/run/docker.sock", // TODO: configurable
 		},
@@ -139,7 +160,7 @@ func (p *FunctionPod) createRuntimeAPI(ctx context.Context) error {
 			p.uuid: {
 				Aliases: []string{APIDNSName},
 			},
-			"nats": {}, // TODO: get this network name from somewhere else, remove hardcoded value
+			core.NetworkNameNATS: {},
 		},
 	}
 
@@ -170,11 +191,9 @@ func (p *FunctionPod) createFunction(ctx context.Context) error {
 		Image: p.Function.Image(),
 		Env: core.MapToEnvList(
 			p.Function.Env(),
-			map[string]string{core.EnvNameAWSLambdaRuntimeAPI: APIDNSName},
+			core.RuntimeEnv(p.Function, APIDNSName),
 		),
-		Labels: map[string]string{
-			core.LabelNameComponent: core.ComponentNameFunction,
-		},
+		Labels:      p.labels(core.ComponentNameFunction),
 		StopTimeout: &stopTimeout,
 	}
 	hostConfig := &container.HostConfig{
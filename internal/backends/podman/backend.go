@@ -0,0 +1,263 @@
+package podman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/zhulik/fid/internal/config"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/pal"
+)
+
+// component describes a container running a FID component.
+type component struct {
+	name      string
+	component string
+	labels    map[string]string
+	env       map[string]string
+	config    core.ServiceConfig
+
+	// podman mounts the podman socket into the container.
+	podman bool
+}
+
+// Backend runs FID components and function pods with podman, rootful or rootless. NATS must be reachable
+// in the core.NetworkNameNATS network.
+type Backend struct {
+	Podman        *Client
+	Config        *config.Config
+	Logger        *slog.Logger
+	FunctionsRepo core.FunctionsRepo
+	Pal           *pal.Pal
+}
+
+// Register creates a new function's template and scaler.
+func (b Backend) Register(ctx context.Context, function core.FunctionDefinition) error {
+	err := b.FunctionsRepo.Upsert(ctx, function)
+	if err != nil {
+		return fmt.Errorf("failed to store function template: %w", err)
+	}
+
+	b.Logger.Info("Function template stored", "function", function)
+
+	_, err = b.startComponent(ctx, component{
+		name:      scalerContainerName(function),
+		component: core.ComponentNameScaler,
+		labels:    map[string]string{core.LabelNameFunction: function.Name()},
+		env:       map[string]string{core.EnvNameFunctionName: function.Name()},
+		podman:    true,
+	})
+	if err != nil {
+		if errors.Is(err, core.ErrContainerAlreadyExists) {
+			b.Logger.Info("Scaler container already exists", "function", function)
+
+			return nil
+		}
+
+		return fmt.Errorf("failed to start scaler container: %w", err)
+	}
+
+	b.Logger.Info("Scaler container created and started", "function", function)
+
+	return nil
+}
+
+// Deregister deletes function's template.
+func (b Backend) Deregister(ctx context.Context, function core.FunctionDefinition) error {
+	err := b.FunctionsRepo.Delete(ctx, function.Name())
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	// We only delete the definition, the scaler and the instances are removed by the garbage collector.
+
+	b.Logger.Info("Function deregistered", "function", function)
+
+	return nil
+}
+
+func (b Backend) Info(ctx context.Context) (map[string]any, error) {
+	info, err := b.Podman.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to podman info: %w", err)
+	}
+
+	return map[string]any{
+		"backend":      "Podman backend",
+		"podmanEngine": info,
+	}, nil
+}
+
+func (b Backend) HealthCheck(ctx context.Context) error {
+	b.Logger.Debug("ContainerBackend health check.")
+
+	_, err := b.Podman.Ping(ctx)
+	if err != nil {
+		return fmt.Errorf("backend health check failed: %w", err)
+	}
+
+	return nil
+}
+
+func (b Backend) Shutdown(_ context.Context) error {
+	b.Logger.Debug("ContainerBackend shutting down...")
+	defer b.Logger.Debug("ContainerBackend shot down.")
+
+	err := b.Podman.Close()
+	if err != nil {
+		return fmt.Errorf("failed to shut down the backend: %w", err)
+	}
+
+	return nil
+}
+
+func (b Backend) AddInstance(ctx context.Context, function core.FunctionDefinition) (string, error) {
+	b.Logger.Info("Creating new function pod", "function", function)
+
+	pod := &FunctionPod{Function: function}
+
+	err := b.Pal.InjectInto(ctx, pod)
+	if err != nil {
+		return "", fmt.Errorf("failed to inject dependencies into function pod: %w", err)
+	}
+
+	err = pod.Init(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize function pod: %w", err)
+	}
+
+	err = pod.Start(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to start function pod: %w", err)
+	}
+
+	b.Logger.Info("Function pod created", "function", function, "podID", pod.uuid)
+
+	return pod.uuid, nil
+}
+
+func (b Backend) StopInstance(ctx context.Context, instanceID string) error {
+	b.Logger.Info("Killing function instance", "instanceID", instanceID)
+
+	pod := &FunctionPod{uuid: instanceID}
+
+	err := b.Pal.InjectInto(ctx, pod)
+	if err != nil {
+		return fmt.Errorf("failed to inject dependencies into function pod: %w", err)
+	}
+
+	err = pod.Init(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to initialize function pod: %w", err)
+	}
+
+	return pod.Stop(ctx)
+}
+
+func (b Backend) StartGateway(ctx context.Context, config core.ServiceConfig) (string, error) {
+	return b.startComponent(ctx, component{
+		name:      core.ContainerNameGateway,
+		component: core.ComponentNameGateway,
+		env:       config.Env,
+		config:    config,
+	})
+}
+
+func (b Backend) StartInfoServer(ctx context.Context, config core.ServiceConfig) (string, error) {
+	return b.startComponent(ctx, component{
+		name:      core.ContainerNameInfoServer,
+		component: core.ComponentNameInfoServer,
+		config:    config,
+		podman:    true,
+	})
+}
+
+func (b Backend) StartGarbageCollector(ctx context.Context) (string, error) {
+	return b.startComponent(ctx, component{
+		name:      core.ContainerNameGarbageCollector,
+		component: core.ComponentNameGarbageCollector,
+		podman:    true,
+	})
+}
+
+func (b Backend) startComponent(ctx context.Context, comp component) (string, error) {
+	id, err := b.Podman.CreateContainer(ctx, b.componentSpec(comp))
+	if err != nil {
+		if errors.Is(err, core.ErrContainerAlreadyExists) {
+			b.Logger.Info("Container already exists", "container", comp.name)
+
+			return "", core.ErrContainerAlreadyExists
+		}
+
+		return "", fmt.Errorf("failed to create %s container: %w", comp.name, err)
+	}
+
+	err = b.Podman.ContainerStart(ctx, id, container.StartOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to start %s container: %w", comp.name, err)
+	}
+
+	b.Logger.Info("Container created and started", "container", comp.name)
+
+	return id, nil
+}
+
+func (b Backend) componentSpec(comp component) ContainerSpec {
+	labels := map[string]string{
+		core.LabelNameComponent: comp.component,
+	}
+
+	for key, value := range comp.labels {
+		labels[key] = value
+	}
+
+	env := map[string]string{
+		core.EnvNameNatsURL: b.Config.ContainerNATSURL(core.HostNamePodmanHost),
+		core.EnvNameBackend: core.BackendNamePodman,
+	}
+
+	for key, value := range comp.env {
+		env[key] = value
+	}
+
+	spec := ContainerSpec{
+		Name:     comp.name,
+		Image:    core.ImageNameFID,
+		Command:  []string{comp.component},
+		Env:      env,
+		Labels:   labels,
+		Networks: map[string]NetworkAttachment{core.NetworkNameNATS: {}},
+	}
+
+	if comp.podman {
+		// The host's socket may be a rootless one, inside the container it's always at the system path.
+		spec.Mounts = []Mount{
+			{
+				Type:        "bind",
+				Source:      hostSocketPath(),
+				Destination: systemSocket,
+				Options:     []string{"rbind"},
+			},
+		}
+		env[EnvNameContainerHost] = "unix://" + systemSocket
+	}
+
+	if comp.config.Port != 0 {
+		spec.PortMappings = []PortMapping{
+			{
+				HostIP:        "0.0.0.0",
+				HostPort:      uint16(comp.config.Port), //nolint:gosec
+				ContainerPort: 80,                       //nolint:mnd
+			},
+		}
+	}
+
+	return spec
+}
+
+func scalerContainerName(function core.FunctionDefinition) string {
+	return fmt.Sprintf("%s-scaler", function)
+}
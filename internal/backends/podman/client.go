@@ -0,0 +1,229 @@
+package podman
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/pkg/json"
+)
+
+const (
+	// EnvNameContainerHost is podman's remote socket variable, it takes precedence over the default sockets.
+	EnvNameContainerHost = "CONTAINER_HOST"
+
+	// systemSocket is the rootful podman socket, the host's socket is mounted at the same path into
+	// component containers.
+	systemSocket = "/run/podman/podman.sock"
+
+	libpodPrefix = "/v4.0.0/libpod"
+)
+
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrRequestFailed = errors.New("podman request failed")
+)
+
+// getuid returns the user podman runs as, it's replaced in tests to check rootless sockets.
+var getuid = os.Getuid //nolint:gochecknoglobals
+
+// Client talks to podman. Containers are managed through the docker compatible API, pods and containers
+// which join them are created with the libpod API, the compatible API knows nothing about pods.
+type Client struct {
+	*client.Client
+
+	baseURL string
+}
+
+// NewClient connects to the podman socket returned by SocketURL.
+func NewClient(_ context.Context) (*Client, error) {
+	return NewClientWithHost(SocketURL())
+}
+
+// NewClientWithHost connects to podman listening on the given host.
+func NewClientWithHost(host string) (*Client, error) {
+	hostURL, err := client.ParseHostURL(host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse podman host: %w", err)
+	}
+
+	dockerClient, err := client.NewClientWithOpts(client.WithHost(host), client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create podman client: %w", err)
+	}
+
+	baseURL := "http://" + hostURL.Host
+	if hostURL.Scheme == "unix" {
+		baseURL = "http://d" // the transport dials the socket, the host is ignored
+	}
+
+	return &Client{Client: dockerClient, baseURL: baseURL}, nil
+}
+
+// SocketURL returns the podman socket, CONTAINER_HOST if set, the rootless socket of the current user
+// if it's not root, the system socket otherwise.
+func SocketURL() string {
+	host := os.Getenv(EnvNameContainerHost)
+	if host != "" {
+		return host
+	}
+
+	return "unix://" + socketPath()
+}
+
+// hostSocketPath returns the path to the socket SocketURL points to, a remote CONTAINER_HOST can't be
+// mounted, the local socket is used instead.
+func hostSocketPath() string {
+	hostURL, err := client.ParseHostURL(SocketURL())
+	if err == nil && hostURL.Scheme == "unix" {
+		return hostURL.Host // the socket path is parsed as the host
+	}
+
+	return socketPath()
+}
+
+// socketPath returns the path to the local podman socket.
+func socketPath() string {
+	uid := getuid()
+	if uid == 0 {
+		return systemSocket
+	}
+
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = filepath.Join("/run/user", strconv.Itoa(uid))
+	}
+
+	return filepath.Join(runtimeDir, "podman", "podman.sock")
+}
+
+// PodCreate creates a pod, its infra container holds the network namespace shared by the pod's containers.
+func (c *Client) PodCreate(ctx context.Context, spec PodSpec) error {
+	_, err := c.do(ctx, http.MethodPost, "/pods/create", nil, spec)
+
+	return err
+}
+
+// PodRemove removes the pod with all its containers, running containers are stopped. A missing pod is
+// not an error.
+func (c *Client) PodRemove(ctx context.Context, name string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/pods/"+url.PathEscape(name), url.Values{"force": {"true"}}, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// PodList lists pods with the given label.
+func (c *Client) PodList(ctx context.Context, label string) ([]PodListReport, error) {
+	filters, err := json.Marshal(map[string][]string{"label": {label}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal filters: %w", err)
+	}
+
+	data, err := c.do(ctx, http.MethodGet, "/pods/json", url.Values{"filters": {string(filters)}}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := json.Unmarshal[[]PodListReport](data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pods: %w", err)
+	}
+
+	return pods, nil
+}
+
+// CreateContainer creates a container with the libpod API, unlike the compatible API it can put the
+// container into a pod. A name conflict is reported as core.ErrContainerAlreadyExists.
+func (c *Client) CreateContainer(ctx context.Context, spec ContainerSpec) (string, error) {
+	data, err := c.do(ctx, http.MethodPost, "/containers/create", nil, spec)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := json.Unmarshal[struct {
+		ID string `json:"Id"`
+	}](data)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse container: %w", err)
+	}
+
+	return resp.ID, nil
+}
+
+// do sends a request to the libpod API and returns the response body.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body any) ([]byte, error) {
+	var reader io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+
+		reader = bytes.NewReader(data)
+	}
+
+	endpoint := c.baseURL + libpodPrefix + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, responseError(resp.StatusCode, data)
+	}
+
+	return data, nil
+}
+
+// responseError turns libpod's error response into an error. Older podman versions report name
+// conflicts as internal errors, so they are detected by the message too.
+func responseError(status int, body []byte) error {
+	message := string(body)
+
+	resp, err := json.Unmarshal[struct {
+		Message string `json:"message"`
+	}](body)
+	if err == nil && resp.Message != "" {
+		message = resp.Message
+	}
+
+	switch {
+	case status == http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrNotFound, message)
+	case status == http.StatusConflict, strings.Contains(message, "already in use"):
+		return fmt.Errorf("%w: %s", core.ErrContainerAlreadyExists, message)
+	default:
+		return fmt.Errorf("%w: %d: %s", ErrRequestFailed, status, message)
+	}
+}
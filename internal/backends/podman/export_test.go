@@ -0,0 +1,11 @@
+package podman
+
+import "os"
+
+// SetUID makes the package see the given user instead of the current one, it returns a function
+// restoring the real one.
+func SetUID(uid int) func() {
+	getuid = func() int { return uid }
+
+	return func() { getuid = os.Getuid }
+}
@@ -0,0 +1,185 @@
+package podman_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/zhulik/fid/internal/backends/podman"
+)
+
+// fakePodman is a fake Podman API server implementing only the libpod and docker compatible endpoints
+// used by the podman backend.
+type fakePodman struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	pods       map[string]podman.PodSpec
+	containers map[string]podman.ContainerSpec
+	running    map[string]bool
+}
+
+func newFakePodman() *fakePodman {
+	fake := &fakePodman{
+		pods:       map[string]podman.PodSpec{},
+		containers: map[string]podman.ContainerSpec{},
+		running:    map[string]bool{},
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/_ping", fake.ping)
+	mux.HandleFunc("POST /{version}/libpod/pods/create", fake.createPod)
+	mux.HandleFunc("DELETE /{version}/libpod/pods/{name}", fake.removePod)
+	mux.HandleFunc("POST /{version}/libpod/containers/create", fake.createContainer)
+	mux.HandleFunc("POST /{version}/containers/{id}/start", fake.startContainer)
+	mux.HandleFunc("POST /{version}/containers/{id}/stop", fake.stopContainer)
+
+	fake.Server = httptest.NewServer(mux)
+
+	return fake
+}
+
+func (f *fakePodman) pod(name string) (podman.PodSpec, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	spec, ok := f.pods[name]
+
+	return spec, ok
+}
+
+func (f *fakePodman) container(name string) (podman.ContainerSpec, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	spec, ok := f.containers[name]
+
+	return spec, ok
+}
+
+func (f *fakePodman) isRunning(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.running[name]
+}
+
+func (f *fakePodman) ping(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Api-Version", "1.41")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *fakePodman) createPod(w http.ResponseWriter, r *http.Request) {
+	var spec podman.PodSpec
+
+	err := json.NewDecoder(r.Body).Decode(&spec)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.pods[spec.Name]; ok {
+		writeJSON(w, http.StatusConflict, map[string]string{"message": "pod already exists"})
+
+		return
+	}
+
+	f.pods[spec.Name] = spec
+
+	writeJSON(w, http.StatusCreated, map[string]string{"Id": spec.Name})
+}
+
+// removePod removes the pod and its containers.
+func (f *fakePodman) removePod(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := r.PathValue("name")
+
+	if _, ok := f.pods[name]; !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "no such pod"})
+
+		return
+	}
+
+	delete(f.pods, name)
+
+	for id, spec := range f.containers {
+		if spec.Pod == name {
+			delete(f.containers, id)
+			delete(f.running, id)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"Id": name})
+}
+
+func (f *fakePodman) createContainer(w http.ResponseWriter, r *http.Request) {
+	var spec podman.ContainerSpec
+
+	err := json.NewDecoder(r.Body).Decode(&spec)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.containers[spec.Name]; ok {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"message": "the container name \"" + spec.Name + "\" is already in use",
+		})
+
+		return
+	}
+
+	if spec.Pod != "" {
+		if _, ok := f.pods[spec.Pod]; !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"message": "no such pod"})
+
+			return
+		}
+	}
+
+	f.containers[spec.Name] = spec
+
+	writeJSON(w, http.StatusCreated, map[string]string{"Id": spec.Name})
+}
+
+func (f *fakePodman) startContainer(w http.ResponseWriter, r *http.Request) {
+	f.setRunning(w, r.PathValue("id"), true)
+}
+
+func (f *fakePodman) stopContainer(w http.ResponseWriter, r *http.Request) {
+	f.setRunning(w, r.PathValue("id"), false)
+}
+
+func (f *fakePodman) setRunning(w http.ResponseWriter, id string, running bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.containers[id]; !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "no such container"})
+
+		return
+	}
+
+	f.running[id] = running
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(body) //nolint:errcheck,errchkjson
+}
@@ -0,0 +1,220 @@
+package podman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/pal"
+)
+
+// gracePeriod protects pods and instance records which are being created right now from being collected.
+const gracePeriod = time.Minute
+
+// podState is a podman pod labelled with an instance ID.
+type podState struct {
+	function          string
+	createdAt         time.Time
+	runtimeAPIRunning bool
+}
+
+// GarbageCollector reconciles podman pods and the instances repo:
+//   - removes pods whose runtime API is not running anymore;
+//   - removes pods and scalers of deregistered functions;
+//   - deletes instance records which do not have a pod.
+type GarbageCollector struct {
+	Podman        *Client
+	Logger        *slog.Logger
+	FunctionsRepo core.FunctionsRepo
+	InstancesRepo core.InstancesRepo
+	Pal           *pal.Pal
+}
+
+func (g GarbageCollector) Collect(ctx context.Context) error {
+	g.Logger.Debug("Collecting garbage...")
+
+	functions, err := g.FunctionsRepo.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list functions: %w", err)
+	}
+
+	registered := lo.SliceToMap(functions, func(fn core.FunctionDefinition) (string, bool) {
+		return fn.Name(), true
+	})
+
+	pods, err := g.listPods(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Records of functions which only have pods left are collected too.
+	names := lo.Uniq(append(lo.Keys(registered), lo.Map(lo.Values(pods), func(pod *podState, _ int) string {
+		return pod.function
+	})...))
+
+	err = g.collectPods(ctx, pods, registered)
+	if err != nil {
+		return err
+	}
+
+	err = g.collectScalers(ctx, registered)
+	if err != nil {
+		return err
+	}
+
+	return g.collectInstanceRecords(ctx, names, pods)
+}
+
+func (g GarbageCollector) collectPods(ctx context.Context, pods map[string]*podState, registered map[string]bool) error { //nolint:lll
+	var errs []error
+
+	for id, pod := range pods {
+		logger := g.Logger.With("podID", id, "function", pod.function)
+
+		switch {
+		case time.Since(pod.createdAt) < gracePeriod:
+			continue
+		case !registered[pod.function]:
+			logger.Info("Removing pod of a deregistered function")
+		case !pod.runtimeAPIRunning:
+			logger.Info("Removing pod with dead runtime API")
+		default:
+			continue
+		}
+
+		err := g.removePod(ctx, id, pod)
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		delete(pods, id)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (g GarbageCollector) removePod(ctx context.Context, id string, pod *podState) error {
+	function := docker.Function{Name_: pod.function}
+
+	fnPod := &FunctionPod{uuid: id, Function: function}
+
+	err := g.Pal.InjectInto(ctx, fnPod)
+	if err != nil {
+		return fmt.Errorf("failed to inject dependencies into function pod: %w", err)
+	}
+
+	err = fnPod.Init(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to initialize function pod: %w", err)
+	}
+
+	err = fnPod.Stop(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to remove pod %s: %w", id, err)
+	}
+
+	// The runtime API deletes its record on graceful shutdown, but a dead one cannot.
+	err = g.InstancesRepo.Delete(ctx, function, id)
+	if err != nil && !errors.Is(err, core.ErrInstanceNotFound) {
+		return fmt.Errorf("failed to delete instance record %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// collectScalers removes scaler containers of deregistered functions.
+func (g GarbageCollector) collectScalers(ctx context.Context, registered map[string]bool) error {
+	containers, err := g.Podman.ContainerList(ctx, container.ListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("label", fmt.Sprintf("%s=%s", core.LabelNameComponent, core.ComponentNameScaler)),
+			filters.Arg("label", core.LabelNameFunction),
+		),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list scaler containers: %w", err)
+	}
+
+	for _, cont := range containers {
+		function := cont.Labels[core.LabelNameFunction]
+		if registered[function] {
+			continue
+		}
+
+		g.Logger.Info("Removing scaler of a deregistered function", "function", function)
+
+		err = g.Podman.ContainerRemove(ctx, cont.ID, container.RemoveOptions{Force: true})
+		if err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("failed to remove scaler container of %s: %w", function, err)
+		}
+	}
+
+	return nil
+}
+
+// collectInstanceRecords deletes instance records of the given functions which do not have a corresponding pod.
+func (g GarbageCollector) collectInstanceRecords(ctx context.Context, names []string, pods map[string]*podState) error {
+	for _, name := range names {
+		function := docker.Function{Name_: name}
+
+		instances, err := g.InstancesRepo.List(ctx, function)
+		if err != nil {
+			return fmt.Errorf("failed to list instances of %s: %w", name, err)
+		}
+
+		for _, instance := range instances {
+			if _, ok := pods[instance.ID()]; ok {
+				continue
+			}
+
+			if time.Since(instance.StartedAt()) < gracePeriod {
+				continue
+			}
+
+			g.Logger.Info("Deleting stale instance record", "function", name, "instanceID", instance.ID())
+
+			err = g.InstancesRepo.Delete(ctx, function, instance.ID())
+			if err != nil && !errors.Is(err, core.ErrInstanceNotFound) {
+				return fmt.Errorf("failed to delete instance record %s: %w", instance.ID(), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// listPods lists pods labelled with an instance ID.
+func (g GarbageCollector) listPods(ctx context.Context) (map[string]*podState, error) {
+	list, err := g.Podman.PodList(ctx, core.LabelNameInstance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	pods := map[string]*podState{}
+
+	for _, pod := range list {
+		state := &podState{function: pod.Labels[core.LabelNameFunction], createdAt: pod.Created}
+
+		runtimeAPIName := fmt.Sprintf("%s-%s", pod.Name, core.ComponentNameRuntimeAPI)
+
+		for _, cont := range pod.Containers {
+			if cont.Names == runtimeAPIName && cont.Status == "running" {
+				state.runtimeAPIRunning = true
+			}
+		}
+
+		pods[pod.Name] = state
+	}
+
+	return pods, nil
+}
@@ -0,0 +1,163 @@
+package podman
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/google/uuid"
+	"github.com/zhulik/fid/internal/config"
+	"github.com/zhulik/fid/internal/core"
+)
+
+// runtimeAPIAddr is where the function reaches its runtime API, the pod's containers share the network
+// namespace.
+const runtimeAPIAddr = "127.0.0.1:80"
+
+// FunctionPod is a function instance and its runtime api running in a podman pod, they share the pod's
+// network namespace instead of a per-pod bridge network.
+type FunctionPod struct {
+	uuid string // Of the pod
+
+	Config *config.Config
+	Podman *Client
+	Logger *slog.Logger
+
+	runtimeAPIContainerName string
+	functionContainerName   string
+
+	Function core.FunctionDefinition
+}
+
+func (p *FunctionPod) Init(ctx context.Context) error {
+	if p.uuid == "" {
+		p.uuid = uuid.NewString()
+	}
+
+	p.Logger = p.Logger.With(
+		"podID", p.uuid,
+		"function", p.Function,
+	)
+
+	p.runtimeAPIContainerName = fmt.Sprintf("%s-%s", p.uuid, core.ComponentNameRuntimeAPI)
+	p.functionContainerName = fmt.Sprintf("%s-%s", p.uuid, core.ComponentNameFunction)
+
+	return nil
+}
+
+func (p *FunctionPod) Start(ctx context.Context) error {
+	var err error
+
+	defer func() {
+		if err != nil {
+			p.Logger.Warn("Pod creation failed, cleaning up...", "error", err)
+
+			err := p.Stop(ctx)
+			if err != nil {
+				p.Logger.Warn("Failed to clean up after failed pod creation.", "error", err)
+			}
+		}
+	}()
+
+	// The runtime API needs NATS, the pod joins the NATS network as a whole.
+	err = p.Podman.PodCreate(ctx, PodSpec{
+		Name:     p.uuid,
+		Labels:   p.labels(core.ComponentNameFunction),
+		Networks: map[string]NetworkAttachment{core.NetworkNameNATS: {}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create pod: %w", err)
+	}
+
+	err = p.startContainer(ctx, p.runtimeAPISpec())
+	if err != nil {
+		return err
+	}
+
+	err = p.startContainer(ctx, p.functionSpec())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Stop removes the pod. The function container is stopped first so the runtime API can deregister the
+// instance during its graceful shutdown.
+func (p *FunctionPod) Stop(ctx context.Context) error {
+	err := p.Podman.ContainerStop(ctx, p.functionContainerName, container.StopOptions{})
+	if err != nil && !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to stop container '%s': %w", p.functionContainerName, err)
+	}
+
+	err = p.Podman.PodRemove(ctx, p.uuid)
+	if err != nil {
+		return fmt.Errorf("failed to remove pod '%s': %w", p.uuid, err)
+	}
+
+	return nil
+}
+
+func (p *FunctionPod) startContainer(ctx context.Context, spec ContainerSpec) error {
+	id, err := p.Podman.CreateContainer(ctx, spec)
+	if err != nil {
+		return fmt.Errorf("failed to create container: %w", err)
+	}
+
+	err = p.Podman.ContainerStart(ctx, id, container.StartOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to start container: %w", err)
+	}
+
+	return nil
+}
+
+// labels returns labels for pod's resources, they are used by the garbage collector to find the pod's
+// parts.
+func (p *FunctionPod) labels(component string) map[string]string {
+	return map[string]string{
+		core.LabelNameComponent: component,
+		core.LabelNameFunction:  p.Function.Name(),
+		core.LabelNameInstance:  p.uuid,
+	}
+}
+
+func (p *FunctionPod) runtimeAPISpec() ContainerSpec {
+	return ContainerSpec{
+		Name:    p.runtimeAPIContainerName,
+		Image:   core.ImageNameFID,
+		Command: []string{core.ComponentNameRuntimeAPI},
+		Env: map[string]string{
+			core.EnvNameFunctionName: p.Function.Name(),
+			core.EnvNameInstanceID:   p.uuid,
+			core.EnvNameNatsURL:      p.Config.ContainerNATSURL(core.HostNamePodmanHost),
+		},
+		Labels: p.labels(core.ComponentNameRuntimeAPI),
+		Pod:    p.uuid,
+	}
+}
+
+func (p *FunctionPod) functionSpec() ContainerSpec {
+	stopTimeout := uint((p.Function.Timeout() + time.Second) / time.Second)
+
+	env := map[string]string{}
+	for key, value := range p.Function.Env() {
+		env[key] = value
+	}
+
+	for key, value := range core.RuntimeEnv(p.Function, runtimeAPIAddr) {
+		env[key] = value
+	}
+
+	return ContainerSpec{
+		Name:        p.functionContainerName,
+		Image:       p.Function.Image(),
+		Env:         env,
+		Labels:      p.labels(core.ComponentNameFunction),
+		Pod:         p.uuid,
+		StopTimeout: &stopTimeout,
+	}
+}
@@ -0,0 +1,59 @@
+package podman
+
+import "time"
+
+// The subset of libpod API types used by the backend.
+
+// PodSpec is libpod's pod spec generator.
+type PodSpec struct {
+	Name     string                       `json:"name"`
+	Labels   map[string]string            `json:"labels,omitempty"`
+	Networks map[string]NetworkAttachment `json:"Networks,omitempty"`
+}
+
+// ContainerSpec is libpod's container spec generator.
+type ContainerSpec struct {
+	Name         string                       `json:"name"`
+	Image        string                       `json:"image"`
+	Command      []string                     `json:"command,omitempty"`
+	Env          map[string]string            `json:"env,omitempty"`
+	Labels       map[string]string            `json:"labels,omitempty"`
+	Pod          string                       `json:"pod,omitempty"`
+	StopTimeout  *uint                        `json:"stop_timeout,omitempty"`
+	Mounts       []Mount                      `json:"mounts,omitempty"`
+	PortMappings []PortMapping                `json:"portmappings,omitempty"`
+	Networks     map[string]NetworkAttachment `json:"Networks,omitempty"`
+}
+
+type NetworkAttachment struct {
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+type Mount struct {
+	Type        string   `json:"type"`
+	Source      string   `json:"source"`
+	Destination string   `json:"destination"`
+	Options     []string `json:"options,omitempty"`
+}
+
+type PortMapping struct {
+	HostIP        string `json:"host_ip,omitempty"`
+	HostPort      uint16 `json:"host_port"`
+	ContainerPort uint16 `json:"container_port"`
+}
+
+// PodListReport is an item of libpod's pod list.
+type PodListReport struct {
+	ID         string             `json:"Id"`
+	Name       string             `json:"Name"`
+	Created    time.Time          `json:"Created"`
+	Status     string             `json:"Status"`
+	Labels     map[string]string  `json:"Labels"`
+	Containers []PodContainerInfo `json:"Containers"`
+}
+
+type PodContainerInfo struct {
+	ID     string `json:"Id"`
+	Names  string `json:"Names"`
+	Status string `json:"Status"`
+}
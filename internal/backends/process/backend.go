@@ -0,0 +1,327 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zhulik/fid/internal/config"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/pal"
+)
+
+// component is a FID component started by the backend as a child process.
+type component struct {
+	name      string
+	component string
+	function  string
+	port      int
+}
+
+// Backend runs FID components as child processes of the fid executable and function instances as
+// local executables, the function's image is the path to the executable. A pod's runtime API runs
+// in-process in the component which created it, usually the function's scaler. No container engine
+// is needed, all processes share the host's network.
+type Backend struct {
+	Config        *config.Config
+	Logger        *slog.Logger
+	FunctionsRepo core.FunctionsRepo
+	Pal           *pal.Pal
+
+	// Executable is the fid executable components are started from, defaults to the current one.
+	Executable string
+
+	mu         sync.Mutex
+	pods       map[string]*FunctionPod
+	components map[string]*exec.Cmd
+}
+
+func (b *Backend) Init(_ context.Context) error {
+	if b.Executable == "" {
+		executable, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to find fid executable: %w", err)
+		}
+
+		b.Executable = executable
+	}
+
+	err := os.MkdirAll(stateDir(), 0o700) //nolint:mnd
+	if err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	b.pods = map[string]*FunctionPod{}
+	b.components = map[string]*exec.Cmd{}
+
+	return nil
+}
+
+// Register creates a new function's template and scaler.
+func (b *Backend) Register(ctx context.Context, function core.FunctionDefinition) error {
+	err := b.FunctionsRepo.Upsert(ctx, function)
+	if err != nil {
+		return fmt.Errorf("failed to store function template: %w", err)
+	}
+
+	b.Logger.Info("Function template stored", "function", function)
+
+	_, err = b.startComponent(component{
+		name:      scalerRecordName(function.Name()),
+		component: core.ComponentNameScaler,
+		function:  function.Name(),
+	})
+	if err != nil {
+		if errors.Is(err, core.ErrContainerAlreadyExists) {
+			b.Logger.Info("Scaler process already exists", "function", function)
+
+			return nil
+		}
+
+		return fmt.Errorf("failed to start scaler process: %w", err)
+	}
+
+	b.Logger.Info("Scaler process started", "function", function)
+
+	return nil
+}
+
+// Deregister deletes function's template.
+func (b *Backend) Deregister(ctx context.Context, function core.FunctionDefinition) error {
+	err := b.FunctionsRepo.Delete(ctx, function.Name())
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	// We only delete the definition, the scaler and the instances are stopped by the garbage collector.
+
+	b.Logger.Info("Function deregistered", "function", function)
+
+	return nil
+}
+
+func (b *Backend) Info(_ context.Context) (map[string]any, error) {
+	return map[string]any{
+		"backend":    "Local process backend",
+		"executable": b.Executable,
+		"stateDir":   stateDir(),
+	}, nil
+}
+
+func (b *Backend) HealthCheck(_ context.Context) error {
+	b.Logger.Debug("ContainerBackend health check.")
+
+	_, err := os.Stat(b.Executable)
+	if err != nil {
+		return fmt.Errorf("backend health check failed: %w", err)
+	}
+
+	return nil
+}
+
+// Shutdown stops pods and components started by this process.
+func (b *Backend) Shutdown(ctx context.Context) error {
+	b.Logger.Debug("ContainerBackend shutting down...")
+	defer b.Logger.Debug("ContainerBackend shot down.")
+
+	b.mu.Lock()
+	pods := make([]*FunctionPod, 0, len(b.pods))
+	for _, pod := range b.pods {
+		pods = append(pods, pod)
+	}
+
+	components := make([]*exec.Cmd, 0, len(b.components))
+	for _, cmd := range b.components {
+		components = append(components, cmd)
+	}
+	b.mu.Unlock()
+
+	var errs []error
+
+	for _, pod := range pods {
+		errs = append(errs, pod.Stop(ctx))
+	}
+
+	for _, cmd := range components {
+		errs = append(errs, terminate(cmd.Process.Pid))
+	}
+
+	err := errors.Join(errs...)
+	if err != nil {
+		return fmt.Errorf("failed to shut down the backend: %w", err)
+	}
+
+	return nil
+}
+
+func (b *Backend) AddInstance(ctx context.Context, function core.FunctionDefinition) (string, error) {
+	b.Logger.Info("Creating new function pod", "function", function)
+
+	pod := &FunctionPod{Function: function}
+
+	err := b.Pal.InjectInto(ctx, pod)
+	if err != nil {
+		return "", fmt.Errorf("failed to inject dependencies into function pod: %w", err)
+	}
+
+	err = pod.Init(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize function pod: %w", err)
+	}
+
+	err = pod.Start(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to start function pod: %w", err)
+	}
+
+	b.mu.Lock()
+	b.pods[pod.uuid] = pod
+	b.mu.Unlock()
+
+	go func() {
+		<-pod.done
+
+		b.mu.Lock()
+		delete(b.pods, pod.uuid)
+		b.mu.Unlock()
+	}()
+
+	b.Logger.Info("Function pod created", "function", function, "podID", pod.uuid)
+
+	return pod.uuid, nil
+}
+
+// StopInstance stops the pod. Pods started by other processes are stopped by terminating the function
+// process, their hosts shut down the runtime API once it exits.
+func (b *Backend) StopInstance(ctx context.Context, instanceID string) error {
+	b.Logger.Info("Killing function instance", "instanceID", instanceID)
+
+	b.mu.Lock()
+	pod, ok := b.pods[instanceID]
+	b.mu.Unlock()
+
+	if ok {
+		return pod.Stop(ctx)
+	}
+
+	rec, err := readRecord(functionRecordName(instanceID))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	return terminate(rec.PID)
+}
+
+func (b *Backend) StartGateway(_ context.Context, config core.ServiceConfig) (string, error) {
+	return b.startComponent(component{
+		name:      core.ContainerNameGateway,
+		component: core.ComponentNameGateway,
+		port:      config.Port,
+	})
+}
+
+func (b *Backend) StartInfoServer(_ context.Context, config core.ServiceConfig) (string, error) {
+	return b.startComponent(component{
+		name:      core.ContainerNameInfoServer,
+		component: core.ComponentNameInfoServer,
+		port:      config.Port,
+	})
+}
+
+func (b *Backend) StartGarbageCollector(_ context.Context) (string, error) {
+	return b.startComponent(component{
+		name:      core.ContainerNameGarbageCollector,
+		component: core.ComponentNameGarbageCollector,
+	})
+}
+
+// startComponent starts the component as a child process unless it's already running. Components
+// without a configured port listen on a random one, as well as their health check servers.
+func (b *Backend) startComponent(comp component) (string, error) {
+	existing, err := readRecord(comp.name)
+	if err == nil && existing.alive() {
+		b.Logger.Info("Process already exists", "process", comp.name)
+
+		return "", core.ErrContainerAlreadyExists
+	}
+
+	env := map[string]string{
+		core.EnvNameNatsURL:         b.Config.NATSURL,
+		core.EnvNameBackend:         core.BackendNameProcess,
+		core.EnvNameLogLevel:        b.Config.LogLevel.String(),
+		core.EnvNameHTTPPort:        strconv.Itoa(comp.port),
+		core.EnvNameHealthCheckAddr: "127.0.0.1:0",
+	}
+
+	if comp.function != "" {
+		env[core.EnvNameFunctionName] = comp.function
+	}
+
+	cmd := exec.Command(b.Executable, comp.component) //nolint:gosec,noctx
+	cmd.Env = append(os.Environ(), core.MapToEnvList(env)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Start()
+	if err != nil {
+		return "", fmt.Errorf("failed to start %s process: %w", comp.name, err)
+	}
+
+	err = writeRecord(record{
+		Name:      comp.name,
+		PID:       cmd.Process.Pid,
+		Component: comp.component,
+		Function:  comp.function,
+		StartedAt: time.Now(),
+	})
+	if err != nil {
+		cmd.Process.Kill() //nolint:errcheck
+		cmd.Wait()         //nolint:errcheck
+
+		return "", err
+	}
+
+	b.mu.Lock()
+	b.components[comp.name] = cmd
+	b.mu.Unlock()
+
+	go b.waitComponent(comp.name, cmd)
+
+	b.Logger.Info("Process started", "process", comp.name, "pid", cmd.Process.Pid)
+
+	return strconv.Itoa(cmd.Process.Pid), nil
+}
+
+// waitComponent reaps the component's process once it exits and removes its record.
+func (b *Backend) waitComponent(name string, cmd *exec.Cmd) {
+	err := cmd.Wait()
+	b.Logger.Info("Process exited", "process", name, "error", err)
+
+	b.mu.Lock()
+	delete(b.components, name)
+	b.mu.Unlock()
+
+	rec, err := readRecord(name)
+	if err != nil || rec.PID != cmd.Process.Pid {
+		return
+	}
+
+	err = removeRecord(name)
+	if err != nil {
+		b.Logger.Warn("Failed to remove process record", "process", name, "error", err)
+	}
+}
+
+func scalerRecordName(function string) string {
+	return fmt.Sprintf("%s-scaler", function)
+}
@@ -0,0 +1,153 @@
+package process_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/backends/process"
+	"github.com/zhulik/fid/internal/core"
+	ikv "github.com/zhulik/fid/internal/kv"
+	"github.com/zhulik/fid/testhelpers"
+	"github.com/zhulik/pal"
+)
+
+// script writes an executable shell script with the given body.
+func script(name string, body string) string {
+	path := filepath.Join(GinkgoT().TempDir(), name)
+
+	lo.Must0(os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o700)) //nolint:gosec
+
+	return path
+}
+
+// sleeper writes an executable which runs until it's terminated.
+func sleeper() string {
+	return script("sleeper", "exec sleep 60")
+}
+
+var _ = Describe("Backend", Serial, func() {
+	var backend *process.Backend
+	var instancesRepo core.InstancesRepo
+	var function docker.Function
+	var executable string
+
+	BeforeEach(func() {
+		executable = sleeper()
+	})
+
+	JustBeforeEach(func(ctx SpecContext) {
+		function = docker.Function{Name_: "test-function", Image_: executable, Timeout_: time.Second}
+
+		p := testhelpers.NewPal(ctx,
+			ikv.Provide(core.BrokerNameNATS),
+			pal.Provide[core.FunctionsRepo](&docker.FunctionsRepo{}),
+			pal.Provide[core.InstancesRepo](&docker.InstancesRepo{}),
+			pal.Provide(&process.Backend{Executable: executable}),
+		)
+
+		kv := lo.Must(pal.Invoke[core.KV](ctx, p))
+
+		DeferCleanup(func(ctx SpecContext) {
+			kv.DeleteBucket(ctx, core.BucketNameFunctions) //nolint:errcheck
+			kv.DeleteBucket(ctx, core.BucketNameInstances) //nolint:errcheck
+		})
+
+		functionsRepo := lo.Must(pal.Invoke[core.FunctionsRepo](ctx, p))
+		lo.Must0(functionsRepo.Upsert(ctx, function))
+
+		instancesRepo = lo.Must(pal.Invoke[core.InstancesRepo](ctx, p))
+		backend = lo.Must(pal.Invoke[*process.Backend](ctx, p))
+
+		DeferCleanup(func(ctx SpecContext) { backend.Shutdown(ctx) }) //nolint:errcheck
+	})
+
+	Describe("AddInstance", func() {
+		It("starts the function with an in-process runtime API", func(ctx SpecContext) {
+			id, err := backend.AddInstance(ctx, function)
+			Expect(err).ToNot(HaveOccurred())
+
+			instance, err := instancesRepo.Get(ctx, function, id)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(instance.ID()).To(Equal(id))
+		})
+	})
+
+	Describe("StopInstance", func() {
+		It("stops the function and deletes the instance record", func(ctx SpecContext) {
+			id := lo.Must(backend.AddInstance(ctx, function))
+
+			err := backend.StopInstance(ctx, id)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = instancesRepo.Get(ctx, function, id)
+			Expect(err).To(MatchError(core.ErrInstanceNotFound))
+		})
+
+		// ready is created by the functions once they trap signals.
+		var ready string
+
+		BeforeEach(func() {
+			ready = filepath.Join(GinkgoT().TempDir(), "ready")
+		})
+
+		Context("when the function handles SIGTERM", func() {
+			var marker string
+
+			BeforeEach(func() {
+				marker = filepath.Join(GinkgoT().TempDir(), "terminated")
+				executable = script("graceful",
+					"trap 'touch "+marker+"; exit 0' TERM\ntouch "+ready+"\nwhile :; do sleep 0.1; done")
+			})
+
+			It("lets it shut down gracefully", func(ctx SpecContext) {
+				id := lo.Must(backend.AddInstance(ctx, function))
+				Eventually(ready).WithContext(ctx).Should(BeAnExistingFile())
+
+				Expect(backend.StopInstance(ctx, id)).To(Succeed())
+
+				Expect(marker).To(BeAnExistingFile())
+			})
+		})
+
+		Context("when the function ignores SIGTERM", func() {
+			BeforeEach(func() {
+				executable = script("stubborn", "trap '' TERM\ntouch "+ready+"\nwhile :; do sleep 0.1; done")
+			})
+
+			It("kills it after the function's timeout", func(ctx SpecContext) {
+				id := lo.Must(backend.AddInstance(ctx, function))
+				Eventually(ready).WithContext(ctx).Should(BeAnExistingFile())
+
+				start := time.Now()
+
+				Expect(backend.StopInstance(ctx, id)).To(Succeed())
+				Expect(time.Since(start)).To(BeNumerically(">=", function.Timeout()))
+
+				_, err := instancesRepo.Get(ctx, function, id)
+				Expect(err).To(MatchError(core.ErrInstanceNotFound))
+			})
+		})
+	})
+
+	Context("when the function exits on its own", func() {
+		BeforeEach(func() {
+			executable = script("short-lived", "exit 1")
+		})
+
+		It("stops the runtime API and deletes the instance record", func(ctx SpecContext) {
+			id := lo.Must(backend.AddInstance(ctx, function))
+
+			Eventually(func(ctx context.Context) error {
+				_, err := instancesRepo.Get(ctx, function, id)
+
+				return err
+			}).WithContext(ctx).Should(MatchError(core.ErrInstanceNotFound))
+		})
+	})
+})
@@ -0,0 +1,190 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/core"
+)
+
+// gracePeriod protects pods and instance records which are being created right now from being collected.
+const gracePeriod = time.Minute
+
+// GarbageCollector reconciles process records and the instances repo:
+//   - stops pods whose function process or runtime API host is not running anymore;
+//   - stops pods and scalers of deregistered functions;
+//   - removes records of exited components;
+//   - deletes instance records which do not have a pod.
+type GarbageCollector struct {
+	Logger        *slog.Logger
+	FunctionsRepo core.FunctionsRepo
+	InstancesRepo core.InstancesRepo
+}
+
+func (g GarbageCollector) Collect(ctx context.Context) error {
+	g.Logger.Debug("Collecting garbage...")
+
+	functions, err := g.FunctionsRepo.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list functions: %w", err)
+	}
+
+	registered := lo.SliceToMap(functions, func(fn core.FunctionDefinition) (string, bool) {
+		return fn.Name(), true
+	})
+
+	records, err := listRecords()
+	if err != nil {
+		return err
+	}
+
+	pods := map[string]record{}
+
+	for _, rec := range records {
+		if rec.Component == core.ComponentNameFunction {
+			pods[rec.Instance] = rec
+		}
+	}
+
+	// Records of functions which only have pods left are collected too.
+	names := lo.Uniq(append(lo.Keys(registered), lo.Map(lo.Values(pods), func(pod record, _ int) string {
+		return pod.Function
+	})...))
+
+	err = g.collectPods(ctx, pods, registered)
+	if err != nil {
+		return err
+	}
+
+	err = g.collectComponents(records, registered)
+	if err != nil {
+		return err
+	}
+
+	return g.collectInstanceRecords(ctx, names, pods)
+}
+
+func (g GarbageCollector) collectPods(ctx context.Context, pods map[string]record, registered map[string]bool) error {
+	var errs []error
+
+	for id, pod := range pods {
+		logger := g.Logger.With("podID", id, "function", pod.Function)
+
+		switch {
+		case time.Since(pod.StartedAt) < gracePeriod:
+			continue
+		case !registered[pod.Function]:
+			logger.Info("Removing pod of a deregistered function")
+		case !pod.alive() || !processAlive(pod.HostPID):
+			logger.Info("Removing pod with dead function process or runtime API")
+		default:
+			continue
+		}
+
+		err := g.removePod(ctx, pod)
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		if !processAlive(pod.HostPID) {
+			delete(pods, id)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// removePod terminates the pod's function process. A live host shuts the runtime API down and cleans up
+// after the process exits, pods of dead hosts are cleaned up here.
+func (g GarbageCollector) removePod(ctx context.Context, pod record) error {
+	err := terminate(pod.PID)
+	if err != nil {
+		return err
+	}
+
+	if processAlive(pod.HostPID) {
+		return nil
+	}
+
+	err = removeRecord(pod.Name)
+	if err != nil {
+		return err
+	}
+
+	// The runtime API deletes its record on graceful shutdown, but a dead one cannot.
+	err = g.InstancesRepo.Delete(ctx, docker.Function{Name_: pod.Function}, pod.Instance)
+	if err != nil && !errors.Is(err, core.ErrInstanceNotFound) {
+		return fmt.Errorf("failed to delete instance record %s: %w", pod.Instance, err)
+	}
+
+	return nil
+}
+
+// collectComponents stops scalers of deregistered functions and removes records of exited components.
+func (g GarbageCollector) collectComponents(records []record, registered map[string]bool) error {
+	for _, rec := range records {
+		if rec.Component == core.ComponentNameFunction {
+			continue
+		}
+
+		if !rec.alive() {
+			err := removeRecord(rec.Name)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if rec.Component != core.ComponentNameScaler || registered[rec.Function] {
+			continue
+		}
+
+		g.Logger.Info("Stopping scaler of a deregistered function", "function", rec.Function)
+
+		err := terminate(rec.PID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// collectInstanceRecords deletes instance records of the given functions which do not have a corresponding pod.
+func (g GarbageCollector) collectInstanceRecords(ctx context.Context, names []string, pods map[string]record) error {
+	for _, name := range names {
+		function := docker.Function{Name_: name}
+
+		instances, err := g.InstancesRepo.List(ctx, function)
+		if err != nil {
+			return fmt.Errorf("failed to list instances of %s: %w", name, err)
+		}
+
+		for _, instance := range instances {
+			if _, ok := pods[instance.ID()]; ok {
+				continue
+			}
+
+			if time.Since(instance.StartedAt()) < gracePeriod {
+				continue
+			}
+
+			g.Logger.Info("Deleting stale instance record", "function", name, "instanceID", instance.ID())
+
+			err = g.InstancesRepo.Delete(ctx, function, instance.ID())
+			if err != nil && !errors.Is(err, core.ErrInstanceNotFound) {
+				return fmt.Errorf("failed to delete instance record %s: %w", instance.ID(), err)
+			}
+		}
+	}
+
+	return nil
+}
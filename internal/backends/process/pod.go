@@ -0,0 +1,291 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/config"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/httpserver"
+	"github.com/zhulik/fid/internal/invocation"
+	"github.com/zhulik/fid/internal/kv"
+	"github.com/zhulik/fid/internal/pubsub"
+	"github.com/zhulik/fid/internal/runtimeapi"
+	"github.com/zhulik/pal"
+)
+
+const (
+	runtimeAPIInitTimeout     = 10 * time.Second
+	runtimeAPIShutdownTimeout = 30 * time.Second
+	runtimeAPIListenTimeout   = 5 * time.Second
+	runtimeAPIListenInterval  = 50 * time.Millisecond
+)
+
+// FunctionPod is a function instance running as a local executable and its runtime API running
+// in-process on a loopback port. The pod lives as long as the function process, when it exits
+// the runtime API is shut down and the instance record is deleted.
+type FunctionPod struct {
+	uuid string // Of the "pod"
+
+	Config *config.Config
+	Logger *slog.Logger
+
+	Function core.FunctionDefinition
+
+	runtimeAPI  *pal.Pal
+	stopRunners context.CancelFunc
+	runnersDone chan struct{}
+
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+func (p *FunctionPod) Init(_ context.Context) error {
+	if p.uuid == "" {
+		p.uuid = uuid.NewString()
+	}
+
+	p.Logger = p.Logger.With(
+		"podID", p.uuid,
+		"function", p.Function,
+	)
+
+	p.runnersDone = make(chan struct{})
+	p.done = make(chan struct{})
+
+	return nil
+}
+
+func (p *FunctionPod) Start(ctx context.Context) error {
+	port, err := loopbackPort()
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+
+	err = p.startRuntimeAPI(ctx, port)
+	if err != nil {
+		return err
+	}
+
+	err = p.startFunction(addr)
+	if err != nil {
+		p.Logger.Warn("Pod creation failed, cleaning up...", "error", err)
+		p.stopRuntimeAPI()
+
+		return err
+	}
+
+	go p.wait()
+
+	return nil
+}
+
+// Stop asks the function process to exit and waits until the pod is stopped. The process is killed if
+// it does not exit within the function's timeout.
+func (p *FunctionPod) Stop(ctx context.Context) error {
+	err := terminate(p.cmd.Process.Pid)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-p.done:
+		return nil
+	case <-time.After(p.Function.Timeout() + time.Second):
+		p.Logger.Warn("Function process did not exit in time, killing...")
+
+		err := p.cmd.Process.Kill()
+		if err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return fmt.Errorf("failed to kill function process: %w", err)
+		}
+	case <-ctx.Done():
+		return ctx.Err() //nolint:wrapcheck
+	}
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err() //nolint:wrapcheck
+	}
+}
+
+// startRuntimeAPI initializes a dedicated runtime API app and runs it in the background.
+func (p *FunctionPod) startRuntimeAPI(ctx context.Context, port int) error {
+	cfg := *p.Config
+	cfg.HTTPPort = port
+	cfg.FunctionName = p.Function.Name()
+	cfg.FunctionInstanceID = p.uuid
+
+	p.runtimeAPI = pal.New(
+		pal.Provide(&cfg),
+		pubsub.Provide(core.BrokerNameNATS),
+		kv.Provide(core.BrokerNameNATS),
+		invocation.Provide(),
+		pal.Provide[core.FunctionsRepo](&docker.FunctionsRepo{}),
+		pal.Provide[core.InstancesRepo](&docker.InstancesRepo{}),
+		httpserver.Provide(),
+		runtimeapi.Provide(),
+	).
+		InjectSlog().
+		InitTimeout(runtimeAPIInitTimeout).
+		HealthCheckTimeout(runtimeAPIInitTimeout).
+		ShutdownTimeout(runtimeAPIShutdownTimeout)
+
+	err := p.runtimeAPI.Init(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to initialize runtime API: %w", err)
+	}
+
+	// The runtime API outlives the request which created the pod.
+	runCtx, cancel := context.WithCancel(pal.WithPal(context.WithoutCancel(ctx), p.runtimeAPI))
+	p.stopRunners = cancel
+
+	go func() {
+		defer close(p.runnersDone)
+
+		err := p.runtimeAPI.Container().StartRunners(runCtx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			p.Logger.Error("Runtime API failed", "error", err)
+		}
+	}()
+
+	err = waitForListener(ctx, port)
+	if err != nil {
+		p.stopRuntimeAPI()
+
+		return err
+	}
+
+	return nil
+}
+
+// stopRuntimeAPI stops the runtime API, it deletes the instance record on shutdown.
+func (p *FunctionPod) stopRuntimeAPI() {
+	p.stopRunners()
+	<-p.runnersDone
+
+	ctx, cancel := context.WithTimeout(context.Background(), runtimeAPIShutdownTimeout)
+	defer cancel()
+
+	err := p.runtimeAPI.Container().Shutdown(pal.WithPal(ctx, p.runtimeAPI))
+	if err != nil {
+		p.Logger.Warn("Failed to shut down runtime API", "error", err)
+	}
+}
+
+func (p *FunctionPod) startFunction(runtimeAPIAddr string) error {
+	cmd := exec.Command(p.Function.Image()) //nolint:gosec,noctx
+	cmd.Env = append(os.Environ(), core.MapToEnvList(
+		p.Function.Env(),
+		core.RuntimeEnv(p.Function, runtimeAPIAddr),
+	)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start function process: %w", err)
+	}
+
+	p.cmd = cmd
+
+	err = writeRecord(record{
+		Name:      functionRecordName(p.uuid),
+		PID:       cmd.Process.Pid,
+		Component: core.ComponentNameFunction,
+		Function:  p.Function.Name(),
+		Instance:  p.uuid,
+		StartedAt: time.Now(),
+		HostPID:   os.Getpid(),
+	})
+	if err != nil {
+		cmd.Process.Kill() //nolint:errcheck
+		cmd.Wait()         //nolint:errcheck
+
+		return err
+	}
+
+	return nil
+}
+
+// wait blocks until either the function process or the runtime API exits and stops the other one.
+func (p *FunctionPod) wait() {
+	defer close(p.done)
+
+	exited := make(chan error, 1)
+
+	go func() {
+		exited <- p.cmd.Wait()
+	}()
+
+	select {
+	case err := <-exited:
+		p.Logger.Info("Function process exited", "error", err)
+	case <-p.runnersDone:
+		p.Logger.Warn("Runtime API stopped, terminating function process...")
+
+		err := terminate(p.cmd.Process.Pid)
+		if err != nil {
+			p.Logger.Warn("Failed to terminate function process", "error", err)
+		}
+
+		<-exited
+	}
+
+	p.stopRuntimeAPI()
+
+	err := removeRecord(functionRecordName(p.uuid))
+	if err != nil {
+		p.Logger.Warn("Failed to remove process record", "error", err)
+	}
+}
+
+func functionRecordName(podID string) string {
+	return fmt.Sprintf("%s-%s", podID, core.ComponentNameFunction)
+}
+
+// loopbackPort returns a free port on the loopback interface.
+func loopbackPort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0") //nolint:noctx
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port, nil //nolint:forcetypeassert
+}
+
+// waitForListener waits until the runtime API accepts connections, so the function does not fail
+// connecting to it on start.
+func waitForListener(ctx context.Context, port int) error {
+	ctx, cancel := context.WithTimeout(ctx, runtimeAPIListenTimeout)
+	defer cancel()
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	dialer := net.Dialer{}
+
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			return conn.Close() //nolint:wrapcheck
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("runtime API is not listening on %s: %w", addr, ctx.Err())
+		case <-time.After(runtimeAPIListenInterval):
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package process_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/fid/testhelpers"
+)
+
+func TestProcess(t *testing.T) {
+	t.Parallel()
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Process Backend Suite")
+}
+
+var _ = AfterSuite(testhelpers.StopNATS)
@@ -0,0 +1,131 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/zhulik/fid/pkg/json"
+)
+
+const recordExt = ".json"
+
+// record describes a process started by the backend. Records are stored as files in the state
+// directory, so processes started by one FID component can be found and stopped by another one, they
+// play the same role as container labels in the docker backend.
+type record struct {
+	Name      string    `json:"name"`
+	PID       int       `json:"pid"`
+	Component string    `json:"component"`
+	Function  string    `json:"function,omitempty"`
+	Instance  string    `json:"instance,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+
+	// HostPID is the PID of the process running the pod's runtime API, only set for function processes.
+	HostPID int `json:"hostPid,omitempty"`
+}
+
+func (r record) alive() bool {
+	return processAlive(r.PID)
+}
+
+// stateDir returns the directory process records are stored in.
+func stateDir() string {
+	return filepath.Join(os.TempDir(), "fid")
+}
+
+func recordPath(name string) string {
+	return filepath.Join(stateDir(), name+recordExt)
+}
+
+func writeRecord(rec record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal process record: %w", err)
+	}
+
+	err = os.WriteFile(recordPath(rec.Name), data, 0o600) //nolint:mnd
+	if err != nil {
+		return fmt.Errorf("failed to write process record: %w", err)
+	}
+
+	return nil
+}
+
+func readRecord(name string) (record, error) {
+	data, err := os.ReadFile(recordPath(name))
+	if err != nil {
+		return record{}, fmt.Errorf("failed to read process record: %w", err)
+	}
+
+	rec, err := json.Unmarshal[record](data)
+	if err != nil {
+		return record{}, fmt.Errorf("failed to unmarshal process record: %w", err)
+	}
+
+	return rec, nil
+}
+
+func removeRecord(name string) error {
+	err := os.Remove(recordPath(name))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove process record: %w", err)
+	}
+
+	return nil
+}
+
+// listRecords returns all stored records, unreadable ones are skipped.
+func listRecords() ([]record, error) {
+	entries, err := os.ReadDir(stateDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state directory: %w", err)
+	}
+
+	records := make([]record, 0, len(entries))
+
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), recordExt)
+		if !ok {
+			continue
+		}
+
+		rec, err := readRecord(name)
+		if err != nil {
+			continue
+		}
+
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+// processAlive reports whether a process with the given PID exists.
+func processAlive(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	return proc.Signal(syscall.Signal(0)) == nil
+}
+
+// terminate asks the process to exit gracefully, a missing process is not an error.
+func terminate(pid int) error {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return nil //nolint:nilerr
+	}
+
+	err = proc.Signal(syscall.SIGTERM)
+	if err != nil && !errors.Is(err, os.ErrProcessDone) && !errors.Is(err, syscall.ESRCH) {
+		return fmt.Errorf("failed to terminate process %d: %w", pid, err)
+	}
+
+	return nil
+}
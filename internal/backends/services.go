@@ -5,17 +5,57 @@ import (
 
 	"github.com/docker/docker/client"
 	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/backends/podman"
+	"github.com/zhulik/fid/internal/backends/process"
+	"github.com/zhulik/fid/internal/backends/swarm"
 	"github.com/zhulik/fid/internal/core"
 	"github.com/zhulik/pal"
 )
 
-func Provide() pal.ServiceDef {
-	return pal.ProvideList(
-		pal.ProvideFn[*client.Client](func(ctx context.Context) (*client.Client, error) {
-			return client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-		}),
-		pal.Provide[core.ContainerBackend](&docker.Backend{}),
+// Provide provides the selected backend. Function and instance records are stored in KV, so the repos
+// are shared by all backends.
+func Provide(backend string) pal.ServiceDef {
+	services := []pal.ServiceDef{
 		pal.Provide[core.FunctionsRepo](&docker.FunctionsRepo{}),
 		pal.Provide[core.InstancesRepo](&docker.InstancesRepo{}),
-	)
+	}
+
+	switch backend {
+	case core.BackendNameProcess:
+		services = append(services,
+			pal.Provide[core.ContainerBackend](&process.Backend{}),
+			pal.Provide[core.GarbageCollector](&process.GarbageCollector{}),
+		)
+	case core.BackendNamePodman:
+		services = append(services,
+			pal.ProvideFn[*podman.Client](podman.NewClient),
+			pal.Provide[core.ContainerBackend](&podman.Backend{}),
+			pal.Provide[core.GarbageCollector](&podman.GarbageCollector{}),
+		)
+	case core.BackendNameSwarm:
+		services = append(services,
+			provideDockerClient(),
+			pal.Provide[core.ContainerBackend](&swarm.Backend{}),
+			pal.Provide[core.GarbageCollector](&swarm.GarbageCollector{}),
+		)
+	default:
+		services = append(services,
+			provideDockerClient(),
+			pal.Provide[core.ContainerBackend](&docker.Backend{}),
+			pal.Provide[core.GarbageCollector](&docker.GarbageCollector{}),
+		)
+	}
+
+	return pal.ProvideList(services...)
+}
+
+// ProvideInstancesView provides the in-memory view of instances for components which frequently read them.
+func ProvideInstancesView() pal.ServiceDef {
+	return pal.Provide[core.InstancesView](&docker.InstancesView{})
+}
+
+func provideDockerClient() pal.ServiceDef {
+	return pal.ProvideFn[*client.Client](func(ctx context.Context) (*client.Client, error) {
+		return client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	})
 }
@@ -0,0 +1,217 @@
+package swarm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/docker/docker/client"
+	"github.com/zhulik/fid/internal/config"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/pal"
+)
+
+var (
+	ErrNotSwarmManager = errors.New("docker engine is not a swarm manager")
+	ErrLoopbackNATSURL = errors.New("NATS URL points to the loopback interface, swarm services can't reach it")
+)
+
+// Backend runs FID components and function pods as swarm services, they are scheduled over the swarm's
+// nodes. NATS must be reachable in the core.NetworkNameNATS attachable overlay network, services may run
+// on other nodes, so loopback NATS URLs are rejected.
+type Backend struct {
+	Docker        *client.Client
+	Config        *config.Config
+	Logger        *slog.Logger
+	FunctionsRepo core.FunctionsRepo
+	Pal           *pal.Pal
+}
+
+// Register creates a new function's template and scaler. The scaler service of a registered function is
+// updated, so it picks up the current config, swarm restarts its tasks only if the spec has changed.
+func (b Backend) Register(ctx context.Context, function core.FunctionDefinition) error {
+	if b.Config.LoopbackNATSURL() {
+		return ErrLoopbackNATSURL
+	}
+
+	err := b.FunctionsRepo.Upsert(ctx, function)
+	if err != nil {
+		return fmt.Errorf("failed to store function template: %w", err)
+	}
+
+	b.Logger.Info("Function template stored", "function", function)
+
+	spec := b.componentSpec(componentService{
+		name:      scalerServiceName(function),
+		component: core.ComponentNameScaler,
+		labels:    map[string]string{core.LabelNameFunction: function.Name()},
+		env:       map[string]string{core.EnvNameFunctionName: function.Name()},
+		docker:    true,
+	})
+
+	_, err = createService(ctx, b.Docker, spec)
+	if errors.Is(err, core.ErrContainerAlreadyExists) {
+		err = updateService(ctx, b.Docker, spec)
+		if err != nil {
+			return fmt.Errorf("failed to update scaler service: %w", err)
+		}
+
+		b.Logger.Info("Scaler service updated", "function", function)
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to create scaler service: %w", err)
+	}
+
+	b.Logger.Info("Scaler service created", "function", function)
+
+	return nil
+}
+
+// Deregister deletes function's template.
+func (b Backend) Deregister(ctx context.Context, function core.FunctionDefinition) error {
+	err := b.FunctionsRepo.Delete(ctx, function.Name())
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	// We only delete the definition, the scaler and the instances are removed by the garbage collector.
+
+	b.Logger.Info("Function deregistered", "function", function)
+
+	return nil
+}
+
+func (b Backend) Info(ctx context.Context) (map[string]any, error) {
+	info, err := b.Docker.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to docker info: %w", err)
+	}
+
+	return map[string]any{
+		"backend":      "Docker Swarm backend",
+		"dockerEngine": info,
+	}, nil
+}
+
+func (b Backend) HealthCheck(ctx context.Context) error {
+	b.Logger.Debug("ContainerBackend health check.")
+
+	info, err := b.Docker.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("backend health check failed: %w", err)
+	}
+
+	if !info.Swarm.ControlAvailable {
+		return fmt.Errorf("backend health check failed: %w", ErrNotSwarmManager)
+	}
+
+	return nil
+}
+
+func (b Backend) Shutdown(_ context.Context) error {
+	b.Logger.Debug("ContainerBackend shutting down...")
+	defer b.Logger.Debug("ContainerBackend shot down.")
+
+	err := b.Docker.Close()
+	if err != nil {
+		return fmt.Errorf("failed to shut down the backend: %w", err)
+	}
+
+	return nil
+}
+
+func (b Backend) AddInstance(ctx context.Context, function core.FunctionDefinition) (string, error) {
+	b.Logger.Info("Creating new function pod", "function", function)
+
+	pod := &FunctionPod{Function: function}
+
+	err := b.Pal.InjectInto(ctx, pod)
+	if err != nil {
+		return "", fmt.Errorf("failed to inject dependencies into function pod: %w", err)
+	}
+
+	err = pod.Init(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize function pod: %w", err)
+	}
+
+	err = pod.Start(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to start function pod: %w", err)
+	}
+
+	b.Logger.Info("Function pod created", "function", function, "podID", pod.uuid)
+
+	return pod.uuid, nil
+}
+
+func (b Backend) StopInstance(ctx context.Context, instanceID string) error {
+	b.Logger.Info("Killing function instance", "instanceID", instanceID)
+
+	pod := &FunctionPod{uuid: instanceID}
+
+	err := b.Pal.InjectInto(ctx, pod)
+	if err != nil {
+		return fmt.Errorf("failed to inject dependencies into function pod: %w", err)
+	}
+
+	err = pod.Init(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to initialize function pod: %w", err)
+	}
+
+	return pod.Stop(ctx)
+}
+
+func (b Backend) StartGateway(ctx context.Context, config core.ServiceConfig) (string, error) {
+	return b.startComponent(ctx, componentService{
+		name:      core.ContainerNameGateway,
+		component: core.ComponentNameGateway,
+		env:       config.Env,
+		config:    config,
+	})
+}
+
+func (b Backend) StartInfoServer(ctx context.Context, config core.ServiceConfig) (string, error) {
+	return b.startComponent(ctx, componentService{
+		name:      core.ContainerNameInfoServer,
+		component: core.ComponentNameInfoServer,
+		config:    config,
+		docker:    true,
+	})
+}
+
+func (b Backend) StartGarbageCollector(ctx context.Context) (string, error) {
+	return b.startComponent(ctx, componentService{
+		name:      core.ContainerNameGarbageCollector,
+		component: core.ComponentNameGarbageCollector,
+		docker:    true,
+	})
+}
+
+func (b Backend) startComponent(ctx context.Context, service componentService) (string, error) {
+	if b.Config.LoopbackNATSURL() {
+		return "", ErrLoopbackNATSURL
+	}
+
+	id, err := createService(ctx, b.Docker, b.componentSpec(service))
+	if err != nil {
+		if errors.Is(err, core.ErrContainerAlreadyExists) {
+			b.Logger.Info("Service already exists", "service", service.name)
+		}
+
+		return "", err
+	}
+
+	b.Logger.Info("Service created", "service", service.name, "replicas", max(service.config.Instances, 1))
+
+	return id, nil
+}
+
+func scalerServiceName(function core.FunctionDefinition) string {
+	return fmt.Sprintf("%s-scaler", function)
+}
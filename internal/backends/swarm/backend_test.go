@@ -0,0 +1,171 @@
+package swarm_test
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/backends/docker"
+	swarmBackend "github.com/zhulik/fid/internal/backends/swarm"
+	"github.com/zhulik/fid/internal/config"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/kv"
+	"github.com/zhulik/pal"
+)
+
+var _ = Describe("Backend", func() {
+	var fake *fakeDocker
+	var cfg *config.Config
+	var backend *swarmBackend.Backend
+
+	function := docker.Function{Name_: "test-function", Image_: "test-image", Timeout_: 10 * time.Second}
+
+	BeforeEach(func(ctx SpecContext) {
+		fake = newFakeDocker()
+		DeferCleanup(fake.Close)
+
+		cfg = &config.Config{NATSURL: "nats://nats:4222"}
+
+		p := pal.New(
+			pal.ProvideFn[*client.Client](func(_ context.Context) (*client.Client, error) {
+				return client.NewClientWithOpts(
+					client.WithHost(strings.Replace(fake.URL, "http://", "tcp://", 1)),
+					client.WithVersion("1.47"),
+				)
+			}),
+			pal.Provide(cfg),
+			kv.Provide(core.BrokerNameMemory),
+			pal.Provide[core.FunctionsRepo](&docker.FunctionsRepo{}),
+			pal.Provide(&swarmBackend.Backend{}),
+		).
+			InjectSlog().
+			InitTimeout(time.Second).
+			HealthCheckTimeout(time.Second).
+			ShutdownTimeout(time.Second)
+
+		lo.Must0(p.Init(ctx))
+
+		backend = lo.Must(pal.Invoke[*swarmBackend.Backend](ctx, p))
+	})
+
+	Describe("Register", func() {
+		It("creates the scaler service on manager nodes", func(ctx SpecContext) {
+			Expect(backend.Register(ctx, function)).To(Succeed())
+
+			scaler, ok := fake.service("test-function-scaler")
+			Expect(ok).To(BeTrue())
+			Expect(scaler.TaskTemplate.Placement.Constraints).To(ConsistOf("node.role==manager"))
+			Expect(scaler.TaskTemplate.ContainerSpec.Env).To(ContainElement(core.EnvNameFunctionName + "=test-function"))
+		})
+
+		Context("when the NATS URL points to the loopback interface", func() {
+			It("returns an error", func(ctx SpecContext) {
+				cfg.NATSURL = "nats://127.0.0.1:4222"
+
+				Expect(backend.Register(ctx, function)).To(MatchError(swarmBackend.ErrLoopbackNATSURL))
+			})
+		})
+
+		Context("when the function is already registered", func() {
+			BeforeEach(func(ctx SpecContext) {
+				lo.Must0(backend.Register(ctx, function))
+			})
+
+			It("updates the scaler service with the current config", func(ctx SpecContext) {
+				cfg.NATSURL = "nats://other:4222"
+
+				Expect(backend.Register(ctx, function)).To(Succeed())
+
+				scaler, _ := fake.service("test-function-scaler")
+				Expect(scaler.TaskTemplate.ContainerSpec.Env).To(ContainElement(core.EnvNameNatsURL + "=nats://other:4222"))
+				Expect(fake.serviceVersion("test-function-scaler")).To(Equal(uint64(2)))
+			})
+		})
+	})
+
+	Describe("AddInstance", func() {
+		It("creates the pod's overlay network and services", func(ctx SpecContext) {
+			id, err := backend.AddInstance(ctx, function)
+			Expect(err).ToNot(HaveOccurred())
+
+			net, ok := fake.network(id)
+			Expect(ok).To(BeTrue())
+			Expect(net.Driver).To(Equal("overlay"))
+			Expect(net.Attachable).To(BeTrue())
+			Expect(net.Labels).To(HaveKeyWithValue(core.LabelNameInstance, id))
+
+			api, ok := fake.service(id + "-" + core.ComponentNameRuntimeAPI)
+			Expect(ok).To(BeTrue())
+			Expect(api.TaskTemplate.Networks).To(ConsistOf(
+				swarm.NetworkAttachmentConfig{Target: id, Aliases: []string{docker.APIDNSName}},
+				swarm.NetworkAttachmentConfig{Target: core.NetworkNameNATS},
+			))
+			Expect(api.TaskTemplate.ContainerSpec.Env).To(ContainElement(core.EnvNameInstanceID + "=" + id))
+
+			fn, ok := fake.service(id + "-" + core.ComponentNameFunction)
+			Expect(ok).To(BeTrue())
+			Expect(fn.TaskTemplate.ContainerSpec.Image).To(Equal("test-image:latest"))
+			Expect(fn.TaskTemplate.Networks).To(ConsistOf(swarm.NetworkAttachmentConfig{Target: id}))
+			Expect(fn.TaskTemplate.RestartPolicy.Condition).To(Equal(swarm.RestartPolicyConditionNone))
+		})
+	})
+
+	Describe("StopInstance", func() {
+		It("removes the pod's services and network", func(ctx SpecContext) {
+			id := lo.Must(backend.AddInstance(ctx, function))
+
+			err := backend.StopInstance(ctx, id)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, ok := fake.service(id + "-" + core.ComponentNameRuntimeAPI)
+			Expect(ok).To(BeFalse())
+
+			_, ok = fake.service(id + "-" + core.ComponentNameFunction)
+			Expect(ok).To(BeFalse())
+
+			_, ok = fake.network(id)
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("StartGateway", func() {
+		It("creates a replicated service published on the configured port", func(ctx SpecContext) {
+			_, err := backend.StartGateway(ctx, core.ServiceConfig{Port: 8080, Instances: 3})
+			Expect(err).ToNot(HaveOccurred())
+
+			gateway, ok := fake.service(core.ContainerNameGateway)
+			Expect(ok).To(BeTrue())
+			Expect(*gateway.Mode.Replicated.Replicas).To(Equal(uint64(3)))
+			Expect(gateway.EndpointSpec.Ports).To(HaveLen(1))
+			Expect(gateway.EndpointSpec.Ports[0].PublishedPort).To(Equal(uint32(8080)))
+			Expect(gateway.TaskTemplate.ContainerSpec.Env).To(ContainElement(core.EnvNameBackend + "=" + core.BackendNameSwarm))
+		})
+	})
+
+	Describe("StartInfoServer", func() {
+		It("places the service on manager nodes", func(ctx SpecContext) {
+			lo.Must(backend.StartInfoServer(ctx, core.ServiceConfig{Port: 8081}))
+
+			infoServer, ok := fake.service(core.ContainerNameInfoServer)
+			Expect(ok).To(BeTrue())
+			Expect(*infoServer.Mode.Replicated.Replicas).To(Equal(uint64(1)))
+			Expect(infoServer.TaskTemplate.Placement.Constraints).To(ConsistOf("node.role==manager"))
+			Expect(infoServer.TaskTemplate.ContainerSpec.Mounts).To(HaveLen(1))
+		})
+	})
+
+	Describe("HealthCheck", func() {
+		Context("when docker engine is not a swarm manager", func() {
+			It("returns an error", func(ctx SpecContext) {
+				fake.manager = false
+
+				Expect(backend.HealthCheck(ctx)).To(MatchError(swarmBackend.ErrNotSwarmManager))
+			})
+		})
+	})
+})
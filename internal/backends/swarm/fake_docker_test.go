@@ -0,0 +1,213 @@
+package swarm_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/system"
+)
+
+// fakeDocker is a fake Docker API server implementing only the endpoints used by the swarm backend.
+type fakeDocker struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	manager  bool
+	services map[string]swarm.Service
+	networks map[string]network.CreateRequest
+}
+
+func newFakeDocker() *fakeDocker {
+	fake := &fakeDocker{
+		manager:  true,
+		services: map[string]swarm.Service{},
+		networks: map[string]network.CreateRequest{},
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /{version}/info", fake.info)
+	mux.HandleFunc("POST /{version}/services/create", fake.createService)
+	mux.HandleFunc("GET /{version}/services/{id}", fake.inspectService)
+	mux.HandleFunc("POST /{version}/services/{id}/update", fake.updateService)
+	mux.HandleFunc("DELETE /{version}/services/{id}", fake.removeService)
+	mux.HandleFunc("POST /{version}/networks/create", fake.createNetwork)
+	mux.HandleFunc("DELETE /{version}/networks/{id}", fake.removeNetwork)
+
+	fake.Server = httptest.NewServer(mux)
+
+	return fake
+}
+
+func (f *fakeDocker) service(name string) (swarm.ServiceSpec, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	service, ok := f.services[name]
+
+	return service.Spec, ok
+}
+
+// serviceVersion returns the version of the service, it's incremented by every update.
+func (f *fakeDocker) serviceVersion(name string) uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.services[name].Version.Index
+}
+
+func (f *fakeDocker) network(name string) (network.CreateRequest, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	req, ok := f.networks[name]
+
+	return req, ok
+}
+
+func (f *fakeDocker) info(w http.ResponseWriter, _ *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, system.Info{Swarm: swarm.Info{ControlAvailable: f.manager}})
+}
+
+func (f *fakeDocker) createService(w http.ResponseWriter, r *http.Request) {
+	var spec swarm.ServiceSpec
+
+	err := json.NewDecoder(r.Body).Decode(&spec)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.services[spec.Name]; ok {
+		writeJSON(w, http.StatusConflict, map[string]string{"message": "name conflicts with an existing object"})
+
+		return
+	}
+
+	service := swarm.Service{ID: spec.Name, Spec: spec}
+	service.Version.Index = 1
+
+	f.services[spec.Name] = service
+
+	writeJSON(w, http.StatusCreated, swarm.ServiceCreateResponse{ID: spec.Name})
+}
+
+func (f *fakeDocker) inspectService(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	service, ok := f.services[r.PathValue("id")]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "service not found"})
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, service)
+}
+
+// updateService replaces the service's spec, like swarm it rejects updates of outdated versions.
+func (f *fakeDocker) updateService(w http.ResponseWriter, r *http.Request) {
+	var spec swarm.ServiceSpec
+
+	err := json.NewDecoder(r.Body).Decode(&spec)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	service, ok := f.services[r.PathValue("id")]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "service not found"})
+
+		return
+	}
+
+	if r.URL.Query().Get("version") != strconv.FormatUint(service.Version.Index, 10) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "update out of sequence"})
+
+		return
+	}
+
+	service.Spec = spec
+	service.Version.Index++
+
+	f.services[service.ID] = service
+
+	writeJSON(w, http.StatusOK, swarm.ServiceUpdateResponse{})
+}
+
+func (f *fakeDocker) removeService(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := r.PathValue("id")
+
+	if _, ok := f.services[id]; !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "service not found"})
+
+		return
+	}
+
+	delete(f.services, id)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *fakeDocker) createNetwork(w http.ResponseWriter, r *http.Request) {
+	var req network.CreateRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.networks[req.Name] = req
+
+	writeJSON(w, http.StatusCreated, network.CreateResponse{ID: req.Name})
+}
+
+func (f *fakeDocker) removeNetwork(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := r.PathValue("id")
+
+	if _, ok := f.networks[id]; !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "network not found"})
+
+		return
+	}
+
+	delete(f.networks, id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(body) //nolint:errcheck,errchkjson
+}
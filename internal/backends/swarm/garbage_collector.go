@@ -0,0 +1,244 @@
+package swarm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/pal"
+)
+
+// gracePeriod protects pods and instance records which are being created right now from being collected.
+const gracePeriod = time.Minute
+
+// podState is a pod assembled from the services and networks labelled with the same instance ID.
+type podState struct {
+	function          string
+	createdAt         time.Time
+	runtimeAPIRunning bool
+}
+
+// GarbageCollector reconciles swarm services and the instances repo:
+//   - removes pods whose runtime API has no running tasks;
+//   - removes pods and scalers of deregistered functions;
+//   - removes pod networks left behind after their services are removed;
+//   - deletes instance records which do not have a pod.
+type GarbageCollector struct {
+	Docker        *client.Client
+	Logger        *slog.Logger
+	FunctionsRepo core.FunctionsRepo
+	InstancesRepo core.InstancesRepo
+	Pal           *pal.Pal
+}
+
+func (g GarbageCollector) Collect(ctx context.Context) error {
+	g.Logger.Debug("Collecting garbage...")
+
+	functions, err := g.FunctionsRepo.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list functions: %w", err)
+	}
+
+	registered := lo.SliceToMap(functions, func(fn core.FunctionDefinition) (string, bool) {
+		return fn.Name(), true
+	})
+
+	pods, err := g.listPods(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Records of functions which only have pods left are collected too.
+	names := lo.Uniq(append(lo.Keys(registered), lo.Map(lo.Values(pods), func(pod *podState, _ int) string {
+		return pod.function
+	})...))
+
+	err = g.collectPods(ctx, pods, registered)
+	if err != nil {
+		return err
+	}
+
+	err = g.collectScalers(ctx, registered)
+	if err != nil {
+		return err
+	}
+
+	return g.collectInstanceRecords(ctx, names, pods)
+}
+
+func (g GarbageCollector) collectPods(ctx context.Context, pods map[string]*podState, registered map[string]bool) error { //nolint:lll
+	var errs []error
+
+	for id, pod := range pods {
+		logger := g.Logger.With("podID", id, "function", pod.function)
+
+		switch {
+		case time.Since(pod.createdAt) < gracePeriod:
+			continue
+		case !registered[pod.function]:
+			logger.Info("Removing pod of a deregistered function")
+		case !pod.runtimeAPIRunning:
+			logger.Info("Removing pod with dead runtime API")
+		default:
+			continue
+		}
+
+		err := g.removePod(ctx, id, pod)
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		delete(pods, id)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (g GarbageCollector) removePod(ctx context.Context, id string, pod *podState) error {
+	function := docker.Function{Name_: pod.function}
+
+	fnPod := &FunctionPod{uuid: id, Function: function}
+
+	err := g.Pal.InjectInto(ctx, fnPod)
+	if err != nil {
+		return fmt.Errorf("failed to inject dependencies into function pod: %w", err)
+	}
+
+	err = fnPod.Init(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to initialize function pod: %w", err)
+	}
+
+	err = fnPod.Stop(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to remove pod %s: %w", id, err)
+	}
+
+	// The runtime API deletes its record on graceful shutdown, but a dead one cannot.
+	err = g.InstancesRepo.Delete(ctx, function, id)
+	if err != nil && !errors.Is(err, core.ErrInstanceNotFound) {
+		return fmt.Errorf("failed to delete instance record %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// collectScalers removes scaler services of deregistered functions.
+func (g GarbageCollector) collectScalers(ctx context.Context, registered map[string]bool) error {
+	services, err := g.Docker.ServiceList(ctx, types.ServiceListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", fmt.Sprintf("%s=%s", core.LabelNameComponent, core.ComponentNameScaler)),
+			filters.Arg("label", core.LabelNameFunction),
+		),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list scaler services: %w", err)
+	}
+
+	for _, service := range services {
+		function := service.Spec.Labels[core.LabelNameFunction]
+		if registered[function] {
+			continue
+		}
+
+		g.Logger.Info("Removing scaler of a deregistered function", "function", function)
+
+		err = removeService(ctx, g.Docker, service.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// collectInstanceRecords deletes instance records of the given functions which do not have a corresponding pod.
+func (g GarbageCollector) collectInstanceRecords(ctx context.Context, names []string, pods map[string]*podState) error {
+	for _, name := range names {
+		function := docker.Function{Name_: name}
+
+		instances, err := g.InstancesRepo.List(ctx, function)
+		if err != nil {
+			return fmt.Errorf("failed to list instances of %s: %w", name, err)
+		}
+
+		for _, instance := range instances {
+			if _, ok := pods[instance.ID()]; ok {
+				continue
+			}
+
+			if time.Since(instance.StartedAt()) < gracePeriod {
+				continue
+			}
+
+			g.Logger.Info("Deleting stale instance record", "function", name, "instanceID", instance.ID())
+
+			err = g.InstancesRepo.Delete(ctx, function, instance.ID())
+			if err != nil && !errors.Is(err, core.ErrInstanceNotFound) {
+				return fmt.Errorf("failed to delete instance record %s: %w", instance.ID(), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// listPods builds pods from services and networks labelled with an instance ID. A pod is also listed when
+// only some of its parts exist, for instance, a network left behind after its services were removed.
+func (g GarbageCollector) listPods(ctx context.Context) (map[string]*podState, error) {
+	args := filters.NewArgs(filters.Arg("label", core.LabelNameInstance))
+
+	services, err := g.Docker.ServiceList(ctx, types.ServiceListOptions{Filters: args, Status: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	networks, err := g.Docker.NetworkList(ctx, network.ListOptions{Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks: %w", err)
+	}
+
+	pods := map[string]*podState{}
+
+	pod := func(labels map[string]string, createdAt time.Time) *podState {
+		id := labels[core.LabelNameInstance]
+
+		state, ok := pods[id]
+		if !ok {
+			state = &podState{function: labels[core.LabelNameFunction], createdAt: createdAt}
+			pods[id] = state
+		}
+
+		if createdAt.After(state.createdAt) {
+			state.createdAt = createdAt
+		}
+
+		return state
+	}
+
+	for _, service := range services {
+		state := pod(service.Spec.Labels, service.CreatedAt)
+
+		if service.Spec.Labels[core.LabelNameComponent] == core.ComponentNameRuntimeAPI &&
+			service.ServiceStatus != nil && service.ServiceStatus.RunningTasks > 0 {
+			state.runtimeAPIRunning = true
+		}
+	}
+
+	for _, net := range networks {
+		pod(net.Labels, net.Created)
+	}
+
+	return pods, nil
+}
@@ -0,0 +1,183 @@
+package swarm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+	"github.com/google/uuid"
+	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/config"
+	"github.com/zhulik/fid/internal/core"
+)
+
+// FunctionPod is a function instance and its runtime api running as two services attached to the pod's
+// overlay network. Swarm may schedule the services on different nodes.
+type FunctionPod struct {
+	uuid string // Of the "pod"
+
+	Config *config.Config
+	Docker *client.Client
+	Logger *slog.Logger
+
+	runtimeAPIServiceName string
+	functionServiceName   string
+
+	Function core.FunctionDefinition
+}
+
+func (p *FunctionPod) Init(ctx context.Context) error {
+	if p.uuid == "" {
+		p.uuid = uuid.NewString()
+	}
+
+	p.Logger = p.Logger.With(
+		"podID", p.uuid,
+		"function", p.Function,
+	)
+
+	p.runtimeAPIServiceName = fmt.Sprintf("%s-%s", p.uuid, core.ComponentNameRuntimeAPI)
+	p.functionServiceName = fmt.Sprintf("%s-%s", p.uuid, core.ComponentNameFunction)
+
+	return nil
+}
+
+func (p *FunctionPod) Start(ctx context.Context) error {
+	var err error
+
+	defer func() {
+		if err != nil {
+			p.Logger.Warn("Pod creation failed, cleaning up...", "error", err)
+
+			err := p.Stop(ctx)
+			if err != nil {
+				p.Logger.Warn("Failed to clean up after failed pod creation.", "error", err)
+			}
+		}
+	}()
+
+	_, err = p.Docker.NetworkCreate(ctx, p.uuid, network.CreateOptions{
+		Driver:     "overlay",
+		Attachable: true,
+		Labels:     p.labels(core.ComponentNameFunction),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create network: %w", err)
+	}
+
+	_, err = createService(ctx, p.Docker, p.runtimeAPISpec())
+	if err != nil {
+		return err
+	}
+
+	_, err = createService(ctx, p.Docker, p.functionSpec())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Stop removes the pod's services and its network. Swarm stops the services' tasks asynchronously, so the
+// network may still be in use, such networks are removed by the garbage collector later.
+func (p *FunctionPod) Stop(ctx context.Context) error {
+	fnStopErr := removeService(ctx, p.Docker, p.functionServiceName)
+	apiStopErr := removeService(ctx, p.Docker, p.runtimeAPIServiceName)
+
+	if fnStopErr != nil || apiStopErr != nil {
+		return errors.Join(fnStopErr, apiStopErr)
+	}
+
+	err := p.Docker.NetworkRemove(ctx, p.uuid)
+	if err != nil && !client.IsErrNotFound(err) {
+		p.Logger.Warn("Failed to delete network, it will be garbage collected", "error", err)
+	}
+
+	return nil
+}
+
+// labels returns labels for pod's resources, they are used by the garbage collector to find the pod's
+// parts.
+func (p *FunctionPod) labels(component string) map[string]string {
+	return map[string]string{
+		core.LabelNameComponent: component,
+		core.LabelNameFunction:  p.Function.Name(),
+		core.LabelNameInstance:  p.uuid,
+	}
+}
+
+func (p *FunctionPod) runtimeAPISpec() swarm.ServiceSpec {
+	labels := p.labels(core.ComponentNameRuntimeAPI)
+
+	return swarm.ServiceSpec{
+		Annotations: swarm.Annotations{
+			Name:   p.runtimeAPIServiceName,
+			Labels: labels,
+		},
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: &swarm.ContainerSpec{
+				Image: core.ImageNameFID,
+				Args:  []string{core.ComponentNameRuntimeAPI},
+				Env: core.MapToEnvList(map[string]string{
+					core.EnvNameFunctionName: p.Function.Name(),
+					core.EnvNameInstanceID:   p.uuid,
+					core.EnvNameNatsURL:      p.Config.NATSURL,
+				}),
+				Labels: labels,
+			},
+			Networks: []swarm.NetworkAttachmentConfig{
+				{Target: p.uuid, Aliases: []string{docker.APIDNSName}},
+				{Target: core.NetworkNameNATS},
+			},
+			RestartPolicy: noRestart(),
+		},
+		Mode: singleReplica(),
+	}
+}
+
+func (p *FunctionPod) functionSpec() swarm.ServiceSpec {
+	labels := p.labels(core.ComponentNameFunction)
+	stopGracePeriod := p.Function.Timeout() + time.Second
+
+	return swarm.ServiceSpec{
+		Annotations: swarm.Annotations{
+			Name:   p.functionServiceName,
+			Labels: labels,
+		},
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: &swarm.ContainerSpec{
+				Image: p.Function.Image(),
+				Env: core.MapToEnvList(
+					p.Function.Env(),
+					core.RuntimeEnv(p.Function, docker.APIDNSName),
+				),
+				Labels:          labels,
+				StopGracePeriod: &stopGracePeriod,
+			},
+			Networks: []swarm.NetworkAttachmentConfig{
+				{Target: p.uuid},
+			},
+			RestartPolicy: noRestart(),
+		},
+		Mode: singleReplica(),
+	}
+}
+
+// noRestart disables restarts of pod's tasks, like docker backend's containers, dead pods are replaced
+// by the scaler and removed by the garbage collector.
+func noRestart() *swarm.RestartPolicy {
+	return &swarm.RestartPolicy{Condition: swarm.RestartPolicyConditionNone}
+}
+
+func singleReplica() swarm.ServiceMode {
+	replicas := uint64(1)
+
+	return swarm.ServiceMode{
+		Replicated: &swarm.ReplicatedService{Replicas: &replicas},
+	}
+}
@@ -0,0 +1,141 @@
+package swarm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/zhulik/fid/internal/core"
+)
+
+const (
+	dockerSocket = "/var/run/docker.sock" // TODO: configurable
+
+	// managerConstraint places services which talk to the docker API on manager nodes, the swarm API is
+	// not available on workers.
+	managerConstraint = "node.role==manager"
+)
+
+// componentService describes a service running a FID component.
+type componentService struct {
+	name      string
+	component string
+	labels    map[string]string
+	env       map[string]string
+	config    core.ServiceConfig
+
+	// docker mounts the docker socket into the service's containers.
+	docker bool
+}
+
+func (b Backend) componentSpec(service componentService) swarm.ServiceSpec {
+	replicas := uint64(max(service.config.Instances, 1)) //nolint:gosec
+
+	labels := map[string]string{
+		core.LabelNameComponent: service.component,
+	}
+
+	for key, value := range service.labels {
+		labels[key] = value
+	}
+
+	containerSpec := &swarm.ContainerSpec{
+		Image: core.ImageNameFID,
+		Args:  []string{service.component},
+		Env: core.MapToEnvList(service.env, map[string]string{
+			core.EnvNameNatsURL: b.Config.NATSURL,
+			core.EnvNameBackend: core.BackendNameSwarm,
+		}),
+		Labels: labels,
+	}
+
+	spec := swarm.ServiceSpec{
+		Annotations: swarm.Annotations{
+			Name:   service.name,
+			Labels: labels,
+		},
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: containerSpec,
+			Networks: []swarm.NetworkAttachmentConfig{
+				{Target: core.NetworkNameNATS},
+			},
+		},
+		Mode: swarm.ServiceMode{
+			Replicated: &swarm.ReplicatedService{Replicas: &replicas},
+		},
+	}
+
+	if service.docker {
+		containerSpec.Mounts = []mount.Mount{
+			{
+				Type:   mount.TypeBind,
+				Source: dockerSocket,
+				Target: dockerSocket,
+			},
+		}
+
+		spec.TaskTemplate.Placement = &swarm.Placement{
+			Constraints: []string{managerConstraint},
+		}
+	}
+
+	if service.config.Port != 0 {
+		spec.EndpointSpec = &swarm.EndpointSpec{
+			Ports: []swarm.PortConfig{
+				{
+					Protocol:      swarm.PortConfigProtocolTCP,
+					TargetPort:    80,                          //nolint:mnd
+					PublishedPort: uint32(service.config.Port), //nolint:gosec
+					PublishMode:   swarm.PortConfigPublishModeIngress,
+				},
+			},
+		}
+	}
+
+	return spec
+}
+
+// createService creates a service, returns core.ErrContainerAlreadyExists if a service with the same name
+// exists.
+func createService(ctx context.Context, docker *client.Client, spec swarm.ServiceSpec) (string, error) {
+	resp, err := docker.ServiceCreate(ctx, spec, types.ServiceCreateOptions{})
+	if err != nil {
+		if errdefs.IsConflict(err) {
+			return "", core.ErrContainerAlreadyExists
+		}
+
+		return "", fmt.Errorf("failed to create service %s: %w", spec.Name, err)
+	}
+
+	return resp.ID, nil
+}
+
+// updateService replaces the spec of an existing service. Swarm rejects updates of outdated versions, so
+// the current version is read right before the update.
+func updateService(ctx context.Context, docker *client.Client, spec swarm.ServiceSpec) error {
+	service, _, err := docker.ServiceInspectWithRaw(ctx, spec.Name, types.ServiceInspectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to inspect service %s: %w", spec.Name, err)
+	}
+
+	_, err = docker.ServiceUpdate(ctx, service.ID, service.Version, spec, types.ServiceUpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update service %s: %w", spec.Name, err)
+	}
+
+	return nil
+}
+
+// removeService removes a service, missing services are ignored.
+func removeService(ctx context.Context, docker *client.Client, name string) error {
+	err := docker.ServiceRemove(ctx, name)
+	if err != nil && !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to remove service '%s': %w", name, err)
+	}
+
+	return nil
+}
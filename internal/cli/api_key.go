@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+	"github.com/zhulik/fid/internal/cli/flags"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/gateway"
+	"github.com/zhulik/pal"
+)
+
+const (
+	flagNameFunction     = "function"
+	flagNameDailyQuota   = "daily-quota"
+	flagNameMonthlyQuota = "monthly-quota"
+)
+
+var ErrAPIKeyNameNotGiven = errors.New("api key name is not provided")
+
+// APIKeyCreator creates an API key and prints it, the key cannot be retrieved later.
+type APIKeyCreator struct {
+	APIKeysRepo core.APIKeysRepo
+
+	CMD *cli.Command `pal:"name=command"`
+}
+
+func (c *APIKeyCreator) Run(ctx context.Context) error {
+	key, err := c.APIKeysRepo.Create(ctx, core.APIKey{
+		Name:      c.CMD.Args().First(),
+		Functions: c.CMD.StringSlice(flagNameFunction),
+		Quota: core.Quota{
+			Daily:   int(c.CMD.Int(flagNameDailyQuota)),
+			Monthly: int(c.CMD.Int(flagNameMonthlyQuota)),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	fmt.Println(key) //nolint:forbidigo
+
+	return nil
+}
+
+// APIKeyRevoker deletes an API key, the gateway rejects it immediately.
+type APIKeyRevoker struct {
+	APIKeysRepo core.APIKeysRepo
+
+	CMD *cli.Command `pal:"name=command"`
+}
+
+func (r *APIKeyRevoker) Run(ctx context.Context) error {
+	err := r.APIKeysRepo.Delete(ctx, r.CMD.Args().First())
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+
+	return nil
+}
+
+var apiKeyCMD = &cli.Command{
+	Name:     "api-key",
+	Aliases:  []string{"ak"},
+	Usage:    "Manage API keys of functions with apiKey auth.",
+	Category: "User",
+	Commands: []*cli.Command{
+		{
+			Name:      "create",
+			Usage:     "Create an API key and print it.",
+			ArgsUsage: "NAME",
+			Flags: append([]cli.Flag{
+				&cli.StringSliceFlag{
+					Name:    flagNameFunction,
+					Aliases: []string{"f"},
+					Usage:   "Allow the key to invoke `FUNCTION`, can be repeated. Any function if not set",
+				},
+				&cli.IntFlag{
+					Name:  flagNameDailyQuota,
+					Usage: "Allow the key `N` invocations per UTC day. Unlimited if not set",
+				},
+				&cli.IntFlag{
+					Name:  flagNameMonthlyQuota,
+					Usage: "Allow the key `N` invocations per UTC month. Unlimited if not set",
+				},
+			}, flags.Common...),
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				if cmd.Args().First() == "" {
+					return ErrAPIKeyNameNotGiven
+				}
+
+				return runApp(ctx, cmd, provideAPIKeysRepo(), pal.Provide(&APIKeyCreator{}))
+			},
+		},
+		{
+			Name:      "revoke",
+			Usage:     "Revoke an API key.",
+			ArgsUsage: "NAME",
+			Flags:     flags.Common,
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				if cmd.Args().First() == "" {
+					return ErrAPIKeyNameNotGiven
+				}
+
+				return runApp(ctx, cmd, provideAPIKeysRepo(), pal.Provide(&APIKeyRevoker{}))
+			},
+		},
+	},
+}
+
+func provideAPIKeysRepo() pal.ServiceDef {
+	return pal.Provide[core.APIKeysRepo](&gateway.APIKeysRepo{})
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/urfave/cli/v3"
 	"github.com/zhulik/fid/internal/cli/flags"
 	"github.com/zhulik/fid/internal/config"
+	"github.com/zhulik/fid/internal/core"
 	"github.com/zhulik/fid/internal/di"
 	"github.com/zhulik/pal"
 )
@@ -25,8 +26,10 @@ var cmd = &cli.Command{
 		infoServerCMD,
 		runtimeapiCMD,
 		scalerCMD,
+		garbageCollectorCMD,
 		healthcheckCMD,
 		startCMD,
+		apiKeyCMD,
 	},
 }
 
@@ -50,12 +53,16 @@ func runApp(ctx context.Context, cmd *cli.Command, services ...pal.ServiceDef) e
 	slog.SetDefault(logger)
 
 	cfg := &config.Config{
-		HTTPPort:           int(cmd.Int(flags.FlagNameServerPort)),
-		FunctionName:       cmd.String(flags.FlagNameFunctionName),
-		FunctionInstanceID: cmd.String(flags.FlagNameFunctionInstanceID),
-		NATSURL:            cmd.String(flags.FlagNameNATSURL),
-		LogLevel:           level,
-		FidfilePath:        cmd.String(flags.FlagNameFIDFile),
+		HTTPPort:             int(cmd.Int(flags.FlagNameServerPort)),
+		FunctionName:         cmd.String(flags.FlagNameFunctionName),
+		FunctionInstanceID:   cmd.String(flags.FlagNameFunctionInstanceID),
+		NATSURL:              cmd.String(flags.FlagNameNATSURL),
+		LogLevel:             level,
+		FidfilePath:          cmd.String(flags.FlagNameFIDFile),
+		Backend:              cmd.String(flags.FlagNameBackend),
+		EmbeddedNATS:         cmd.Bool(flags.FlagNameEmbeddedNATS),
+		EmbeddedNATSStoreDir: cmd.String(flags.FlagNameEmbeddedNATSDir),
+		HealthCheckAddr:      lo.CoalesceOrEmpty(os.Getenv(core.EnvNameHealthCheckAddr), core.DefaultHealthCheckAddr),
 	}
 
 	return di.Run(ctx, cfg, services...) //nolint:wrapcheck
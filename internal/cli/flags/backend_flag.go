@@ -4,11 +4,14 @@ import (
 	"fmt"
 
 	"github.com/urfave/cli/v3"
+	"github.com/zhulik/fid/internal/core"
 )
 
 var (
-	supportedBackends = []string{"docker"}
-	defaultBackend    = "docker"
+	supportedBackends = []string{
+		core.BackendNameDocker, core.BackendNameSwarm, core.BackendNamePodman, core.BackendNameProcess,
+	}
+	defaultBackend = core.BackendNameDocker
 )
 
 func NewBackendFlag() cli.Flag {
@@ -20,6 +23,6 @@ func NewBackendFlag() cli.Flag {
 			selected: defaultBackend,
 			possible: supportedBackends,
 		},
-		Sources: cli.EnvVars("BACKEND"),
+		Sources: cli.EnvVars(core.EnvNameBackend),
 	}
 }
@@ -22,7 +22,7 @@ func (e *EnumFlag) Set(value string) error {
 		}
 	}
 
-	return fmt.Errorf("%w, allowed values are %v", errUnknownValue, supportedBackends)
+	return fmt.Errorf("%w, allowed values are %v", errUnknownValue, e.possible)
 }
 
 func (e *EnumFlag) Get() any {
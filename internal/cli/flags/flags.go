@@ -1,6 +1,9 @@
 package flags
 
 import (
+	"os"
+	"path/filepath"
+
 	"github.com/urfave/cli/v3"
 	"github.com/zhulik/fid/internal/core"
 )
@@ -17,6 +20,8 @@ const (
 	FlagNameDockerURL          = "docker-url"
 	FlagNameFIDFile            = "fidfile"
 	FlagNameInitOnly           = "init-only"
+	FlagNameEmbeddedNATS       = "embedded-nats"
+	FlagNameEmbeddedNATSDir    = "embedded-nats-store-dir"
 )
 
 var (
@@ -49,7 +54,7 @@ var (
 		Aliases: []string{"p"},
 		Usage:   "Set server port to `PORT`.",
 		Value:   defaultHTTPPort,
-		Sources: cli.EnvVars("HTTP_PORT"),
+		Sources: cli.EnvVars(core.EnvNameHTTPPort),
 	}
 
 	LogLevel = &cli.StringFlag{
@@ -57,7 +62,7 @@ var (
 		Aliases: []string{"l"},
 		Usage:   "Set log level to `LEVEL`.",
 		Value:   "info",
-		Sources: cli.EnvVars("LOG_LEVEL"),
+		Sources: cli.EnvVars(core.EnvNameLogLevel),
 	}
 
 	Backend = NewBackendFlag()
@@ -70,6 +75,21 @@ var (
 		Sources: cli.EnvVars("DOCKER_URL"),
 	}
 
+	EmbeddedNATS = &cli.BoolFlag{
+		Name: FlagNameEmbeddedNATS,
+		Usage: "Run NATS in process on the port of the NATS URL, started services connect with the URL. " +
+			"It listens on all interfaces and requires the URL's credentials, unless the process backend " +
+			"is used with a loopback URL.",
+		Sources: cli.EnvVars("EMBEDDED_NATS"),
+	}
+
+	EmbeddedNATSStoreDir = &cli.StringFlag{
+		Name:    FlagNameEmbeddedNATSDir,
+		Usage:   "Store embedded NATS JetStream data in `DIR`.",
+		Value:   defaultStoreDir(),
+		Sources: cli.EnvVars("EMBEDDED_NATS_STORE_DIR"),
+	}
+
 	Common = []cli.Flag{
 		NatsURL,
 		LogLevel,
@@ -82,3 +102,19 @@ var (
 
 	ForBackend = []cli.Flag{Backend, DockerURL}
 )
+
+// defaultStoreDir returns the directory embedded NATS stores its data in unless configured, it's in the
+// user's data dir, so the data survives reboots.
+func defaultStoreDir() string {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return filepath.Join(os.TempDir(), "fid-nats")
+		}
+
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+
+	return filepath.Join(dataDir, "fid", "nats")
+}
@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/urfave/cli/v3"
+	"github.com/zhulik/fid/internal/cli/flags"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/garbagecollector"
+)
+
+var garbageCollectorCMD = &cli.Command{
+	Name:     core.ComponentNameGarbageCollector,
+	Aliases:  []string{"gc"},
+	Usage:    "Garbage collector is a component that removes pods, networks and instance records left behind by crashed or deregistered function instances.", //nolint:lll
+	Category: "Service",
+	Flags: append(
+		flags.ForServer,
+		flags.ForBackend...,
+	),
+	Action: func(ctx context.Context, cmd *cli.Command) error {
+		return runApp(ctx, cmd, garbagecollector.Provide())
+	},
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/urfave/cli/v3"
+	"github.com/zhulik/fid/internal/backends"
 	"github.com/zhulik/fid/internal/cli/flags"
 	"github.com/zhulik/fid/internal/core"
 	"github.com/zhulik/fid/internal/gateway"
@@ -16,6 +17,6 @@ var gatewayCMD = &cli.Command{
 	Category: "Service",
 	Flags:    flags.ForServer,
 	Action: func(ctx context.Context, cmd *cli.Command) error {
-		return runApp(ctx, cmd, gateway.Provide())
+		return runApp(ctx, cmd, gateway.Provide(), backends.ProvideInstancesView())
 	},
 }
@@ -4,10 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
 	"time"
 
+	"github.com/samber/lo"
 	"github.com/urfave/cli/v3"
+	"github.com/zhulik/fid/internal/core"
 )
 
 var ErrHealthCheckFailed = errors.New("healthcheck failed")
@@ -18,7 +22,16 @@ var healthcheckCMD = &cli.Command{
 	Usage:    "Run healthcheck.",
 	Category: "Utility",
 	Action: func(ctx context.Context, cmd *cli.Command) error {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://127.0.0.1:8081/health", nil)
+		addr := lo.CoalesceOrEmpty(os.Getenv(core.EnvNameHealthCheckAddr), core.DefaultHealthCheckAddr)
+
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return fmt.Errorf("failed to parse health check address: %w", err)
+		}
+
+		url := fmt.Sprintf("http://127.0.0.1:%s/health", port)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 		if err != nil {
 			return fmt.Errorf("failed to create HTTP request: %w", err)
 		}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/urfave/cli/v3"
+	"github.com/zhulik/fid/internal/backends"
 	"github.com/zhulik/fid/internal/cli/flags"
 	"github.com/zhulik/fid/internal/core"
 	"github.com/zhulik/fid/internal/infoserver"
@@ -19,6 +20,6 @@ var infoServerCMD = &cli.Command{
 		flags.ForBackend...,
 	),
 	Action: func(ctx context.Context, cmd *cli.Command) error {
-		return runApp(ctx, cmd, infoserver.Provide())
+		return runApp(ctx, cmd, infoserver.Provide(), backends.ProvideInstancesView())
 	},
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/urfave/cli/v3"
+	"github.com/zhulik/fid/internal/backends"
 	"github.com/zhulik/fid/internal/cli/flags"
 	"github.com/zhulik/fid/internal/core"
 	"github.com/zhulik/fid/internal/scaler"
@@ -21,6 +22,6 @@ var scalerCMD = &cli.Command{
 	),
 
 	Action: func(ctx context.Context, cmd *cli.Command) error {
-		return runApp(ctx, cmd, scaler.Provide())
+		return runApp(ctx, cmd, scaler.Provide(), backends.ProvideInstancesView())
 	},
 }
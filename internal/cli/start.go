@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 
+	"github.com/samber/lo"
 	"github.com/urfave/cli/v3"
 	"github.com/zhulik/fid/internal/cli/flags"
 	"github.com/zhulik/fid/internal/config"
@@ -15,12 +16,13 @@ import (
 )
 
 type Starter struct {
-	Logger        *slog.Logger
-	Backend       core.ContainerBackend
-	PubSuber      core.PubSuber
-	FunctionsRepo core.FunctionsRepo
-	KV            core.KV
-	Config        *config.Config
+	Logger             *slog.Logger
+	Backend            core.ContainerBackend
+	PubSuber           core.PubSuber
+	FunctionsRepo      core.FunctionsRepo
+	ConcurrencyLimiter core.ConcurrencyLimiter
+	KV                 core.KV
+	Config             *config.Config
 
 	CMD *cli.Command `pal:"name=command"`
 }
@@ -49,19 +51,35 @@ func (s *Starter) Run(ctx context.Context) error {
 		return fmt.Errorf("failed to create or update function streams %s: %w", fidFilePath, err)
 	}
 
+	reserved := lo.SumBy(lo.Values(fidFile.Functions), func(function *fidfile.Function) int {
+		return function.LimitsConfig().ReservedConcurrency
+	})
+
+	err = s.ConcurrencyLimiter.SetBudget(ctx, fidFile.MaxConcurrency, reserved)
+	if err != nil {
+		return fmt.Errorf("failed to set concurrency budget: %w", err)
+	}
+
 	if initOnly {
 		return nil
 	}
 
-	_, err = s.startGateway(ctx)
+	_, err = s.startGateway(ctx, fidFile.GatewayConfig())
 	if err != nil {
 		if !errors.Is(err, core.ErrContainerAlreadyExists) {
 			return fmt.Errorf("failed to start gateway: %w", err)
 		}
 	}
 
+	_, err = s.startGarbageCollector(ctx)
+	if err != nil {
+		if !errors.Is(err, core.ErrContainerAlreadyExists) {
+			return fmt.Errorf("failed to start garbage collector: %w", err)
+		}
+	}
+
 	if fidFile.InfoServer != nil {
-		_, err = s.startInfoServer(ctx)
+		_, err = s.startInfoServer(ctx, fidFile.InfoServer.Config())
 		if err != nil {
 			if !errors.Is(err, core.ErrContainerAlreadyExists) {
 				return fmt.Errorf("failed to start info server: %w", err)
@@ -69,11 +87,24 @@ func (s *Starter) Run(ctx context.Context) error {
 		}
 	}
 
-	return s.registerFunctions(ctx, fidFile.Functions)
+	err = s.registerFunctions(ctx, fidFile.Functions)
+	if err != nil {
+		return err
+	}
+
+	// Components started by the process backend are child processes, they are stopped with FID. Components
+	// started by other backends need the embedded NATS server to keep running.
+	if s.Config.Backend == core.BackendNameProcess || s.Config.EmbeddedNATS {
+		s.Logger.Info("Running until interrupted...")
+
+		<-ctx.Done()
+	}
+
+	return nil
 }
 
 func (s *Starter) createKVBuckets(ctx context.Context) error {
-	_, err := s.KV.CreateBucket(ctx, core.BucketNameInstances)
+	_, err := s.KV.CreateBucketWithConfig(ctx, core.BucketConfigInstances)
 	if err != nil {
 		return fmt.Errorf("failed to create or update instances bucket: %w", err)
 	}
@@ -83,6 +114,11 @@ func (s *Starter) createKVBuckets(ctx context.Context) error {
 		return fmt.Errorf("failed to create or update functions bucket: %w", err)
 	}
 
+	_, err = s.KV.CreateBucketWithConfig(ctx, core.BucketConfigInvocations)
+	if err != nil {
+		return fmt.Errorf("failed to create or update invocations bucket: %w", err)
+	}
+
 	s.Logger.Info("KV buckets created or updated")
 
 	return nil
@@ -131,8 +167,8 @@ func (s *Starter) registerFunctions(ctx context.Context, functions map[string]*f
 	return nil
 }
 
-func (s *Starter) startGateway(ctx context.Context) (string, error) {
-	id, err := s.Backend.StartGateway(ctx)
+func (s *Starter) startGateway(ctx context.Context, config core.ServiceConfig) (string, error) {
+	id, err := s.Backend.StartGateway(ctx, config)
 	if err != nil {
 		return "", fmt.Errorf("failed to start gateway: %w", err)
 	}
@@ -140,8 +176,8 @@ func (s *Starter) startGateway(ctx context.Context) (string, error) {
 	return id, nil
 }
 
-func (s *Starter) startInfoServer(ctx context.Context) (string, error) {
-	id, err := s.Backend.StartInfoServer(ctx)
+func (s *Starter) startInfoServer(ctx context.Context, config core.ServiceConfig) (string, error) {
+	id, err := s.Backend.StartInfoServer(ctx, config)
 	if err != nil {
 		return "", fmt.Errorf("failed to start info server: %w", err)
 	}
@@ -149,14 +185,25 @@ func (s *Starter) startInfoServer(ctx context.Context) (string, error) {
 	return id, nil
 }
 
+func (s *Starter) startGarbageCollector(ctx context.Context) (string, error) {
+	id, err := s.Backend.StartGarbageCollector(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to start garbage collector: %w", err)
+	}
+
+	return id, nil
+}
+
 var startCMD = &cli.Command{
 	Name:     "start",
 	Aliases:  []string{"s"},
 	Usage:    "Start FID. Reads Fidfile.yaml and starts the required services.",
 	Category: "User",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		flags.NatsURL,
 		flags.LogLevel,
+		flags.EmbeddedNATS,
+		flags.EmbeddedNATSStoreDir,
 		&cli.BoolFlag{
 			Name:    flags.FlagNameInitOnly,
 			Aliases: []string{"i"},
@@ -169,11 +216,37 @@ var startCMD = &cli.Command{
 			Usage:   "Load Fidfile.yaml from `FILE`",
 			Sources: cli.EnvVars("FIDFILE"),
 		},
-	},
+	}, flags.ForBackend...),
 
 	Action: func(ctx context.Context, cmd *cli.Command) error {
+		err := useFidfileBackend(cmd)
+		if err != nil {
+			return err
+		}
+
 		return runApp(ctx, cmd,
 			pal.Provide(&Starter{}),
 		)
 	},
 }
+
+// useFidfileBackend selects the backend configured in the Fidfile unless it's explicitly set with the flag.
+func useFidfileBackend(cmd *cli.Command) error {
+	if cmd.IsSet(flags.FlagNameBackend) {
+		return nil
+	}
+
+	fidFilePath := cmd.String(flags.FlagNameFIDFile)
+
+	fidFile, err := fidfile.ParseFile(fidFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", fidFilePath, err)
+	}
+
+	err = cmd.Set(flags.FlagNameBackend, fidFile.Backend)
+	if err != nil {
+		return fmt.Errorf("failed to set backend: %w", err)
+	}
+
+	return nil
+}
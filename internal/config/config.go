@@ -2,6 +2,8 @@ package config
 
 import (
 	"log/slog"
+	"net"
+	"net/url"
 )
 
 type Config struct {
@@ -9,7 +11,55 @@ type Config struct {
 	FunctionName       string
 	FunctionInstanceID string
 
-	NATSURL     string
+	NATSURL string
+	// EmbeddedNATS runs NATS in the process, components reach it with NATSURL.
+	EmbeddedNATS         bool
+	EmbeddedNATSStoreDir string
+
 	LogLevel    slog.Level
 	FidfilePath string
+	Backend     string
+
+	// HealthCheckAddr is the address of the health check server, components started by the process
+	// backend share the host network, so each of them gets its own.
+	HealthCheckAddr string
+}
+
+// LoopbackNATSURL returns true if NATSURL points to the loopback interface.
+func (c *Config) LoopbackNATSURL() bool {
+	parsed, err := url.Parse(c.NATSURL)
+	if err != nil {
+		return false
+	}
+
+	host := parsed.Hostname()
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// ContainerNATSURL returns the NATS URL for components started in containers. The loopback interface
+// of a container is its own, so a loopback NATSURL is rewritten to point to hostGateway, the name the
+// host is reachable with from containers.
+func (c *Config) ContainerNATSURL(hostGateway string) string {
+	if !c.LoopbackNATSURL() {
+		return c.NATSURL
+	}
+
+	parsed, err := url.Parse(c.NATSURL)
+	if err != nil {
+		return c.NATSURL
+	}
+
+	if port := parsed.Port(); port != "" {
+		parsed.Host = net.JoinHostPort(hostGateway, port)
+	} else {
+		parsed.Host = hostGateway
+	}
+
+	return parsed.String()
 }
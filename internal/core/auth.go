@@ -0,0 +1,54 @@
+package core
+
+import (
+	"time"
+)
+
+type AuthType string
+
+const (
+	// AuthTypeNone allows anyone who can reach the gateway to invoke the function.
+	AuthTypeNone AuthType = ""
+	// AuthTypeAPIKey requires a key stored in APIKeysRepo in the X-Api-Key header.
+	AuthTypeAPIKey AuthType = "apiKey"
+	// AuthTypeJWT requires a bearer JWT signed with one of the JWKS keys.
+	AuthTypeJWT AuthType = "jwt"
+	// AuthTypeHMAC requires the body to be signed with the shared secret, like webhooks of GitHub do.
+	AuthTypeHMAC AuthType = "hmac"
+)
+
+// AuthConfig configures how the gateway authenticates invocations of the function.
+type AuthConfig struct {
+	Type AuthType
+
+	// JWKS is a JSON Web Key Set, JWTs must be signed with one of its keys and must not be expired.
+	// Issuer and Audience are checked when set.
+	JWKS     []byte
+	Issuer   string
+	Audience string
+
+	// HMACSecretEnv is the gateway's env variable with the secret which signs request bodies, the signature
+	// is sent in HMACHeader as "sha256=<hex>". Function definitions are stored in KV, so the secret is not.
+	HMACSecretEnv string
+	HMACHeader    string
+}
+
+// Principal is the authenticated caller, it's passed to the function as JSON in the X-Fid-Principal header.
+type Principal struct {
+	Type AuthType `json:"type"`
+	// ID is the API key's name or the JWT's subject, it's empty for HMAC signed requests.
+	ID     string         `json:"id,omitempty"`
+	Claims map[string]any `json:"claims,omitempty"`
+
+	// Quota of the API key, it's not passed to the function.
+	Quota Quota `json:"-"`
+}
+
+// APIKey is a record of an API key, keys themselves are not stored, only their hashes.
+type APIKey struct {
+	Name string `json:"name"`
+	// Functions the key can invoke, any function when empty.
+	Functions []string  `json:"functions,omitempty"`
+	Quota     Quota     `json:"quota,omitzero"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -6,11 +6,57 @@ import (
 
 const (
 	StreamNameInvocation = "INVOCATION" // used as INVOCATION:<function_name>
+	StreamNameDeadLetter = "DLQ"        // used as DLQ:<function_name>
+	StreamNameResponse   = "RESPONSE"   // used as RESPONSE:<function_name>
 
-	HeaderNameRequestID       = "Lambda-Runtime-Aws-Request-Id"
-	HeaderNameRequestDeadline = "Lambda-Runtime-Deadline-Ms"
+	HeaderNameRequestID          = "Lambda-Runtime-Aws-Request-Id"
+	HeaderNameRequestDeadline    = "Lambda-Runtime-Deadline-Ms"
+	HeaderNameInvokedFunctionArn = "Lambda-Runtime-Invoked-Function-Arn"
+	HeaderNameTraceID            = "Lambda-Runtime-Trace-Id"
+	HeaderNameClientContext      = "Lambda-Runtime-Client-Context"
+	HeaderNameCognitoIdentity    = "Lambda-Runtime-Cognito-Identity"
+	HeaderNameInvocationType     = "X-Fid-Invocation-Type"
+	HeaderNameInstanceID         = "X-Fid-Instance-Id"
+	HeaderNameErrorType          = "Lambda-Runtime-Function-Error-Type"
+	HeaderNameErrorBody          = "Lambda-Runtime-Function-Error-Body" // Trailer of streamed responses
+	HeaderNameResponseMode       = "Lambda-Runtime-Function-Response-Mode"
+	HeaderNameStreamEnd          = "X-Fid-Stream-End"
+	HeaderNameContentType        = "Content-Type"
+	HeaderNamePayloadRef         = "X-Fid-Payload-Ref" // Key of an offloaded payload in the blob store
+
+	// Gateway request headers, named after the AWS Lambda Invoke API.
+	HeaderNameAmznTraceID        = "X-Amzn-Trace-Id"
+	HeaderNameAmzClientContext   = "X-Amz-Client-Context" // base64 encoded JSON
+	HeaderNameAmzCognitoIdentity = "X-Amz-Cognito-Identity"
+
+	HeaderNameRetryAfter = "Retry-After"
+
+	// Gateway response headers.
+	HeaderNameFidRequestID     = "X-Fid-Request-Id"     // the invocation's request ID, set on every response
+	HeaderNameFidFunctionError = "X-Fid-Function-Error" // the function's error type, set when it failed
+
+	// Gateway authentication headers.
+	HeaderNameAuthorization   = "Authorization"
+	HeaderNameWWWAuthenticate = "WWW-Authenticate"
+	HeaderNameAPIKey          = "X-Api-Key"
+	HeaderNamePrincipal       = "X-Fid-Principal" // JSON, passed to the function as is
+	DefaultHMACHeader         = "X-Hub-Signature-256"
+
+	HeaderNameRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderNameRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderNameRateLimitReset     = "X-RateLimit-Reset" // seconds until the bucket is full
+
+	// AccountID is the fake AWS account ID used in ARNs and events for AWS Lambda runtimes which expect one.
+	AccountID = "000000000000"
+	// FunctionARNFormat is used to build ARNs for AWS Lambda runtimes which expect one.
+	FunctionARNFormat = "arn:aws:lambda:local:" + AccountID + ":function:%s"
+
+	InvocationTypeRequestResponse = "RequestResponse"
+	InvocationTypeEvent           = "Event"
 
 	LabelNameComponent = "wtf.zhulik.fid.component"
+	LabelNameFunction  = "wtf.zhulik.fid.function"
+	LabelNameInstance  = "wtf.zhulik.fid.instance"
 
 	ComponentNameRuntimeAPI               = "runtimeapi"
 	ComponentNameFunction                 = "function"
@@ -20,25 +66,137 @@ const (
 	ComponentNameGarbageCollector         = "garbage-collector"
 	ComponentNameFunctionGarbageCollector = "function-garbage-collector"
 
-	ContentTypeJSON = "application/json; charset=utf-8"
+	ResponseModeStreaming = "streaming"
+
+	ContentTypeJSON        = "application/json; charset=utf-8"
+	ContentTypeOctetStream = "application/octet-stream"
 
 	MaxTimeout = 15 * time.Minute
 
+	DefaultIdleTimeout = 5 * time.Minute
+	DefaultConcurrency = 1
+
+	DefaultRetryBackoff    = time.Second
+	DefaultMaxRetryBackoff = time.Minute
+
+	// InvocationTTL is how long results of asynchronous invocations are kept. Records of pending invocations
+	// must not expire while the invocations wait in the queue, so it matches the max age of invocation streams.
+	InvocationTTL = DefaultStreamMaxAge
+
+	// InstanceHeartbeatInterval is how often the runtime API reports that its instance is alive.
+	InstanceHeartbeatInterval = 10 * time.Second
+	// InstanceLeaseTTL is how long an instance is considered alive after its last heartbeat, instances
+	// which die without deregistering disappear after it.
+	InstanceLeaseTTL = 30 * time.Second
+
+	MaxRateLimitPeriod = 24 * time.Hour
+	QuotaCounterTTL    = 32 * 24 * time.Hour
+
+	// ThrottleRetryAfter is how long clients of throttled invocations are asked to wait before retrying.
+	ThrottleRetryAfter = time.Second
+
+	// MaxInlinePayloadSize is the maximum size of a payload sent within a message, bigger payloads are
+	// offloaded to the blob store. NATS limits messages to 1MB by default.
+	MaxInlinePayloadSize = 512 * 1024
+	// PayloadTTL is how long offloaded payloads are kept, it matches the max age of invocation streams.
+	PayloadTTL = 72 * time.Hour
+	// PayloadsMaxBytes limits the blob store, payloads are deleted once consumed, so it only fills up when
+	// invocations pile up in queues.
+	PayloadsMaxBytes = 1024 * 1024 * 1024 // 1GB
+
+	// Invocation streams limits unless the function configures them.
+	DefaultStreamMaxAge   = PayloadTTL
+	DefaultStreamMaxMsgs  = 1000
+	DefaultStreamMaxBytes = 10 * 1024 * 1024 // 10MB
+	DefaultStreamReplicas = 1
+
+	// Response streams hold responses and streamed chunks until invokers read them, so they are kept apart
+	// from invocation streams and never evict queued invocations. Nobody waits for a response longer than
+	// the max timeout.
+	ResponseStreamMaxAge   = MaxTimeout
+	ResponseStreamMaxBytes = 100 * 1024 * 1024 // 100MB
+
 	ImageNameFID = "ghcr.io/zhulik/fid"
 
 	EnvNameAWSLambdaRuntimeAPI   = "AWS_LAMBDA_RUNTIME_API"
+	EnvNameMaxConcurrency        = "AWS_LAMBDA_MAX_CONCURRENCY"
 	EnvNameFunctionName          = "FUNCTION_NAME"
 	EnvNameFunctionContainerName = "FUNCTION_CONTAINER_NAME"
 	EnvNameInstanceID            = "FUNCTION_INSTANCE_ID"
 	EnvNameNatsURL               = "NATS_URL"
+	EnvNameBackend               = "BACKEND"
+	EnvNameHTTPPort              = "HTTP_PORT"
+	EnvNameLogLevel              = "LOG_LEVEL"
+	EnvNameHealthCheckAddr       = "HEALTHCHECK_ADDR"
+
+	// DefaultHealthCheckAddr is where components serve their health check unless HEALTHCHECK_ADDR is set.
+	DefaultHealthCheckAddr = ":8081"
+
+	BackendNameDocker  = "docker"
+	BackendNameSwarm   = "swarm"
+	BackendNameProcess = "process"
+	BackendNamePodman  = "podman"
+
+	// Brokers hold streams and KV buckets. The memory broker keeps them in the process memory, components
+	// run in separate processes, so it's only selectable in tests, the CLI always uses NATS.
+	BrokerNameNATS   = "nats"
+	BrokerNameMemory = "memory"
+
+	// NetworkNameNATS is the network NATS is reachable in, it must be an attachable overlay network when
+	// the swarm backend is used.
+	NetworkNameNATS = "nats"
 
-	ContainerNameInfoServer = "info-server"
-	ContainerNameGateway    = "gateway"
+	// Containers reach the host with these names, docker resolves HostNameDockerHost only if the container
+	// is created with ExtraHostDockerHost, podman always resolves HostNamePodmanHost.
+	HostNameDockerHost  = "host.docker.internal"
+	HostNamePodmanHost  = "host.containers.internal"
+	ExtraHostDockerHost = HostNameDockerHost + ":host-gateway"
 
-	BucketNameFunctions = "fid-functions"
-	BucketNameInstances = "fid-instances"
+	ContainerNameInfoServer       = "info-server"
+	ContainerNameGateway          = "gateway"
+	ContainerNameGarbageCollector = "garbage-collector"
+
+	BucketNameFunctions   = "fid-functions"
+	BucketNameInstances   = "fid-instances"
+	BucketNameInvocations = "fid-invocations"
+	BucketNamePayloads    = "fid-payloads"
+	BucketNameConcurrency = "fid-concurrency"
+	BucketNameAPIKeys     = "fid-api-keys"
+	BucketNameRateLimits  = "fid-rate-limits"
+	BucketNameQuotas      = "fid-quotas"
 
 	FilenameFidfile = "Fidfile.yaml"
 
 	PortTCP80 = "80/tcp"
 )
+
+// Buckets are created or updated by every component which uses them, so their configs are shared.
+var (
+	BucketConfigInstances = BucketConfig{ //nolint:gochecknoglobals
+		Name:        BucketNameInstances,
+		AllowKeyTTL: true,
+	}
+
+	BucketConfigInvocations = BucketConfig{ //nolint:gochecknoglobals
+		Name: BucketNameInvocations,
+		TTL:  InvocationTTL,
+	}
+
+	BucketConfigConcurrency = BucketConfig{ //nolint:gochecknoglobals
+		Name:        BucketNameConcurrency,
+		AllowKeyTTL: true,
+	}
+
+	// Buckets of callers idle for a day are dropped, so they are full again. Rate limit periods are at
+	// most a day.
+	BucketConfigRateLimits = BucketConfig{ //nolint:gochecknoglobals
+		Name: BucketNameRateLimits,
+		TTL:  MaxRateLimitPeriod,
+	}
+
+	// Quota counters are kept by date, they only need to outlive a month.
+	BucketConfigQuotas = BucketConfig{ //nolint:gochecknoglobals
+		Name: BucketNameQuotas,
+		TTL:  QuotaCounterTTL,
+	}
+)
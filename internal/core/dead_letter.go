@@ -0,0 +1,20 @@
+package core
+
+import (
+	"time"
+)
+
+// DeadLetter is an asynchronous invocation which failed after all retries.
+type DeadLetter struct {
+	// ID is the sequence number of the dead letter in the function's dead-letter stream.
+	ID uint64 `json:"-"`
+
+	RequestID string             `json:"requestID"`
+	Payload   []byte             `json:"payload"`
+	Metadata  InvocationMetadata `json:"metadata"`
+
+	// Error is the error payload reported by the function on the last attempt.
+	Error    []byte    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failedAt"`
+}
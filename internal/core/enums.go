@@ -8,4 +8,18 @@ const (
 
 	// ResponseSubjectBase used as fid.response.<function_name>.<request_id>.response or fid.response.<request_id>.error.
 	ResponseSubjectBase SubjectName = "fid.response"
+
+	// ErrorSubjectBase used as fid.error.<function_name>.init.
+	ErrorSubjectBase SubjectName = "fid.error"
+
+	// DeadLetterSubjectBase used as fid.dlq.<function_name>.
+	DeadLetterSubjectBase SubjectName = "fid.dlq"
+)
+
+type InvocationStatus = string
+
+const (
+	InvocationStatusPending   InvocationStatus = "pending"
+	InvocationStatusSucceeded InvocationStatus = "succeeded"
+	InvocationStatusFailed    InvocationStatus = "failed"
 )
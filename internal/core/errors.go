@@ -2,6 +2,7 @@ package core
 
 import (
 	"errors"
+	"fmt"
 )
 
 var (
@@ -15,10 +16,60 @@ var (
 
 	ErrInstanceNotFound      = errors.New("function instance not found")
 	ErrInstanceAlreadyExists = errors.New("function instance already exists")
+	ErrInstanceLeaseExpired  = errors.New("function instance lease expired")
+
+	// Invocation errors.
+	ErrInvocationNotFound = errors.New("invocation not found")
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	ErrInvocationTimedOut = errors.New("invocation timed out")
+
+	// Throttling errors, all of them wrap ErrThrottled.
+	ErrThrottled                  = errors.New("invocation throttled")
+	ErrConcurrencyLimitExceeded   = fmt.Errorf("%w: function concurrency limit exceeded", ErrThrottled)
+	ErrConcurrencyBudgetExhausted = fmt.Errorf("%w: account concurrency budget exhausted", ErrThrottled)
+	ErrQueueFull                  = fmt.Errorf("%w: function queue is full", ErrThrottled)
+	ErrRateLimitExceeded          = fmt.Errorf("%w: rate limit exceeded", ErrThrottled)
+	ErrQuotaExceeded              = fmt.Errorf("%w: api key quota exceeded", ErrThrottled)
+
+	// Unavailability errors, all of them wrap ErrUnavailable.
+	ErrUnavailable    = errors.New("function unavailable")
+	ErrNoCapacity     = fmt.Errorf("%w: no instances picked up the invocation", ErrUnavailable)
+	ErrStreamNotFound = fmt.Errorf("%w: function stream not found", ErrUnavailable)
+	ErrBlobStoreFull  = fmt.Errorf("%w: payload store is full", ErrUnavailable)
+
+	// Authentication errors.
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrForbidden       = errors.New("forbidden")
+	ErrAPIKeyNotFound  = errors.New("api key not found")
+	ErrAPIKeyExists    = errors.New("api key already exists")
+
+	// PubSub errors.
+	ErrUnsafeStreamUpdate = errors.New("stream update would lose messages")
 
 	// KV errors.
 	ErrKeyNotFound    = errors.New("key not found")
 	ErrBucketNotFound = errors.New("bucket not found")
-	ErrBucketExists   = errors.New("bucket already exists")
 	ErrKeyExists      = errors.New("key already exists")
+	ErrWrongSequence  = errors.New("wrong key sequence")
+	ErrWatchStopped   = errors.New("watch stopped")
+	ErrKeyTTLDisabled = errors.New("key TTLs are not allowed in the bucket")
 )
+
+// FunctionError is an error reported by the function. Payload is what the function sent to the runtime API,
+// usually sdk.Error JSON.
+type FunctionError struct {
+	Type    string
+	Payload []byte
+}
+
+func (e *FunctionError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("%s: %s", ErrFunctionErrored, e.Payload)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", ErrFunctionErrored, e.Type, e.Payload)
+}
+
+func (e *FunctionError) Unwrap() error {
+	return ErrFunctionErrored
+}
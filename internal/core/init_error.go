@@ -0,0 +1,12 @@
+package core
+
+import (
+	"time"
+)
+
+// InitError is an error reported by a function instance which failed to initialize.
+type InitError struct {
+	InstanceID string    `json:"instanceID"`
+	Payload    []byte    `json:"payload"`
+	Timestamp  time.Time `json:"timestamp"`
+}
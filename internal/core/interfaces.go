@@ -12,6 +12,42 @@ import (
 type KVEntry struct {
 	Key   string
 	Value []byte
+	// Sequence is the key's last sequence, it's only set by GetEntry.
+	Sequence uint64
+}
+
+type KVEventType int
+
+const (
+	KVEventPut KVEventType = iota
+	KVEventDelete
+	// KVEventSynced is sent once all entries which existed when the watch started are delivered.
+	KVEventSynced
+)
+
+type KVEvent struct {
+	Type  KVEventType
+	Key   string
+	Value []byte
+}
+
+type StorageType string
+
+const (
+	StorageTypeFile   StorageType = "file"
+	StorageTypeMemory StorageType = "memory"
+)
+
+type BucketConfig struct {
+	Name     string
+	TTL      time.Duration // Entries expire after this duration, 0 means never
+	History  uint8         // Values kept per key, 0 means 1
+	MaxBytes int64         // Maximum size of the bucket, 0 means unlimited
+	Replicas int           // Copies of the bucket in a cluster, 0 means 1
+	Storage  StorageType   // Where entries are stored, file by default
+
+	// AllowKeyTTL enables per-key TTLs set with CreateWithTTL and PutWithTTL.
+	AllowKeyTTL bool
 }
 
 type PublishWaitResponseInput struct {
@@ -29,13 +65,20 @@ type ContainerBackend interface {
 	Register(ctx context.Context, function FunctionDefinition) error
 	Deregister(ctx context.Context, function FunctionDefinition) error
 
-	StartGateway(ctx context.Context) (string, error)
-	StartInfoServer(ctx context.Context) (string, error)
+	StartGateway(ctx context.Context, config ServiceConfig) (string, error)
+	StartInfoServer(ctx context.Context, config ServiceConfig) (string, error)
+	StartGarbageCollector(ctx context.Context) (string, error)
 
 	AddInstance(ctx context.Context, function FunctionDefinition) (string, error)
 	StopInstance(ctx context.Context, instanceID string) error
 }
 
+// GarbageCollector removes backend resources and instance records left behind by crashed or
+// deregistered function instances.
+type GarbageCollector interface {
+	Collect(ctx context.Context) error
+}
+
 type FunctionsRepo interface {
 	Upsert(ctx context.Context, function FunctionDefinition) error
 	Get(ctx context.Context, name string) (FunctionDefinition, error)
@@ -44,10 +87,25 @@ type FunctionsRepo interface {
 }
 
 type InstancesRepo interface {
+	// Add registers the instance with a lease which expires after InstanceLeaseTTL unless it's renewed
+	// with Heartbeat.
 	Add(ctx context.Context, function FunctionDefinition, id string) error
+	// Heartbeat records the instance's heartbeat and extends its lease, ErrInstanceLeaseExpired is returned
+	// if the lease has expired: the instance is considered dead and must stop.
+	Heartbeat(ctx context.Context, function FunctionDefinition, id string) error
 	SetLastExecuted(ctx context.Context, function FunctionDefinition, id string, timestamp time.Time) error
-	SetBusy(ctx context.Context, function FunctionDefinition, id string, busy bool) error
-	CountIdle(ctx context.Context, function FunctionDefinition) (int, error)
+	// SetInFlight records the amount of invocations the instance is handling at the moment.
+	SetInFlight(ctx context.Context, function FunctionDefinition, id string, inFlight int) error
+	// CountAvailable counts free invocation slots of alive instances.
+	CountAvailable(ctx context.Context, function FunctionDefinition) (int, error)
+
+	// SetInitError marks the instance as failed and remembers the error as the function's last init error.
+	SetInitError(ctx context.Context, function FunctionDefinition, id string, payload []byte) error
+	// LastInitError returns the function's last init error or nil if there was none.
+	LastInitError(ctx context.Context, function FunctionDefinition) (*InitError, error)
+	// SetUnhealthy marks the instance as failed, e.g. when an invocation timed out and the function's handler
+	// may still be hanging.
+	SetUnhealthy(ctx context.Context, function FunctionDefinition, id string) error
 
 	Get(ctx context.Context, function FunctionDefinition, id string) (FunctionInstance, error)
 	List(ctx context.Context, function FunctionDefinition) ([]FunctionInstance, error)
@@ -55,6 +113,17 @@ type InstancesRepo interface {
 	Count(ctx context.Context, function FunctionDefinition) (int, error)
 }
 
+// InstancesView is an in-memory view of the instances records. It's kept up to date by watching KV, so
+// reads are cheap, but lag behind the changes made with InstancesRepo. Dead instances are not listed.
+type InstancesView interface {
+	List(function FunctionDefinition) []FunctionInstance
+	Count(function FunctionDefinition) int
+	// CountAvailable counts free invocation slots of the listed instances.
+	CountAvailable(function FunctionDefinition) int
+	// LastInitError returns the function's last init error or nil if there was none.
+	LastInitError(function FunctionDefinition) *InitError
+}
+
 type FunctionDefinition interface {
 	fmt.Stringer
 
@@ -64,14 +133,28 @@ type FunctionDefinition interface {
 
 	Timeout() time.Duration
 	ScalingConfig() ScalingConfig
+	RetryConfig() RetryConfig
+	LimitsConfig() LimitsConfig
+	StreamConfig() StreamConfig
+	Routes() []Route
+	AuthConfig() AuthConfig
 
 	Env() map[string]string
 }
 
 type FunctionInstance interface {
 	ID() string
+	StartedAt() time.Time
 	LastExecuted() time.Time
-	Busy() bool
+	// LastHeartbeat is zero if the instance never reported a heartbeat, see IsAlive.
+	LastHeartbeat() time.Time
+	// InFlight is the amount of invocations the instance is handling, instances which never reported it
+	// are considered to have all their slots taken.
+	InFlight() int
+	// Failed is true if the instance reported an init error or was marked unhealthy.
+	Failed() bool
+	// InitFailed is true if the instance reported an init error.
+	InitFailed() bool
 	Function() FunctionDefinition
 }
 
@@ -87,16 +170,76 @@ type PubSuber interface {
 
 	Subscribe(ctx context.Context, streamName string, subjects []string, durableName string) (Subscription, error)
 
+	// Broadcast publishes the message to listeners without storing it in a stream.
+	Broadcast(ctx context.Context, msg *nats.Msg) error
+
+	// Listen observes messages published to the subject without consuming them from the stream.
+	Listen(ctx context.Context, subject string) (<-chan *nats.Msg, error)
+
+	// Pending returns the number of invocations waiting in the function's stream.
+	Pending(ctx context.Context, function FunctionDefinition) (int, error)
+
+	// CreateOrUpdateFunctionStream applies the function's StreamConfig to its invocation stream and creates
+	// its response and dead-letter streams. Updates which would drop stored messages fail with
+	// ErrUnsafeStreamUpdate.
 	CreateOrUpdateFunctionStream(ctx context.Context, function FunctionDefinition) error
 
 	FunctionStreamName(function FunctionDefinition) string
+	ResponseStreamName(function FunctionDefinition) string
 	InvokeSubjectName(function FunctionDefinition) string
 	ResponseSubjectName(function FunctionDefinition, requestID string) string
 	ErrorSubjectName(function FunctionDefinition, requestID string) string
+	InitErrorSubjectName(function FunctionDefinition) string
+	DeadLetterStreamName(function FunctionDefinition) string
+	DeadLetterSubjectName(function FunctionDefinition) string
+}
+
+// DeadLetterQueue holds asynchronous invocations which failed after all retries.
+type DeadLetterQueue interface {
+	Add(ctx context.Context, function FunctionDefinition, letter DeadLetter) error
+	List(ctx context.Context, function FunctionDefinition) ([]DeadLetter, error)
+	Get(ctx context.Context, function FunctionDefinition, id uint64) (DeadLetter, error)
+	Delete(ctx context.Context, function FunctionDefinition, id uint64) error
 }
 
 type Invoker interface {
-	Invoke(ctx context.Context, function FunctionDefinition, payload []byte) ([]byte, error)
+	Invoke(ctx context.Context, function FunctionDefinition, payload []byte, metadata InvocationMetadata) ([]byte, error) //nolint:lll
+
+	// InvokeStream invokes the function and returns its response as soon as it starts. Streamed responses are
+	// read chunk by chunk from the response's body, the body must be closed by the caller.
+	InvokeStream(ctx context.Context, function FunctionDefinition, payload []byte, metadata InvocationMetadata) (*InvocationResponse, error) //nolint:lll
+
+	// InvokeAsync enqueues an invocation and returns its request ID without waiting for the response.
+	// The result can be fetched from InvocationsRepo.
+	InvokeAsync(ctx context.Context, function FunctionDefinition, payload []byte, metadata InvocationMetadata) (string, error) //nolint:lll
+}
+
+// ConcurrencyLimiter keeps invocations within the functions' concurrency limits and the account-wide
+// concurrency budget shared by all functions.
+type ConcurrencyLimiter interface {
+	// Acquire takes a concurrency slot for the invocation, it's freed by calling release. When a limit is
+	// exceeded, an error wrapping ErrThrottled is returned.
+	Acquire(ctx context.Context, function FunctionDefinition, requestID string) (release func(), err error)
+	// SetBudget sets the account-wide concurrency budget, 0 means unlimited. Reserved is the sum of the
+	// reserved concurrency of all functions, it's not shared by other functions.
+	SetBudget(ctx context.Context, budget int, reserved int) error
+}
+
+type InvocationsRepo interface {
+	Create(ctx context.Context, invocation Invocation) error
+	Get(ctx context.Context, requestID string) (Invocation, error)
+
+	Succeed(ctx context.Context, requestID string, response []byte) error
+	Fail(ctx context.Context, requestID string, errorPayload []byte) error
+}
+
+// APIKeysRepo stores API keys used by the gateway to authenticate invocations.
+type APIKeysRepo interface {
+	// Create generates a new key for the record, names are unique. The key is only returned once, it cannot
+	// be retrieved later.
+	Create(ctx context.Context, record APIKey) (string, error)
+	Get(ctx context.Context, key string) (APIKey, error)
+	Delete(ctx context.Context, name string) error
 }
 
 type KVBucket interface {
@@ -115,14 +258,35 @@ type KVBucket interface {
 	All(ctx context.Context, filters ...string) ([]KVEntry, error)
 
 	Get(ctx context.Context, key string) ([]byte, error)
+	// GetEntry returns the value with its sequence, which can be passed to Update to change the key only if
+	// it was not changed concurrently.
+	GetEntry(ctx context.Context, key string) (KVEntry, error)
 	Create(ctx context.Context, key string, value []byte) (uint64, error)
 	Put(ctx context.Context, key string, value []byte) error
+	// CreateWithTTL and PutWithTTL store keys which expire after ttl, the bucket must allow key TTLs.
+	CreateWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) (uint64, error)
+	PutWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error
 	Update(ctx context.Context, key string, value []byte, seq uint64) (uint64, error)
 	Delete(ctx context.Context, key string) error
+
+	// Watch delivers the existing entries matching any of the filters as put events followed by a synced
+	// event, then delivers every following put and delete. Keys expired by their own TTL are reported as
+	// deleted, entries expired by the bucket's TTL are not reported.
+	// When an empty filters list is passed - watches all keys. The channel is closed when ctx is done.
+	Watch(ctx context.Context, filters ...string) (<-chan KVEvent, error)
+}
+
+// BlobStore stores payloads which are too big to be sent within messages.
+type BlobStore interface {
+	Put(ctx context.Context, data []byte) (string, error)
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
 }
 
 type KV interface {
+	// CreateBucket and CreateBucketWithConfig create a bucket or update the existing bucket's config.
 	CreateBucket(ctx context.Context, name string) (KVBucket, error)
+	CreateBucketWithConfig(ctx context.Context, config BucketConfig) (KVBucket, error)
 	Bucket(ctx context.Context, name string) (KVBucket, error)
 	DeleteBucket(ctx context.Context, name string) error
 }
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"io"
+	"time"
+)
+
+// Invocation is a record of an asynchronous invocation.
+type Invocation struct {
+	RequestID string           `json:"requestID"`
+	Function  string           `json:"function"`
+	Status    InvocationStatus `json:"status"`
+	// Caller is the identity of the authenticated caller, only the same caller can fetch the invocation.
+	Caller string `json:"caller,omitempty"`
+
+	// Response holds the function's response when succeeded or its error payload when failed.
+	Response []byte `json:"response,omitempty"`
+	// ResponseRef is the blob store key of the response when it's too big to be stored in the record.
+	ResponseRef string `json:"responseRef,omitempty"`
+
+	CreatedAt  time.Time `json:"createdAt"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+}
+
+// InvocationMetadata holds optional invocation context, it's passed to the function with Lambda runtime
+// API headers.
+type InvocationMetadata struct {
+	RequestID       string `json:"-"`                         // generated if empty
+	TraceID         string `json:"traceID,omitempty"`         // X-Ray trace header, generated if empty
+	ClientContext   string `json:"clientContext,omitempty"`   // JSON
+	CognitoIdentity string `json:"cognitoIdentity,omitempty"` // JSON
+	Principal       string `json:"principal,omitempty"`       // JSON, the caller authenticated by the gateway
+	Caller          string `json:"-"`                         // the principal's identity, empty if it has none
+}
+
+// InvocationResponse is a response of a synchronous invocation.
+type InvocationResponse struct {
+	// Streaming is true when the function streams its response.
+	Streaming   bool
+	ContentType string
+	// Body returns function errors which happen after streaming started.
+	Body io.ReadCloser
+}
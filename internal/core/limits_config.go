@@ -0,0 +1,17 @@
+package core
+
+// LimitsConfig configures how many invocations of a function are accepted, invocations over the limits are
+// throttled with ErrThrottled. Zero values mean no limit.
+type LimitsConfig struct {
+	// MaxConcurrency is the maximum amount of synchronous invocations in flight.
+	MaxConcurrency int
+	// ReservedConcurrency is the part of the account-wide concurrency budget which only this function may use.
+	ReservedConcurrency int
+	// MaxQueueLength is the maximum amount of invocations waiting to be picked up by an instance.
+	MaxQueueLength int
+
+	// RateLimit is shared by all callers of the function, CallerRateLimit applies to each caller separately.
+	// Callers are identified by their principals, anonymous ones by IP addresses.
+	RateLimit       RateLimit
+	CallerRateLimit RateLimit
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"time"
+)
+
+// RateLimit is a token bucket which holds up to Burst tokens and is refilled with Requests tokens per
+// Period, every invocation takes a token. Burst defaults to Requests, zero Requests means no limit.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+func (l RateLimit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+// Capacity returns the size of the bucket.
+func (l RateLimit) Capacity() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+
+	return l.Requests
+}
+
+// Quota limits how many invocations an API key makes per UTC day and month. Zero values mean no limit.
+type Quota struct {
+	Daily   int `json:"daily,omitempty"`
+	Monthly int `json:"monthly,omitempty"`
+}
+
+// RateLimitStatus describes the most restrictive rate limit applied to an invocation, the gateway reports it
+// in X-RateLimit-* headers.
+type RateLimitStatus struct {
+	Limit     int
+	Remaining int
+	// Reset is how long it takes to refill the bucket.
+	Reset time.Duration
+	// RetryAfter is how long throttled clients should wait before retrying.
+	RetryAfter time.Duration
+}
@@ -0,0 +1,30 @@
+package core
+
+import (
+	"time"
+)
+
+// RetryConfig configures redelivery of failed asynchronous invocations.
+type RetryConfig struct {
+	// Retries is how many times a failed invocation is retried before it's moved to the dead-letter queue.
+	Retries int
+
+	// Backoff is the delay before the first retry, it doubles with every next retry up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Delay returns the delay before the given retry, retries are counted from 1.
+func (c RetryConfig) Delay(retry int) time.Duration {
+	delay := c.Backoff
+
+	for range retry - 1 {
+		if delay >= c.MaxBackoff {
+			break
+		}
+
+		delay *= 2
+	}
+
+	return min(delay, c.MaxBackoff)
+}
@@ -0,0 +1,19 @@
+package core
+
+// RouteMethodAny matches requests with any HTTP method.
+const RouteMethodAny = "ANY"
+
+// Route exposes the function over HTTP, the gateway translates matching requests into API Gateway HTTP API
+// v2 events.
+type Route struct {
+	// Method is an HTTP method or RouteMethodAny.
+	Method string
+	// Path may contain "{name}" segments which match a single segment and a trailing "{name+}" segment which
+	// matches the rest of the path.
+	Path string
+}
+
+// Key returns the route key in the API Gateway format: "<method> <path>".
+func (r Route) Key() string {
+	return r.Method + " " + r.Path
+}
@@ -1,6 +1,17 @@
 package core
 
+import (
+	"time"
+)
+
 type ScalingConfig struct {
 	Min int
 	Max int
+
+	// Concurrency is how many invocations a single instance handles at once, it's at least 1.
+	Concurrency int
+
+	// IdleTimeout is how long an instance may stay idle before it's stopped. Instances are never stopped
+	// below Min.
+	IdleTimeout time.Duration
 }
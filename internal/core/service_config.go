@@ -0,0 +1,11 @@
+package core
+
+// ServiceConfig configures a FID service like the gateway or the info server.
+type ServiceConfig struct {
+	// Port is the host port the service is published on, the service is not published if 0.
+	Port int
+	// Instances is the number of service replicas, only supported by the swarm backend.
+	Instances int
+	// Env is added to the service's environment, the gateway gets HMAC secrets of functions with it.
+	Env map[string]string
+}
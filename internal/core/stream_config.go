@@ -0,0 +1,28 @@
+package core
+
+import (
+	"time"
+)
+
+type DiscardPolicy string
+
+const (
+	// DiscardOld drops the oldest messages to make room for new ones.
+	DiscardOld DiscardPolicy = "old"
+	// DiscardNew rejects new messages with ErrQueueFull once the stream is full.
+	DiscardNew DiscardPolicy = "new"
+)
+
+// StreamConfig configures the function's invocation stream, which also holds responses. The dead-letter
+// stream uses the same storage and replicas.
+type StreamConfig struct {
+	Storage StorageType
+	// Replicas is the number of copies of the stream in a cluster.
+	Replicas int
+
+	// Invocations are dropped after MaxAge or according to Discard when MaxMsgs or MaxBytes is reached.
+	MaxAge   time.Duration
+	MaxMsgs  int
+	MaxBytes int64
+	Discard  DiscardPolicy
+}
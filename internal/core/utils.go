@@ -2,6 +2,9 @@ package core
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func MapToEnvList(maps ...map[string]string) []string {
@@ -15,3 +18,47 @@ func MapToEnvList(maps ...map[string]string) []string {
 
 	return envList
 }
+
+// RuntimeEnv returns the env variables which tell the function's runtime where the runtime API is and how
+// many invocations it may poll for at once.
+func RuntimeEnv(function FunctionDefinition, runtimeAPIAddr string) map[string]string {
+	return map[string]string{
+		EnvNameAWSLambdaRuntimeAPI: runtimeAPIAddr,
+		EnvNameMaxConcurrency:      strconv.Itoa(function.ScalingConfig().Concurrency),
+	}
+}
+
+// IsAlive reports whether the instance's last heartbeat is within InstanceLeaseTTL, instances which are
+// not alive are considered dead even if their records still exist.
+func IsAlive(instance FunctionInstance) bool {
+	return time.Since(instance.LastHeartbeat()) <= InstanceLeaseTTL
+}
+
+// AvailableSlots returns how many more invocations the instance can take according to its function's
+// concurrency.
+func AvailableSlots(instance FunctionInstance) int {
+	return max(instance.Function().ScalingConfig().Concurrency-instance.InFlight(), 0)
+}
+
+func FunctionARN(function FunctionDefinition) string {
+	return fmt.Sprintf(FunctionARNFormat, function.Name())
+}
+
+// SubjectMatches reports whether the dot-separated subject matches the filter. Like in NATS, "*" in
+// the filter matches a single token and a trailing ">" matches one or more tokens.
+func SubjectMatches(filter, subject string) bool {
+	filterTokens := strings.Split(filter, ".")
+	subjectTokens := strings.Split(subject, ".")
+
+	for i, token := range filterTokens {
+		if token == ">" && i == len(filterTokens)-1 {
+			return len(subjectTokens) > i
+		}
+
+		if i >= len(subjectTokens) || (token != "*" && token != subjectTokens[i]) {
+			return false
+		}
+	}
+
+	return len(filterTokens) == len(subjectTokens)
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/zhulik/fid/internal/backends"
 	"github.com/zhulik/fid/internal/config"
+	"github.com/zhulik/fid/internal/core"
 	"github.com/zhulik/fid/internal/httpserver"
 	"github.com/zhulik/fid/internal/invocation"
 	"github.com/zhulik/fid/internal/kv"
@@ -22,19 +23,23 @@ const (
 func Run(ctx context.Context, cfg *config.Config, services ...pal.ServiceDef) error {
 	services = append(services,
 		pal.Provide(cfg),
-		pubsub.Provide(),
-		kv.Provide(),
+		pubsub.Provide(core.BrokerNameNATS),
+		kv.Provide(core.BrokerNameNATS),
 		invocation.Provide(),
-		backends.Provide(),
+		backends.Provide(cfg.Backend),
 		httpserver.Provide(),
 	)
 
+	if cfg.EmbeddedNATS {
+		services = append(services, pubsub.ProvideEmbeddedNATS())
+	}
+
 	p := pal.New(services...).
 		InjectSlog().
 		InitTimeout(initTimeout).
 		HealthCheckTimeout(healthCheckTimeout).
 		ShutdownTimeout(shutdownTimeout).
-		RunHealthCheckServer(":8081", "/health")
+		RunHealthCheckServer(cfg.HealthCheckAddr, "/health")
 
 	return p.Run(ctx) //nolint:wrapcheck
 }
@@ -4,13 +4,17 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/goccy/go-yaml"
+	"github.com/zhulik/fid/internal/core"
 )
 
 var (
 	ErrValidationFailed = errors.New("functions file validation failed")
+	ErrReservedTooHigh  = errors.New("reserved concurrency exceeds the limit")
+	ErrHMACSecretNotSet = errors.New("HMAC secret env variable is not set")
 	validate            = validator.New() //nolint:gochecknoglobals
 )
 
@@ -19,15 +23,50 @@ type ServiceConfig struct {
 	Instances int `yaml:"instances"`
 }
 
+// Config returns the backend service config, a missing service is not published.
+func (c *ServiceConfig) Config() core.ServiceConfig {
+	if c == nil {
+		return core.ServiceConfig{}
+	}
+
+	return core.ServiceConfig{
+		Port:      c.Port,
+		Instances: c.Instances,
+	}
+}
+
 type Fidfile struct {
-	Version   int                  `validate:"required,eq=1"               yaml:"version"`
-	Backend   string               `validate:"required,oneof=docker swarm" yaml:"backend"`
-	Functions map[string]*Function `validate:"required,dive"               yaml:"functions"`
+	Version   int                  `validate:"required,eq=1"                              yaml:"version"`
+	Backend   string               `validate:"required,oneof=docker swarm podman process" yaml:"backend"`
+	Functions map[string]*Function `validate:"required,dive"                              yaml:"functions"`
+
+	// MaxConcurrency is the account-wide budget of synchronous invocations in flight shared by all functions.
+	MaxConcurrency int `validate:"gte=0" yaml:"maxConcurrency"`
 
 	Gateway    *ServiceConfig `yaml:"gateway"`
 	InfoServer *ServiceConfig `yaml:"infoserver"`
 }
 
+// GatewayConfig returns the gateway's service config, its environment holds HMAC secrets of the functions,
+// so the gateway can verify signatures.
+func (f *Fidfile) GatewayConfig() core.ServiceConfig {
+	config := f.Gateway.Config()
+
+	for _, function := range f.Functions {
+		if function.Auth == nil || function.Auth.secret == "" {
+			continue
+		}
+
+		if config.Env == nil {
+			config.Env = map[string]string{}
+		}
+
+		config.Env[function.Auth.SecretEnv] = function.Auth.secret
+	}
+
+	return config
+}
+
 // TODO: add proper support for versioning
 
 func ParseFile(path string) (*Fidfile, error) {
@@ -41,6 +80,17 @@ func ParseFile(path string) (*Fidfile, error) {
 		return nil, fmt.Errorf("failed to parse fidfile %s: %w", path, err)
 	}
 
+	for name, function := range config.Functions {
+		if function.Auth == nil {
+			continue
+		}
+
+		err = function.Auth.load(filepath.Dir(path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load auth of function %s: %w", name, err)
+		}
+	}
+
 	return config, nil
 }
 
@@ -61,5 +111,32 @@ func Parse(data []byte) (*Fidfile, error) {
 		return nil, fmt.Errorf("%w: %w", ErrValidationFailed, err)
 	}
 
+	err = validateReservedConcurrency(functionsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrValidationFailed, err)
+	}
+
 	return &functionsConfig, nil
 }
+
+// validateReservedConcurrency checks that functions do not reserve more than they are allowed to use and that
+// the reservations fit into the account-wide budget.
+func validateReservedConcurrency(fidfile Fidfile) error {
+	reserved := 0
+
+	for name, function := range fidfile.Functions {
+		if function.MaxConcurrency > 0 && function.ReservedConcurrency > function.MaxConcurrency {
+			return fmt.Errorf("%w: function %s reserves %d, its max concurrency is %d",
+				ErrReservedTooHigh, name, function.ReservedConcurrency, function.MaxConcurrency)
+		}
+
+		reserved += function.ReservedConcurrency
+	}
+
+	if fidfile.MaxConcurrency > 0 && reserved > fidfile.MaxConcurrency {
+		return fmt.Errorf("%w: functions reserve %d, the max concurrency is %d",
+			ErrReservedTooHigh, reserved, fidfile.MaxConcurrency)
+	}
+
+	return nil
+}
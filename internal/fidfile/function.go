@@ -1,18 +1,89 @@
 package fidfile
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/samber/lo"
 	"github.com/zhulik/fid/internal/core"
 )
 
 type Function struct {
-	Name_    string            `validate:"required"           yaml:"-"`
-	Image_   string            `validate:"required"           yaml:"image"`
-	Env_     map[string]string `yaml:"env"`
-	Min      int               `validate:"gte=0,ltefield=Max" yaml:"min"`
-	Max      int               `validate:"gte=0,gtefield=Min" yaml:"max"`
-	Timeout_ time.Duration     `validate:"required,gte=1s"    yaml:"timeout"`
+	Name_           string            `validate:"required"           yaml:"-"`
+	Image_          string            `validate:"required"           yaml:"image"`
+	Env_            map[string]string `yaml:"env"`
+	Min             int               `validate:"gte=0,ltefield=Max" yaml:"min"`
+	Max             int               `validate:"gte=0,gtefield=Min" yaml:"max"`
+	Concurrency     int               `validate:"gte=0"              yaml:"concurrency"`
+	Timeout_        time.Duration     `validate:"required,gte=1s"    yaml:"timeout"`
+	IdleTimeout     time.Duration     `validate:"omitempty,gte=1s"   yaml:"idleTimeout"`
+	Retries         int               `validate:"gte=0"              yaml:"retries"`
+	RetryBackoff    time.Duration     `validate:"omitempty,gte=1ms"  yaml:"retryBackoff"`
+	MaxRetryBackoff time.Duration     `validate:"omitempty,gte=1ms"  yaml:"maxRetryBackoff"`
+
+	MaxConcurrency      int `validate:"gte=0" yaml:"maxConcurrency"`
+	ReservedConcurrency int `validate:"gte=0" yaml:"reservedConcurrency"`
+	MaxQueueLength      int `validate:"gte=0" yaml:"maxQueueLength"`
+
+	RateLimit       *RateLimit `yaml:"rateLimit"`
+	CallerRateLimit *RateLimit `yaml:"callerRateLimit"`
+
+	Stream  *Stream `yaml:"stream"`
+	Routes_ []Route `validate:"dive" yaml:"routes"`
+	Auth    *Auth   `yaml:"auth"`
+}
+
+// Auth configures how the gateway authenticates invocations, see core.AuthConfig. The JWKS file and the HMAC
+// secret are loaded when the Fidfile is parsed, so the gateway does not need access to them. The secret is
+// passed to the gateway in the same env variable, see Fidfile.GatewayConfig. Relative JWKS paths are resolved
+// against the Fidfile's directory.
+type Auth struct {
+	Type      string `validate:"required,oneof=apiKey jwt hmac" yaml:"type"`
+	JWKS      string `validate:"required_if=Type jwt"           yaml:"jwks"`
+	Issuer    string `yaml:"issuer"`
+	Audience  string `yaml:"audience"`
+	SecretEnv string `validate:"required_if=Type hmac"          yaml:"secretEnv"`
+	Header    string `yaml:"header"`
+
+	jwks   []byte
+	secret string
+}
+
+// RateLimit is a token bucket, see core.RateLimit.
+type RateLimit struct {
+	Requests int           `validate:"required,gt=0"            yaml:"requests"`
+	Period   time.Duration `validate:"required,gte=1ms,lte=24h" yaml:"period"`
+	Burst    int           `validate:"gte=0"                    yaml:"burst"`
+}
+
+func (r *RateLimit) config() core.RateLimit {
+	if r == nil {
+		return core.RateLimit{}
+	}
+
+	return core.RateLimit{
+		Requests: r.Requests,
+		Period:   r.Period,
+		Burst:    r.Burst,
+	}
+}
+
+// Route exposes the function over HTTP, see core.Route.
+type Route struct {
+	Method string `validate:"required,oneof=ANY GET POST PUT PATCH DELETE HEAD OPTIONS" yaml:"method"`
+	Path   string `validate:"required,startswith=/"                                  yaml:"path"`
+}
+
+// Stream configures the function's queue, missing values are set to defaults.
+type Stream struct {
+	Storage  string        `validate:"omitempty,oneof=file memory" yaml:"storage"`
+	Replicas int           `validate:"gte=0,lte=5"                 yaml:"replicas"`
+	MaxAge   time.Duration `validate:"omitempty,gte=1s,lte=72h"    yaml:"maxAge"`
+	MaxMsgs  int           `validate:"gte=0"                       yaml:"maxMsgs"`
+	MaxBytes int64         `validate:"gte=0"                       yaml:"maxBytes"`
+	Discard  string        `validate:"omitempty,oneof=old new"     yaml:"discard"`
 }
 
 func (f Function) Name() string {
@@ -32,10 +103,112 @@ func (f Function) Timeout() time.Duration {
 }
 
 func (f Function) ScalingConfig() core.ScalingConfig {
+	idleTimeout := f.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = core.DefaultIdleTimeout
+	}
+
+	concurrency := f.Concurrency
+	if concurrency == 0 {
+		concurrency = core.DefaultConcurrency
+	}
+
 	return core.ScalingConfig{
-		Min: f.Min,
-		Max: f.Max,
+		Min:         f.Min,
+		Max:         f.Max,
+		Concurrency: concurrency,
+		IdleTimeout: idleTimeout,
+	}
+}
+
+func (f Function) RetryConfig() core.RetryConfig {
+	backoff := f.RetryBackoff
+	if backoff == 0 {
+		backoff = core.DefaultRetryBackoff
 	}
+
+	maxBackoff := f.MaxRetryBackoff
+	if maxBackoff == 0 {
+		maxBackoff = core.DefaultMaxRetryBackoff
+	}
+
+	return core.RetryConfig{
+		Retries:    f.Retries,
+		Backoff:    backoff,
+		MaxBackoff: maxBackoff,
+	}
+}
+
+func (f Function) LimitsConfig() core.LimitsConfig {
+	return core.LimitsConfig{
+		MaxConcurrency:      f.MaxConcurrency,
+		ReservedConcurrency: f.ReservedConcurrency,
+		MaxQueueLength:      f.MaxQueueLength,
+		RateLimit:           f.RateLimit.config(),
+		CallerRateLimit:     f.CallerRateLimit.config(),
+	}
+}
+
+func (f Function) StreamConfig() core.StreamConfig {
+	stream := lo.FromPtr(f.Stream)
+
+	return core.StreamConfig{
+		Storage:  core.StorageType(lo.CoalesceOrEmpty(stream.Storage, string(core.StorageTypeFile))),
+		Replicas: lo.CoalesceOrEmpty(stream.Replicas, core.DefaultStreamReplicas),
+		MaxAge:   lo.CoalesceOrEmpty(stream.MaxAge, core.DefaultStreamMaxAge),
+		MaxMsgs:  lo.CoalesceOrEmpty(stream.MaxMsgs, core.DefaultStreamMaxMsgs),
+		MaxBytes: lo.CoalesceOrEmpty(stream.MaxBytes, core.DefaultStreamMaxBytes),
+		Discard:  core.DiscardPolicy(lo.CoalesceOrEmpty(stream.Discard, string(core.DiscardOld))),
+	}
+}
+
+func (f Function) Routes() []core.Route {
+	return lo.Map(f.Routes_, func(route Route, _ int) core.Route {
+		return core.Route{Method: route.Method, Path: route.Path}
+	})
+}
+
+func (f Function) AuthConfig() core.AuthConfig {
+	if f.Auth == nil {
+		return core.AuthConfig{}
+	}
+
+	return core.AuthConfig{
+		Type:          core.AuthType(f.Auth.Type),
+		JWKS:          f.Auth.jwks,
+		Issuer:        f.Auth.Issuer,
+		Audience:      f.Auth.Audience,
+		HMACSecretEnv: f.Auth.SecretEnv,
+		HMACHeader:    lo.CoalesceOrEmpty(f.Auth.Header, core.DefaultHMACHeader),
+	}
+}
+
+// load reads the JWKS file and the HMAC secret.
+func (a *Auth) load(dir string) error {
+	switch core.AuthType(a.Type) {
+	case core.AuthTypeJWT:
+		path := a.JWKS
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		jwks, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read JWKS file: %w", err)
+		}
+
+		a.jwks = jwks
+	case core.AuthTypeHMAC:
+		secret := os.Getenv(a.SecretEnv)
+		if secret == "" {
+			return fmt.Errorf("%w: %s", ErrHMACSecretNotSet, a.SecretEnv)
+		}
+
+		a.secret = secret
+	case core.AuthTypeNone, core.AuthTypeAPIKey:
+	}
+
+	return nil
 }
 
 func (f Function) Env() map[string]string {
@@ -0,0 +1,36 @@
+package garbagecollector
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/zhulik/fid/internal/core"
+)
+
+const collectInterval = 30 * time.Second
+
+type Collector struct {
+	Logger           *slog.Logger
+	GarbageCollector core.GarbageCollector
+}
+
+// Run periodically collects garbage until ctx is done. Collection errors are logged, but do not stop
+// the collector.
+func (c Collector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(collectInterval)
+	defer ticker.Stop()
+
+	for {
+		err := c.GarbageCollector.Collect(ctx)
+		if err != nil {
+			c.Logger.Error("Failed to collect garbage", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package garbagecollector
+
+import (
+	"github.com/zhulik/pal"
+)
+
+func Provide() pal.ServiceDef {
+	return pal.ProvideList(
+		pal.Provide(&Collector{}),
+	)
+}
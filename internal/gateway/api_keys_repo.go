@@ -0,0 +1,129 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/pkg/json"
+)
+
+// apiKeyPrefix makes keys recognizable, e.g. by secret scanners.
+const apiKeyPrefix = "fid_"
+
+const apiKeySize = 32
+
+// APIKeysRepo is core.APIKeysRepo which stores API key records in KV under SHA-256 hashes of the keys, so
+// leaked buckets do not leak keys.
+type APIKeysRepo struct { //nolint:recvcheck
+	Logger *slog.Logger
+	KV     core.KV
+
+	bucket core.KVBucket
+}
+
+func (r *APIKeysRepo) Init(ctx context.Context) error {
+	bucket, err := r.KV.CreateBucket(ctx, core.BucketNameAPIKeys)
+	if err != nil {
+		return fmt.Errorf("failed to create api keys bucket: %w", err)
+	}
+
+	r.bucket = bucket
+
+	return nil
+}
+
+func (r APIKeysRepo) Create(ctx context.Context, record core.APIKey) (string, error) {
+	_, err := r.find(ctx, record.Name)
+	if err == nil {
+		return "", fmt.Errorf("%w: %s", core.ErrAPIKeyExists, record.Name)
+	}
+
+	if !errors.Is(err, core.ErrAPIKeyNotFound) {
+		return "", err
+	}
+
+	random := make([]byte, apiKeySize)
+	rand.Read(random) //nolint:errcheck
+
+	key := apiKeyPrefix + hex.EncodeToString(random)
+
+	record.CreatedAt = time.Now()
+
+	bytes, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal api key: %w", err)
+	}
+
+	_, err = r.bucket.Create(ctx, hashAPIKey(key), bytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to store api key: %w", err)
+	}
+
+	return key, nil
+}
+
+func (r APIKeysRepo) Get(ctx context.Context, key string) (core.APIKey, error) {
+	bytes, err := r.bucket.Get(ctx, hashAPIKey(key))
+	if err != nil {
+		if errors.Is(err, core.ErrKeyNotFound) {
+			return core.APIKey{}, core.ErrAPIKeyNotFound
+		}
+
+		return core.APIKey{}, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	record, err := json.Unmarshal[core.APIKey](bytes)
+	if err != nil {
+		return core.APIKey{}, fmt.Errorf("failed to unmarshal api key: %w", err)
+	}
+
+	return record, nil
+}
+
+func (r APIKeysRepo) Delete(ctx context.Context, name string) error {
+	hash, err := r.find(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	err = r.bucket.Delete(ctx, hash)
+	if err != nil {
+		return fmt.Errorf("failed to delete api key: %w", err)
+	}
+
+	return nil
+}
+
+// find returns the hash of the key with the name. Keys are looked up by hashes, so names require a scan.
+func (r APIKeysRepo) find(ctx context.Context, name string) (string, error) {
+	entries, err := r.bucket.All(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list api keys: %w", err)
+	}
+
+	for _, entry := range entries {
+		record, err := json.Unmarshal[core.APIKey](entry.Value)
+		if err != nil {
+			return "", fmt.Errorf("failed to unmarshal api key: %w", err)
+		}
+
+		if record.Name == name {
+			return entry.Key, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", core.ErrAPIKeyNotFound, name)
+}
+
+func hashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(hash[:])
+}
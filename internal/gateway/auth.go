@@ -0,0 +1,173 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhulik/fid/internal/core"
+)
+
+const hmacSignaturePrefix = "sha256="
+
+var ErrHMACSecretNotSet = errors.New("HMAC secret env variable is not set")
+
+// Authenticator authenticates invocations according to functions' auth configs.
+type Authenticator struct {
+	Logger      *slog.Logger
+	APIKeysRepo core.APIKeysRepo
+
+	mu sync.Mutex
+	// keySets holds parsed JWKS by function name, they are parsed again when the function's JWKS changes.
+	keySets map[string]*jwtKeySet
+}
+
+// Authenticate returns the caller of the function, nil when the function does not require authentication.
+// Errors wrap core.ErrUnauthenticated when credentials are missing or invalid and core.ErrForbidden when
+// the caller is not allowed to invoke the function. Bodies of HMAC signed requests are read and replaced.
+func (a *Authenticator) Authenticate(
+	ctx context.Context,
+	request *http.Request,
+	function core.FunctionDefinition,
+) (*core.Principal, error) {
+	config := function.AuthConfig()
+
+	switch config.Type {
+	case core.AuthTypeAPIKey:
+		return a.authenticateAPIKey(ctx, request, function)
+	case core.AuthTypeJWT:
+		return a.authenticateJWT(request, function)
+	case core.AuthTypeHMAC:
+		return authenticateHMAC(request, config)
+	case core.AuthTypeNone:
+		return nil, nil //nolint:nilnil
+	default:
+		return nil, fmt.Errorf("%w: unknown auth type %q", core.ErrUnauthenticated, config.Type)
+	}
+}
+
+func (a *Authenticator) authenticateAPIKey(
+	ctx context.Context,
+	request *http.Request,
+	function core.FunctionDefinition,
+) (*core.Principal, error) {
+	key := request.Header.Get(core.HeaderNameAPIKey)
+	if key == "" {
+		return nil, fmt.Errorf("%w: %s header is missing", core.ErrUnauthenticated, core.HeaderNameAPIKey)
+	}
+
+	record, err := a.APIKeysRepo.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, core.ErrAPIKeyNotFound) {
+			return nil, fmt.Errorf("%w: invalid api key", core.ErrUnauthenticated)
+		}
+
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	if len(record.Functions) > 0 && !slices.Contains(record.Functions, function.Name()) {
+		return nil, fmt.Errorf("%w: api key %s cannot invoke %s", core.ErrForbidden, record.Name, function.Name())
+	}
+
+	return &core.Principal{Type: core.AuthTypeAPIKey, ID: record.Name, Quota: record.Quota}, nil
+}
+
+func (a *Authenticator) authenticateJWT(
+	request *http.Request,
+	function core.FunctionDefinition,
+) (*core.Principal, error) {
+	token, ok := strings.CutPrefix(request.Header.Get(core.HeaderNameAuthorization), "Bearer ")
+	if !ok {
+		return nil, fmt.Errorf("%w: bearer token is missing", core.ErrUnauthenticated)
+	}
+
+	keySet, err := a.keySet(function)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := verifyJWT(token, keySet, function.AuthConfig(), time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", core.ErrUnauthenticated, err)
+	}
+
+	subject, _ := claims["sub"].(string)
+
+	return &core.Principal{Type: core.AuthTypeJWT, ID: subject, Claims: claims}, nil
+}
+
+// keySet returns the function's parsed JWKS, it's parsed once per function definition. Malformed keys are
+// skipped and logged, tokens signed with other keys are still accepted.
+func (a *Authenticator) keySet(function core.FunctionDefinition) (*jwtKeySet, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	jwks := function.AuthConfig().JWKS
+
+	keySet, ok := a.keySets[function.Name()]
+	if ok && bytes.Equal(keySet.jwks, jwks) {
+		return keySet, nil
+	}
+
+	keySet, skipped, err := parseJWKS(jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, err := range skipped {
+		a.Logger.Warn("Skipping malformed JWKS key", "function", function.Name(), "error", err)
+	}
+
+	if a.keySets == nil {
+		a.keySets = map[string]*jwtKeySet{}
+	}
+
+	a.keySets[function.Name()] = keySet
+
+	return keySet, nil
+}
+
+func authenticateHMAC(request *http.Request, config core.AuthConfig) (*core.Principal, error) {
+	secret := os.Getenv(config.HMACSecretEnv)
+	if secret == "" {
+		return nil, fmt.Errorf("%w: %s", ErrHMACSecretNotSet, config.HMACSecretEnv)
+	}
+
+	signature, ok := strings.CutPrefix(request.Header.Get(config.HMACHeader), hmacSignaturePrefix)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s header is missing", core.ErrUnauthenticated, config.HMACHeader)
+	}
+
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", core.ErrUnauthenticated)
+	}
+
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+
+	request.Body = io.NopCloser(bytes.NewReader(body))
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return nil, fmt.Errorf("%w: signature mismatch", core.ErrUnauthenticated)
+	}
+
+	return &core.Principal{Type: core.AuthTypeHMAC}, nil
+}
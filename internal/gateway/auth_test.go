@@ -0,0 +1,286 @@
+package gateway_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/gateway"
+	"github.com/zhulik/fid/testhelpers"
+	"github.com/zhulik/pal"
+)
+
+var _ = Describe("Authenticator", Serial, func() {
+	var authenticator *gateway.Authenticator
+	var apiKeysRepo core.APIKeysRepo
+
+	BeforeEach(func(ctx SpecContext) {
+		p := testhelpers.NewMemoryPal(ctx,
+			pal.Provide[core.APIKeysRepo](&gateway.APIKeysRepo{}),
+			pal.Provide(&gateway.Authenticator{}),
+		)
+
+		authenticator = lo.Must(pal.Invoke[*gateway.Authenticator](ctx, p))
+		apiKeysRepo = lo.Must(pal.Invoke[core.APIKeysRepo](ctx, p))
+	})
+
+	Context("when the function does not require auth", func() {
+		It("returns no principal", func(ctx SpecContext) {
+			request := httptest.NewRequest(http.MethodPost, "/", nil)
+
+			Expect(authenticator.Authenticate(ctx, request, docker.Function{Name_: "public"})).To(BeNil())
+		})
+	})
+
+	Describe("API keys", func() {
+		function := docker.Function{Name_: "test", Auth: core.AuthConfig{Type: core.AuthTypeAPIKey}}
+
+		It("authenticates requests with a valid key", func(ctx SpecContext) {
+			key := lo.Must(apiKeysRepo.Create(ctx, core.APIKey{Name: "client"}))
+
+			request := httptest.NewRequest(http.MethodPost, "/", nil)
+			request.Header.Set(core.HeaderNameAPIKey, key)
+
+			principal := lo.Must(authenticator.Authenticate(ctx, request, function))
+			Expect(principal).To(Equal(&core.Principal{Type: core.AuthTypeAPIKey, ID: "client"}))
+		})
+
+		It("rejects unknown and revoked keys", func(ctx SpecContext) {
+			key := lo.Must(apiKeysRepo.Create(ctx, core.APIKey{Name: "revoked"}))
+			lo.Must0(apiKeysRepo.Delete(ctx, "revoked"))
+
+			request := httptest.NewRequest(http.MethodPost, "/", nil)
+			request.Header.Set(core.HeaderNameAPIKey, key)
+
+			_, err := authenticator.Authenticate(ctx, request, function)
+			Expect(err).To(MatchError(core.ErrUnauthenticated))
+		})
+
+		It("forbids keys which are not allowed to invoke the function", func(ctx SpecContext) {
+			key := lo.Must(apiKeysRepo.Create(ctx, core.APIKey{Name: "other", Functions: []string{"other"}}))
+
+			request := httptest.NewRequest(http.MethodPost, "/", nil)
+			request.Header.Set(core.HeaderNameAPIKey, key)
+
+			_, err := authenticator.Authenticate(ctx, request, function)
+			Expect(err).To(MatchError(core.ErrForbidden))
+		})
+	})
+
+	Describe("JWT", func() {
+		rsaKey := lo.Must(rsa.GenerateKey(rand.Reader, 2048))
+		ecKey := lo.Must(ecdsa.GenerateKey(elliptic.P256(), rand.Reader))
+
+		jwks := lo.Must(json.Marshal(map[string]any{
+			"keys": []map[string]string{
+				{
+					"kty": "RSA", "kid": "rsa",
+					"n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes()),
+				},
+				{
+					"kty": "EC", "kid": "ec", "crv": "P-256",
+					"x": encode(ecKey.X.FillBytes(make([]byte, 32))), "y": encode(ecKey.Y.FillBytes(make([]byte, 32))),
+				},
+			},
+		}))
+
+		function := docker.Function{Name_: "test", Auth: core.AuthConfig{
+			Type:     core.AuthTypeJWT,
+			JWKS:     jwks,
+			Issuer:   "issuer",
+			Audience: "test",
+		}}
+
+		authenticate := func(ctx SpecContext, token string) (*core.Principal, error) {
+			request := httptest.NewRequest(http.MethodPost, "/", nil)
+			request.Header.Set(core.HeaderNameAuthorization, "Bearer "+token)
+
+			return authenticator.Authenticate(ctx, request, function)
+		}
+
+		claims := func() map[string]any {
+			return map[string]any{
+				"sub": "user",
+				"iss": "issuer",
+				"aud": []string{"other", "test"},
+				"exp": time.Now().Add(time.Minute).Unix(),
+			}
+		}
+
+		It("authenticates tokens signed with RSA keys", func(ctx SpecContext) {
+			principal := lo.Must(authenticate(ctx, signRS256(rsaKey, "rsa", claims())))
+
+			Expect(principal.Type).To(Equal(core.AuthTypeJWT))
+			Expect(principal.ID).To(Equal("user"))
+			Expect(principal.Claims).To(HaveKeyWithValue("iss", "issuer"))
+		})
+
+		It("authenticates tokens signed with EC keys", func(ctx SpecContext) {
+			principal := lo.Must(authenticate(ctx, signES256(ecKey, "ec", claims())))
+
+			Expect(principal.ID).To(Equal("user"))
+		})
+
+		It("rejects tokens signed with other keys", func(ctx SpecContext) {
+			otherKey := lo.Must(rsa.GenerateKey(rand.Reader, 2048))
+
+			_, err := authenticate(ctx, signRS256(otherKey, "rsa", claims()))
+			Expect(err).To(MatchError(gateway.ErrInvalidJWT))
+			Expect(err).To(MatchError(core.ErrUnauthenticated))
+		})
+
+		It("rejects expired tokens and tokens for other audiences", func(ctx SpecContext) {
+			expired := claims()
+			expired["exp"] = time.Now().Add(-time.Minute).Unix()
+
+			_, err := authenticate(ctx, signRS256(rsaKey, "rsa", expired))
+			Expect(err).To(MatchError(ContainSubstring("expired")))
+
+			other := claims()
+			other["aud"] = "other"
+
+			_, err = authenticate(ctx, signRS256(rsaKey, "rsa", other))
+			Expect(err).To(MatchError(ContainSubstring("audience")))
+		})
+
+		It("rejects unsigned tokens", func(ctx SpecContext) {
+			token := encodeJSON(map[string]string{"alg": "none"}) + "." + encodeJSON(claims()) + "."
+
+			_, err := authenticate(ctx, token)
+			Expect(err).To(MatchError(gateway.ErrInvalidJWT))
+		})
+
+		It("skips malformed keys", func(ctx SpecContext) {
+			malformed := function
+			malformed.Auth.JWKS = lo.Must(json.Marshal(map[string]any{
+				"keys": []map[string]string{
+					{"kty": "RSA", "kid": "rsa", "n": "!", "e": "!"},
+					{"kty": "EC", "kid": "unknown", "crv": "P-999"},
+					{"kty": "RSA", "kid": "rsa", "n": encode(rsaKey.N.Bytes()), "e": "AQAB"},
+				},
+			}))
+
+			request := httptest.NewRequest(http.MethodPost, "/", nil)
+			request.Header.Set(core.HeaderNameAuthorization, "Bearer "+signRS256(rsaKey, "rsa", claims()))
+
+			Expect(authenticator.Authenticate(ctx, request, malformed)).ToNot(BeNil())
+		})
+
+		It("picks up changes of the function's JWKS", func(ctx SpecContext) {
+			lo.Must(authenticate(ctx, signRS256(rsaKey, "rsa", claims())))
+
+			otherKey := lo.Must(rsa.GenerateKey(rand.Reader, 2048))
+
+			rotated := function
+			rotated.Auth.JWKS = lo.Must(json.Marshal(map[string]any{
+				"keys": []map[string]string{
+					{"kty": "RSA", "kid": "rsa", "n": encode(otherKey.N.Bytes()), "e": "AQAB"},
+				},
+			}))
+
+			request := httptest.NewRequest(http.MethodPost, "/", nil)
+			request.Header.Set(core.HeaderNameAuthorization, "Bearer "+signRS256(otherKey, "rsa", claims()))
+
+			Expect(authenticator.Authenticate(ctx, request, rotated)).ToNot(BeNil())
+		})
+	})
+
+	Describe("HMAC", func() {
+		function := docker.Function{Name_: "test", Auth: core.AuthConfig{
+			Type:          core.AuthTypeHMAC,
+			HMACSecretEnv: "FID_TEST_HMAC_SECRET",
+			HMACHeader:    core.DefaultHMACHeader,
+		}}
+
+		BeforeEach(func() {
+			lo.Must0(os.Setenv("FID_TEST_HMAC_SECRET", "secret"))
+			DeferCleanup(os.Unsetenv, "FID_TEST_HMAC_SECRET")
+		})
+
+		sign := func(secret, body string) string {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write([]byte(body))
+
+			return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		}
+
+		It("authenticates signed requests and keeps their bodies", func(ctx SpecContext) {
+			request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("payload"))
+			request.Header.Set(core.DefaultHMACHeader, sign("secret", "payload"))
+
+			Expect(authenticator.Authenticate(ctx, request, function)).To(Equal(&core.Principal{Type: core.AuthTypeHMAC}))
+			Expect(io.ReadAll(request.Body)).To(Equal([]byte("payload")))
+		})
+
+		It("rejects requests signed with other secrets", func(ctx SpecContext) {
+			request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("payload"))
+			request.Header.Set(core.DefaultHMACHeader, sign("other", "payload"))
+
+			_, err := authenticator.Authenticate(ctx, request, function)
+			Expect(err).To(MatchError(core.ErrUnauthenticated))
+		})
+
+		Context("when the secret env variable is not set", func() {
+			BeforeEach(func() {
+				lo.Must0(os.Unsetenv("FID_TEST_HMAC_SECRET"))
+			})
+
+			It("returns an error", func(ctx SpecContext) {
+				request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("payload"))
+				request.Header.Set(core.DefaultHMACHeader, sign("", "payload"))
+
+				_, err := authenticator.Authenticate(ctx, request, function)
+				Expect(err).To(MatchError(gateway.ErrHMACSecretNotSet))
+				Expect(err).ToNot(MatchError(core.ErrUnauthenticated))
+			})
+		})
+	})
+})
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func encodeJSON(value any) string {
+	return encode(lo.Must(json.Marshal(value)))
+}
+
+func signingInput(alg, kid string, claims map[string]any) (string, []byte) {
+	input := encodeJSON(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + encodeJSON(claims)
+	digest := sha256.Sum256([]byte(input))
+
+	return input, digest[:]
+}
+
+func signRS256(key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	input, digest := signingInput("RS256", kid, claims)
+
+	return input + "." + encode(lo.Must(rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)))
+}
+
+func signES256(key *ecdsa.PrivateKey, kid string, claims map[string]any) string {
+	input, digest := signingInput("ES256", kid, claims)
+
+	r, s := lo.Must2(ecdsa.Sign(rand.Reader, key, digest))
+
+	return input + "." + encode(append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...))
+}
@@ -0,0 +1,84 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/pkg/json"
+	"github.com/zhulik/fid/pkg/sdk"
+)
+
+// RequestIDMiddleware assigns a request ID to every request and reports it in X-Fid-Request-Id header.
+// Invocations are made with the same request ID, so responses can be correlated with functions' logs.
+func RequestIDMiddleware(c *gin.Context) {
+	requestID := uuid.NewString()
+
+	c.Set("requestID", requestID)
+	c.Header(core.HeaderNameFidRequestID, requestID)
+
+	c.Next()
+}
+
+// invocationFailed responds to a failed invocation with a status telling what went wrong: 429 when it's
+// throttled, 502 with the function's error, 503 when there is no capacity to run the function and 504 when
+// the function did not respond in time.
+func (s *Server) invocationFailed(c *gin.Context, function core.FunctionDefinition, err error) {
+	var functionError *core.FunctionError
+
+	switch {
+	case errors.As(err, &functionError):
+		if functionError.Type != "" {
+			c.Header(core.HeaderNameFidFunctionError, functionError.Type)
+		}
+
+		c.Data(http.StatusBadGateway, core.ContentTypeJSON, functionErrorBody(functionError))
+	case errors.Is(err, core.ErrThrottled):
+		throttled(c, err)
+	case errors.Is(err, core.ErrUnavailable):
+		unavailable(c, err)
+	case errors.Is(err, context.DeadlineExceeded):
+		// Invocations which are not picked up by any instance time out too, but it's not the function's fault.
+		if s.InstancesView.Count(function) == 0 {
+			unavailable(c, fmt.Errorf("%w: %w", core.ErrNoCapacity, err))
+
+			return
+		}
+
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error": fmt.Sprintf("function did not respond in %s", function.Timeout()),
+		})
+	case errors.Is(err, context.Canceled):
+		// The client is gone, there is nobody to respond to.
+		c.Abort()
+	default:
+		c.Error(err)
+	}
+}
+
+// unavailable responds with 503 and asks the client to retry the invocation later.
+func unavailable(c *gin.Context, err error) {
+	c.Header(core.HeaderNameRetryAfter, strconv.Itoa(int(core.ThrottleRetryAfter.Seconds())))
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+}
+
+// functionErrorBody returns the error reported by the function. Runtimes report sdk.Error JSON, which is
+// returned as is, anything else is wrapped into it.
+func functionErrorBody(err *core.FunctionError) []byte {
+	if json.Valid(err.Payload) {
+		return err.Payload
+	}
+
+	body, _ := json.Marshal(sdk.Error{ //nolint:errchkjson
+		ErrorMessage: string(err.Payload),
+		ErrorType:    err.Type,
+		StackTrace:   []string{},
+	})
+
+	return body
+}
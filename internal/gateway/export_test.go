@@ -0,0 +1,11 @@
+package gateway
+
+// MatchedFunction returns the name of the function whose route matches the request, empty if there is none.
+func (t *RouteTable) MatchedFunction(method, path string) string {
+	match := t.match(method, path)
+	if match == nil {
+		return ""
+	}
+
+	return match.function.Name()
+}
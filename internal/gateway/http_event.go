@@ -0,0 +1,217 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/pkg/json"
+)
+
+const (
+	httpEventVersion = "2.0"
+	httpEventStage   = "$default"
+	httpEventAPIID   = "fid"
+	// httpEventTimeFormat is the format of requestContext.time, e.g. 12/Mar/2020:19:03:58 +0000.
+	httpEventTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+	// Functions may respond with any status code HTTP defines.
+	minStatusCode = 100
+	maxStatusCode = 599
+)
+
+var ErrMalformedHTTPResponse = errors.New("malformed function response")
+
+// httpEvent is an API Gateway HTTP API v2 (and Lambda function URL) event.
+type httpEvent struct {
+	Version               string             `json:"version"`
+	RouteKey              string             `json:"routeKey"`
+	RawPath               string             `json:"rawPath"`
+	RawQueryString        string             `json:"rawQueryString"`
+	Cookies               []string           `json:"cookies,omitempty"`
+	Headers               map[string]string  `json:"headers"`
+	QueryStringParameters map[string]string  `json:"queryStringParameters,omitempty"`
+	PathParameters        map[string]string  `json:"pathParameters,omitempty"`
+	RequestContext        httpRequestContext `json:"requestContext"`
+	Body                  string             `json:"body,omitempty"`
+	IsBase64Encoded       bool               `json:"isBase64Encoded"`
+}
+
+type httpRequestContext struct {
+	AccountID    string          `json:"accountId"`
+	APIID        string          `json:"apiId"`
+	Authorizer   *httpAuthorizer `json:"authorizer,omitempty"`
+	DomainName   string          `json:"domainName"`
+	DomainPrefix string          `json:"domainPrefix"`
+	HTTP         httpRequest     `json:"http"`
+	RequestID    string          `json:"requestId"`
+	RouteKey     string          `json:"routeKey"`
+	Stage        string          `json:"stage"`
+	Time         string          `json:"time"`
+	TimeEpoch    int64           `json:"timeEpoch"`
+}
+
+// httpAuthorizer holds the authenticated caller. Like in API Gateway, JWT claims are passed in jwt, the
+// principal is passed as the context of a Lambda authorizer.
+type httpAuthorizer struct {
+	JWT    *httpJWTAuthorizer `json:"jwt,omitempty"`
+	Lambda *core.Principal    `json:"lambda"`
+}
+
+type httpJWTAuthorizer struct {
+	Claims map[string]any `json:"claims"`
+	Scopes []string       `json:"scopes"`
+}
+
+type httpRequest struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Protocol  string `json:"protocol"`
+	SourceIP  string `json:"sourceIp"`
+	UserAgent string `json:"userAgent"`
+}
+
+// httpResponse is a function's response in the API Gateway HTTP API v2 payload format.
+type httpResponse struct {
+	StatusCode      int               `json:"statusCode"`
+	Headers         map[string]string `json:"headers"`
+	Cookies         []string          `json:"cookies"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+}
+
+// newHTTPEvent translates the request into an event for the matched route. Like in API Gateway, header names
+// are lowercased and repeated headers and query parameters are joined with commas. Bodies which are not
+// valid UTF-8 are base64 encoded.
+func newHTTPEvent(c *gin.Context, match *routeMatch, body []byte) httpEvent {
+	request := c.Request
+	now := time.Now()
+
+	headers := make(map[string]string, len(request.Header))
+
+	for name, values := range request.Header {
+		if name == "Cookie" {
+			continue
+		}
+
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+
+	cookies := make([]string, 0, len(request.Cookies()))
+	for _, cookie := range request.Cookies() {
+		cookies = append(cookies, cookie.String())
+	}
+
+	query := request.URL.Query()
+	queryParameters := make(map[string]string, len(query))
+
+	for name, values := range query {
+		queryParameters[name] = strings.Join(values, ",")
+	}
+
+	event := httpEvent{
+		Version:               httpEventVersion,
+		RouteKey:              match.route.Key(),
+		RawPath:               request.URL.Path,
+		RawQueryString:        request.URL.RawQuery,
+		Cookies:               cookies,
+		Headers:               headers,
+		QueryStringParameters: queryParameters,
+		PathParameters:        match.pathParameters,
+		RequestContext: httpRequestContext{
+			AccountID:    core.AccountID,
+			APIID:        httpEventAPIID,
+			DomainName:   request.Host,
+			DomainPrefix: strings.Split(request.Host, ".")[0],
+			HTTP: httpRequest{
+				Method:    request.Method,
+				Path:      request.URL.Path,
+				Protocol:  request.Proto,
+				SourceIP:  c.ClientIP(),
+				UserAgent: request.UserAgent(),
+			},
+			RequestID: c.GetString("requestID"),
+			RouteKey:  match.route.Key(),
+			Stage:     httpEventStage,
+			Time:      now.Format(httpEventTimeFormat),
+			TimeEpoch: now.UnixMilli(),
+		},
+	}
+
+	if value, ok := c.Get("principal"); ok {
+		principal := value.(*core.Principal) //nolint:forcetypeassert
+
+		event.RequestContext.Authorizer = &httpAuthorizer{Lambda: principal}
+
+		if principal.Type == core.AuthTypeJWT {
+			// OAuth scopes are a space separated list.
+			scope, _ := principal.Claims["scope"].(string)
+
+			event.RequestContext.Authorizer.JWT = &httpJWTAuthorizer{
+				Claims: principal.Claims,
+				Scopes: strings.Fields(scope),
+			}
+		}
+	}
+
+	if utf8.Valid(body) {
+		event.Body = string(body)
+	} else {
+		event.Body = base64.StdEncoding.EncodeToString(body)
+		event.IsBase64Encoded = true
+	}
+
+	return event
+}
+
+// writeHTTPResponse maps the function's response to HTTP. Like in API Gateway, responses without a status
+// code are returned as JSON with status 200, responses without a content type are assumed to be JSON.
+func writeHTTPResponse(c *gin.Context, data []byte) error {
+	fields, err := json.Unmarshal[map[string]json.RawMessage](data)
+	if err != nil || fields["statusCode"] == nil {
+		c.Data(http.StatusOK, core.ContentTypeJSON, data)
+
+		return nil
+	}
+
+	response, err := json.Unmarshal[httpResponse](data)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMalformedHTTPResponse, err)
+	}
+
+	if response.StatusCode < minStatusCode || response.StatusCode > maxStatusCode {
+		return fmt.Errorf("%w: invalid status code %d", ErrMalformedHTTPResponse, response.StatusCode)
+	}
+
+	body := []byte(response.Body)
+
+	if response.IsBase64Encoded {
+		body, err = base64.StdEncoding.DecodeString(response.Body)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrMalformedHTTPResponse, err)
+		}
+	}
+
+	for name, value := range response.Headers {
+		c.Header(name, value)
+	}
+
+	for _, cookie := range response.Cookies {
+		c.Writer.Header().Add("Set-Cookie", cookie)
+	}
+
+	contentType := c.Writer.Header().Get(core.HeaderNameContentType)
+	if contentType == "" {
+		contentType = core.ContentTypeJSON
+	}
+
+	c.Data(response.StatusCode, contentType, body)
+
+	return nil
+}
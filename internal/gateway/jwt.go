@@ -0,0 +1,318 @@
+package gateway
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // hashes of JWT algorithms
+	_ "crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/pkg/json"
+)
+
+var (
+	ErrInvalidJWT  = errors.New("invalid JWT")
+	ErrInvalidJWKS = errors.New("invalid JWKS")
+)
+
+// jwtAlgorithm describes how tokens signed with an asymmetric JWS algorithm are verified. Symmetric
+// algorithms and "none" are not supported: JWKS files are public.
+type jwtAlgorithm struct {
+	hash crypto.Hash
+	kty  string
+	pss  bool
+}
+
+var jwtAlgorithms = map[string]jwtAlgorithm{ //nolint:gochecknoglobals
+	"RS256": {hash: crypto.SHA256, kty: "RSA"},
+	"RS384": {hash: crypto.SHA384, kty: "RSA"},
+	"RS512": {hash: crypto.SHA512, kty: "RSA"},
+	"PS256": {hash: crypto.SHA256, kty: "RSA", pss: true},
+	"PS384": {hash: crypto.SHA384, kty: "RSA", pss: true},
+	"PS512": {hash: crypto.SHA512, kty: "RSA", pss: true},
+	"ES256": {hash: crypto.SHA256, kty: "EC"},
+	"ES384": {hash: crypto.SHA384, kty: "EC"},
+	"ES512": {hash: crypto.SHA512, kty: "EC"},
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// jwtKeySet is a parsed JWKS.
+type jwtKeySet struct {
+	// jwks is the JWKS the keys are parsed from.
+	jwks []byte
+	keys []jwtKey
+}
+
+// jwtKey is a parsed public key of a JWKS.
+type jwtKey struct {
+	kty string
+	kid string
+	alg string
+
+	publicKey crypto.PublicKey
+}
+
+// jwk is a public RSA or EC JSON Web Key.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+
+	N string `json:"n"`
+	E string `json:"e"`
+
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS parses keys of the JWKS. Malformed and unsupported keys are skipped and returned as errors, so
+// one bad key does not lock out tokens signed with the others.
+func parseJWKS(data []byte) (*jwtKeySet, []error, error) {
+	keySet, err := json.Unmarshal[jwks](data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidJWKS, err)
+	}
+
+	parsed := &jwtKeySet{jwks: data}
+
+	var skipped []error
+
+	for _, key := range keySet.Keys {
+		publicKey, err := key.publicKey()
+		if err != nil {
+			skipped = append(skipped, err)
+
+			continue
+		}
+
+		parsed.keys = append(parsed.keys, jwtKey{kty: key.Kty, kid: key.Kid, alg: key.Alg, publicKey: publicKey})
+	}
+
+	return parsed, skipped, nil
+}
+
+// verifyJWT verifies the token's signature with the key set and checks its claims: the token must not be
+// expired or used before nbf, iss and aud must match the config when set. It returns the claims.
+func verifyJWT(token string, keySet *jwtKeySet, config core.AuthConfig, now time.Time) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 { //nolint:mnd
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidJWT)
+	}
+
+	header, err := decodeJWTPart[jwtHeader](parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm, ok := jwtAlgorithms[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidJWT, header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature: %w", ErrInvalidJWT, err)
+	}
+
+	hasher := algorithm.hash.New()
+	hasher.Write([]byte(parts[0] + "." + parts[1]))
+	digest := hasher.Sum(nil)
+
+	verified := false
+
+	for _, key := range keySet.keys {
+		if key.kty != algorithm.kty || (header.Kid != "" && key.kid != header.Kid) ||
+			(key.alg != "" && key.alg != header.Alg) {
+			continue
+		}
+
+		verified = algorithm.verify(key.publicKey, digest, signature)
+		if verified {
+			break
+		}
+	}
+
+	if !verified {
+		return nil, fmt.Errorf("%w: signature verification failed", ErrInvalidJWT)
+	}
+
+	claims, err := decodeJWTPart[map[string]any](parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkJWTClaims(claims, config, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (a jwtAlgorithm) verify(key crypto.PublicKey, digest, signature []byte) bool {
+	switch publicKey := key.(type) {
+	case *rsa.PublicKey:
+		if a.pss {
+			return rsa.VerifyPSS(publicKey, a.hash, digest, signature, nil) == nil
+		}
+
+		return rsa.VerifyPKCS1v15(publicKey, a.hash, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		// JWS EC signatures are r and s concatenated, each padded to the size of the curve.
+		size := (publicKey.Curve.Params().BitSize + 7) / 8 //nolint:mnd
+		if len(signature) != 2*size {
+			return false
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+
+		return ecdsa.Verify(publicKey, digest, r, s)
+	default:
+		return false
+	}
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		return k.rsaPublicKey()
+	case "EC":
+		return k.ecdsaPublicKey()
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %q of key %q", ErrInvalidJWKS, k.Kty, k.Kid)
+	}
+}
+
+func (k jwk) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed modulus of key %q: %w", ErrInvalidJWKS, k.Kid, err)
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed exponent of key %q: %w", ErrInvalidJWKS, k.Kid, err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 2 || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("%w: invalid exponent of key %q", ErrInvalidJWKS, k.Kid)
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+func (k jwk) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("%w: unsupported curve %q of key %q", ErrInvalidJWKS, k.Crv, k.Kid)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed x of key %q: %w", ErrInvalidJWKS, k.Kid, err)
+	}
+
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed y of key %q: %w", ErrInvalidJWKS, k.Kid, err)
+	}
+
+	size := (curve.Params().BitSize + 7) / 8 //nolint:mnd
+	if len(x) > size || len(y) > size {
+		return nil, fmt.Errorf("%w: invalid point of key %q", ErrInvalidJWKS, k.Kid)
+	}
+
+	// The uncompressed point format is 0x04 followed by x and y padded to the size of the curve.
+	point := make([]byte, 1+2*size)
+	point[0] = 4
+	copy(point[1+size-len(x):1+size], x)
+	copy(point[1+2*size-len(y):], y)
+
+	publicKey, err := ecdsa.ParseUncompressedPublicKey(curve, point)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid point of key %q: %w", ErrInvalidJWKS, k.Kid, err)
+	}
+
+	return publicKey, nil
+}
+
+func checkJWTClaims(claims map[string]any, config core.AuthConfig, now time.Time) error {
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("%w: exp is missing", ErrInvalidJWT)
+	}
+
+	if now.Unix() >= int64(exp) {
+		return fmt.Errorf("%w: token is expired", ErrInvalidJWT)
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Unix() < int64(nbf) {
+		return fmt.Errorf("%w: token is not valid yet", ErrInvalidJWT)
+	}
+
+	if config.Issuer != "" && claims["iss"] != config.Issuer {
+		return fmt.Errorf("%w: unexpected issuer", ErrInvalidJWT)
+	}
+
+	if config.Audience == "" {
+		return nil
+	}
+
+	// aud is either a single audience or a list of them.
+	switch aud := claims["aud"].(type) {
+	case string:
+		if aud == config.Audience {
+			return nil
+		}
+	case []any:
+		if slices.Contains(aud, any(config.Audience)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: unexpected audience", ErrInvalidJWT)
+}
+
+func decodeJWTPart[T any](part string) (T, error) {
+	var result T
+
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return result, fmt.Errorf("%w: malformed token: %w", ErrInvalidJWT, err)
+	}
+
+	result, err = json.Unmarshal[T](data)
+	if err != nil {
+		return result, fmt.Errorf("%w: malformed token: %w", ErrInvalidJWT, err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,328 @@
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/pkg/json"
+)
+
+// maxUpdateAttempts limits retries of updates of buckets and counters changed concurrently by other gateways.
+const maxUpdateAttempts = 10
+
+// tokenBucket is the state of a rate limit, missing buckets are full.
+type tokenBucket struct {
+	Tokens    float64   `json:"tokens"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// RateLimiter enforces functions' rate limits and API keys' quotas. Token buckets and quota counters are
+// kept in KV, so they are shared by all gateways, concurrent updates are retried.
+type RateLimiter struct {
+	Logger *slog.Logger
+	KV     core.KV
+
+	buckets core.KVBucket
+	quotas  core.KVBucket
+}
+
+func (r *RateLimiter) Init(ctx context.Context) error {
+	buckets, err := r.KV.CreateBucketWithConfig(ctx, core.BucketConfigRateLimits)
+	if err != nil {
+		return fmt.Errorf("failed to create rate limits bucket: %w", err)
+	}
+
+	quotas, err := r.KV.CreateBucketWithConfig(ctx, core.BucketConfigQuotas)
+	if err != nil {
+		return fmt.Errorf("failed to create quotas bucket: %w", err)
+	}
+
+	r.buckets = buckets
+	r.quotas = quotas
+
+	return nil
+}
+
+// rateLimitBucket is a token bucket of a rate limit.
+type rateLimitBucket struct {
+	key   string
+	limit core.RateLimit
+}
+
+// quotaCounter counts invocations of a principal until reset.
+type quotaCounter struct {
+	key   string
+	limit int
+	reset time.Time
+}
+
+// Take takes a token from the caller's and the function's buckets and counts the invocation against the
+// principal's quota. It returns the status of the most restrictive bucket, nil if the function is not rate
+// limited. Errors wrap core.ErrRateLimitExceeded or core.ErrQuotaExceeded when the invocation is throttled,
+// the status tells when to retry.
+func (r *RateLimiter) Take(
+	ctx context.Context,
+	function core.FunctionDefinition,
+	caller string,
+	principal *core.Principal,
+) (*core.RateLimitStatus, error) {
+	now := time.Now()
+	buckets := rateLimitBuckets(function, caller)
+
+	var counters []quotaCounter
+	if principal != nil && principal.Type == core.AuthTypeAPIKey {
+		counters = quotaCounters(principal, now)
+	}
+
+	// All buckets and quotas are checked before anything is taken, so invocations throttled by one of them
+	// do not drain the others. Concurrent invocations may take the last token in between, then the invocation
+	// is throttled anyway.
+	for _, bucket := range buckets {
+		status, err := r.peek(ctx, bucket, now)
+		if err != nil {
+			return &status, err
+		}
+	}
+
+	retryAfter, err := r.checkQuotas(ctx, counters, now)
+	if err != nil {
+		// Quotas are not reported in X-RateLimit headers, only when to retry.
+		return &core.RateLimitStatus{RetryAfter: retryAfter}, err
+	}
+
+	var status *core.RateLimitStatus
+
+	for _, bucket := range buckets {
+		bucketStatus, err := r.take(ctx, bucket, now)
+		if err != nil {
+			return &bucketStatus, err
+		}
+
+		if status == nil || bucketStatus.Remaining < status.Remaining {
+			status = &bucketStatus
+		}
+	}
+
+	retryAfter, err = r.countQuotas(ctx, counters, now)
+	if err != nil {
+		return &core.RateLimitStatus{RetryAfter: retryAfter}, err
+	}
+
+	return status, nil
+}
+
+// peek checks that the bucket has a token without taking it.
+func (r *RateLimiter) peek(ctx context.Context, bucket rateLimitBucket, now time.Time) (core.RateLimitStatus, error) {
+	value, err := r.buckets.Get(ctx, bucket.key)
+	if err != nil && !errors.Is(err, core.ErrKeyNotFound) {
+		return core.RateLimitStatus{}, fmt.Errorf("failed to get rate limit: %w", err)
+	}
+
+	tokens, err := refill(value, bucket.limit, now)
+	if err != nil {
+		return core.RateLimitStatus{}, err
+	}
+
+	return bucketStatus(tokens, bucket.limit)
+}
+
+func (r *RateLimiter) take(ctx context.Context, bucket rateLimitBucket, now time.Time) (core.RateLimitStatus, error) {
+	var status core.RateLimitStatus
+
+	err := update(ctx, r.buckets, bucket.key, func(value []byte) ([]byte, error) {
+		tokens, err := refill(value, bucket.limit, now)
+		if err != nil {
+			return nil, err
+		}
+
+		status, err = bucketStatus(tokens, bucket.limit)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens.Tokens--
+
+		status.Remaining = int(tokens.Tokens)
+		status.Reset = seconds((float64(bucket.limit.Capacity()) - tokens.Tokens) / rate(bucket.limit))
+
+		return json.Marshal(tokens) //nolint:wrapcheck
+	})
+
+	return status, err
+}
+
+// checkQuotas checks that none of the quotas is exceeded, if one is, it returns the time left until it's
+// reset. Invocations rejected by the monthly quota do not count against the daily one.
+func (r *RateLimiter) checkQuotas(ctx context.Context, counters []quotaCounter, now time.Time) (time.Duration, error) {
+	for _, counter := range counters {
+		value, err := r.quotas.Get(ctx, counter.key)
+		if err != nil && !errors.Is(err, core.ErrKeyNotFound) {
+			return 0, fmt.Errorf("failed to get quota counter: %w", err)
+		}
+
+		if parseCounter(value) >= counter.limit {
+			return counter.reset.Sub(now), core.ErrQuotaExceeded
+		}
+	}
+
+	return 0, nil
+}
+
+// countQuotas counts the invocation against the quotas, if one of them is exceeded concurrently, it returns
+// the time left until it's reset.
+func (r *RateLimiter) countQuotas(ctx context.Context, counters []quotaCounter, now time.Time) (time.Duration, error) {
+	for _, counter := range counters {
+		err := update(ctx, r.quotas, counter.key, func(value []byte) ([]byte, error) {
+			count := parseCounter(value)
+			if count >= counter.limit {
+				return nil, core.ErrQuotaExceeded
+			}
+
+			return []byte(strconv.Itoa(count + 1)), nil
+		})
+		if err != nil {
+			return counter.reset.Sub(now), err
+		}
+	}
+
+	return 0, nil
+}
+
+// rateLimitBuckets returns the enabled buckets of the caller's and the function's rate limits.
+func rateLimitBuckets(function core.FunctionDefinition, caller string) []rateLimitBucket {
+	limits := function.LimitsConfig()
+
+	buckets := []rateLimitBucket{
+		{key: function.Name() + ".caller." + encodeKeyToken(caller), limit: limits.CallerRateLimit},
+		{key: function.Name() + ".function", limit: limits.RateLimit},
+	}
+
+	return lo.Filter(buckets, func(bucket rateLimitBucket, _ int) bool {
+		return bucket.limit.Enabled()
+	})
+}
+
+// quotaCounters returns the counters of the principal's daily and monthly quotas which are set.
+func quotaCounters(principal *core.Principal, now time.Time) []quotaCounter {
+	now = now.UTC()
+	name := encodeKeyToken(principal.ID)
+
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	counters := []quotaCounter{
+		{key: name + ".day." + day.Format("20060102"), limit: principal.Quota.Daily, reset: day.AddDate(0, 0, 1)},
+		{
+			key:   name + ".month." + month.Format("200601"),
+			limit: principal.Quota.Monthly,
+			reset: month.AddDate(0, 1, 0),
+		},
+	}
+
+	return lo.Filter(counters, func(counter quotaCounter, _ int) bool {
+		return counter.limit > 0
+	})
+}
+
+// refill returns the bucket stored in value with tokens added since it was updated, missing buckets are full.
+func refill(value []byte, limit core.RateLimit, now time.Time) (tokenBucket, error) {
+	capacity := float64(limit.Capacity())
+	bucket := tokenBucket{Tokens: capacity, UpdatedAt: now}
+
+	if value == nil {
+		return bucket, nil
+	}
+
+	stored, err := json.Unmarshal[tokenBucket](value)
+	if err != nil {
+		return bucket, fmt.Errorf("failed to unmarshal rate limit: %w", err)
+	}
+
+	elapsed := max(now.Sub(stored.UpdatedAt).Seconds(), 0)
+	bucket.Tokens = min(capacity, stored.Tokens+elapsed*rate(limit))
+
+	return bucket, nil
+}
+
+// bucketStatus reports the bucket's state, it returns core.ErrRateLimitExceeded if there are no tokens left.
+func bucketStatus(bucket tokenBucket, limit core.RateLimit) (core.RateLimitStatus, error) {
+	capacity := float64(limit.Capacity())
+
+	status := core.RateLimitStatus{
+		Limit:     limit.Capacity(),
+		Remaining: int(bucket.Tokens),
+		Reset:     seconds((capacity - bucket.Tokens) / rate(limit)),
+	}
+
+	if bucket.Tokens < 1 {
+		status.Remaining = 0
+		status.RetryAfter = seconds((1 - bucket.Tokens) / rate(limit))
+
+		return status, core.ErrRateLimitExceeded
+	}
+
+	return status, nil
+}
+
+// rate returns the limit's refill rate in tokens per second.
+func rate(limit core.RateLimit) float64 {
+	return float64(limit.Requests) / limit.Period.Seconds()
+}
+
+// update changes the key with fn, which gets nil if the key does not exist. Updates are retried when the
+// key is changed concurrently, errors returned by fn are returned as is.
+func update(ctx context.Context, bucket core.KVBucket, key string, fn func([]byte) ([]byte, error)) error {
+	for range maxUpdateAttempts {
+		entry, err := bucket.GetEntry(ctx, key)
+		if err != nil && !errors.Is(err, core.ErrKeyNotFound) {
+			return fmt.Errorf("failed to get %s: %w", key, err)
+		}
+
+		value, err := fn(entry.Value)
+		if err != nil {
+			return err
+		}
+
+		if entry.Sequence == 0 {
+			_, err = bucket.Create(ctx, key, value)
+		} else {
+			_, err = bucket.Update(ctx, key, value, entry.Sequence)
+		}
+
+		if errors.Is(err, core.ErrKeyExists) || errors.Is(err, core.ErrWrongSequence) {
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to store %s: %w", key, err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("failed to update %s: %w", key, core.ErrWrongSequence)
+}
+
+// parseCounter parses a quota counter, missing counters are zero.
+func parseCounter(value []byte) int {
+	count, _ := strconv.Atoi(string(value))
+
+	return count
+}
+
+// encodeKeyToken makes caller identities, e.g. JWT subjects like "auth0|123", safe to use in KV keys.
+func encodeKeyToken(value string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(math.Ceil(value * float64(time.Second)))
+}
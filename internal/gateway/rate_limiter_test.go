@@ -0,0 +1,118 @@
+package gateway_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/gateway"
+	"github.com/zhulik/fid/testhelpers"
+	"github.com/zhulik/pal"
+)
+
+var _ = Describe("RateLimiter", Serial, func() {
+	var rateLimiter *gateway.RateLimiter
+
+	BeforeEach(func(ctx SpecContext) {
+		p := testhelpers.NewMemoryPal(ctx, pal.Provide(&gateway.RateLimiter{}))
+
+		rateLimiter = lo.Must(pal.Invoke[*gateway.RateLimiter](ctx, p))
+	})
+
+	Context("when the function is not rate limited", func() {
+		It("returns no status", func(ctx SpecContext) {
+			Expect(rateLimiter.Take(ctx, docker.Function{Name_: "unlimited"}, "caller", nil)).To(BeNil())
+		})
+	})
+
+	Context("when the caller's bucket is empty", func() {
+		function := docker.Function{
+			Name_:           "limited",
+			CallerRateLimit: core.RateLimit{Requests: 2, Period: time.Minute},
+		}
+
+		It("throttles the caller until a token is refilled", func(ctx SpecContext) {
+			status := lo.Must(rateLimiter.Take(ctx, function, "caller", nil))
+			Expect(status.Limit).To(Equal(2))
+			Expect(status.Remaining).To(Equal(1))
+
+			lo.Must(rateLimiter.Take(ctx, function, "caller", nil))
+
+			status, err := rateLimiter.Take(ctx, function, "caller", nil)
+			Expect(err).To(MatchError(core.ErrRateLimitExceeded))
+			Expect(err).To(MatchError(core.ErrThrottled))
+			Expect(status.Remaining).To(Equal(0))
+			Expect(status.RetryAfter).To(BeNumerically("~", 30*time.Second, time.Second))
+		})
+
+		It("does not throttle other callers", func(ctx SpecContext) {
+			lo.Must(rateLimiter.Take(ctx, function, "caller", nil))
+			lo.Must(rateLimiter.Take(ctx, function, "caller", nil))
+
+			Expect(rateLimiter.Take(ctx, function, "auth0|other", nil)).ToNot(BeNil())
+		})
+	})
+
+	Context("when the burst is smaller than the rate", func() {
+		function := docker.Function{
+			Name_:           "limited",
+			CallerRateLimit: core.RateLimit{Requests: 100, Period: time.Minute, Burst: 2},
+		}
+
+		It("takes only burst tokens at once", func(ctx SpecContext) {
+			status := lo.Must(rateLimiter.Take(ctx, function, "caller", nil))
+			Expect(status.Limit).To(Equal(2))
+
+			lo.Must(rateLimiter.Take(ctx, function, "caller", nil))
+
+			_, err := rateLimiter.Take(ctx, function, "caller", nil)
+			Expect(err).To(MatchError(core.ErrRateLimitExceeded))
+		})
+	})
+
+	Context("when the function's bucket is empty", func() {
+		function := docker.Function{
+			Name_:     "limited",
+			RateLimit: core.RateLimit{Requests: 1, Period: time.Minute},
+		}
+
+		It("throttles all callers", func(ctx SpecContext) {
+			lo.Must(rateLimiter.Take(ctx, function, "caller", nil))
+
+			_, err := rateLimiter.Take(ctx, function, "other", nil)
+			Expect(err).To(MatchError(core.ErrRateLimitExceeded))
+		})
+	})
+
+	Context("when the api key's quota is exceeded", func() {
+		principal := &core.Principal{Type: core.AuthTypeAPIKey, ID: "partner", Quota: core.Quota{Daily: 1, Monthly: 10}}
+
+		It("throttles the key until the next day", func(ctx SpecContext) {
+			lo.Must(rateLimiter.Take(ctx, docker.Function{Name_: "first"}, "caller", principal))
+
+			status, err := rateLimiter.Take(ctx, docker.Function{Name_: "second"}, "caller", principal)
+			Expect(err).To(MatchError(core.ErrQuotaExceeded))
+			Expect(status.RetryAfter).To(BeNumerically("<=", 24*time.Hour))
+		})
+
+		It("does not take tokens of throttled invocations", func(ctx SpecContext) {
+			function := docker.Function{
+				Name_:           "limited",
+				CallerRateLimit: core.RateLimit{Requests: 2, Period: time.Minute},
+			}
+
+			lo.Must(rateLimiter.Take(ctx, function, "caller", principal))
+
+			_, err := rateLimiter.Take(ctx, function, "caller", principal)
+			Expect(err).To(MatchError(core.ErrQuotaExceeded))
+
+			other := &core.Principal{Type: core.AuthTypeAPIKey, ID: "other", Quota: core.Quota{Daily: 1}}
+
+			status := lo.Must(rateLimiter.Take(ctx, function, "caller", other))
+			Expect(status.Remaining).To(Equal(0))
+		})
+	})
+})
@@ -0,0 +1,234 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhulik/fid/internal/core"
+)
+
+// rewatchInterval is how long RouteTable waits before retrying a failed watch.
+const rewatchInterval = time.Second
+
+// routeMatch is a function's route which matches a request.
+type routeMatch struct {
+	function       core.FunctionDefinition
+	route          core.Route
+	pathParameters map[string]string
+
+	// literals and params count the matched segments, they are used to pick the most specific route.
+	literals int
+	params   int
+}
+
+// moreSpecific reports whether the match is preferred over the other one. Like in API Gateway, literal
+// segments win over parameters, parameters win over greedy parameters and methods win over ANY.
+func (m routeMatch) moreSpecific(other routeMatch) bool {
+	if m.literals != other.literals {
+		return m.literals > other.literals
+	}
+
+	if m.params != other.params {
+		return m.params > other.params
+	}
+
+	return m.route.Method != core.RouteMethodAny && other.route.Method == core.RouteMethodAny
+}
+
+// RouteTable keeps functions' routes in memory, so requests are matched without listing functions. The
+// functions bucket is watched, functions are reloaded whenever one of them is added, updated or removed.
+type RouteTable struct {
+	Logger        *slog.Logger
+	KV            core.KV
+	FunctionsRepo core.FunctionsRepo
+
+	bucket core.KVBucket
+
+	mu        sync.RWMutex
+	functions []core.FunctionDefinition
+
+	cancel context.CancelFunc
+}
+
+func (t *RouteTable) Init(ctx context.Context) error {
+	bucket, err := t.KV.CreateBucket(ctx, core.BucketNameFunctions)
+	if err != nil {
+		return fmt.Errorf("failed to create functions bucket: %w", err)
+	}
+
+	t.bucket = bucket
+
+	// The watch outlives Init, it's stopped on shutdown.
+	watchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	t.cancel = cancel
+
+	events, err := t.watch(watchCtx, ctx)
+	if err != nil {
+		cancel()
+
+		return err
+	}
+
+	go t.follow(watchCtx, events)
+
+	return nil
+}
+
+func (t *RouteTable) Shutdown(_ context.Context) error {
+	t.cancel()
+
+	return nil
+}
+
+// match finds the most specific route of all functions which matches the request, nil if there is none.
+func (t *RouteTable) match(method, path string) *routeMatch {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var best *routeMatch
+
+	for _, function := range t.functions {
+		for _, route := range function.Routes() {
+			if route.Method != core.RouteMethodAny && route.Method != method {
+				continue
+			}
+
+			match, ok := matchPath(route.Path, path)
+			if !ok {
+				continue
+			}
+
+			match.function = function
+			match.route = route
+
+			if best == nil || match.moreSpecific(*best) {
+				best = &match
+			}
+		}
+	}
+
+	return best
+}
+
+// watch starts a watch which lasts until ctx is done and loads functions once the existing ones are
+// delivered, syncCtx limits the time it takes.
+func (t *RouteTable) watch(ctx, syncCtx context.Context) (<-chan core.KVEvent, error) {
+	events, err := t.bucket.Watch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch functions: %w", err)
+	}
+
+	for {
+		select {
+		case <-syncCtx.Done():
+			return nil, fmt.Errorf("failed to sync functions: %w", syncCtx.Err())
+		case event, ok := <-events:
+			if !ok {
+				return nil, fmt.Errorf("failed to sync functions: %w", core.ErrWatchStopped)
+			}
+
+			if event.Type != core.KVEventSynced {
+				continue
+			}
+
+			err = t.load(syncCtx)
+			if err != nil {
+				return nil, err
+			}
+
+			return events, nil
+		}
+	}
+}
+
+// follow reloads functions when they change. When the watch stops before ctx is done, they are reloaded
+// from a new watch.
+func (t *RouteTable) follow(ctx context.Context, events <-chan core.KVEvent) {
+	for {
+		for range events {
+			err := t.load(ctx)
+			if err != nil {
+				t.Logger.Error("Failed to reload routes", "error", err)
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		t.Logger.Warn("Functions watch stopped, resyncing routes")
+
+		var err error
+
+		events, err = t.watch(ctx, ctx)
+		for err != nil {
+			t.Logger.Error("Failed to resync routes", "error", err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(rewatchInterval):
+			}
+
+			events, err = t.watch(ctx, ctx)
+		}
+	}
+}
+
+func (t *RouteTable) load(ctx context.Context) error {
+	functions, err := t.FunctionsRepo.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list functions: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.functions = functions
+
+	return nil
+}
+
+// matchPath matches the path against the route's pattern and extracts path parameters.
+func matchPath(pattern, path string) (routeMatch, bool) {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+
+	match := routeMatch{pathParameters: map[string]string{}}
+
+	for i, segment := range patternSegments {
+		name, isParam := strings.CutPrefix(segment, "{")
+		name, _ = strings.CutSuffix(name, "}")
+
+		if greedy, ok := strings.CutSuffix(name, "+"); isParam && ok && i == len(patternSegments)-1 {
+			// Greedy parameters match one or more segments.
+			if i >= len(pathSegments) || pathSegments[i] == "" {
+				return routeMatch{}, false
+			}
+
+			match.pathParameters[greedy] = strings.Join(pathSegments[i:], "/")
+
+			return match, true
+		}
+
+		if i >= len(pathSegments) {
+			return routeMatch{}, false
+		}
+
+		switch {
+		case isParam && pathSegments[i] != "":
+			match.pathParameters[name] = pathSegments[i]
+			match.params++
+		case segment == pathSegments[i]:
+			match.literals++
+		default:
+			return routeMatch{}, false
+		}
+	}
+
+	return match, len(patternSegments) == len(pathSegments)
+}
@@ -2,36 +2,68 @@ package gateway
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/zhulik/fid/internal/config"
 	"github.com/zhulik/fid/internal/core"
 	"github.com/zhulik/fid/internal/httpserver"
 	"github.com/zhulik/fid/internal/middlewares"
+	"github.com/zhulik/fid/pkg/json"
 	"github.com/zhulik/pal"
 )
 
+// streamBufferSize is the size of the buffer used to relay streamed responses.
+const streamBufferSize = 32 * 1024
+
+var ErrInvalidClientContext = errors.New("client context must be base64 encoded")
+
 type Server struct {
 	*httpserver.Server
 
-	Config        *config.Config
-	Logger        *slog.Logger
-	FunctionsRepo core.FunctionsRepo
-	Invoker       core.Invoker
+	Config          *config.Config
+	Logger          *slog.Logger
+	FunctionsRepo   core.FunctionsRepo
+	InvocationsRepo core.InvocationsRepo
+	Invoker         core.Invoker
+	InstancesView   core.InstancesView
+	Authenticator   *Authenticator
+	RateLimiter     *RateLimiter
+	RouteTable      *RouteTable
 
 	Pal *pal.Pal
 }
 
 // NewServer creates a new Server instance.
 func (s *Server) Init(ctx context.Context) error {
-	s.Router.Use(middlewares.FunctionMiddleware(s.FunctionsRepo, func(c *gin.Context) string {
+	s.Router.Use(RequestIDMiddleware)
+
+	invoke := s.Router.Group("/invoke/:functionName")
+
+	invoke.Use(middlewares.FunctionMiddleware(s.FunctionsRepo, func(c *gin.Context) string {
 		return c.Param("functionName")
 	}))
+	invoke.Use(s.AuthMiddleware, s.RateLimitMiddleware)
+
+	invoke.POST("", s.InvokeHandler)
+	invoke.POST("/async", s.InvokeAsyncHandler)
+
+	// Invocations are fetched by their callers, polling is not rate limited.
+	invocations := s.Router.Group("/invocations/:requestID")
+
+	invocations.Use(s.InvocationMiddleware)
 
-	s.Router.POST("/invoke/:functionName", s.InvokeHandler)
+	invocations.GET("", s.InvocationHandler)
+
+	// Functions' HTTP routes are matched dynamically, functions may be added and removed at any time.
+	s.Router.NoRoute(s.HTTPHandler)
 
 	return nil
 }
@@ -40,7 +72,15 @@ func (s *Server) Run(ctx context.Context) error {
 	return s.RunServer(ctx) //nolint:wrapcheck
 }
 
+// InvokeHandler invokes the function and responds with its response. If X-Fid-Invocation-Type header
+// is set to Event, the function is invoked asynchronously.
 func (s *Server) InvokeHandler(c *gin.Context) {
+	if c.GetHeader(core.HeaderNameInvocationType) == core.InvocationTypeEvent {
+		s.InvokeAsyncHandler(c)
+
+		return
+	}
+
 	ctx := c.Request.Context()
 
 	function := c.MustGet("function").(core.FunctionDefinition) //nolint:forcetypeassert
@@ -52,12 +92,404 @@ func (s *Server) InvokeHandler(c *gin.Context) {
 		return
 	}
 
-	response, err := s.Invoker.Invoke(ctx, function, body)
+	metadata, err := invocationMetadata(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	response, err := s.Invoker.InvokeStream(ctx, function, body, metadata)
+	if err != nil {
+		s.invocationFailed(c, function, err)
+
+		return
+	}
+	defer response.Body.Close()
+
+	if !response.Streaming {
+		data, err := io.ReadAll(response.Body)
+		if err != nil {
+			c.Error(err)
+
+			return
+		}
+
+		c.Data(http.StatusOK, response.ContentType, data)
+
+		return
+	}
+
+	s.relayStream(c, response)
+}
+
+// HTTPHandler invokes the function which declares the most specific route matching the request with an
+// API Gateway HTTP API v2 event and maps its response back to HTTP.
+func (s *Server) HTTPHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	match := s.RouteTable.match(c.Request.Method, c.Request.URL.Path)
+	if match == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "route not found"})
+
+		return
+	}
+
+	if !s.authenticate(c, match.function) || !s.rateLimit(c, match.function) {
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.Error(err)
+
+		return
+	}
+
+	metadata, err := invocationMetadata(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	event, err := json.Marshal(newHTTPEvent(c, match, body))
+	if err != nil {
+		c.Error(err)
+
+		return
+	}
+
+	response, err := s.Invoker.InvokeStream(ctx, match.function, event, metadata)
+	if err != nil {
+		s.invocationFailed(c, match.function, err)
+
+		return
+	}
+	defer response.Body.Close()
+
+	if response.Streaming {
+		s.relayStream(c, response)
+
+		return
+	}
+
+	data, err := io.ReadAll(response.Body)
 	if err != nil {
 		c.Error(err)
 
 		return
 	}
 
-	c.Data(http.StatusOK, core.ContentTypeJSON, response)
+	err = writeHTTPResponse(c, data)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	}
+}
+
+// AuthMiddleware authenticates invocations of the function set by middlewares.FunctionMiddleware.
+func (s *Server) AuthMiddleware(c *gin.Context) {
+	function := c.MustGet("function").(core.FunctionDefinition) //nolint:forcetypeassert
+
+	if !s.authenticate(c, function) {
+		return
+	}
+
+	c.Next()
+}
+
+// authenticate stores the caller of the function in the context. If authentication fails, it responds with
+// 401 or 403, aborts the request and returns false.
+func (s *Server) authenticate(c *gin.Context, function core.FunctionDefinition) bool {
+	principal, err := s.Authenticator.Authenticate(c.Request.Context(), c.Request, function)
+	if err != nil {
+		switch {
+		case errors.Is(err, core.ErrUnauthenticated):
+			if function.AuthConfig().Type == core.AuthTypeJWT {
+				c.Header(core.HeaderNameWWWAuthenticate, "Bearer")
+			}
+
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, core.ErrForbidden):
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.Error(err)
+			c.Abort()
+		}
+
+		return false
+	}
+
+	if principal != nil {
+		c.Set("principal", principal)
+	}
+
+	return true
+}
+
+// RateLimitMiddleware enforces rate limits of the function set by middlewares.FunctionMiddleware and quotas
+// of the caller authenticated by AuthMiddleware.
+func (s *Server) RateLimitMiddleware(c *gin.Context) {
+	function := c.MustGet("function").(core.FunctionDefinition) //nolint:forcetypeassert
+
+	if !s.rateLimit(c, function) {
+		return
+	}
+
+	c.Next()
+}
+
+// rateLimit takes a token for the invocation and reports the rate limit in X-RateLimit headers. If the
+// invocation is throttled, it responds with 429, aborts the request and returns false.
+func (s *Server) rateLimit(c *gin.Context, function core.FunctionDefinition) bool {
+	var principal *core.Principal
+
+	caller := "ip:" + c.ClientIP()
+
+	if value, ok := c.Get("principal"); ok {
+		principal = value.(*core.Principal) //nolint:forcetypeassert
+
+		if identity := principalIdentity(principal); identity != "" {
+			caller = identity
+		}
+	}
+
+	status, err := s.RateLimiter.Take(c.Request.Context(), function, caller, principal)
+
+	if status != nil && status.Limit > 0 {
+		c.Header(core.HeaderNameRateLimitLimit, strconv.Itoa(status.Limit))
+		c.Header(core.HeaderNameRateLimitRemaining, strconv.Itoa(status.Remaining))
+		c.Header(core.HeaderNameRateLimitReset, strconv.Itoa(int(math.Ceil(status.Reset.Seconds()))))
+	}
+
+	if err != nil {
+		if errors.Is(err, core.ErrThrottled) {
+			retryAfter := max(int(math.Ceil(status.RetryAfter.Seconds())), 1)
+
+			c.Header(core.HeaderNameRetryAfter, strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+
+			return false
+		}
+
+		c.Error(err)
+		c.Abort()
+
+		return false
+	}
+
+	return true
+}
+
+// relayStream writes chunks of a streamed response to the client as soon as they arrive. Once the status
+// is sent, errors cannot be reported to the client anymore, so the connection is just closed.
+func (s *Server) relayStream(c *gin.Context, response *core.InvocationResponse) {
+	c.Header(core.HeaderNameContentType, response.ContentType)
+	c.Status(http.StatusOK)
+
+	buf := make([]byte, streamBufferSize)
+
+	for {
+		n, err := response.Body.Read(buf)
+		if n > 0 {
+			_, writeErr := c.Writer.Write(buf[:n])
+			if writeErr != nil {
+				s.Logger.Warn("Failed to write streamed response", "error", writeErr)
+				c.Abort()
+
+				return
+			}
+
+			c.Writer.Flush()
+		}
+
+		if errors.Is(err, io.EOF) {
+			return
+		}
+
+		if err != nil {
+			s.Logger.Error("Failed to stream response", "error", err)
+			c.Abort()
+
+			return
+		}
+	}
+}
+
+// InvokeAsyncHandler enqueues an invocation and responds with its request ID, the result can be fetched
+// with InvocationHandler.
+func (s *Server) InvokeAsyncHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	function := c.MustGet("function").(core.FunctionDefinition) //nolint:forcetypeassert
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.Error(err)
+
+		return
+	}
+
+	metadata, err := invocationMetadata(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	requestID, err := s.Invoker.InvokeAsync(ctx, function, body, metadata)
+	if err != nil {
+		s.invocationFailed(c, function, err)
+
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"requestID": requestID})
+}
+
+// InvocationMiddleware stores the invocation with the request ID from the path in the context. The caller
+// is authenticated with the invocation's function and must be the one who invoked it. Otherwise, it responds
+// with 404 as if the invocation did not exist, so its existence is not revealed to others.
+func (s *Server) InvocationMiddleware(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	invocation, err := s.InvocationsRepo.Get(ctx, c.Param("requestID"))
+	if err != nil {
+		if errors.Is(err, core.ErrInvocationNotFound) {
+			invocationNotFound(c)
+
+			return
+		}
+
+		c.Error(err)
+		c.Abort()
+
+		return
+	}
+
+	function, err := s.FunctionsRepo.Get(ctx, invocation.Function)
+	if err != nil {
+		if errors.Is(err, core.ErrFunctionNotFound) {
+			invocationNotFound(c)
+
+			return
+		}
+
+		c.Error(err)
+		c.Abort()
+
+		return
+	}
+
+	principal, err := s.Authenticator.Authenticate(ctx, c.Request, function)
+	if err != nil {
+		if errors.Is(err, core.ErrUnauthenticated) || errors.Is(err, core.ErrForbidden) {
+			invocationNotFound(c)
+
+			return
+		}
+
+		c.Error(err)
+		c.Abort()
+
+		return
+	}
+
+	if principalIdentity(principal) != invocation.Caller {
+		invocationNotFound(c)
+
+		return
+	}
+
+	c.Set("invocation", invocation)
+
+	c.Next()
+}
+
+// InvocationHandler responds with the invocation stored by InvocationMiddleware.
+func (s *Server) InvocationHandler(c *gin.Context) {
+	invocation := c.MustGet("invocation").(core.Invocation) //nolint:forcetypeassert
+
+	c.JSON(http.StatusOK, serializeInvocation(invocation))
+}
+
+func invocationNotFound(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "invocation not found"})
+}
+
+// principalIdentity returns the principal's type and ID, it's empty when the caller is anonymous or HMAC
+// signed requests which have no identity.
+func principalIdentity(principal *core.Principal) string {
+	if principal == nil || principal.ID == "" {
+		return ""
+	}
+
+	return string(principal.Type) + ":" + principal.ID
+}
+
+// throttled responds with 429 and asks the client to retry the invocation later.
+func throttled(c *gin.Context, err error) {
+	c.Header(core.HeaderNameRetryAfter, strconv.Itoa(int(core.ThrottleRetryAfter.Seconds())))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+}
+
+// invocationMetadata extracts invocation context from request headers named after the AWS Lambda Invoke API
+// and adds the authenticated caller.
+func invocationMetadata(c *gin.Context) (core.InvocationMetadata, error) {
+	metadata := core.InvocationMetadata{
+		RequestID:       c.GetString("requestID"),
+		TraceID:         c.GetHeader(core.HeaderNameAmznTraceID),
+		CognitoIdentity: c.GetHeader(core.HeaderNameAmzCognitoIdentity),
+	}
+
+	if principal, ok := c.Get("principal"); ok {
+		data, err := json.Marshal(principal)
+		if err != nil {
+			return metadata, fmt.Errorf("failed to marshal principal: %w", err)
+		}
+
+		metadata.Principal = string(data)
+		metadata.Caller = principalIdentity(principal.(*core.Principal)) //nolint:forcetypeassert
+	}
+
+	clientContext := c.GetHeader(core.HeaderNameAmzClientContext)
+	if clientContext != "" {
+		decoded, err := base64.StdEncoding.DecodeString(clientContext)
+		if err != nil {
+			return metadata, fmt.Errorf("%w: %w", ErrInvalidClientContext, err)
+		}
+
+		metadata.ClientContext = string(decoded)
+	}
+
+	return metadata, nil
+}
+
+func serializeInvocation(invocation core.Invocation) gin.H {
+	result := gin.H{
+		"requestID": invocation.RequestID,
+		"function":  invocation.Function,
+		"status":    invocation.Status,
+		"createdAt": invocation.CreatedAt,
+	}
+
+	if invocation.Status == core.InvocationStatusPending {
+		return result
+	}
+
+	result["finishedAt"] = invocation.FinishedAt
+
+	// Functions usually respond with JSON, it's embedded as is, anything else is returned as a string.
+	var response any = string(invocation.Response)
+	if json.Valid(invocation.Response) {
+		response = json.RawMessage(invocation.Response)
+	}
+
+	if invocation.Status == core.InvocationStatusFailed {
+		result["error"] = response
+	} else {
+		result["response"] = response
+	}
+
+	return result
 }
@@ -0,0 +1,408 @@
+package gateway_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/gateway"
+	"github.com/zhulik/fid/internal/httpserver"
+	"github.com/zhulik/fid/internal/invocation"
+	"github.com/zhulik/fid/pkg/json"
+	"github.com/zhulik/fid/testhelpers"
+	"github.com/zhulik/pal"
+)
+
+// event is the part of API Gateway HTTP API v2 events checked by the specs.
+type event struct {
+	RouteKey        string            `json:"routeKey"`
+	Cookies         []string          `json:"cookies"`
+	PathParameters  map[string]string `json:"pathParameters"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+}
+
+var _ = Describe("Server", Serial, func() {
+	var server *gateway.Server
+	var routeTable *gateway.RouteTable
+	var functionsRepo core.FunctionsRepo
+	var pubSuber core.PubSuber
+	var invocationsRepo core.InvocationsRepo
+	var apiKeysRepo core.APIKeysRepo
+	var instancesRepo core.InstancesRepo
+	var instancesView core.InstancesView
+	var limiter core.ConcurrencyLimiter
+
+	items := docker.Function{
+		Name_:    "items",
+		Timeout_: 5 * time.Second,
+		Routes_: []core.Route{
+			{Method: http.MethodGet, Path: "/items/{id}"},
+			{Method: core.RouteMethodAny, Path: "/items"},
+		},
+	}
+	newItem := docker.Function{
+		Name_:    "new-item",
+		Timeout_: 5 * time.Second,
+		Routes_:  []core.Route{{Method: http.MethodGet, Path: "/items/new"}},
+	}
+	files := docker.Function{
+		Name_:    "files",
+		Timeout_: 5 * time.Second,
+		Routes_:  []core.Route{{Method: core.RouteMethodAny, Path: "/files/{path+}"}},
+	}
+
+	BeforeEach(func(ctx SpecContext) {
+		p := testhelpers.NewMemoryPal(ctx,
+			gateway.Provide(),
+			invocation.Provide(),
+			httpserver.Provide(),
+			pal.Provide[core.FunctionsRepo](&docker.FunctionsRepo{}),
+			pal.Provide[core.InstancesView](&docker.InstancesView{}),
+			pal.Provide[core.InstancesRepo](&docker.InstancesRepo{}),
+		)
+
+		server = lo.Must(pal.Invoke[*gateway.Server](ctx, p))
+		routeTable = lo.Must(pal.Invoke[*gateway.RouteTable](ctx, p))
+		DeferCleanup(routeTable.Shutdown)
+		functionsRepo = lo.Must(pal.Invoke[core.FunctionsRepo](ctx, p))
+		pubSuber = lo.Must(pal.Invoke[core.PubSuber](ctx, p))
+		invocationsRepo = lo.Must(pal.Invoke[core.InvocationsRepo](ctx, p))
+		apiKeysRepo = lo.Must(pal.Invoke[core.APIKeysRepo](ctx, p))
+		instancesRepo = lo.Must(pal.Invoke[core.InstancesRepo](ctx, p))
+		instancesView = lo.Must(pal.Invoke[core.InstancesView](ctx, p))
+		limiter = lo.Must(pal.Invoke[core.ConcurrencyLimiter](ctx, p))
+
+		for _, function := range []docker.Function{items, newItem, files} {
+			lo.Must0(functionsRepo.Upsert(ctx, function))
+			lo.Must0(pubSuber.CreateOrUpdateFunctionStream(ctx, function))
+		}
+
+		Eventually(func() string { return routeTable.MatchedFunction(http.MethodGet, "/files/a") }).
+			Should(Equal(files.Name()))
+	})
+
+	// respond picks up the next invocation of the function like the runtime API does, responds with the
+	// given response and returns the event it was invoked with.
+	respond := func(ctx context.Context, function core.FunctionDefinition, response any) <-chan event {
+		events := make(chan event, 1)
+
+		go func() {
+			defer GinkgoRecover()
+
+			msg := lo.Must(pubSuber.Next(ctx, pubSuber.FunctionStreamName(function),
+				[]string{pubSuber.InvokeSubjectName(function)}, function.Name()))
+			lo.Must0(msg.Ack())
+
+			events <- lo.Must(json.Unmarshal[event](msg.Data()))
+
+			requestID := msg.Headers().Get(core.HeaderNameRequestID)
+
+			lo.Must0(pubSuber.Publish(ctx, &nats.Msg{
+				Subject: pubSuber.ResponseSubjectName(function, requestID),
+				Data:    lo.Must(json.Marshal(response)),
+			}))
+		}()
+
+		return events
+	}
+
+	serve := func(request *http.Request) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		server.Router.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	Describe("routes", func() {
+		It("prefers literal segments over parameters", func() {
+			Expect(routeTable.MatchedFunction(http.MethodGet, "/items/new")).To(Equal(newItem.Name()))
+			Expect(routeTable.MatchedFunction(http.MethodGet, "/items/42")).To(Equal(items.Name()))
+		})
+
+		It("matches ANY with every method", func() {
+			Expect(routeTable.MatchedFunction(http.MethodDelete, "/items")).To(Equal(items.Name()))
+			Expect(routeTable.MatchedFunction(http.MethodDelete, "/items/42")).To(BeEmpty())
+		})
+
+		It("matches greedy parameters with one or more segments", func() {
+			Expect(routeTable.MatchedFunction(http.MethodPut, "/files/a/b/c")).To(Equal(files.Name()))
+			Expect(routeTable.MatchedFunction(http.MethodPut, "/files")).To(BeEmpty())
+		})
+
+		It("follows changes of functions", func(ctx SpecContext) {
+			lo.Must0(functionsRepo.Upsert(ctx, docker.Function{
+				Name_:   "users",
+				Routes_: []core.Route{{Method: http.MethodGet, Path: "/users"}},
+			}))
+
+			Eventually(func() string { return routeTable.MatchedFunction(http.MethodGet, "/users") }).
+				Should(Equal("users"))
+
+			lo.Must0(functionsRepo.Delete(ctx, files.Name()))
+
+			Eventually(func() string { return routeTable.MatchedFunction(http.MethodGet, "/files/a") }).
+				Should(BeEmpty())
+		})
+	})
+
+	Describe("HTTPHandler", func() {
+		Context("when no route matches the request", func() {
+			It("responds with 404", func() {
+				Expect(serve(httptest.NewRequest(http.MethodGet, "/unknown", nil)).Code).To(Equal(http.StatusNotFound))
+			})
+		})
+
+		It("passes path parameters", func(ctx SpecContext) {
+			events := respond(ctx, files, map[string]any{"statusCode": http.StatusOK})
+
+			serve(httptest.NewRequestWithContext(ctx, http.MethodGet, "/files/docs/readme.md", nil))
+
+			received := <-events
+			Expect(received.RouteKey).To(Equal("ANY /files/{path+}"))
+			Expect(received.PathParameters).To(Equal(map[string]string{"path": "docs/readme.md"}))
+		})
+
+		It("base64 encodes binary bodies", func(ctx SpecContext) {
+			events := respond(ctx, items, map[string]any{"statusCode": http.StatusOK})
+
+			body := []byte{0xff, 0xfe, 0x00}
+			serve(httptest.NewRequestWithContext(ctx, http.MethodPost, "/items", bytes.NewReader(body)))
+
+			received := <-events
+			Expect(received.IsBase64Encoded).To(BeTrue())
+			Expect(base64.StdEncoding.DecodeString(received.Body)).To(Equal(body))
+		})
+
+		It("decodes base64 encoded responses", func(ctx SpecContext) {
+			respond(ctx, items, map[string]any{
+				"statusCode":      http.StatusOK,
+				"headers":         map[string]string{"Content-Type": "image/png"},
+				"body":            base64.StdEncoding.EncodeToString([]byte{0x89, 0x50}),
+				"isBase64Encoded": true,
+			})
+
+			response := serve(httptest.NewRequestWithContext(ctx, http.MethodGet, "/items/42", nil))
+
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(response.Header().Get(core.HeaderNameContentType)).To(Equal("image/png"))
+			Expect(response.Body.Bytes()).To(Equal([]byte{0x89, 0x50}))
+		})
+
+		It("passes cookies both ways", func(ctx SpecContext) {
+			events := respond(ctx, items, map[string]any{
+				"statusCode": http.StatusOK,
+				"cookies":    []string{"session=new; HttpOnly", "theme=dark"},
+			})
+
+			request := httptest.NewRequestWithContext(ctx, http.MethodGet, "/items/42", nil)
+			request.AddCookie(&http.Cookie{Name: "session", Value: "old"})
+
+			response := serve(request)
+
+			Expect((<-events).Cookies).To(Equal([]string{"session=old"}))
+			Expect(response.Header().Values("Set-Cookie")).To(Equal([]string{"session=new; HttpOnly", "theme=dark"}))
+		})
+
+		Describe("status mapping", func() {
+			It("responds with the function's status code", func(ctx SpecContext) {
+				respond(ctx, items, map[string]any{"statusCode": http.StatusCreated, "body": `{"id":"42"}`})
+
+				response := serve(httptest.NewRequestWithContext(ctx, http.MethodPost, "/items", nil))
+
+				Expect(response.Code).To(Equal(http.StatusCreated))
+				Expect(response.Header().Get(core.HeaderNameContentType)).To(Equal(core.ContentTypeJSON))
+				Expect(response.Body.String()).To(Equal(`{"id":"42"}`))
+			})
+
+			It("responds with 200 when the function's response has no status code", func(ctx SpecContext) {
+				respond(ctx, items, map[string]any{"id": "42"})
+
+				response := serve(httptest.NewRequestWithContext(ctx, http.MethodGet, "/items/42", nil))
+
+				Expect(response.Code).To(Equal(http.StatusOK))
+				Expect(response.Body.String()).To(Equal(`{"id":"42"}`))
+			})
+
+			It("responds with 502 when the function's status code is invalid", func(ctx SpecContext) {
+				respond(ctx, items, map[string]any{"statusCode": 700})
+
+				response := serve(httptest.NewRequestWithContext(ctx, http.MethodGet, "/items/42", nil))
+
+				Expect(response.Code).To(Equal(http.StatusBadGateway))
+				Expect(response.Body.String()).To(ContainSubstring(gateway.ErrMalformedHTTPResponse.Error()))
+			})
+		})
+	})
+
+	Describe("InvocationHandler", func() {
+		private := docker.Function{Name_: "private", Auth: core.AuthConfig{Type: core.AuthTypeAPIKey}}
+
+		var key string
+
+		BeforeEach(func(ctx SpecContext) {
+			lo.Must0(functionsRepo.Upsert(ctx, private))
+			lo.Must0(pubSuber.CreateOrUpdateFunctionStream(ctx, private))
+
+			key = lo.Must(apiKeysRepo.Create(ctx, core.APIKey{Name: "client"}))
+		})
+
+		invoke := func(ctx context.Context, key string) string {
+			request := httptest.NewRequestWithContext(ctx, http.MethodPost, "/invoke/private/async", nil)
+			request.Header.Set(core.HeaderNameAPIKey, key)
+
+			response := serve(request)
+			Expect(response.Code).To(Equal(http.StatusAccepted))
+
+			body := lo.Must(json.Unmarshal[map[string]string](response.Body.Bytes()))
+
+			return body["requestID"]
+		}
+
+		get := func(ctx context.Context, requestID, key string) *httptest.ResponseRecorder {
+			request := httptest.NewRequestWithContext(ctx, http.MethodGet, "/invocations/"+requestID, nil)
+			request.Header.Set(core.HeaderNameAPIKey, key)
+
+			return serve(request)
+		}
+
+		It("stores the caller with the invocation", func(ctx SpecContext) {
+			invocation := lo.Must(invocationsRepo.Get(ctx, invoke(ctx, key)))
+
+			Expect(invocation.Caller).To(Equal("apiKey:client"))
+		})
+
+		It("responds with the invocation to its caller", func(ctx SpecContext) {
+			response := get(ctx, invoke(ctx, key), key)
+
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(response.Body.String()).To(ContainSubstring(`"status":"pending"`))
+			Expect(response.Header().Get(core.HeaderNameRateLimitLimit)).To(BeEmpty())
+		})
+
+		Context("when the caller is not authenticated", func() {
+			It("responds with 404", func(ctx SpecContext) {
+				Expect(get(ctx, invoke(ctx, key), "").Code).To(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("when the invocation belongs to another caller", func() {
+			It("responds with 404", func(ctx SpecContext) {
+				other := lo.Must(apiKeysRepo.Create(ctx, core.APIKey{Name: "other"}))
+
+				Expect(get(ctx, invoke(ctx, key), other).Code).To(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("when the invocation does not exist", func() {
+			It("responds with 404", func(ctx SpecContext) {
+				Expect(get(ctx, "unknown", key).Code).To(Equal(http.StatusNotFound))
+			})
+		})
+	})
+
+	Describe("failed invocations", func() {
+		slow := docker.Function{Name_: "slow", Timeout_: 200 * time.Millisecond, MaxConcurrency: 1}
+
+		BeforeEach(func(ctx SpecContext) {
+			lo.Must0(functionsRepo.Upsert(ctx, slow))
+			lo.Must0(pubSuber.CreateOrUpdateFunctionStream(ctx, slow))
+		})
+
+		invoke := func(ctx context.Context, function core.FunctionDefinition) *httptest.ResponseRecorder {
+			return serve(httptest.NewRequestWithContext(ctx, http.MethodPost, "/invoke/"+function.Name(), nil))
+		}
+
+		Context("when the function fails", func() {
+			It("responds with 502 and the function's error", func(ctx SpecContext) {
+				go func() {
+					defer GinkgoRecover()
+
+					msg := lo.Must(pubSuber.Next(ctx, pubSuber.FunctionStreamName(items),
+						[]string{pubSuber.InvokeSubjectName(items)}, items.Name()))
+					lo.Must0(msg.Ack())
+
+					lo.Must0(pubSuber.Publish(ctx, &nats.Msg{
+						Subject: pubSuber.ErrorSubjectName(items, msg.Headers().Get(core.HeaderNameRequestID)),
+						Header:  nats.Header{core.HeaderNameErrorType: {"Function.Error"}},
+						Data:    []byte("failed"),
+					}))
+				}()
+
+				response := invoke(ctx, items)
+
+				Expect(response.Code).To(Equal(http.StatusBadGateway))
+				Expect(response.Header().Get(core.HeaderNameFidFunctionError)).To(Equal("Function.Error"))
+				Expect(response.Body.String()).To(ContainSubstring(`"errorMessage":"failed"`))
+			})
+		})
+
+		Context("when the invocation is throttled", func() {
+			It("responds with 429", func(ctx SpecContext) {
+				release := lo.Must(limiter.Acquire(ctx, slow, "other"))
+				DeferCleanup(release)
+
+				response := invoke(ctx, slow)
+
+				Expect(response.Code).To(Equal(http.StatusTooManyRequests))
+				Expect(response.Header().Get(core.HeaderNameRetryAfter)).To(Equal("1"))
+			})
+		})
+
+		Context("when the function is unavailable", func() {
+			It("responds with 503", func(ctx SpecContext) {
+				unavailable := docker.Function{Name_: "unavailable", Timeout_: time.Second}
+				lo.Must0(functionsRepo.Upsert(ctx, unavailable))
+
+				response := invoke(ctx, unavailable)
+
+				Expect(response.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(response.Header().Get(core.HeaderNameRetryAfter)).To(Equal("1"))
+			})
+		})
+
+		Context("when the function does not respond in time", func() {
+			Context("when it has instances", func() {
+				BeforeEach(func(ctx SpecContext) {
+					lo.Must0(instancesRepo.Add(ctx, slow, "instance"))
+					lo.Must0(instancesRepo.Heartbeat(ctx, slow, "instance"))
+
+					Eventually(func() int { return instancesView.Count(slow) }).Should(Equal(1))
+				})
+
+				It("responds with 504", func(ctx SpecContext) {
+					Expect(invoke(ctx, slow).Code).To(Equal(http.StatusGatewayTimeout))
+				})
+			})
+
+			Context("when it has no instances", func() {
+				It("responds with 503", func(ctx SpecContext) {
+					response := invoke(ctx, slow)
+
+					Expect(response.Code).To(Equal(http.StatusServiceUnavailable))
+					Expect(response.Body.String()).To(ContainSubstring(core.ErrNoCapacity.Error()))
+				})
+			})
+		})
+
+		Context("when the client goes away", func() {
+			It("responds with nothing", func(ctx SpecContext) {
+				requestCtx, cancel := context.WithCancel(ctx)
+				time.AfterFunc(50*time.Millisecond, cancel)
+
+				response := invoke(requestCtx, slow)
+
+				Expect(response.Body.Len()).To(BeZero())
+			})
+		})
+	})
+})
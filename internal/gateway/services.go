@@ -1,11 +1,16 @@
 package gateway
 
 import (
+	"github.com/zhulik/fid/internal/core"
 	"github.com/zhulik/pal"
 )
 
 func Provide() pal.ServiceDef {
 	return pal.ProvideList(
 		pal.Provide(&Server{}),
+		pal.Provide(&Authenticator{}),
+		pal.Provide(&RateLimiter{}),
+		pal.Provide(&RouteTable{}),
+		pal.Provide[core.APIKeysRepo](&APIKeysRepo{}),
 	)
 }
@@ -5,22 +5,28 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/samber/lo"
 	"github.com/zhulik/fid/internal/config"
 	"github.com/zhulik/fid/internal/core"
 	"github.com/zhulik/fid/internal/httpserver"
+	"github.com/zhulik/fid/internal/middlewares"
+	"github.com/zhulik/fid/pkg/json"
 	"github.com/zhulik/pal"
 )
 
 type Server struct {
 	*httpserver.Server
 
-	Config        *config.Config
-	Logger        *slog.Logger
-	Backend       core.ContainerBackend
-	FunctionsRepo core.FunctionsRepo
+	Config          *config.Config
+	Logger          *slog.Logger
+	Backend         core.ContainerBackend
+	FunctionsRepo   core.FunctionsRepo
+	InstancesView   core.InstancesView
+	DeadLetterQueue core.DeadLetterQueue
+	Invoker         core.Invoker
 
 	Pal *pal.Pal
 }
@@ -31,6 +37,15 @@ func (s *Server) Init(ctx context.Context) error {
 	s.Router.GET("/functions", s.FunctionsHandler)
 	s.Router.GET("/functions/:functionName", s.FunctionHandler)
 
+	dlq := s.Router.Group("/functions/:functionName/dlq")
+
+	dlq.Use(middlewares.FunctionMiddleware(s.FunctionsRepo, func(c *gin.Context) string {
+		return c.Param("functionName")
+	}))
+
+	dlq.GET("", s.DeadLettersHandler)
+	dlq.POST("/:id/redrive", s.RedriveHandler)
+
 	return nil
 }
 
@@ -42,6 +57,8 @@ func (s *Server) BackendHandler(c *gin.Context) {
 	info, err := s.Backend.Info(c)
 	if err != nil {
 		c.Error(err)
+
+		return
 	}
 
 	c.IndentedJSON(http.StatusOK, info)
@@ -51,10 +68,12 @@ func (s *Server) FunctionsHandler(c *gin.Context) {
 	functions, err := s.FunctionsRepo.List(c.Request.Context())
 	if err != nil {
 		c.Error(err)
+
+		return
 	}
 
 	fns := lo.Map(functions, func(fn core.FunctionDefinition, _ int) gin.H {
-		return serializeFunction(fn)
+		return s.serializeFunction(fn)
 	})
 
 	c.IndentedJSON(http.StatusOK, fns)
@@ -68,18 +87,131 @@ func (s *Server) FunctionHandler(c *gin.Context) {
 
 			return
 		}
+
+		c.Error(err)
+
+		return
+	}
+
+	serialized := s.serializeFunction(function)
+	if initError := s.InstancesView.LastInitError(function); initError != nil {
+		serialized["lastInitError"] = serializeInitError(*initError)
+	}
+
+	c.IndentedJSON(http.StatusOK, serialized)
+}
+
+func (s *Server) DeadLettersHandler(c *gin.Context) {
+	function := c.MustGet("function").(core.FunctionDefinition) //nolint:forcetypeassert
+
+	letters, err := s.DeadLetterQueue.List(c.Request.Context(), function)
+	if err != nil {
+		c.Error(err)
+
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, lo.Map(letters, func(letter core.DeadLetter, _ int) gin.H {
+		return serializeDeadLetter(letter)
+	}))
+}
+
+// RedriveHandler invokes the function asynchronously with the dead letter's payload and removes the letter
+// from the queue. The new invocation gets a new request ID.
+func (s *Server) RedriveHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	function := c.MustGet("function").(core.FunctionDefinition) //nolint:forcetypeassert
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid dead letter id"})
+
+		return
+	}
+
+	letter, err := s.DeadLetterQueue.Get(ctx, function, id)
+	if err != nil {
+		if errors.Is(err, core.ErrDeadLetterNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "dead letter not found"})
+
+			return
+		}
+
+		c.Error(err)
+
+		return
+	}
+
+	requestID, err := s.Invoker.InvokeAsync(ctx, function, letter.Payload, letter.Metadata)
+	if err != nil {
+		// The letter is kept, so it can be redriven once the function's queue has room.
+		if errors.Is(err, core.ErrQueueFull) {
+			c.Header(core.HeaderNameRetryAfter, strconv.Itoa(int(core.ThrottleRetryAfter.Seconds())))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+
+			return
+		}
+
+		c.Error(err)
+
+		return
 	}
 
-	c.IndentedJSON(http.StatusOK, serializeFunction(function))
+	err = s.DeadLetterQueue.Delete(ctx, function, id)
+	if err != nil {
+		c.Error(err)
+
+		return
+	}
+
+	s.Logger.Info("Dead letter redriven", "function", function, "id", id, "requestID", requestID)
+
+	c.JSON(http.StatusAccepted, gin.H{"requestID": requestID})
 }
 
-func serializeFunction(fn core.FunctionDefinition) gin.H {
+func (s *Server) serializeFunction(fn core.FunctionDefinition) gin.H {
 	return gin.H{
-		"name":     fn.Name(),
-		"timeout":  fn.Timeout().Seconds(),
-		"minScale": fn.ScalingConfig().Min,
-		"maxScale": fn.ScalingConfig().Max,
-		// TODO: running instances
+		"name":           fn.Name(),
+		"timeout":        fn.Timeout().Seconds(),
+		"minScale":       fn.ScalingConfig().Min,
+		"maxScale":       fn.ScalingConfig().Max,
+		"concurrency":    fn.ScalingConfig().Concurrency,
+		"maxConcurrency": fn.LimitsConfig().MaxConcurrency,
+		"maxQueueLength": fn.LimitsConfig().MaxQueueLength,
+		"idleTimeout":    fn.ScalingConfig().IdleTimeout.Seconds(),
+		"retries":        fn.RetryConfig().Retries,
+		"instances":      s.InstancesView.Count(fn),
+		"availableSlots": s.InstancesView.CountAvailable(fn),
 		// TODO: something else?
 	}
 }
+
+func serializeInitError(initError core.InitError) gin.H {
+	// Runtimes usually report errors as JSON.
+	return gin.H{
+		"instanceID": initError.InstanceID,
+		"timestamp":  initError.Timestamp,
+		"error":      rawJSON(initError.Payload),
+	}
+}
+
+func serializeDeadLetter(letter core.DeadLetter) gin.H {
+	return gin.H{
+		"id":        letter.ID,
+		"requestID": letter.RequestID,
+		"payload":   rawJSON(letter.Payload),
+		"error":     rawJSON(letter.Error),
+		"attempts":  letter.Attempts,
+		"failedAt":  letter.FailedAt,
+	}
+}
+
+// rawJSON embeds JSON payloads as is, anything else is returned as a string.
+func rawJSON(payload []byte) any {
+	if json.Valid(payload) {
+		return json.RawMessage(payload)
+	}
+
+	return string(payload)
+}
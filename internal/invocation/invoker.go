@@ -1,60 +1,264 @@
 package invocation
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"log/slog"
 	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
+	"github.com/samber/lo"
 	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/payloads"
 )
 
 // TODO: move to pubusub?
 
 type Invoker struct {
-	PubSuber core.PubSuber
-	KV       core.KV
-	Logger   *slog.Logger
+	PubSuber           core.PubSuber
+	KV                 core.KV
+	InvocationsRepo    core.InvocationsRepo
+	ConcurrencyLimiter core.ConcurrencyLimiter
+	BlobStore          core.BlobStore
+	Logger             *slog.Logger
 }
 
-func (i Invoker) Invoke(ctx context.Context, function core.FunctionDefinition, payload []byte) ([]byte, error) {
-	requestID := uuid.NewString()
+func (i Invoker) Invoke(
+	ctx context.Context,
+	function core.FunctionDefinition,
+	payload []byte,
+	metadata core.InvocationMetadata,
+) ([]byte, error) {
+	response, err := i.InvokeStream(ctx, function, payload, metadata)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return data, nil
+}
+
+// InvokeStream publishes the invocation and waits for the first response message. The whole response,
+// including streamed chunks, must arrive before the function's timeout. The invocation holds a concurrency
+// slot until the response is closed.
+func (i Invoker) InvokeStream(
+	ctx context.Context,
+	function core.FunctionDefinition,
+	payload []byte,
+	metadata core.InvocationMetadata,
+) (*core.InvocationResponse, error) {
+	requestID := lo.CoalesceOrEmpty(metadata.RequestID, uuid.NewString())
+
+	err := i.checkQueueLength(ctx, function)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := i.ConcurrencyLimiter.Acquire(ctx, function, requestID)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
 	subject := i.PubSuber.InvokeSubjectName(function)
-	deadline := time.Now().Add(function.Timeout()).UnixMilli()
+	deadline := time.Now().Add(function.Timeout())
 
 	msg := nats.NewMsg(subject)
 	msg.Data = payload
-	msg.Header = nats.Header{
-		core.HeaderNameRequestID:       {requestID},
-		core.HeaderNameRequestDeadline: {strconv.FormatInt(deadline, 10)},
-	}
+	msg.Header = invocationHeader(function, requestID, core.InvocationTypeRequestResponse, metadata)
+	msg.Header.Set(core.HeaderNameRequestDeadline, strconv.FormatInt(deadline.UnixMilli(), 10))
 
 	errorSubject := i.PubSuber.ErrorSubjectName(function, requestID)
+	subjects := []string{
+		i.PubSuber.ResponseSubjectName(function, requestID),
+		errorSubject,
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+
+	sub, err := i.PubSuber.Subscribe(ctx, i.PubSuber.ResponseStreamName(function), subjects, "")
+	if err != nil {
+		cancel()
+		release()
 
-	responseInput := core.PublishWaitResponseInput{
-		Subjects: []string{
-			i.PubSuber.ResponseSubjectName(function, requestID),
-			errorSubject,
-		},
-		Stream:  i.PubSuber.FunctionStreamName(function),
-		Msg:     msg,
-		Timeout: function.Timeout(),
+		return nil, fmt.Errorf("failed to subscribe to response: %w", err)
+	}
+
+	stream := &responseStream{
+		ctx:          ctx,
+		cancel:       cancel,
+		sub:          sub,
+		errorSubject: errorSubject,
+		blobs:        i.BlobStore,
+		release:      release,
 	}
 
 	i.Logger.Info("Invoking...", "requestID", requestID, "function", function)
 
-	response, err := i.PubSuber.PublishWaitResponse(ctx, responseInput)
+	err = payloads.Offload(ctx, i.BlobStore, msg)
+	if err != nil {
+		stream.Close()
+
+		return nil, err //nolint:wrapcheck
+	}
+
+	err = i.PubSuber.Publish(ctx, msg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to publish and wait for response: %w", err)
+		stream.Close()
+
+		return nil, fmt.Errorf("failed to publish: %w", err)
 	}
 
-	data := response.Data()
-	if response.Subject() == errorSubject {
-		return nil, fmt.Errorf("%w: %s", core.ErrFunctionErrored, string(data))
+	first, err := stream.next()
+	if err != nil {
+		stream.Close()
+
+		return nil, err
 	}
 
-	return data, nil
+	if first.Headers().Get(core.HeaderNameResponseMode) != core.ResponseModeStreaming {
+		defer stream.Close()
+
+		response, err := stream.resolve(first)
+		if err != nil {
+			return nil, err
+		}
+
+		return &core.InvocationResponse{
+			ContentType: core.ContentTypeJSON,
+			Body:        io.NopCloser(bytes.NewReader(response)),
+		}, nil
+	}
+
+	return &core.InvocationResponse{
+		Streaming:   true,
+		ContentType: first.Headers().Get(core.HeaderNameContentType),
+		Body:        stream,
+	}, nil
+}
+
+// InvokeAsync stores a pending invocation record and publishes the event, it's throttled like synchronous
+// invocations. The deadline is not set, the runtime API calculates it when the event is picked up by an
+// instance. The runtime API stores the result in the invocations repo instead of publishing it.
+func (i Invoker) InvokeAsync(
+	ctx context.Context,
+	function core.FunctionDefinition,
+	payload []byte,
+	metadata core.InvocationMetadata,
+) (string, error) {
+	requestID := lo.CoalesceOrEmpty(metadata.RequestID, uuid.NewString())
+
+	err := i.checkQueueLength(ctx, function)
+	if err != nil {
+		return "", err
+	}
+
+	// Queued invocations don't hold concurrency slots, but they are not accepted while the function is
+	// at its limits.
+	release, err := i.ConcurrencyLimiter.Acquire(ctx, function, requestID)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	release()
+
+	err = i.InvocationsRepo.Create(ctx, core.Invocation{
+		RequestID: requestID,
+		Function:  function.Name(),
+		Status:    core.InvocationStatusPending,
+		Caller:    metadata.Caller,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create invocation: %w", err)
+	}
+
+	msg := nats.NewMsg(i.PubSuber.InvokeSubjectName(function))
+	msg.Data = payload
+	msg.Header = invocationHeader(function, requestID, core.InvocationTypeEvent, metadata)
+
+	i.Logger.Info("Invoking asynchronously...", "requestID", requestID, "function", function)
+
+	err = payloads.Offload(ctx, i.BlobStore, msg)
+	if err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	err = i.PubSuber.Publish(ctx, msg)
+	if err != nil {
+		return "", fmt.Errorf("failed to publish: %w", err)
+	}
+
+	return requestID, nil
+}
+
+// checkQueueLength returns ErrQueueFull if the function's queue has reached its max length.
+func (i Invoker) checkQueueLength(ctx context.Context, function core.FunctionDefinition) error {
+	maxQueueLength := function.LimitsConfig().MaxQueueLength
+	if maxQueueLength == 0 {
+		return nil
+	}
+
+	pending, err := i.PubSuber.Pending(ctx, function)
+	if err != nil {
+		return fmt.Errorf("failed to get pending invocations: %w", err)
+	}
+
+	if pending >= maxQueueLength {
+		return core.ErrQueueFull
+	}
+
+	return nil
+}
+
+// invocationHeader builds headers which are passed to the function by the runtime API as is.
+func invocationHeader(
+	function core.FunctionDefinition,
+	requestID string,
+	invocationType string,
+	metadata core.InvocationMetadata,
+) nats.Header {
+	traceID := metadata.TraceID
+	if traceID == "" {
+		traceID = newTraceID()
+	}
+
+	header := nats.Header{
+		core.HeaderNameRequestID:          {requestID},
+		core.HeaderNameInvocationType:     {invocationType},
+		core.HeaderNameInvokedFunctionArn: {core.FunctionARN(function)},
+		core.HeaderNameTraceID:            {traceID},
+	}
+
+	if metadata.ClientContext != "" {
+		header.Set(core.HeaderNameClientContext, metadata.ClientContext)
+	}
+
+	if metadata.CognitoIdentity != "" {
+		header.Set(core.HeaderNameCognitoIdentity, metadata.CognitoIdentity)
+	}
+
+	if metadata.Principal != "" {
+		header.Set(core.HeaderNamePrincipal, metadata.Principal)
+	}
+
+	return header
+}
+
+// newTraceID generates an X-Ray compatible trace header: Root=1-<unix time in hex>-<96 random bits in hex>.
+func newTraceID() string {
+	random := make([]byte, 12) //nolint:mnd
+	rand.Read(random)          //nolint:errcheck
+
+	return fmt.Sprintf("Root=1-%08x-%s;Sampled=0", time.Now().Unix(), hex.EncodeToString(random))
 }
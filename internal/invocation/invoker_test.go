@@ -0,0 +1,148 @@
+package invocation_test
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/invocation"
+	"github.com/zhulik/fid/testhelpers"
+	"github.com/zhulik/pal"
+)
+
+var _ = Describe("Invoker", Serial, func() {
+	var invoker core.Invoker
+	var pubSuber core.PubSuber
+	var limiter core.ConcurrencyLimiter
+
+	function := docker.Function{Name_: "echo", Timeout_: 5 * time.Second}
+
+	BeforeEach(func(ctx SpecContext) {
+		p := testhelpers.NewMemoryPal(ctx,
+			pal.Provide[core.FunctionsRepo](&docker.FunctionsRepo{}),
+			invocation.Provide(),
+		)
+
+		invoker = lo.Must(pal.Invoke[core.Invoker](ctx, p))
+		pubSuber = lo.Must(pal.Invoke[core.PubSuber](ctx, p))
+		limiter = lo.Must(pal.Invoke[core.ConcurrencyLimiter](ctx, p))
+
+		functionsRepo := lo.Must(pal.Invoke[core.FunctionsRepo](ctx, p))
+		lo.Must0(functionsRepo.Upsert(ctx, function))
+		lo.Must0(pubSuber.CreateOrUpdateFunctionStream(ctx, function))
+	})
+
+	// respond picks up the next invocation like the runtime API does and publishes the given messages to
+	// the subject built by the subject function.
+	respond := func(ctx context.Context, subject func(requestID string) string, messages ...*nats.Msg) {
+		go func() {
+			defer GinkgoRecover()
+
+			msg := lo.Must(pubSuber.Next(ctx, pubSuber.FunctionStreamName(function),
+				[]string{pubSuber.InvokeSubjectName(function)}, function.Name()))
+			lo.Must0(msg.Ack())
+
+			for _, response := range messages {
+				response.Subject = subject(msg.Headers().Get(core.HeaderNameRequestID))
+
+				lo.Must0(pubSuber.Publish(ctx, response))
+			}
+		}()
+	}
+
+	responseSubject := func(requestID string) string { return pubSuber.ResponseSubjectName(function, requestID) }
+	errorSubject := func(requestID string) string { return pubSuber.ErrorSubjectName(function, requestID) }
+
+	chunk := func(header nats.Header, data string) *nats.Msg {
+		return &nats.Msg{Header: header, Data: []byte(data)}
+	}
+
+	streamStart := nats.Header{
+		core.HeaderNameResponseMode: {core.ResponseModeStreaming},
+		core.HeaderNameContentType:  {"text/plain"},
+	}
+
+	Describe("InvokeStream", func() {
+		Context("when the function responds", func() {
+			It("returns the whole response", func(ctx SpecContext) {
+				respond(ctx, responseSubject, chunk(nil, "response"))
+
+				response := lo.Must(invoker.InvokeStream(ctx, function, []byte("request"), core.InvocationMetadata{}))
+				DeferCleanup(response.Body.Close)
+
+				Expect(response.Streaming).To(BeFalse())
+				Expect(io.ReadAll(response.Body)).To(Equal([]byte("response")))
+			})
+		})
+
+		Context("when the function streams its response", func() {
+			It("returns chunks as they arrive", func(ctx SpecContext) {
+				respond(ctx, responseSubject,
+					chunk(streamStart, ""),
+					chunk(nil, "first "),
+					chunk(nil, "second"),
+					chunk(nats.Header{core.HeaderNameStreamEnd: {"true"}}, ""),
+				)
+
+				response := lo.Must(invoker.InvokeStream(ctx, function, []byte("request"), core.InvocationMetadata{}))
+				DeferCleanup(response.Body.Close)
+
+				Expect(response.Streaming).To(BeTrue())
+				Expect(response.ContentType).To(Equal("text/plain"))
+				Expect(io.ReadAll(response.Body)).To(Equal([]byte("first second")))
+			})
+
+			It("returns errors reported after streaming started", func(ctx SpecContext) {
+				respond(ctx, responseSubject,
+					chunk(streamStart, ""),
+					chunk(nil, "partial"),
+					chunk(nats.Header{
+						core.HeaderNameStreamEnd: {"true"},
+						core.HeaderNameErrorType: {"Function.Error"},
+					}, "failed"),
+				)
+
+				response := lo.Must(invoker.InvokeStream(ctx, function, []byte("request"), core.InvocationMetadata{}))
+				DeferCleanup(response.Body.Close)
+
+				body, err := io.ReadAll(response.Body)
+				Expect(body).To(Equal([]byte("partial")))
+
+				Expect(err).To(MatchError(core.ErrFunctionErrored))
+				Expect(err.(*core.FunctionError).Type).To(Equal("Function.Error")) //nolint:errorlint,forcetypeassert
+			})
+		})
+
+		Context("when the function fails", func() {
+			It("returns the function's error", func(ctx SpecContext) {
+				respond(ctx, errorSubject, chunk(nats.Header{core.HeaderNameErrorType: {"Function.Error"}}, "failed"))
+
+				_, err := invoker.InvokeStream(ctx, function, []byte("request"), core.InvocationMetadata{})
+
+				Expect(err).To(MatchError(core.ErrFunctionErrored))
+				Expect(err.(*core.FunctionError).Payload).To(Equal([]byte("failed"))) //nolint:errorlint,forcetypeassert
+			})
+		})
+	})
+
+	Describe("InvokeAsync", func() {
+		Context("when the function is at its concurrency limit", func() {
+			limited := docker.Function{Name_: "echo", Timeout_: 5 * time.Second, MaxConcurrency: 1}
+
+			It("throttles the invocation", func(ctx SpecContext) {
+				release := lo.Must(limiter.Acquire(ctx, limited, "first"))
+				DeferCleanup(release)
+
+				_, err := invoker.InvokeAsync(ctx, limited, []byte("request"), core.InvocationMetadata{})
+
+				Expect(err).To(MatchError(core.ErrConcurrencyLimitExceeded))
+			})
+		})
+	})
+})
@@ -0,0 +1,342 @@
+package invocation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/pkg/json"
+)
+
+const (
+	// leaseTTLMargin is added to the function's timeout to get the TTL of invocation leases. Leases are
+	// deleted when invocations finish, the TTL only cleans up after gateways which die in the middle of an
+	// invocation.
+	leaseTTLMargin = 5 * time.Second
+
+	// rewatchInterval is how long Limiter waits before retrying a failed watch.
+	rewatchInterval = time.Second
+)
+
+// Key structure "<function-name>.<request-id>" for leases of invocations in flight, their values are the
+// functions' reserved concurrency. The budget is stored under a single token key, so it does not match
+// leases filters.
+const budgetKey = "budget"
+
+// budget is the account-wide concurrency budget and the part of it reserved by functions.
+type budget struct {
+	Budget   int `json:"budget"`
+	Reserved int `json:"reserved"`
+}
+
+// Limiter is core.ConcurrencyLimiter which keeps invocation leases in KV, so limits are shared by all
+// gateways. Leases are counted in memory, the bucket is watched. A lease is taken before the limits are
+// checked and dropped if they are exceeded, the check waits until the watch delivers the lease, so all
+// leases taken before it are counted too. Concurrent invocations may throttle each other, but never
+// exceed the limits.
+type Limiter struct {
+	Logger *slog.Logger
+	KV     core.KV
+
+	bucket core.KVBucket
+
+	mu sync.Mutex
+	// leases holds request IDs of invocations in flight by function name.
+	leases map[string]map[string]struct{}
+	// reserved holds the reserved concurrency of functions with invocations in flight.
+	reserved map[string]int
+	budget   budget
+	// waiters are notified when the watch delivers the leases they wait for.
+	waiters map[string]chan struct{}
+
+	cancel context.CancelFunc
+}
+
+func (l *Limiter) Init(ctx context.Context) error {
+	l.waiters = map[string]chan struct{}{}
+
+	bucket, err := l.KV.CreateBucketWithConfig(ctx, core.BucketConfigConcurrency)
+	if err != nil {
+		return fmt.Errorf("failed to create concurrency bucket: %w", err)
+	}
+
+	l.bucket = bucket
+
+	// The watch outlives Init, it's stopped on shutdown.
+	watchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	l.cancel = cancel
+
+	events, err := l.watch(watchCtx, ctx)
+	if err != nil {
+		cancel()
+
+		return err
+	}
+
+	go l.follow(watchCtx, events)
+
+	return nil
+}
+
+func (l *Limiter) Shutdown(_ context.Context) error {
+	l.cancel()
+
+	return nil
+}
+
+func (l *Limiter) Acquire(
+	ctx context.Context,
+	function core.FunctionDefinition,
+	requestID string,
+) (func(), error) {
+	key := leaseKey(function.Name(), requestID)
+
+	seen := l.await(key)
+	defer l.stopAwaiting(key)
+
+	reserved := strconv.Itoa(function.LimitsConfig().ReservedConcurrency)
+
+	_, err := l.bucket.CreateWithTTL(ctx, key, []byte(reserved), function.Timeout()+leaseTTLMargin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invocation lease: %w", err)
+	}
+
+	release := func() {
+		// The invocation's context may already be cancelled, the lease must be deleted anyway.
+		err := l.bucket.Delete(context.WithoutCancel(ctx), key)
+		if err != nil {
+			l.Logger.Error("Failed to delete invocation lease", "requestID", requestID, "error", err)
+		}
+	}
+
+	select {
+	case <-seen:
+	case <-ctx.Done():
+		release()
+
+		return nil, fmt.Errorf("failed to await invocation lease: %w", ctx.Err())
+	}
+
+	err = l.check(function)
+	if err != nil {
+		release()
+
+		return nil, err
+	}
+
+	return release, nil
+}
+
+func (l *Limiter) SetBudget(ctx context.Context, value int, reserved int) error {
+	if value == 0 {
+		err := l.bucket.Delete(ctx, budgetKey)
+		if err != nil && !errors.Is(err, core.ErrKeyNotFound) {
+			return fmt.Errorf("failed to delete concurrency budget: %w", err)
+		}
+
+		return nil
+	}
+
+	data, err := json.Marshal(budget{Budget: value, Reserved: reserved})
+	if err != nil {
+		return fmt.Errorf("failed to marshal concurrency budget: %w", err)
+	}
+
+	err = l.bucket.Put(ctx, budgetKey, data)
+	if err != nil {
+		return fmt.Errorf("failed to store concurrency budget: %w", err)
+	}
+
+	return nil
+}
+
+// check counts the leases, including the one of the invocation being checked, against the function's max
+// concurrency and the budget. Functions use their reserved concurrency first, the rest of the budget is
+// shared by all functions.
+func (l *Limiter) check(function core.FunctionDefinition) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limits := function.LimitsConfig()
+	inFlight := len(l.leases[function.Name()])
+
+	if limits.MaxConcurrency > 0 && inFlight > limits.MaxConcurrency {
+		return core.ErrConcurrencyLimitExceeded
+	}
+
+	if l.budget.Budget == 0 || inFlight <= limits.ReservedConcurrency {
+		return nil
+	}
+
+	shared := 0
+
+	for name, leases := range l.leases {
+		shared += max(len(leases)-l.reserved[name], 0)
+	}
+
+	if shared > l.budget.Budget-l.budget.Reserved {
+		return core.ErrConcurrencyBudgetExhausted
+	}
+
+	return nil
+}
+
+// await returns a channel which is closed when the watch delivers the key.
+func (l *Limiter) await(key string) <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	seen := make(chan struct{})
+	l.waiters[key] = seen
+
+	return seen
+}
+
+func (l *Limiter) stopAwaiting(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.waiters, key)
+}
+
+// watch starts a watch which lasts until ctx is done and rebuilds the counters from the leases which exist
+// when it starts, syncCtx limits the time it takes.
+func (l *Limiter) watch(ctx, syncCtx context.Context) (<-chan core.KVEvent, error) {
+	events, err := l.bucket.Watch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch invocation leases: %w", err)
+	}
+
+	var existing []core.KVEvent
+
+	for {
+		select {
+		case <-syncCtx.Done():
+			return nil, fmt.Errorf("failed to sync invocation leases: %w", syncCtx.Err())
+		case event, ok := <-events:
+			if !ok {
+				return nil, fmt.Errorf("failed to sync invocation leases: %w", core.ErrWatchStopped)
+			}
+
+			if event.Type != core.KVEventSynced {
+				existing = append(existing, event)
+
+				continue
+			}
+
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			l.leases = map[string]map[string]struct{}{}
+			l.reserved = map[string]int{}
+			l.budget = budget{}
+
+			for _, event := range existing {
+				l.applyEvent(event)
+			}
+
+			return events, nil
+		}
+	}
+}
+
+// follow applies the changes of the leases. When the watch stops before ctx is done, the counters are
+// rebuilt from a new watch.
+func (l *Limiter) follow(ctx context.Context, events <-chan core.KVEvent) {
+	for {
+		for event := range events {
+			l.apply(event)
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		l.Logger.Warn("Invocation leases watch stopped, resyncing")
+
+		var err error
+
+		events, err = l.watch(ctx, ctx)
+		for err != nil {
+			l.Logger.Error("Failed to resync invocation leases", "error", err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(rewatchInterval):
+			}
+
+			events, err = l.watch(ctx, ctx)
+		}
+	}
+}
+
+func (l *Limiter) apply(event core.KVEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.applyEvent(event)
+}
+
+func (l *Limiter) applyEvent(event core.KVEvent) {
+	if event.Key == budgetKey {
+		l.applyBudget(event)
+
+		return
+	}
+
+	functionName, requestID, ok := strings.Cut(event.Key, ".")
+	if !ok {
+		return
+	}
+
+	if event.Type == core.KVEventDelete {
+		delete(l.leases[functionName], requestID)
+
+		if len(l.leases[functionName]) == 0 {
+			delete(l.leases, functionName)
+			delete(l.reserved, functionName)
+		}
+
+		return
+	}
+
+	if l.leases[functionName] == nil {
+		l.leases[functionName] = map[string]struct{}{}
+	}
+
+	l.leases[functionName][requestID] = struct{}{}
+	l.reserved[functionName], _ = strconv.Atoi(string(event.Value))
+
+	if seen, ok := l.waiters[event.Key]; ok {
+		close(seen)
+		delete(l.waiters, event.Key)
+	}
+}
+
+func (l *Limiter) applyBudget(event core.KVEvent) {
+	if event.Type == core.KVEventDelete {
+		l.budget = budget{}
+
+		return
+	}
+
+	value, err := json.Unmarshal[budget](event.Value)
+	if err != nil {
+		l.Logger.Error("Failed to unmarshal concurrency budget", "error", err)
+
+		return
+	}
+
+	l.budget = value
+}
+
+func leaseKey(functionName, requestID string) string {
+	return fmt.Sprintf("%s.%s", functionName, requestID)
+}
@@ -0,0 +1,86 @@
+package invocation_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/invocation"
+	"github.com/zhulik/fid/testhelpers"
+	"github.com/zhulik/pal"
+)
+
+var _ = Describe("Limiter", Serial, func() {
+	var limiter *invocation.Limiter
+	var p *pal.Pal
+
+	limited := docker.Function{Name_: "limited", Timeout_: time.Second, MaxConcurrency: 1}
+	reserved := docker.Function{Name_: "reserved", Timeout_: time.Second, ReservedConcurrency: 1}
+	unlimited := docker.Function{Name_: "unlimited", Timeout_: time.Second}
+
+	BeforeEach(func(ctx SpecContext) {
+		p = testhelpers.NewMemoryPal(ctx,
+			pal.Provide(&invocation.Limiter{}),
+		)
+
+		limiter = lo.Must(pal.Invoke[*invocation.Limiter](ctx, p))
+	})
+
+	Describe("Acquire", func() {
+		Context("when the function's max concurrency is reached", func() {
+			It("throttles the invocation until a slot is released", func(ctx SpecContext) {
+				release := lo.Must(limiter.Acquire(ctx, limited, "first"))
+
+				_, err := limiter.Acquire(ctx, limited, "second")
+				Expect(err).To(MatchError(core.ErrConcurrencyLimitExceeded))
+				Expect(err).To(MatchError(core.ErrThrottled))
+
+				release()
+
+				Expect(limiter.Acquire(ctx, limited, "third")).ToNot(BeNil())
+			})
+		})
+
+		Context("when another gateway holds the slot", func() {
+			It("throttles the invocation", func(ctx SpecContext) {
+				other := &invocation.Limiter{}
+				lo.Must0(pal.InjectInto(ctx, p, other))
+				lo.Must0(other.Init(ctx))
+				DeferCleanup(other.Shutdown)
+
+				lo.Must(other.Acquire(ctx, limited, "first"))
+
+				_, err := limiter.Acquire(ctx, limited, "second")
+				Expect(err).To(MatchError(core.ErrConcurrencyLimitExceeded))
+			})
+		})
+
+		Context("when the budget is exhausted", func() {
+			BeforeEach(func(ctx SpecContext) {
+				lo.Must0(limiter.SetBudget(ctx, 2, 1))
+			})
+
+			It("keeps the reserved concurrency for its function", func(ctx SpecContext) {
+				lo.Must(limiter.Acquire(ctx, unlimited, "first"))
+
+				_, err := limiter.Acquire(ctx, unlimited, "second")
+				Expect(err).To(MatchError(core.ErrConcurrencyBudgetExhausted))
+
+				lo.Must(limiter.Acquire(ctx, reserved, "third"))
+
+				_, err = limiter.Acquire(ctx, reserved, "fourth")
+				Expect(err).To(MatchError(core.ErrConcurrencyBudgetExhausted))
+			})
+
+			It("does not throttle when the budget is removed", func(ctx SpecContext) {
+				lo.Must(limiter.Acquire(ctx, unlimited, "first"))
+				lo.Must0(limiter.SetBudget(ctx, 0, 0))
+
+				Expect(limiter.Acquire(ctx, unlimited, "second")).ToNot(BeNil())
+			})
+		})
+	})
+})
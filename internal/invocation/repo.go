@@ -0,0 +1,114 @@
+package invocation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/pkg/json"
+)
+
+// Repo stores asynchronous invocations, records expire after core.InvocationTTL. Responses bigger than
+// core.MaxInlinePayloadSize are kept in the blob store.
+type Repo struct { //nolint:recvcheck
+	Logger    *slog.Logger
+	KV        core.KV
+	BlobStore core.BlobStore
+
+	bucket core.KVBucket
+}
+
+func (r *Repo) Init(ctx context.Context) error {
+	bucket, err := r.KV.CreateBucketWithConfig(ctx, core.BucketConfigInvocations)
+	if err != nil {
+		return fmt.Errorf("failed to create invocations bucket: %w", err)
+	}
+
+	r.bucket = bucket
+
+	return nil
+}
+
+func (r Repo) Create(ctx context.Context, invocation core.Invocation) error {
+	bytes, err := json.Marshal(invocation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal invocation: %w", err)
+	}
+
+	_, err = r.bucket.Create(ctx, invocation.RequestID, bytes)
+	if err != nil {
+		return fmt.Errorf("failed to store invocation: %w", err)
+	}
+
+	return nil
+}
+
+func (r Repo) Get(ctx context.Context, requestID string) (core.Invocation, error) {
+	bytes, err := r.bucket.Get(ctx, requestID)
+	if err != nil {
+		if errors.Is(err, core.ErrKeyNotFound) {
+			return core.Invocation{}, core.ErrInvocationNotFound
+		}
+
+		return core.Invocation{}, fmt.Errorf("failed to get invocation: %w", err)
+	}
+
+	invocation, err := json.Unmarshal[core.Invocation](bytes)
+	if err != nil {
+		return core.Invocation{}, fmt.Errorf("failed to unmarshal invocation: %w", err)
+	}
+
+	if invocation.ResponseRef != "" {
+		invocation.Response, err = r.BlobStore.Get(ctx, invocation.ResponseRef)
+		if err != nil {
+			return core.Invocation{}, fmt.Errorf("failed to get invocation response: %w", err)
+		}
+	}
+
+	return invocation, nil
+}
+
+func (r Repo) Succeed(ctx context.Context, requestID string, response []byte) error {
+	return r.finish(ctx, requestID, core.InvocationStatusSucceeded, response)
+}
+
+func (r Repo) Fail(ctx context.Context, requestID string, errorPayload []byte) error {
+	return r.finish(ctx, requestID, core.InvocationStatusFailed, errorPayload)
+}
+
+func (r Repo) finish(ctx context.Context, requestID string, status core.InvocationStatus, response []byte) error {
+	invocation, err := r.Get(ctx, requestID)
+	if err != nil {
+		return err
+	}
+
+	invocation.Status = status
+	invocation.Response = response
+	invocation.FinishedAt = time.Now()
+
+	if len(response) > core.MaxInlinePayloadSize {
+		invocation.ResponseRef, err = r.BlobStore.Put(ctx, response)
+		if err != nil {
+			return fmt.Errorf("failed to store invocation response: %w", err)
+		}
+
+		invocation.Response = nil
+	}
+
+	bytes, err := json.Marshal(invocation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal invocation: %w", err)
+	}
+
+	err = r.bucket.Put(ctx, requestID, bytes)
+	if err != nil {
+		return fmt.Errorf("failed to store invocation: %w", err)
+	}
+
+	r.Logger.Debug("Invocation finished", "requestID", requestID, "status", status)
+
+	return nil
+}
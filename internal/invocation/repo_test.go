@@ -0,0 +1,115 @@
+package invocation_test
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/invocation"
+	"github.com/zhulik/fid/testhelpers"
+	"github.com/zhulik/pal"
+)
+
+const requestID = "some-request-id"
+
+var _ = Describe("Repo", Serial, func() {
+	var p *pal.Pal
+	var repo *invocation.Repo
+
+	BeforeEach(func(ctx SpecContext) {
+		p = testhelpers.NewMemoryPal(ctx,
+			pal.Provide(&invocation.Repo{}),
+		)
+
+		repo = lo.Must(pal.Invoke[*invocation.Repo](ctx, p))
+	})
+
+	Describe("Get", func() {
+		Context("when invocation exists", func() {
+			BeforeEach(func(ctx SpecContext) {
+				lo.Must0(repo.Create(ctx, core.Invocation{
+					RequestID: requestID,
+					Function:  "some-function",
+					Status:    core.InvocationStatusPending,
+					CreatedAt: time.Now(),
+				}))
+			})
+
+			It("returns the invocation", func(ctx SpecContext) {
+				invocation, err := repo.Get(ctx, requestID)
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(invocation.Function).To(Equal("some-function"))
+				Expect(invocation.Status).To(Equal(core.InvocationStatusPending))
+			})
+		})
+
+		Context("when invocation does not exist", func() {
+			It("returns an error", func(ctx SpecContext) {
+				_, err := repo.Get(ctx, requestID)
+
+				Expect(err).To(MatchError(core.ErrInvocationNotFound))
+			})
+		})
+	})
+
+	Describe("Succeed", func() {
+		BeforeEach(func(ctx SpecContext) {
+			lo.Must0(repo.Create(ctx, core.Invocation{RequestID: requestID, Status: core.InvocationStatusPending}))
+		})
+
+		It("stores the response", func(ctx SpecContext) {
+			err := repo.Succeed(ctx, requestID, []byte(`{"ok":true}`))
+			Expect(err).ToNot(HaveOccurred())
+
+			invocation, err := repo.Get(ctx, requestID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(invocation.Status).To(Equal(core.InvocationStatusSucceeded))
+			Expect(invocation.Response).To(Equal([]byte(`{"ok":true}`)))
+			Expect(invocation.FinishedAt).To(BeTemporally("~", time.Now(), time.Second))
+		})
+
+		Context("when response is too big to be stored in the record", func() {
+			It("stores the response in the blob store", func(ctx SpecContext) {
+				response := bytes.Repeat([]byte("a"), core.MaxInlinePayloadSize+1)
+
+				err := repo.Succeed(ctx, requestID, response)
+				Expect(err).ToNot(HaveOccurred())
+
+				invocation, err := repo.Get(ctx, requestID)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(invocation.ResponseRef).ToNot(BeEmpty())
+				Expect(invocation.Response).To(Equal(response))
+			})
+		})
+	})
+
+	Describe("Fail", func() {
+		Context("when invocation exists", func() {
+			BeforeEach(func(ctx SpecContext) {
+				lo.Must0(repo.Create(ctx, core.Invocation{RequestID: requestID, Status: core.InvocationStatusPending}))
+			})
+
+			It("stores the error", func(ctx SpecContext) {
+				err := repo.Fail(ctx, requestID, []byte(`{"errorMessage":"boom"}`))
+				Expect(err).ToNot(HaveOccurred())
+
+				invocation, err := repo.Get(ctx, requestID)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(invocation.Status).To(Equal(core.InvocationStatusFailed))
+				Expect(invocation.Response).To(Equal([]byte(`{"errorMessage":"boom"}`)))
+			})
+		})
+
+		Context("when invocation does not exist", func() {
+			It("returns an error", func(ctx SpecContext) {
+				err := repo.Fail(ctx, requestID, []byte{})
+
+				Expect(err).To(MatchError(core.ErrInvocationNotFound))
+			})
+		})
+	})
+})
@@ -0,0 +1,108 @@
+package invocation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/payloads"
+)
+
+// responseStream reads function's response messages from the subscription to the response and error
+// subjects. Streamed responses consist of a start message, chunks and an end message which may carry
+// an error reported by the function after streaming started.
+type responseStream struct {
+	ctx    context.Context //nolint:containedctx
+	cancel context.CancelFunc
+
+	sub          core.Subscription
+	errorSubject string
+	blobs        core.BlobStore
+	// release frees the invocation's concurrency slot.
+	release func()
+
+	buf   []byte
+	ended bool
+
+	closeOnce sync.Once
+}
+
+func (r *responseStream) next() (jetstream.Msg, error) {
+	select {
+	case <-r.ctx.Done():
+		return nil, fmt.Errorf("failed to consume response: %w", r.ctx.Err())
+	case msg := <-r.sub.C():
+		msg.Ack() //nolint:errcheck
+
+		if msg.Subject() == r.errorSubject {
+			errorPayload, err := r.resolve(msg)
+			if err != nil {
+				return nil, err
+			}
+
+			return nil, &core.FunctionError{
+				Type:    msg.Headers().Get(core.HeaderNameErrorType),
+				Payload: errorPayload,
+			}
+		}
+
+		return msg, nil
+	}
+}
+
+// resolve returns the message's payload, offloaded payloads are deleted from the blob store once resolved
+// as every response is consumed only once.
+func (r *responseStream) resolve(msg jetstream.Msg) ([]byte, error) {
+	data, err := payloads.Resolve(r.ctx, r.blobs, msg.Headers(), msg.Data())
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	payloads.Delete(r.ctx, r.blobs, msg.Headers()) //nolint:errcheck
+
+	return data, nil
+}
+
+func (r *responseStream) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.ended {
+			return 0, io.EOF
+		}
+
+		msg, err := r.next()
+		if err != nil {
+			return 0, err
+		}
+
+		if msg.Headers().Get(core.HeaderNameStreamEnd) != "" {
+			r.ended = true
+
+			errorType := msg.Headers().Get(core.HeaderNameErrorType)
+			if errorType != "" {
+				return 0, &core.FunctionError{Type: errorType, Payload: msg.Data()}
+			}
+
+			continue
+		}
+
+		r.buf = msg.Data()
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+func (r *responseStream) Close() error {
+	r.closeOnce.Do(func() {
+		r.sub.Stop()
+		r.cancel()
+		r.release()
+	})
+
+	return nil
+}
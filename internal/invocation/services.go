@@ -8,5 +8,7 @@ import (
 func Provide() pal.ServiceDef {
 	return pal.ProvideList(
 		pal.Provide[core.Invoker](&Invoker{}),
+		pal.Provide[core.InvocationsRepo](&Repo{}),
+		pal.Provide[core.ConcurrencyLimiter](&Limiter{}),
 	)
 }
@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zhulik/fid/internal/core"
+)
+
+type blob struct {
+	data      []byte
+	createdAt time.Time
+}
+
+// BlobStore keeps payloads in memory, they expire after core.PayloadTTL. Payloads are rejected with
+// core.ErrBlobStoreFull once the store holds core.PayloadsMaxBytes.
+type BlobStore struct {
+	mu    sync.Mutex
+	blobs map[string]blob
+	size  int
+}
+
+func (b *BlobStore) Init(_ context.Context) error {
+	b.blobs = map[string]blob{}
+
+	return nil
+}
+
+// Put stores the data under a new random key and returns the key.
+func (b *BlobStore) Put(_ context.Context, data []byte) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	// Expired blobs are dropped lazily.
+	for key, blob := range b.blobs {
+		if now.Sub(blob.createdAt) > core.PayloadTTL {
+			delete(b.blobs, key)
+			b.size -= len(blob.data)
+		}
+	}
+
+	if b.size+len(data) > core.PayloadsMaxBytes {
+		return "", fmt.Errorf("%w: %d bytes stored", core.ErrBlobStoreFull, b.size)
+	}
+
+	key := uuid.NewString()
+
+	b.blobs[key] = blob{data: slices.Clone(data), createdAt: now}
+	b.size += len(data)
+
+	return key, nil
+}
+
+func (b *BlobStore) Get(_ context.Context, key string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	blob, ok := b.blobs[key]
+	if !ok || time.Since(blob.createdAt) > core.PayloadTTL {
+		return nil, fmt.Errorf("%w: %s", core.ErrKeyNotFound, key)
+	}
+
+	return slices.Clone(blob.data), nil
+}
+
+func (b *BlobStore) Delete(_ context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	blob, ok := b.blobs[key]
+	if !ok {
+		return fmt.Errorf("%w: %s", core.ErrKeyNotFound, key)
+	}
+
+	delete(b.blobs, key)
+	b.size -= len(blob.data)
+
+	return nil
+}
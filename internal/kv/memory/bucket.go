@@ -0,0 +1,295 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/zhulik/fid/internal/core"
+)
+
+type entry struct {
+	value     []byte
+	seq       uint64
+	updatedAt time.Time
+	// expiresAt is set for keys with their own TTL.
+	expiresAt time.Time
+
+	// deleted entries are kept as tombstones, like purge markers in NATS they hold the key's last sequence.
+	deleted bool
+}
+
+// Bucket is an in-memory core.KVBucket. Sequences are per bucket, keys are listed in the order of
+// their last update.
+type Bucket struct {
+	config core.BucketConfig
+
+	mu       sync.Mutex
+	lastSeq  uint64
+	entries  map[string]*entry
+	watchers map[*watcher]struct{}
+}
+
+func newBucket(config core.BucketConfig) *Bucket {
+	return &Bucket{
+		config:   config,
+		entries:  map[string]*entry{},
+		watchers: map[*watcher]struct{}{},
+	}
+}
+
+func (b *Bucket) Name() string {
+	return b.config.Name
+}
+
+func (b *Bucket) configure(config core.BucketConfig) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.config = config
+}
+
+func (b *Bucket) Keys(_ context.Context, filters ...string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.keys(filters), nil
+}
+
+func (b *Bucket) Count(_ context.Context, filters ...string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.keys(filters)), nil
+}
+
+func (b *Bucket) All(_ context.Context, filters ...string) ([]core.KVEntry, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var entries []core.KVEntry //nolint:prealloc
+
+	for _, key := range b.keys(filters) {
+		entries = append(entries, core.KVEntry{
+			Key:   key,
+			Value: slices.Clone(b.entries[key].value),
+		})
+	}
+
+	return entries, nil
+}
+
+func (b *Bucket) Get(ctx context.Context, key string) ([]byte, error) {
+	entry, err := b.GetEntry(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.Value, nil
+}
+
+func (b *Bucket) GetEntry(_ context.Context, key string) (core.KVEntry, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry, ok := b.live(key, time.Now())
+	if !ok {
+		return core.KVEntry{}, fmt.Errorf("%w: %s", core.ErrKeyNotFound, key)
+	}
+
+	return core.KVEntry{Key: key, Value: slices.Clone(entry.value), Sequence: entry.seq}, nil
+}
+
+func (b *Bucket) Create(_ context.Context, key string, value []byte) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.live(key, time.Now()); ok {
+		return 0, fmt.Errorf("%w: %s", core.ErrKeyExists, key)
+	}
+
+	return b.put(key, value, false), nil
+}
+
+func (b *Bucket) Put(_ context.Context, key string, value []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.put(key, value, false)
+
+	return nil
+}
+
+func (b *Bucket) CreateWithTTL(_ context.Context, key string, value []byte, ttl time.Duration) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.config.AllowKeyTTL {
+		return 0, fmt.Errorf("%w: %s", core.ErrKeyTTLDisabled, b.config.Name)
+	}
+
+	if _, ok := b.live(key, time.Now()); ok {
+		return 0, fmt.Errorf("%w: %s", core.ErrKeyExists, key)
+	}
+
+	seq := b.put(key, value, false)
+	b.expireAfter(key, ttl)
+
+	return seq, nil
+}
+
+func (b *Bucket) PutWithTTL(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.config.AllowKeyTTL {
+		return fmt.Errorf("%w: %s", core.ErrKeyTTLDisabled, b.config.Name)
+	}
+
+	b.put(key, value, false)
+	b.expireAfter(key, ttl)
+
+	return nil
+}
+
+// Update stores the value only if seq is the key's last sequence, 0 is the sequence of keys which never existed.
+func (b *Bucket) Update(_ context.Context, key string, value []byte, seq uint64) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var lastSeq uint64
+
+	if entry, ok := b.entries[key]; ok && !b.expired(entry, time.Now()) {
+		lastSeq = entry.seq
+	}
+
+	if seq != lastSeq {
+		return 0, fmt.Errorf("%w: %s: expected %d, got %d", core.ErrWrongSequence, key, lastSeq, seq)
+	}
+
+	return b.put(key, value, false), nil
+}
+
+func (b *Bucket) Delete(_ context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.put(key, nil, true)
+
+	return nil
+}
+
+func (b *Bucket) Watch(ctx context.Context, filters ...string) (<-chan core.KVEvent, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	watcher := newWatcher(filters)
+
+	for _, key := range b.keys(filters) {
+		watcher.push(core.KVEvent{Type: core.KVEventPut, Key: key, Value: slices.Clone(b.entries[key].value)})
+	}
+
+	watcher.push(core.KVEvent{Type: core.KVEventSynced})
+
+	b.watchers[watcher] = struct{}{}
+
+	events := make(chan core.KVEvent)
+
+	go watcher.run(ctx, events)
+
+	context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.watchers, watcher)
+	})
+
+	return events, nil
+}
+
+func (b *Bucket) put(key string, value []byte, deleted bool) uint64 {
+	b.lastSeq++
+
+	b.entries[key] = &entry{
+		value:     slices.Clone(value),
+		seq:       b.lastSeq,
+		updatedAt: time.Now(),
+		deleted:   deleted,
+	}
+
+	event := core.KVEvent{Type: core.KVEventPut, Key: key, Value: slices.Clone(value)}
+	if deleted {
+		event = core.KVEvent{Type: core.KVEventDelete, Key: key}
+	}
+
+	for watcher := range b.watchers {
+		if watcher.matches(key) {
+			watcher.push(event)
+		}
+	}
+
+	return b.lastSeq
+}
+
+// expireAfter deletes the key's last entry after ttl unless it's replaced, watchers see the deletion.
+func (b *Bucket) expireAfter(key string, ttl time.Duration) {
+	entry := b.entries[key]
+	entry.expiresAt = entry.updatedAt.Add(ttl)
+
+	time.AfterFunc(ttl, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if b.entries[key] == entry {
+			b.put(key, nil, true)
+		}
+	})
+}
+
+// live returns the key's entry unless it's deleted or expired.
+func (b *Bucket) live(key string, now time.Time) (*entry, bool) {
+	entry, ok := b.entries[key]
+	if !ok || entry.deleted || b.expired(entry, now) {
+		return nil, false
+	}
+
+	return entry, true
+}
+
+func (b *Bucket) expired(entry *entry, now time.Time) bool {
+	if !entry.expiresAt.IsZero() && !now.Before(entry.expiresAt) {
+		return true
+	}
+
+	return b.config.TTL > 0 && now.Sub(entry.updatedAt) > b.config.TTL
+}
+
+// keys returns live keys matching any of the filters ordered by their last sequence.
+func (b *Bucket) keys(filters []string) []string {
+	now := time.Now()
+
+	keys := []string{}
+
+	for key := range b.entries {
+		if _, ok := b.live(key, now); !ok {
+			continue
+		}
+
+		if len(filters) > 0 && !slices.ContainsFunc(filters, func(filter string) bool {
+			return core.SubjectMatches(filter, key)
+		}) {
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	slices.SortFunc(keys, func(left, right string) int {
+		return cmp.Compare(b.entries[left].seq, b.entries[right].seq)
+	})
+
+	return keys
+}
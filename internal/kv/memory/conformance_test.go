@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"context"
+
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/testhelpers"
+	"github.com/zhulik/fid/testhelpers/conformance"
+	"github.com/zhulik/pal"
+)
+
+var _ = conformance.KV("Memory", func(ctx context.Context) core.KV {
+	return lo.Must(pal.Invoke[core.KV](ctx, testhelpers.NewMemoryPal(ctx)))
+})
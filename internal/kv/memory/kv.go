@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/zhulik/fid/internal/core"
+)
+
+// KV is an in-memory core.KV, it follows the semantics of the NATS implementation, but only works
+// within a single process.
+type KV struct {
+	mu      sync.Mutex
+	buckets map[string]*Bucket
+}
+
+func (k *KV) Init(_ context.Context) error {
+	k.buckets = map[string]*Bucket{}
+
+	return nil
+}
+
+func (k *KV) CreateBucket(ctx context.Context, name string) (core.KVBucket, error) {
+	return k.CreateBucketWithConfig(ctx, core.BucketConfig{Name: name})
+}
+
+// CreateBucketWithConfig creates a bucket or updates the existing bucket's config, only the TTLs are used.
+func (k *KV) CreateBucketWithConfig(_ context.Context, config core.BucketConfig) (core.KVBucket, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if bucket, ok := k.buckets[config.Name]; ok {
+		bucket.configure(config)
+
+		return bucket, nil
+	}
+
+	bucket := newBucket(config)
+	k.buckets[config.Name] = bucket
+
+	return bucket, nil
+}
+
+func (k *KV) Bucket(_ context.Context, name string) (core.KVBucket, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	bucket, ok := k.buckets[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", core.ErrBucketNotFound, name)
+	}
+
+	return bucket, nil
+}
+
+func (k *KV) DeleteBucket(_ context.Context, name string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.buckets[name]; !ok {
+		return fmt.Errorf("%w: %s", core.ErrBucketNotFound, name)
+	}
+
+	delete(k.buckets, name)
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/zhulik/fid/internal/core"
+)
+
+// watcher queues events of a Bucket.Watch call, so writers never wait for slow readers.
+type watcher struct {
+	filters []string
+
+	mu     sync.Mutex
+	queue  []core.KVEvent
+	signal chan struct{}
+}
+
+func newWatcher(filters []string) *watcher {
+	return &watcher{
+		filters: slices.Clone(filters),
+		signal:  make(chan struct{}, 1),
+	}
+}
+
+func (w *watcher) matches(key string) bool {
+	return len(w.filters) == 0 || slices.ContainsFunc(w.filters, func(filter string) bool {
+		return core.SubjectMatches(filter, key)
+	})
+}
+
+func (w *watcher) push(event core.KVEvent) {
+	w.mu.Lock()
+	w.queue = append(w.queue, event)
+	w.mu.Unlock()
+
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers queued events to the channel until ctx is done, then closes it.
+func (w *watcher) run(ctx context.Context, events chan<- core.KVEvent) {
+	defer close(events)
+
+	for {
+		w.mu.Lock()
+		queue := w.queue
+		w.queue = nil
+		w.mu.Unlock()
+
+		for _, event := range queue {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-w.signal:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
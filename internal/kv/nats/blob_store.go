@@ -0,0 +1,78 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/zhulik/fid/internal/core"
+	pubSubNats "github.com/zhulik/fid/internal/pubsub/nats"
+)
+
+// BlobStore stores payloads in a NATS object store, objects expire after core.PayloadTTL. Payloads are
+// rejected with core.ErrBlobStoreFull once the store holds core.PayloadsMaxBytes.
+type BlobStore struct { //nolint:recvcheck
+	Nats *pubSubNats.Client
+
+	store jetstream.ObjectStore
+}
+
+func (b *BlobStore) Init(ctx context.Context) error {
+	store, err := b.Nats.JetStream.CreateOrUpdateObjectStore(ctx, jetstream.ObjectStoreConfig{
+		Bucket:   core.BucketNamePayloads,
+		TTL:      core.PayloadTTL,
+		MaxBytes: core.PayloadsMaxBytes,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create payloads object store: %w", err)
+	}
+
+	b.store = store
+
+	return nil
+}
+
+// Put stores the data under a new random key and returns the key.
+func (b BlobStore) Put(ctx context.Context, data []byte) (string, error) {
+	key := uuid.NewString()
+
+	_, err := b.store.PutBytes(ctx, key, data)
+	if err != nil {
+		var apiErr *jetstream.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode == pubSubNats.ErrCodeStreamStoreFailed {
+			return "", fmt.Errorf("%w: %w", core.ErrBlobStoreFull, err)
+		}
+
+		return "", fmt.Errorf("failed to put blob: %w", err)
+	}
+
+	return key, nil
+}
+
+func (b BlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := b.store.GetBytes(ctx, key)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrObjectNotFound) {
+			return nil, fmt.Errorf("%w: %w", core.ErrKeyNotFound, err)
+		}
+
+		return nil, fmt.Errorf("failed to get blob: %w", err)
+	}
+
+	return data, nil
+}
+
+func (b BlobStore) Delete(ctx context.Context, key string) error {
+	err := b.store.Delete(ctx, key)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrObjectNotFound) {
+			return fmt.Errorf("%w: %w", core.ErrKeyNotFound, err)
+		}
+
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+
+	return nil
+}
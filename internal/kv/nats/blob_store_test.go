@@ -0,0 +1,60 @@
+package nats_test
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/kv/nats"
+	"github.com/zhulik/fid/testhelpers"
+	"github.com/zhulik/pal"
+)
+
+var _ = Describe("Nats BlobStore", Serial, func() {
+	var store *nats.BlobStore
+
+	BeforeEach(func(ctx SpecContext) {
+		p := testhelpers.NewPal(ctx)
+
+		store = &nats.BlobStore{}
+
+		lo.Must0(pal.InjectInto(ctx, p, store))
+		lo.Must0(store.Init(ctx))
+	})
+
+	Describe("Put", func() {
+		It("stores payloads bigger than the max message size", func(ctx SpecContext) {
+			data := bytes.Repeat([]byte("a"), 2*1024*1024)
+
+			key, err := store.Put(ctx, data)
+			Expect(err).ToNot(HaveOccurred())
+
+			DeferCleanup(func(ctx SpecContext) { store.Delete(ctx, key) }) //nolint:errcheck
+
+			Expect(store.Get(ctx, key)).To(Equal(data))
+		})
+	})
+
+	Describe("Get", func() {
+		Context("when blob does not exist", func() {
+			It("returns an error", func(ctx SpecContext) {
+				_, err := store.Get(ctx, "missing")
+
+				Expect(err).To(MatchError(core.ErrKeyNotFound))
+			})
+		})
+	})
+
+	Describe("Delete", func() {
+		It("deletes the blob", func(ctx SpecContext) {
+			key := lo.Must(store.Put(ctx, []byte("data")))
+
+			Expect(store.Delete(ctx, key)).To(Succeed())
+
+			_, err := store.Get(ctx, key)
+			Expect(err).To(MatchError(core.ErrKeyNotFound))
+		})
+	})
+})
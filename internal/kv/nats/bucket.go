@@ -4,14 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/samber/lo"
 	"github.com/zhulik/fid/internal/core"
 )
 
+// errCodeMessageTTLDisabled is returned by JetStream when a message with a TTL is published to a stream
+// which does not allow message TTLs.
+const errCodeMessageTTLDisabled jetstream.ErrorCode = 10166
+
 type Bucket struct {
-	bucket jetstream.KeyValue
+	bucket    jetstream.KeyValue
+	jetStream jetstream.JetStream
 }
 
 func (b Bucket) Count(ctx context.Context, filters ...string) (int, error) {
@@ -48,16 +55,25 @@ func (b Bucket) All(ctx context.Context, filters ...string) ([]core.KVEntry, err
 }
 
 func (b Bucket) Get(ctx context.Context, key string) ([]byte, error) {
+	entry, err := b.GetEntry(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.Value, nil
+}
+
+func (b Bucket) GetEntry(ctx context.Context, key string) (core.KVEntry, error) {
 	entry, err := b.bucket.Get(ctx, key)
 	if err != nil {
 		if errors.Is(err, jetstream.ErrKeyNotFound) {
-			return nil, fmt.Errorf("%w: %w", core.ErrKeyNotFound, err)
+			return core.KVEntry{}, fmt.Errorf("%w: %w", core.ErrKeyNotFound, err)
 		}
 
-		return nil, fmt.Errorf("failed to get value: %w", err)
+		return core.KVEntry{}, fmt.Errorf("failed to get value: %w", err)
 	}
 
-	return entry.Value(), nil
+	return core.KVEntry{Key: key, Value: entry.Value(), Sequence: entry.Revision()}, nil
 }
 
 func (b Bucket) Create(ctx context.Context, key string, value []byte) (uint64, error) {
@@ -82,11 +98,43 @@ func (b Bucket) Put(ctx context.Context, key string, value []byte) error {
 	return nil
 }
 
+func (b Bucket) CreateWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) (uint64, error) {
+	seq, err := b.bucket.Create(ctx, key, value, jetstream.KeyTTL(ttl))
+	if err != nil {
+		if errors.Is(err, jetstream.ErrKeyExists) {
+			return 0, fmt.Errorf("%w: %w", core.ErrKeyExists, err)
+		}
+
+		if isTTLDisabled(err) {
+			return 0, fmt.Errorf("%w: %w", core.ErrKeyTTLDisabled, err)
+		}
+
+		return 0, fmt.Errorf("failed to put value: %w", err)
+	}
+
+	return seq, nil
+}
+
+// PutWithTTL publishes the value directly as the KV API only supports TTLs on create.
+func (b Bucket) PutWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := b.jetStream.Publish(ctx, "$KV."+b.bucket.Bucket()+"."+key, value, jetstream.WithMsgTTL(ttl))
+	if err != nil {
+		if isTTLDisabled(err) {
+			return fmt.Errorf("%w: %w", core.ErrKeyTTLDisabled, err)
+		}
+
+		return fmt.Errorf("failed to put value: %w", err)
+	}
+
+	return nil
+}
+
 func (b Bucket) Update(ctx context.Context, key string, value []byte, seq uint64) (uint64, error) {
 	seq, err := b.bucket.Update(ctx, key, value, seq)
 	if err != nil {
-		if errors.Is(err, jetstream.ErrKeyNotFound) {
-			return 0, fmt.Errorf("%w: %w", core.ErrKeyNotFound, err)
+		// NATS reports a wrong last sequence as an existing key.
+		if errors.Is(err, jetstream.ErrKeyExists) {
+			return 0, fmt.Errorf("%w: %w", core.ErrWrongSequence, err)
 		}
 
 		return 0, fmt.Errorf("failed to put value: %w", err)
@@ -104,10 +152,63 @@ func (b Bucket) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+func (b Bucket) Watch(ctx context.Context, filters ...string) (<-chan core.KVEvent, error) {
+	// WatchFiltered modifies the filters.
+	watcher, err := b.bucket.WatchFiltered(ctx, slices.Clone(filters))
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch keys: %w", err)
+	}
+
+	context.AfterFunc(ctx, func() {
+		watcher.Stop() //nolint:errcheck
+	})
+
+	events := make(chan core.KVEvent)
+
+	go func() {
+		defer close(events)
+
+		synced := false
+
+		// The watcher blocks when updates are not consumed, so they are drained until it's stopped.
+		for entry := range watcher.Updates() {
+			event := core.KVEvent{Type: core.KVEventSynced}
+
+			if entry != nil {
+				event = core.KVEvent{Type: core.KVEventPut, Key: entry.Key(), Value: entry.Value()}
+
+				if entry.Operation() != jetstream.KeyValuePut {
+					// Purge markers of keys deleted before the watch started are not interesting.
+					if !synced {
+						continue
+					}
+
+					event = core.KVEvent{Type: core.KVEventDelete, Key: entry.Key()}
+				}
+			} else {
+				synced = true
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return events, nil
+}
+
 func (b Bucket) Name() string {
 	return b.bucket.Bucket()
 }
 
+func isTTLDisabled(err error) bool {
+	var apiErr *jetstream.APIError
+
+	return errors.As(err, &apiErr) && apiErr.ErrorCode == errCodeMessageTTLDisabled
+}
+
 func (b Bucket) listKeys(ctx context.Context, lister jetstream.KeyLister) ([]core.KVEntry, error) {
 	var entries []core.KVEntry //nolint:prealloc
 
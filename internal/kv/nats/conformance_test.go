@@ -0,0 +1,20 @@
+package nats_test
+
+import (
+	"context"
+
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/kv/nats"
+	"github.com/zhulik/fid/testhelpers"
+	"github.com/zhulik/fid/testhelpers/conformance"
+	"github.com/zhulik/pal"
+)
+
+var _ = conformance.KV("Nats", func(ctx context.Context) core.KV {
+	var kv nats.KV
+
+	lo.Must0(pal.InjectInto(ctx, testhelpers.NewPal(ctx), &kv))
+
+	return kv
+})
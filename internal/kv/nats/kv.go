@@ -4,29 +4,52 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/zhulik/fid/internal/core"
 	pubSubNats "github.com/zhulik/fid/internal/pubsub/nats"
 )
 
+const limitMarkerTTL = time.Minute
+
 type KV struct {
 	Nats *pubSubNats.Client
 }
 
 func (k KV) CreateBucket(ctx context.Context, name string) (core.KVBucket, error) {
-	bucket, err := k.Nats.JetStream.CreateKeyValue(ctx, jetstream.KeyValueConfig{
-		Bucket: name,
-	})
-	if err != nil {
-		if errors.Is(err, jetstream.ErrBucketExists) {
-			return nil, fmt.Errorf("%w: %w", core.ErrBucketExists, err)
-		}
+	return k.CreateBucketWithConfig(ctx, core.BucketConfig{Name: name})
+}
 
-		return nil, fmt.Errorf("failed to create bucket: %w", err)
+func (k KV) CreateBucketWithConfig(ctx context.Context, config core.BucketConfig) (core.KVBucket, error) {
+	kvConfig := jetstream.KeyValueConfig{
+		Bucket:   config.Name,
+		TTL:      config.TTL,
+		History:  config.History,
+		MaxBytes: config.MaxBytes,
+		Replicas: config.Replicas,
+		Storage:  jetstream.FileStorage,
+	}
+
+	if kvConfig.MaxBytes == 0 {
+		kvConfig.MaxBytes = -1
+	}
+
+	if config.Storage == core.StorageTypeMemory {
+		kvConfig.Storage = jetstream.MemoryStorage
+	}
+
+	// Markers of expired keys are kept long enough to be seen by watchers.
+	if config.AllowKeyTTL {
+		kvConfig.LimitMarkerTTL = limitMarkerTTL
+	}
+
+	bucket, err := k.Nats.JetStream.CreateOrUpdateKeyValue(ctx, kvConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create or update bucket: %w", err)
 	}
 
-	return Bucket{bucket: bucket}, nil
+	return Bucket{bucket: bucket, jetStream: k.Nats.JetStream}, nil
 }
 
 func (k KV) Bucket(ctx context.Context, name string) (core.KVBucket, error) {
@@ -39,7 +62,7 @@ func (k KV) Bucket(ctx context.Context, name string) (core.KVBucket, error) {
 		return nil, fmt.Errorf("failed to get bucket: %w", err)
 	}
 
-	return Bucket{bucket: bucket}, nil
+	return Bucket{bucket: bucket, jetStream: k.Nats.JetStream}, nil
 }
 
 func (k KV) DeleteBucket(ctx context.Context, name string) error {
@@ -5,6 +5,7 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/zhulik/fid/testhelpers"
 )
 
 func TestNats(t *testing.T) {
@@ -13,3 +14,5 @@ func TestNats(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Nats KV Suite")
 }
+
+var _ = AfterSuite(testhelpers.StopNATS)
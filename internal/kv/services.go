@@ -2,12 +2,22 @@ package kv
 
 import (
 	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/kv/memory"
 	"github.com/zhulik/fid/internal/kv/nats"
 	"github.com/zhulik/pal"
 )
 
-func Provide() pal.ServiceDef {
+// Provide provides KV and BlobStore of the selected broker, NATS unless memory is selected.
+func Provide(broker string) pal.ServiceDef {
+	if broker == core.BrokerNameMemory {
+		return pal.ProvideList(
+			pal.Provide[core.KV](&memory.KV{}),
+			pal.Provide[core.BlobStore](&memory.BlobStore{}),
+		)
+	}
+
 	return pal.ProvideList(
 		pal.Provide[core.KV](&nats.KV{}),
+		pal.Provide[core.BlobStore](&nats.BlobStore{}),
 	)
 }
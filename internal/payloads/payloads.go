@@ -0,0 +1,64 @@
+// Package payloads offloads payloads which are too big to be sent within NATS messages to the blob store.
+package payloads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"github.com/zhulik/fid/internal/core"
+)
+
+// Offload moves the message's data to the blob store when it exceeds core.MaxInlinePayloadSize and replaces
+// it with a reference header.
+func Offload(ctx context.Context, blobs core.BlobStore, msg *nats.Msg) error {
+	if len(msg.Data) <= core.MaxInlinePayloadSize {
+		return nil
+	}
+
+	key, err := blobs.Put(ctx, msg.Data)
+	if err != nil {
+		return fmt.Errorf("failed to offload payload: %w", err)
+	}
+
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+
+	msg.Header.Set(core.HeaderNamePayloadRef, key)
+	msg.Data = nil
+
+	return nil
+}
+
+// Resolve returns the offloaded payload referenced by the header, or data as is if it's not offloaded.
+func Resolve(ctx context.Context, blobs core.BlobStore, header nats.Header, data []byte) ([]byte, error) {
+	key := header.Get(core.HeaderNamePayloadRef)
+	if key == "" {
+		return data, nil
+	}
+
+	data, err := blobs.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve offloaded payload: %w", err)
+	}
+
+	return data, nil
+}
+
+// Delete deletes the offloaded payload referenced by the header. Every payload is consumed once, so it's
+// deleted once the message is handled, payloads which are already gone are ignored.
+func Delete(ctx context.Context, blobs core.BlobStore, header nats.Header) error {
+	key := header.Get(core.HeaderNamePayloadRef)
+	if key == "" {
+		return nil
+	}
+
+	err := blobs.Delete(ctx, key)
+	if err != nil && !errors.Is(err, core.ErrKeyNotFound) {
+		return fmt.Errorf("failed to delete offloaded payload: %w", err)
+	}
+
+	return nil
+}
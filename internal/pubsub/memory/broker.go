@@ -0,0 +1,422 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/zhulik/fid/internal/core"
+)
+
+var (
+	ErrStreamNotFound   = errors.New("stream not found")
+	ErrConsumerNotFound = errors.New("consumer not found")
+	ErrMsgNotFound      = errors.New("message not found")
+	ErrNoStream         = errors.New("no stream matches subject")
+)
+
+type ackKind int
+
+const (
+	ackKindAck ackKind = iota
+	ackKindNak
+	ackKindInProgress
+	ackKindTerm
+)
+
+type listener struct {
+	subject string
+	ch      chan *nats.Msg
+}
+
+// Broker keeps streams, their consumers and plain subscriptions in memory, it plays the role of the NATS
+// server for the in-memory PubSuber and DeadLetterQueue.
+type Broker struct {
+	mu sync.Mutex
+
+	streams   map[string]*stream
+	listeners map[*listener]struct{}
+
+	// changed is closed and replaced whenever consumers may have something new to receive.
+	changed chan struct{}
+}
+
+func (b *Broker) Init(_ context.Context) error {
+	b.streams = map[string]*stream{}
+	b.listeners = map[*listener]struct{}{}
+	b.changed = make(chan struct{})
+
+	return nil
+}
+
+// createOrUpdateStream creates a stream or updates the config of an existing one, stored messages are kept.
+// createOrUpdateStream creates the stream or updates it unless the update drops stored messages.
+func (b *Broker) createOrUpdateStream(config streamConfig) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if existing, ok := b.streams[config.name]; ok {
+		if config.exceeds(len(existing.messages), existing.bytes()) {
+			return fmt.Errorf("%w: %s holds %d messages, %d bytes",
+				core.ErrUnsafeStreamUpdate, config.name, len(existing.messages), existing.bytes())
+		}
+
+		if config.maxAge > 0 && len(existing.messages) > 0 &&
+			time.Since(existing.messages[0].timestamp) > config.maxAge {
+			return fmt.Errorf("%w: %s holds messages older than %s",
+				core.ErrUnsafeStreamUpdate, config.name, config.maxAge)
+		}
+
+		existing.config = config
+
+		return nil
+	}
+
+	b.streams[config.name] = &stream{
+		config:    config,
+		consumers: map[string]*consumer{},
+	}
+
+	return nil
+}
+
+// publish stores the message in the stream which subjects match the message's subject. Listeners of
+// the subject observe the message too.
+func (b *Broker) publish(msg *nats.Msg) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	var target *stream
+
+	for _, s := range b.streams {
+		if s.matches(msg.Subject) {
+			target = s
+
+			break
+		}
+	}
+
+	if target == nil {
+		return fmt.Errorf("%w: %s", ErrNoStream, msg.Subject)
+	}
+
+	target.expire(now)
+
+	err := target.store(msg, now)
+	if err != nil {
+		return err
+	}
+
+	b.notify()
+	b.deliver(msg)
+
+	return nil
+}
+
+// broadcast delivers the message to the subject's listeners without storing it.
+func (b *Broker) broadcast(msg *nats.Msg) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.deliver(msg)
+}
+
+// deliver delivers the message to the subject's listeners, slow listeners miss messages. Must be called
+// with the lock held.
+func (b *Broker) deliver(msg *nats.Msg) {
+	for l := range b.listeners {
+		if !core.SubjectMatches(l.subject, msg.Subject) {
+			continue
+		}
+
+		select {
+		case l.ch <- &nats.Msg{Subject: msg.Subject, Header: cloneHeader(msg.Header), Data: msg.Data}:
+		default:
+		}
+	}
+}
+
+func (b *Broker) listen(ctx context.Context, subject string, bufferSize int) <-chan *nats.Msg {
+	l := &listener{subject: subject, ch: make(chan *nats.Msg, bufferSize)}
+
+	b.mu.Lock()
+	b.listeners[l] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		b.mu.Lock()
+		delete(b.listeners, l)
+		b.mu.Unlock()
+	}()
+
+	return l.ch
+}
+
+// consumer creates or updates a consumer, an empty durable name creates an ephemeral consumer. The consumer
+// is marked active until release is called.
+func (b *Broker) consumer(streamName string, filters []string, durableName string, ackWait time.Duration) (string, error) { //nolint:lll
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.streams[streamName]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrStreamNotFound, streamName)
+	}
+
+	name := durableName
+	if name == "" {
+		name = uuid.NewString()
+	}
+
+	cons, ok := s.consumers[name]
+	if !ok {
+		cons = newConsumer(name, filters, ackWait, durableName == "")
+		s.consumers[name] = cons
+	}
+
+	cons.filters = filters
+	cons.ackWait = ackWait
+	cons.active = true
+
+	return name, nil
+}
+
+// release marks the consumer inactive, ephemeral ones are removed once their deliveries are resolved.
+func (b *Broker) release(streamName, consumerName string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if s, ok := b.streams[streamName]; ok {
+		if cons, ok := s.consumers[consumerName]; ok {
+			cons.active = false
+		}
+
+		s.expire(time.Now())
+	}
+}
+
+// fetch waits for the next message the consumer can receive.
+func (b *Broker) fetch(ctx context.Context, streamName, consumerName string) (*Msg, error) {
+	for {
+		msg, changed, redeliverAt, err := b.tryFetch(streamName, consumerName)
+		if err != nil || msg != nil {
+			return msg, err
+		}
+
+		err = wait(ctx, changed, redeliverAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// wait blocks until the broker state changes, the redelivery deadline is reached or ctx is done.
+func wait(ctx context.Context, changed <-chan struct{}, redeliverAt time.Time) error {
+	var timeout <-chan time.Time
+
+	if !redeliverAt.IsZero() {
+		timer := time.NewTimer(time.Until(redeliverAt))
+		defer timer.Stop()
+
+		timeout = timer.C
+	}
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("context cancelled: %w", ctx.Err())
+	case <-changed:
+	case <-timeout:
+	}
+
+	return nil
+}
+
+func (b *Broker) tryFetch(streamName, consumerName string) (*Msg, <-chan struct{}, time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	s, ok := b.streams[streamName]
+	if !ok {
+		return nil, nil, time.Time{}, fmt.Errorf("%w: %s", ErrStreamNotFound, streamName)
+	}
+
+	s.expire(now)
+
+	cons, ok := s.consumers[consumerName]
+	if !ok {
+		return nil, nil, time.Time{}, fmt.Errorf("%w: %s", ErrConsumerNotFound, consumerName)
+	}
+
+	stored, redeliverAt := s.next(cons, now)
+	if stored == nil {
+		return nil, b.changed, redeliverAt, nil
+	}
+
+	cons.deliveredSeq++
+	cons.deliveries[stored.seq]++
+	cons.pending[stored.seq] = now.Add(cons.ackWait)
+
+	return &Msg{
+		broker:       b,
+		stream:       streamName,
+		consumer:     consumerName,
+		seq:          stored.seq,
+		consumerSeq:  cons.deliveredSeq,
+		numDelivered: cons.deliveries[stored.seq],
+		subject:      stored.subject,
+		header:       cloneHeader(stored.header),
+		data:         stored.data,
+		timestamp:    stored.timestamp,
+	}, nil, time.Time{}, nil
+}
+
+// ack resolves a delivery of the message.
+func (b *Broker) ack(msg *Msg, kind ackKind, delay time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	s, ok := b.streams[msg.stream]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrStreamNotFound, msg.stream)
+	}
+
+	// Ephemeral consumers may be already removed if the delivery timed out, acknowledgements still remove
+	// messages from work queues.
+	cons, ok := s.consumers[msg.consumer]
+	if !ok {
+		cons = newConsumer(msg.consumer, nil, 0, true)
+	}
+
+	switch kind {
+	case ackKindAck, ackKindTerm:
+		delete(cons.pending, msg.seq)
+
+		if s.config.retention == workQueueRetention {
+			s.remove(msg.seq)
+		} else {
+			cons.acked[msg.seq] = true
+		}
+	case ackKindNak:
+		if delay > 0 {
+			cons.pending[msg.seq] = now.Add(delay)
+		} else {
+			delete(cons.pending, msg.seq)
+		}
+	case ackKindInProgress:
+		cons.pending[msg.seq] = now.Add(cons.ackWait)
+	}
+
+	s.expire(now)
+	b.notify()
+
+	return nil
+}
+
+// pending counts messages on the subject, except the ones delivered to the consumer and awaiting
+// acknowledgement.
+func (b *Broker) pending(streamName, subject, consumerName string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	s, ok := b.streams[streamName]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrStreamNotFound, streamName)
+	}
+
+	s.expire(now)
+
+	cons := s.consumers[consumerName]
+
+	count := 0
+
+	for _, msg := range s.messages {
+		if msg.subject != subject {
+			continue
+		}
+
+		if cons != nil && cons.isPending(msg.seq, now) {
+			continue
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+// messages returns the stream's messages ordered by sequence.
+func (b *Broker) messages(streamName string) ([]storedMsg, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.streams[streamName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrStreamNotFound, streamName)
+	}
+
+	s.expire(time.Now())
+
+	messages := make([]storedMsg, len(s.messages))
+	for i, msg := range s.messages {
+		messages[i] = *msg
+	}
+
+	return messages, nil
+}
+
+func (b *Broker) message(streamName string, seq uint64) (storedMsg, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.streams[streamName]
+	if !ok {
+		return storedMsg{}, fmt.Errorf("%w: %s", ErrStreamNotFound, streamName)
+	}
+
+	s.expire(time.Now())
+
+	msg := s.get(seq)
+	if msg == nil {
+		return storedMsg{}, fmt.Errorf("%w: %d", ErrMsgNotFound, seq)
+	}
+
+	return *msg, nil
+}
+
+func (b *Broker) deleteMessage(streamName string, seq uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.streams[streamName]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrStreamNotFound, streamName)
+	}
+
+	if !s.remove(seq) {
+		return fmt.Errorf("%w: %d", ErrMsgNotFound, seq)
+	}
+
+	b.notify()
+
+	return nil
+}
+
+// notify wakes up consumers waiting for messages, must be called with the lock held.
+func (b *Broker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
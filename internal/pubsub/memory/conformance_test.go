@@ -0,0 +1,13 @@
+package memory_test
+
+import (
+	"context"
+
+	"github.com/zhulik/fid/testhelpers"
+	"github.com/zhulik/fid/testhelpers/conformance"
+	"github.com/zhulik/pal"
+)
+
+var _ = conformance.PubSub("Memory", func(ctx context.Context) *pal.Pal {
+	return testhelpers.NewMemoryPal(ctx)
+})
@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/nats-io/nats.go"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/payloads"
+	"github.com/zhulik/fid/pkg/json"
+)
+
+// DeadLetterQueue stores dead letters as JSON messages in the function's in-memory dead-letter stream,
+// letters are identified by their sequence numbers in the stream.
+type DeadLetterQueue struct {
+	Broker    *Broker
+	PubSuber  core.PubSuber
+	BlobStore core.BlobStore
+
+	Logger *slog.Logger
+}
+
+func (q DeadLetterQueue) Add(ctx context.Context, function core.FunctionDefinition, letter core.DeadLetter) error {
+	bytes, err := json.Marshal(letter)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+
+	msg := nats.NewMsg(q.PubSuber.DeadLetterSubjectName(function))
+	msg.Data = bytes
+
+	err = payloads.Offload(ctx, q.BlobStore, msg)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	err = q.PubSuber.Publish(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("failed to publish dead letter: %w", err)
+	}
+
+	q.Logger.Info("Dead letter added", "function", function, "requestID", letter.RequestID)
+
+	return nil
+}
+
+func (q DeadLetterQueue) List(ctx context.Context, function core.FunctionDefinition) ([]core.DeadLetter, error) {
+	messages, err := q.Broker.messages(q.PubSuber.DeadLetterStreamName(function))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead-letter stream: %w", err)
+	}
+
+	letters := []core.DeadLetter{}
+
+	for _, msg := range messages {
+		letter, err := q.decode(ctx, msg)
+		if err != nil {
+			return nil, err
+		}
+
+		letters = append(letters, letter)
+	}
+
+	return letters, nil
+}
+
+func (q DeadLetterQueue) Get(ctx context.Context, function core.FunctionDefinition, id uint64) (core.DeadLetter, error) { //nolint:lll
+	msg, err := q.Broker.message(q.PubSuber.DeadLetterStreamName(function), id)
+	if err != nil {
+		if errors.Is(err, ErrMsgNotFound) {
+			return core.DeadLetter{}, core.ErrDeadLetterNotFound
+		}
+
+		return core.DeadLetter{}, fmt.Errorf("failed to get dead letter: %w", err)
+	}
+
+	return q.decode(ctx, msg)
+}
+
+func (q DeadLetterQueue) Delete(ctx context.Context, function core.FunctionDefinition, id uint64) error {
+	streamName := q.PubSuber.DeadLetterStreamName(function)
+
+	msg, err := q.Broker.message(streamName, id)
+	if err != nil {
+		if errors.Is(err, ErrMsgNotFound) {
+			return core.ErrDeadLetterNotFound
+		}
+
+		return fmt.Errorf("failed to get dead letter: %w", err)
+	}
+
+	err = q.Broker.deleteMessage(streamName, id)
+	if err != nil {
+		if errors.Is(err, ErrMsgNotFound) {
+			return core.ErrDeadLetterNotFound
+		}
+
+		return fmt.Errorf("failed to delete dead letter: %w", err)
+	}
+
+	return payloads.Delete(ctx, q.BlobStore, msg.header) //nolint:wrapcheck
+}
+
+func (q DeadLetterQueue) decode(ctx context.Context, msg storedMsg) (core.DeadLetter, error) {
+	data, err := payloads.Resolve(ctx, q.BlobStore, msg.header, msg.data)
+	if err != nil {
+		return core.DeadLetter{}, err //nolint:wrapcheck
+	}
+
+	letter, err := json.Unmarshal[core.DeadLetter](data)
+	if err != nil {
+		return core.DeadLetter{}, fmt.Errorf("failed to unmarshal dead letter: %w", err)
+	}
+
+	letter.ID = msg.seq
+
+	return letter, nil
+}
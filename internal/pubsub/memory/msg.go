@@ -0,0 +1,110 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Msg is a message delivered to a consumer of an in-memory stream, it implements jetstream.Msg.
+type Msg struct {
+	broker *Broker
+
+	stream       string
+	consumer     string
+	seq          uint64
+	consumerSeq  uint64
+	numDelivered uint64
+
+	subject   string
+	header    nats.Header
+	data      []byte
+	timestamp time.Time
+
+	mu    sync.Mutex
+	acked bool
+}
+
+var _ jetstream.Msg = &Msg{}
+
+func (m *Msg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{
+		Sequence: jetstream.SequencePair{
+			Consumer: m.consumerSeq,
+			Stream:   m.seq,
+		},
+		NumDelivered: m.numDelivered,
+		Timestamp:    m.timestamp,
+		Stream:       m.stream,
+		Consumer:     m.consumer,
+	}, nil
+}
+
+func (m *Msg) Data() []byte {
+	return m.data
+}
+
+func (m *Msg) Headers() nats.Header {
+	return m.header
+}
+
+func (m *Msg) Subject() string {
+	return m.subject
+}
+
+func (m *Msg) Reply() string {
+	return ""
+}
+
+func (m *Msg) Ack() error {
+	return m.resolve(ackKindAck, 0)
+}
+
+func (m *Msg) DoubleAck(_ context.Context) error {
+	return m.Ack()
+}
+
+func (m *Msg) Nak() error {
+	return m.resolve(ackKindNak, 0)
+}
+
+func (m *Msg) NakWithDelay(delay time.Duration) error {
+	return m.resolve(ackKindNak, delay)
+}
+
+func (m *Msg) InProgress() error {
+	return m.resolve(ackKindInProgress, 0)
+}
+
+func (m *Msg) Term() error {
+	return m.resolve(ackKindTerm, 0)
+}
+
+func (m *Msg) TermWithReason(_ string) error {
+	return m.Term()
+}
+
+// resolve reports the delivery outcome to the broker, like with NATS, a message can only be resolved once,
+// except for progress reports.
+func (m *Msg) resolve(kind ackKind, delay time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.acked {
+		return jetstream.ErrMsgAlreadyAckd
+	}
+
+	err := m.broker.ack(m, kind, delay)
+	if err != nil {
+		return err
+	}
+
+	if kind != ackKindInProgress {
+		m.acked = true
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/pubsub/naming"
+)
+
+const (
+	// defaultAckWait matches the NATS default.
+	defaultAckWait = 30 * time.Second
+
+	listenBufferSize = 64
+)
+
+// PubSuber is an in-memory core.PubSuber, streams and their consumers are kept by the Broker. It follows
+// the semantics of the NATS implementation, but only works within a single process.
+type PubSuber struct {
+	naming.Names
+
+	Broker *Broker
+
+	Logger *slog.Logger
+}
+
+func (p PubSuber) Publish(_ context.Context, msg *nats.Msg) error {
+	err := p.Broker.publish(msg)
+	if err != nil {
+		if errors.Is(err, ErrNoStream) {
+			return fmt.Errorf("%w: %w", core.ErrStreamNotFound, err)
+		}
+
+		return fmt.Errorf("failed to publish: %w", err)
+	}
+
+	return nil
+}
+
+// PublishWaitResponse Publishes a message to "subject", awaits for response on "subject.response".
+func (p PubSuber) PublishWaitResponse(ctx context.Context, input core.PublishWaitResponseInput) (jetstream.Msg, error) { //nolint:lll
+	replChan := lo.Async2(func() (jetstream.Msg, error) { return p.awaitResponse(ctx, input) })
+
+	if err := p.Publish(ctx, input.Msg); err != nil {
+		return nil, fmt.Errorf("failed to publish msg: %w", err)
+	}
+
+	p.Logger.Debug("Message sent, awaiting response", "subject", input.Msg.Subject)
+
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to consume response: %w", ctx.Err())
+	case response := <-replChan:
+		return response.Unpack()
+	}
+}
+
+func (p PubSuber) awaitResponse(ctx context.Context, input core.PublishWaitResponseInput) (jetstream.Msg, error) { //nolint:lll
+	responseCtx, cancel := context.WithTimeout(ctx, input.Timeout)
+	defer cancel()
+
+	response, err := p.Next(responseCtx, input.Stream, input.Subjects, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	response.Ack() //nolint:errcheck
+
+	return response, nil
+}
+
+// CreateOrUpdateFunctionStream creates or updates the function's work queue, response and dead-letter streams.
+// Storage and replicas are meaningless in memory, they are ignored.
+func (p PubSuber) CreateOrUpdateFunctionStream(_ context.Context, function core.FunctionDefinition) error {
+	config := function.StreamConfig()
+	streamName := p.FunctionStreamName(function)
+
+	err := p.Broker.createOrUpdateStream(streamConfig{
+		name:       streamName,
+		subjects:   []string{p.InvokeSubjectName(function)},
+		retention:  workQueueRetention,
+		maxMsgs:    config.MaxMsgs,
+		maxBytes:   config.MaxBytes,
+		maxAge:     config.MaxAge,
+		discardNew: config.Discard == core.DiscardNew,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create or update stream: %w", err)
+	}
+
+	p.Logger.Info("Stream created or updated", "streamName", streamName)
+
+	responseStreamName := p.ResponseStreamName(function)
+
+	err = p.Broker.createOrUpdateStream(streamConfig{
+		name: responseStreamName,
+		subjects: []string{
+			p.ResponseSubjectName(function, "*"),
+			p.ErrorSubjectName(function, "*"),
+		},
+		retention: workQueueRetention,
+		maxBytes:  core.ResponseStreamMaxBytes,
+		maxAge:    core.ResponseStreamMaxAge,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create or update response stream: %w", err)
+	}
+
+	p.Logger.Info("Stream created or updated", "streamName", responseStreamName)
+
+	dlqName := p.DeadLetterStreamName(function)
+
+	err = p.Broker.createOrUpdateStream(streamConfig{
+		name:       dlqName,
+		subjects:   []string{p.DeadLetterSubjectName(function)},
+		retention:  limitsRetention,
+		maxMsgs:    core.DefaultStreamMaxMsgs,
+		maxBytes:   core.DefaultStreamMaxBytes,
+		maxAge:     core.DefaultStreamMaxAge,
+		discardNew: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create or update dead-letter stream: %w", err)
+	}
+
+	p.Logger.Info("Stream created or updated", "streamName", dlqName)
+
+	return nil
+}
+
+// Next returns the next message from the stream, unlike the NATS implementation it respects ctx cancellation.
+func (p PubSuber) Next(ctx context.Context, streamName string, subjects []string, durableName string) (jetstream.Msg, error) { //nolint:lll
+	ackWait := defaultAckWait
+	if durableName != "" {
+		// Asynchronous invocations are acknowledged once handled, it may take up to core.MaxTimeout.
+		ackWait = core.MaxTimeout
+	}
+
+	consumerName, err := p.Broker.consumer(streamName, subjects, durableName, ackWait)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer: %w", err)
+	}
+	defer p.Broker.release(streamName, consumerName)
+
+	msg, err := p.Broker.fetch(ctx, streamName, consumerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch message: %w", err)
+	}
+
+	return msg, nil
+}
+
+func (p PubSuber) Subscribe(_ context.Context, streamName string, subjects []string, durableName string) (core.Subscription, error) { //nolint:lll
+	consumerName, err := p.Broker.consumer(streamName, subjects, durableName, defaultAckWait)
+	if err != nil {
+		if errors.Is(err, ErrStreamNotFound) {
+			return nil, fmt.Errorf("%w: %w", core.ErrStreamNotFound, err)
+		}
+
+		return nil, fmt.Errorf("failed to create consumer: %w", err)
+	}
+
+	logger := p.Logger.With(
+		"stream", streamName,
+		"consumer", consumerName,
+		"subjects", subjects,
+	)
+
+	return newSubscription(p.Broker, streamName, consumerName, logger), nil
+}
+
+// Broadcast delivers the message to active listeners only.
+func (p PubSuber) Broadcast(_ context.Context, msg *nats.Msg) error {
+	p.Broker.broadcast(msg)
+
+	return nil
+}
+
+// Listen observes messages published to the subject, stored messages are not consumed. Messages are dropped
+// if the reader is slower than the publishers. Listening stops when ctx is done.
+func (p PubSuber) Listen(ctx context.Context, subject string) (<-chan *nats.Msg, error) {
+	return p.Broker.listen(ctx, subject, listenBufferSize), nil
+}
+
+// Pending returns the number of invocations stored in the function's stream which are not picked up
+// by any instance yet.
+func (p PubSuber) Pending(_ context.Context, function core.FunctionDefinition) (int, error) {
+	pending, err := p.Broker.pending(p.FunctionStreamName(function), p.InvokeSubjectName(function), function.Name())
+	if err != nil {
+		return 0, fmt.Errorf("failed to count pending messages: %w", err)
+	}
+
+	return pending, nil
+}
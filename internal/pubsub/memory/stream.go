@@ -0,0 +1,250 @@
+package memory
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/zhulik/fid/internal/core"
+)
+
+type retention int
+
+const (
+	// workQueueRetention removes messages once they are acknowledged.
+	workQueueRetention retention = iota
+	// limitsRetention keeps messages until they are deleted or the stream's limits are reached.
+	limitsRetention
+)
+
+type streamConfig struct {
+	name      string
+	subjects  []string
+	retention retention
+	maxMsgs   int
+	maxBytes  int64
+	maxAge    time.Duration
+	// discardNew rejects new messages when the stream is full instead of dropping the oldest ones.
+	discardNew bool
+}
+
+type storedMsg struct {
+	seq       uint64
+	subject   string
+	header    nats.Header
+	data      []byte
+	timestamp time.Time
+}
+
+type stream struct {
+	config streamConfig
+
+	lastSeq   uint64
+	messages  []*storedMsg // ordered by seq
+	consumers map[string]*consumer
+}
+
+type consumer struct {
+	name      string
+	filters   []string
+	ackWait   time.Duration
+	ephemeral bool
+
+	// active is set while a subscription or a Next call uses the consumer, inactive ephemeral consumers
+	// are removed once all their deliveries are resolved.
+	active bool
+
+	deliveredSeq uint64
+	pending      map[uint64]time.Time // stream seq -> redelivery deadline
+	deliveries   map[uint64]uint64    // stream seq -> number of deliveries
+	acked        map[uint64]bool      // only used with limitsRetention
+}
+
+func newConsumer(name string, filters []string, ackWait time.Duration, ephemeral bool) *consumer {
+	return &consumer{
+		name:       name,
+		filters:    filters,
+		ackWait:    ackWait,
+		ephemeral:  ephemeral,
+		pending:    map[uint64]time.Time{},
+		deliveries: map[uint64]uint64{},
+		acked:      map[uint64]bool{},
+	}
+}
+
+func (c *consumer) matches(subject string) bool {
+	if len(c.filters) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(c.filters, func(filter string) bool {
+		return core.SubjectMatches(filter, subject)
+	})
+}
+
+func (c *consumer) isPending(seq uint64, now time.Time) bool {
+	deadline, ok := c.pending[seq]
+
+	return ok && now.Before(deadline)
+}
+
+func (c *consumer) forget(seq uint64) {
+	delete(c.pending, seq)
+	delete(c.deliveries, seq)
+	delete(c.acked, seq)
+}
+
+func (s *stream) matches(subject string) bool {
+	return slices.ContainsFunc(s.config.subjects, func(filter string) bool {
+		return core.SubjectMatches(filter, subject)
+	})
+}
+
+func (s *stream) store(msg *nats.Msg, now time.Time) error {
+	if s.config.discardNew && s.config.exceeds(len(s.messages)+1, s.bytes()+int64(len(msg.Data))) {
+		return core.ErrQueueFull
+	}
+
+	s.lastSeq++
+
+	s.messages = append(s.messages, &storedMsg{
+		seq:       s.lastSeq,
+		subject:   msg.Subject,
+		header:    cloneHeader(msg.Header),
+		data:      slices.Clone(msg.Data),
+		timestamp: now,
+	})
+
+	// Like NATS streams with the default discard policy, the oldest messages are dropped.
+	for len(s.messages) > 0 && s.config.exceeds(len(s.messages), s.bytes()) {
+		s.remove(s.messages[0].seq)
+	}
+
+	return nil
+}
+
+// exceeds reports whether the amount of messages and their size exceed the stream's limits.
+func (c streamConfig) exceeds(msgs int, bytes int64) bool {
+	return (c.maxMsgs > 0 && msgs > c.maxMsgs) || (c.maxBytes > 0 && bytes > c.maxBytes)
+}
+
+func (s *stream) bytes() int64 {
+	var total int64
+	for _, msg := range s.messages {
+		total += int64(len(msg.data))
+	}
+
+	return total
+}
+
+func (s *stream) get(seq uint64) *storedMsg {
+	index, found := slices.BinarySearchFunc(s.messages, seq, func(msg *storedMsg, seq uint64) int {
+		return cmp.Compare(msg.seq, seq)
+	})
+	if !found {
+		return nil
+	}
+
+	return s.messages[index]
+}
+
+func (s *stream) remove(seq uint64) bool {
+	index := slices.IndexFunc(s.messages, func(msg *storedMsg) bool { return msg.seq == seq })
+	if index < 0 {
+		return false
+	}
+
+	s.messages = slices.Delete(s.messages, index, index+1)
+
+	for _, cons := range s.consumers {
+		cons.forget(seq)
+	}
+
+	return true
+}
+
+// expire removes messages older than the stream's max age and ephemeral consumers nobody uses anymore.
+func (s *stream) expire(now time.Time) {
+	if s.config.maxAge > 0 {
+		for len(s.messages) > 0 && now.Sub(s.messages[0].timestamp) > s.config.maxAge {
+			s.remove(s.messages[0].seq)
+		}
+	}
+
+	for name, cons := range s.consumers {
+		if !cons.ephemeral || cons.active {
+			continue
+		}
+
+		inFlight := false
+
+		for seq := range cons.pending {
+			if cons.isPending(seq, now) {
+				inFlight = true
+
+				break
+			}
+		}
+
+		if !inFlight {
+			delete(s.consumers, name)
+		}
+	}
+}
+
+// next returns the next message the consumer can receive. When there is none, it returns when
+// the earliest pending message is going to be redelivered, zero time if there are no such messages.
+func (s *stream) next(cons *consumer, now time.Time) (*storedMsg, time.Time) {
+	var redeliverAt time.Time
+
+	for _, msg := range s.messages {
+		if !cons.matches(msg.subject) || cons.acked[msg.seq] {
+			continue
+		}
+
+		deadline, pending := s.pendingDeadline(cons, msg.seq, now)
+		if pending {
+			if redeliverAt.IsZero() || deadline.Before(redeliverAt) {
+				redeliverAt = deadline
+			}
+
+			continue
+		}
+
+		return msg, time.Time{}
+	}
+
+	return nil, redeliverAt
+}
+
+// pendingDeadline returns the redelivery deadline of the message if it awaits acknowledgement. Messages
+// of work queue streams are delivered to one consumer at a time, so all consumers are checked.
+func (s *stream) pendingDeadline(cons *consumer, seq uint64, now time.Time) (time.Time, bool) {
+	consumers := []*consumer{cons}
+	if s.config.retention == workQueueRetention {
+		consumers = slices.Collect(maps.Values(s.consumers))
+	}
+
+	for _, c := range consumers {
+		if c.isPending(seq, now) {
+			return c.pending[seq], true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func cloneHeader(header nats.Header) nats.Header {
+	if header == nil {
+		return nil
+	}
+
+	clone := make(nats.Header, len(header))
+	for key, values := range header {
+		clone[key] = slices.Clone(values)
+	}
+
+	return clone
+}
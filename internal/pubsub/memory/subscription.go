@@ -0,0 +1,59 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type subscription struct {
+	ch     chan jetstream.Msg
+	cancel context.CancelFunc
+	logger *slog.Logger
+}
+
+func newSubscription(broker *Broker, streamName, consumerName string, logger *slog.Logger) subscription {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sub := subscription{
+		ch:     make(chan jetstream.Msg),
+		cancel: cancel,
+		logger: logger,
+	}
+
+	go func() {
+		defer broker.release(streamName, consumerName)
+
+		for {
+			msg, err := broker.fetch(ctx, streamName, consumerName)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Warn("Subscription failed", "error", err)
+				}
+
+				return
+			}
+
+			// Messages fetched after Stop are dropped unacknowledged, they are redelivered later.
+			select {
+			case sub.ch <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return sub
+}
+
+// C returns the channel of consumed messages. It is not closed on Stop, readers should stop reading
+// when Stop is called.
+func (s subscription) C() <-chan jetstream.Msg {
+	return s.ch
+}
+
+func (s subscription) Stop() {
+	s.cancel()
+	s.logger.Debug("Subscription stopped")
+}
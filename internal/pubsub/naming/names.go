@@ -0,0 +1,43 @@
+package naming
+
+import (
+	"fmt"
+
+	"github.com/zhulik/fid/internal/core"
+)
+
+// Names implements stream and subject naming of core.PubSuber, it's embedded into PubSuber implementations
+// so all of them agree on names.
+type Names struct{}
+
+func (Names) FunctionStreamName(function core.FunctionDefinition) string {
+	return fmt.Sprintf("%s:%s", core.StreamNameInvocation, function)
+}
+
+func (Names) ResponseStreamName(function core.FunctionDefinition) string {
+	return fmt.Sprintf("%s:%s", core.StreamNameResponse, function)
+}
+
+func (Names) InvokeSubjectName(function core.FunctionDefinition) string {
+	return fmt.Sprintf("%s.%s", core.InvokeSubjectBase, function)
+}
+
+func (Names) ResponseSubjectName(function core.FunctionDefinition, requestID string) string {
+	return fmt.Sprintf("%s.%s.%s.response", core.ResponseSubjectBase, function, requestID)
+}
+
+func (Names) ErrorSubjectName(function core.FunctionDefinition, requestID string) string {
+	return fmt.Sprintf("%s.%s.%s.error", core.ResponseSubjectBase, function, requestID)
+}
+
+func (Names) InitErrorSubjectName(function core.FunctionDefinition) string {
+	return fmt.Sprintf("%s.%s.init", core.ErrorSubjectBase, function)
+}
+
+func (Names) DeadLetterStreamName(function core.FunctionDefinition) string {
+	return fmt.Sprintf("%s:%s", core.StreamNameDeadLetter, function)
+}
+
+func (Names) DeadLetterSubjectName(function core.FunctionDefinition) string {
+	return fmt.Sprintf("%s.%s", core.DeadLetterSubjectBase, function)
+}
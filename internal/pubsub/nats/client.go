@@ -11,13 +11,21 @@ import (
 )
 
 type Client struct { //nolint:recvcheck
-	Config    *config.Config
+	Config *config.Config
+	// Server is only provided when NATS is embedded, the client connects to it in-process.
+	Server *Server
+
 	Nats      *libNats.Conn
 	JetStream jetstream.JetStream
 }
 
 func (c *Client) Init(_ context.Context) error {
-	natsClient, err := libNats.Connect(c.Config.NATSURL)
+	var options []libNats.Option
+	if c.Server != nil {
+		options = append(options, libNats.InProcessServer(c.Server.server))
+	}
+
+	natsClient, err := libNats.Connect(c.Config.NATSURL, options...)
 	if err != nil {
 		return fmt.Errorf("failed to connect to NATS: %w", err)
 	}
@@ -0,0 +1,33 @@
+package nats_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/kv"
+	"github.com/zhulik/fid/internal/pubsub/nats"
+	"github.com/zhulik/fid/testhelpers"
+	"github.com/zhulik/fid/testhelpers/conformance"
+	"github.com/zhulik/pal"
+)
+
+var _ = conformance.PubSub("Nats", func(ctx context.Context) *pal.Pal {
+	p := testhelpers.NewPal(ctx,
+		pal.Provide[core.PubSuber](&nats.PubSuber{}),
+		pal.Provide[core.DeadLetterQueue](&nats.DeadLetterQueue{}),
+		kv.Provide(core.BrokerNameNATS),
+	)
+
+	client := lo.Must(pal.Invoke[*nats.Client](ctx, p))
+	pubSuber := lo.Must(pal.Invoke[core.PubSuber](ctx, p))
+
+	DeferCleanup(func(ctx SpecContext) {
+		client.JetStream.DeleteStream(ctx, pubSuber.FunctionStreamName(conformance.Function))   //nolint:errcheck
+		client.JetStream.DeleteStream(ctx, pubSuber.ResponseStreamName(conformance.Function))   //nolint:errcheck
+		client.JetStream.DeleteStream(ctx, pubSuber.DeadLetterStreamName(conformance.Function)) //nolint:errcheck
+	})
+
+	return p
+})
@@ -0,0 +1,149 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/payloads"
+	"github.com/zhulik/fid/pkg/json"
+)
+
+// DeadLetterQueue stores dead letters as JSON messages in the function's dead-letter stream, letters are
+// identified by their sequence numbers in the stream.
+type DeadLetterQueue struct {
+	Nats      *Client
+	PubSuber  core.PubSuber
+	BlobStore core.BlobStore
+
+	Logger *slog.Logger
+}
+
+func (q DeadLetterQueue) Add(ctx context.Context, function core.FunctionDefinition, letter core.DeadLetter) error {
+	bytes, err := json.Marshal(letter)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+
+	msg := nats.NewMsg(q.PubSuber.DeadLetterSubjectName(function))
+	msg.Data = bytes
+
+	err = payloads.Offload(ctx, q.BlobStore, msg)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	err = q.PubSuber.Publish(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("failed to publish dead letter: %w", err)
+	}
+
+	q.Logger.Info("Dead letter added", "function", function, "requestID", letter.RequestID)
+
+	return nil
+}
+
+func (q DeadLetterQueue) List(ctx context.Context, function core.FunctionDefinition) ([]core.DeadLetter, error) {
+	stream, err := q.stream(ctx, function)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := stream.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead-letter stream info: %w", err)
+	}
+
+	letters := []core.DeadLetter{}
+
+	if info.State.Msgs == 0 {
+		return letters, nil
+	}
+
+	for id := info.State.FirstSeq; id <= info.State.LastSeq; id++ {
+		letter, err := q.get(ctx, stream, id)
+		if err != nil {
+			// Deleted letters leave gaps in the stream.
+			if errors.Is(err, core.ErrDeadLetterNotFound) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		letters = append(letters, letter)
+	}
+
+	return letters, nil
+}
+
+func (q DeadLetterQueue) Get(ctx context.Context, function core.FunctionDefinition, id uint64) (core.DeadLetter, error) { //nolint:lll
+	stream, err := q.stream(ctx, function)
+	if err != nil {
+		return core.DeadLetter{}, err
+	}
+
+	return q.get(ctx, stream, id)
+}
+
+func (q DeadLetterQueue) Delete(ctx context.Context, function core.FunctionDefinition, id uint64) error {
+	stream, err := q.stream(ctx, function)
+	if err != nil {
+		return err
+	}
+
+	// NATS does not report missing messages on deletion distinctly.
+	msg, err := stream.GetMsg(ctx, id)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			return core.ErrDeadLetterNotFound
+		}
+
+		return fmt.Errorf("failed to get dead letter: %w", err)
+	}
+
+	err = stream.DeleteMsg(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete dead letter: %w", err)
+	}
+
+	return payloads.Delete(ctx, q.BlobStore, msg.Header) //nolint:wrapcheck
+}
+
+func (q DeadLetterQueue) stream(ctx context.Context, function core.FunctionDefinition) (jetstream.Stream, error) {
+	stream, err := q.Nats.JetStream.Stream(ctx, q.PubSuber.DeadLetterStreamName(function))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead-letter stream: %w", err)
+	}
+
+	return stream, nil
+}
+
+func (q DeadLetterQueue) get(ctx context.Context, stream jetstream.Stream, id uint64) (core.DeadLetter, error) {
+	msg, err := stream.GetMsg(ctx, id)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			return core.DeadLetter{}, core.ErrDeadLetterNotFound
+		}
+
+		return core.DeadLetter{}, fmt.Errorf("failed to get dead letter: %w", err)
+	}
+
+	data, err := payloads.Resolve(ctx, q.BlobStore, msg.Header, msg.Data)
+	if err != nil {
+		return core.DeadLetter{}, err //nolint:wrapcheck
+	}
+
+	letter, err := json.Unmarshal[core.DeadLetter](data)
+	if err != nil {
+		return core.DeadLetter{}, fmt.Errorf("failed to unmarshal dead letter: %w", err)
+	}
+
+	letter.ID = id
+
+	return letter, nil
+}
@@ -0,0 +1,18 @@
+package nats_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/fid/testhelpers"
+)
+
+func TestNats(t *testing.T) {
+	t.Parallel()
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Nats PubSub Suite")
+}
+
+var _ = AfterSuite(testhelpers.StopNATS)
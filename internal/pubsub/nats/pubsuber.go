@@ -11,16 +11,22 @@ import (
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/samber/lo"
 	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/pubsub/naming"
 )
 
 const (
-	maxBytes    = 10 * 1024 * 1024 // 10MB
-	maxMsgs     = 1000
-	maxAge      = 72 * time.Hour
 	nextTimeout = 30 * time.Second
+
+	listenBufferSize = 64
 )
 
+// ErrCodeStreamStoreFailed is returned by JetStream when a message is published to a full stream with the
+// DiscardNew policy, object stores are such streams too.
+const ErrCodeStreamStoreFailed jetstream.ErrorCode = 10077
+
 type PubSuber struct {
+	naming.Names
+
 	Nats *Client
 
 	Logger *slog.Logger
@@ -40,6 +46,16 @@ func (p PubSuber) HealthCheck(ctx context.Context) error {
 func (p PubSuber) Publish(ctx context.Context, msg *nats.Msg) error {
 	_, err := p.Nats.JetStream.PublishMsg(ctx, msg)
 	if err != nil {
+		var apiErr *jetstream.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode == ErrCodeStreamStoreFailed {
+			return fmt.Errorf("%w: %w", core.ErrQueueFull, err)
+		}
+
+		// Nothing responds to publishes to subjects without a stream.
+		if errors.Is(err, jetstream.ErrNoStreamResponse) {
+			return fmt.Errorf("%w: %w", core.ErrStreamNotFound, err)
+		}
+
 		return fmt.Errorf("failed to publish: %w", err)
 	}
 
@@ -79,53 +95,185 @@ func (p PubSuber) awaitResponse(ctx context.Context, input core.PublishWaitRespo
 	return response, nil
 }
 
-// CreateOrUpdateFunctionStream creates or updates a stream for function invocation.
-// TODO: something more universal, for any kind of streams?
+// CreateOrUpdateFunctionStream creates or updates the function's work queue, response and dead-letter streams.
+// The response and dead-letter streams keep their own limits, so neither responses nor letters are rejected
+// or evict queued invocations.
 func (p PubSuber) CreateOrUpdateFunctionStream(ctx context.Context, function core.FunctionDefinition) error {
+	config := function.StreamConfig()
 	streamName := p.FunctionStreamName(function)
 
-	cfg := jetstream.StreamConfig{
-		Name: streamName,
+	discard := jetstream.DiscardOld
+	if config.Discard == core.DiscardNew {
+		discard = jetstream.DiscardNew
+	}
+
+	err := p.createOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      streamName,
+		Subjects:  []string{p.InvokeSubjectName(function)},
+		Storage:   storageType(config.Storage),
+		Retention: jetstream.WorkQueuePolicy,
+		Discard:   discard,
+		MaxAge:    config.MaxAge,
+		MaxMsgs:   int64(config.MaxMsgs),
+		MaxBytes:  config.MaxBytes,
+		Replicas:  config.Replicas,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create or update stream: %w", err)
+	}
+
+	p.Logger.Info("Stream created or updated", "streamName", streamName)
+
+	// Created after the work queue stream is updated, older versions stored responses in it and streams
+	// cannot share subjects.
+	responseStreamName := p.ResponseStreamName(function)
+
+	err = p.createOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name: responseStreamName,
 		Subjects: []string{
-			p.InvokeSubjectName(function),
 			p.ResponseSubjectName(function, "*"),
 			p.ErrorSubjectName(function, "*"),
 		},
-		Storage:   jetstream.FileStorage,
+		Storage:   storageType(config.Storage),
 		Retention: jetstream.WorkQueuePolicy,
-		MaxAge:    maxAge,
-		MaxMsgs:   maxMsgs,
-		MaxBytes:  maxBytes,
-		Replicas:  1,
+		MaxAge:    core.ResponseStreamMaxAge,
+		MaxBytes:  core.ResponseStreamMaxBytes,
+		Replicas:  config.Replicas,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create or update response stream: %w", err)
 	}
 
-	_, err := p.Nats.JetStream.CreateOrUpdateStream(ctx, cfg)
+	p.Logger.Info("Stream created or updated", "streamName", responseStreamName)
+
+	dlqName := p.DeadLetterStreamName(function)
+
+	// Dead letters are not evicted to make room for new ones, they are rejected when the stream is full.
+	err = p.createOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      dlqName,
+		Subjects:  []string{p.DeadLetterSubjectName(function)},
+		Storage:   storageType(config.Storage),
+		Retention: jetstream.LimitsPolicy,
+		Discard:   jetstream.DiscardNew,
+		MaxAge:    core.DefaultStreamMaxAge,
+		MaxMsgs:   core.DefaultStreamMaxMsgs,
+		MaxBytes:  core.DefaultStreamMaxBytes,
+		Replicas:  config.Replicas,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create or update stream: %w", err)
+		return fmt.Errorf("failed to create or update dead-letter stream: %w", err)
 	}
 
-	p.Logger.Info("Stream created or updated", "streamName", streamName)
+	p.Logger.Info("Stream created or updated", "streamName", dlqName)
+
+	return nil
+}
+
+// createOrUpdateStream creates the stream or updates it unless the update drops stored messages. The storage
+// of a stream cannot be changed in place, so empty streams are recreated and others are left as is.
+func (p PubSuber) createOrUpdateStream(ctx context.Context, config jetstream.StreamConfig) error {
+	stream, err := p.Nats.JetStream.Stream(ctx, config.Name)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		_, err = p.Nats.JetStream.CreateStream(ctx, config)
+		if err != nil {
+			return fmt.Errorf("failed to create stream: %w", err)
+		}
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to get stream: %w", err)
+	}
+
+	info := stream.CachedInfo()
+
+	err = checkStreamUpdate(info, config)
+	if err != nil {
+		return err
+	}
+
+	if info.Config.Storage != config.Storage {
+		p.Logger.Warn("Recreating empty stream to change its storage", "streamName", config.Name,
+			"from", info.Config.Storage, "to", config.Storage)
+
+		err = p.Nats.JetStream.DeleteStream(ctx, config.Name)
+		if err != nil {
+			return fmt.Errorf("failed to delete stream: %w", err)
+		}
+
+		_, err = p.Nats.JetStream.CreateStream(ctx, config)
+		if err != nil {
+			return fmt.Errorf("failed to create stream: %w", err)
+		}
+
+		return nil
+	}
+
+	_, err = p.Nats.JetStream.UpdateStream(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to update stream: %w", err)
+	}
 
 	return nil
 }
 
+// checkStreamUpdate returns ErrUnsafeStreamUpdate if the stored messages do not fit into the new config.
+func checkStreamUpdate(info *jetstream.StreamInfo, config jetstream.StreamConfig) error {
+	state := info.State
+
+	switch {
+	case state.Msgs == 0:
+		return nil
+	case info.Config.Storage != config.Storage:
+		return fmt.Errorf("%w: %s holds %d messages, its storage cannot be changed",
+			core.ErrUnsafeStreamUpdate, config.Name, state.Msgs)
+	case config.MaxMsgs > 0 && state.Msgs > uint64(config.MaxMsgs): //nolint:gosec
+		return fmt.Errorf("%w: %s holds %d messages, more than %d",
+			core.ErrUnsafeStreamUpdate, config.Name, state.Msgs, config.MaxMsgs)
+	case config.MaxBytes > 0 && state.Bytes > uint64(config.MaxBytes): //nolint:gosec
+		return fmt.Errorf("%w: %s holds %d bytes, more than %d",
+			core.ErrUnsafeStreamUpdate, config.Name, state.Bytes, config.MaxBytes)
+	case config.MaxAge > 0 && time.Since(state.FirstTime) > config.MaxAge:
+		return fmt.Errorf("%w: %s holds messages older than %s",
+			core.ErrUnsafeStreamUpdate, config.Name, config.MaxAge)
+	}
+
+	return nil
+}
+
+func storageType(storage core.StorageType) jetstream.StorageType {
+	if storage == core.StorageTypeMemory {
+		return jetstream.MemoryStorage
+	}
+
+	return jetstream.FileStorage
+}
+
 // Next returns the next message from the stream, **does not respect ctx cancellation properly yet**,
 // but checks ctx status when reaches timeout in the Nats client, so ctx cancellation will be
 // respected in the next iteration.
 func (p PubSuber) Next(ctx context.Context, streamName string, subjects []string, durableName string) (jetstream.Msg, error) { //nolint:lll
-	var inactiveThreshold time.Duration
+	var inactiveThreshold, ackWait time.Duration
 	if durableName != "" {
 		inactiveThreshold = core.MaxTimeout
+		// Asynchronous invocations are acknowledged once handled, it may take up to core.MaxTimeout.
+		ackWait = core.MaxTimeout
 	}
 
 	config := jetstream.ConsumerConfig{
 		Durable:           durableName,
 		FilterSubjects:    subjects,
 		InactiveThreshold: inactiveThreshold,
+		AckWait:           ackWait,
 	}
 
 	cons, err := p.Nats.JetStream.CreateOrUpdateConsumer(ctx, streamName, config)
 	if err != nil {
+		if errors.Is(err, jetstream.ErrStreamNotFound) {
+			return nil, fmt.Errorf("%w: %w", core.ErrStreamNotFound, err)
+		}
+
 		return nil, fmt.Errorf("failed to create consumerCtx: %w", err)
 	}
 
@@ -180,6 +328,10 @@ func (p PubSuber) Subscribe(ctx context.Context, streamName string, subjects []s
 
 	cons, err := p.Nats.JetStream.CreateOrUpdateConsumer(ctx, streamName, config)
 	if err != nil {
+		if errors.Is(err, jetstream.ErrStreamNotFound) {
+			return nil, fmt.Errorf("%w: %w", core.ErrStreamNotFound, err)
+		}
+
 		return nil, fmt.Errorf("failed to create consumerCtx: %w", err)
 	}
 
@@ -196,18 +348,71 @@ func (p PubSuber) Subscribe(ctx context.Context, streamName string, subjects []s
 	return newSubscriptionWrapper(cons, logger)
 }
 
-func (p PubSuber) FunctionStreamName(function core.FunctionDefinition) string {
-	return fmt.Sprintf("%s:%s", core.StreamNameInvocation, function)
-}
+// Broadcast publishes the message with a plain NATS publish, it's only delivered to active listeners.
+func (p PubSuber) Broadcast(_ context.Context, msg *nats.Msg) error {
+	err := p.Nats.Nats.PublishMsg(msg)
+	if err != nil {
+		return fmt.Errorf("failed to broadcast: %w", err)
+	}
 
-func (p PubSuber) InvokeSubjectName(function core.FunctionDefinition) string {
-	return fmt.Sprintf("%s.%s", core.InvokeSubjectBase, function)
+	return nil
 }
 
-func (p PubSuber) ResponseSubjectName(function core.FunctionDefinition, requestID string) string {
-	return fmt.Sprintf("%s.%s.%s.response", core.ResponseSubjectBase, function, requestID)
+// Listen subscribes to the subject with a plain NATS subscription, so messages stored in work queue streams
+// are observed, but not consumed. Messages are dropped if the reader is slower than the publishers.
+// The subscription is dropped when ctx is done.
+func (p PubSuber) Listen(ctx context.Context, subject string) (<-chan *nats.Msg, error) {
+	msgChan := make(chan *nats.Msg, listenBufferSize)
+
+	sub, err := p.Nats.Nats.Subscribe(subject, func(msg *nats.Msg) {
+		select {
+		case msgChan <- msg:
+		default:
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		sub.Unsubscribe() //nolint:errcheck
+	}()
+
+	return msgChan, nil
 }
 
-func (p PubSuber) ErrorSubjectName(function core.FunctionDefinition, requestID string) string {
-	return fmt.Sprintf("%s.%s.%s.error", core.ResponseSubjectBase, function, requestID)
+// Pending returns the number of invocations stored in the function's stream which are not picked up
+// by any instance yet.
+func (p PubSuber) Pending(ctx context.Context, function core.FunctionDefinition) (int, error) {
+	subject := p.InvokeSubjectName(function)
+
+	stream, err := p.Nats.JetStream.Stream(ctx, p.FunctionStreamName(function))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get stream: %w", err)
+	}
+
+	info, err := stream.Info(ctx, jetstream.WithSubjectFilter(subject))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get stream info: %w", err)
+	}
+
+	pending := int(info.State.Subjects[subject]) //nolint:gosec
+
+	// Asynchronous invocations stay in the stream while being handled, they are not pending.
+	consumer, err := stream.Consumer(ctx, function.Name())
+	if err != nil {
+		if errors.Is(err, jetstream.ErrConsumerNotFound) {
+			return pending, nil
+		}
+
+		return 0, fmt.Errorf("failed to get consumer: %w", err)
+	}
+
+	consumerInfo, err := consumer.Info(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get consumer info: %w", err)
+	}
+
+	return max(pending-consumerInfo.NumAckPending, 0), nil
 }
@@ -0,0 +1,141 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/zhulik/fid/internal/config"
+	"github.com/zhulik/fid/internal/core"
+)
+
+const (
+	serverReadyTimeout = 10 * time.Second
+	defaultPort        = 4222
+	loopbackHost       = "127.0.0.1"
+	anyHost            = "0.0.0.0"
+)
+
+var (
+	ErrServerNotReady      = errors.New("NATS server is not ready for connections")
+	ErrCredentialsRequired = errors.New("embedded NATS listens on all interfaces, the NATS URL must carry credentials")
+)
+
+// Server is an embedded NATS server with JetStream. When it's provided, Client connects to it in-process,
+// components started by the backend reach it with the configured NATS URL, so the server listens on the
+// URL's port. Only components started by the process backend share the host's loopback interface, the
+// server listens on it if the URL points to it. Otherwise it listens on all interfaces and requires the
+// credentials the URL carries: user and password or a token.
+type Server struct {
+	Config *config.Config
+	Logger *slog.Logger
+
+	server *server.Server
+}
+
+func (s *Server) Init(_ context.Context) error {
+	options, err := s.options()
+	if err != nil {
+		return err
+	}
+
+	natsServer, err := StartServer(options)
+	if err != nil {
+		return err
+	}
+
+	s.server = natsServer
+
+	s.Logger.Info("Embedded NATS server started",
+		"host", options.Host, "port", options.Port, "storeDir", options.StoreDir)
+
+	return nil
+}
+
+func (s *Server) Shutdown(_ context.Context) error {
+	s.server.Shutdown()
+	s.server.WaitForShutdown()
+
+	s.Logger.Info("Embedded NATS server stopped")
+
+	return nil
+}
+
+// StartServer starts a NATS server with JetStream storing its data in options.StoreDir and waits until it
+// accepts connections. server.RANDOM_PORT picks a random port, the server's ClientURL tells which.
+func StartServer(options *server.Options) (*server.Server, error) {
+	options.JetStream = true
+	options.NoSigs = true
+	options.NoLog = true
+
+	natsServer, err := server.NewServer(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create NATS server: %w", err)
+	}
+
+	natsServer.Start()
+
+	if !natsServer.ReadyForConnections(serverReadyTimeout) {
+		natsServer.Shutdown()
+
+		return nil, ErrServerNotReady
+	}
+
+	return natsServer, nil
+}
+
+func (s *Server) options() (*server.Options, error) {
+	parsed, err := url.Parse(s.Config.NATSURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse NATS URL: %w", err)
+	}
+
+	port, err := urlPort(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &server.Options{
+		Host:     loopbackHost,
+		Port:     port,
+		StoreDir: s.Config.EmbeddedNATSStoreDir,
+	}
+
+	if s.Config.Backend == core.BackendNameProcess && s.Config.LoopbackNATSURL() {
+		return options, nil
+	}
+
+	options.Host = anyHost
+
+	if parsed.User == nil {
+		return nil, ErrCredentialsRequired
+	}
+
+	password, ok := parsed.User.Password()
+	if ok {
+		options.Username = parsed.User.Username()
+		options.Password = password
+	} else {
+		options.Authorization = parsed.User.Username()
+	}
+
+	return options, nil
+}
+
+func urlPort(parsed *url.URL) (int, error) {
+	if parsed.Port() == "" {
+		return defaultPort, nil
+	}
+
+	port, err := strconv.Atoi(parsed.Port())
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse NATS URL port: %w", err)
+	}
+
+	return port, nil
+}
@@ -10,14 +10,20 @@ import (
 type subscriptionWrapper struct {
 	consumerCtx jetstream.ConsumeContext
 	ch          chan jetstream.Msg
+	done        chan struct{}
 	logger      *slog.Logger
 }
 
 func newSubscriptionWrapper(cons jetstream.Consumer, logger *slog.Logger) (subscriptionWrapper, error) {
 	msgChan := make(chan jetstream.Msg)
+	done := make(chan struct{})
 
 	consumerCtx, err := cons.Consume(func(msg jetstream.Msg) {
-		msgChan <- msg
+		// The consumer may still deliver messages after Stop, they are dropped unacknowledged.
+		select {
+		case msgChan <- msg:
+		case <-done:
+		}
 	})
 	if err != nil {
 		return subscriptionWrapper{}, fmt.Errorf("failed to consume: %w", err)
@@ -26,17 +32,19 @@ func newSubscriptionWrapper(cons jetstream.Consumer, logger *slog.Logger) (subsc
 	return subscriptionWrapper{
 		consumerCtx: consumerCtx,
 		ch:          msgChan,
+		done:        done,
 		logger:      logger,
 	}, nil
 }
 
+// C returns the channel of consumed messages. It is not closed on Stop, readers should stop reading
+// when Stop is called.
 func (s subscriptionWrapper) C() <-chan jetstream.Msg {
 	return s.ch
 }
 
 func (s subscriptionWrapper) Stop() {
-	s.consumerCtx.Drain()
+	close(s.done)
 	s.consumerCtx.Stop()
-	close(s.ch)
-	s.logger.Info("Subscription stopped")
+	s.logger.Debug("Subscription stopped")
 }
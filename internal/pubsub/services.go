@@ -2,13 +2,29 @@ package pubsub
 
 import (
 	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/pubsub/memory"
 	"github.com/zhulik/fid/internal/pubsub/nats"
 	"github.com/zhulik/pal"
 )
 
-func Provide() pal.ServiceDef {
+// Provide provides PubSuber and DeadLetterQueue of the selected broker, NATS unless memory is selected.
+func Provide(broker string) pal.ServiceDef {
+	if broker == core.BrokerNameMemory {
+		return pal.ProvideList(
+			pal.Provide(&memory.Broker{}),
+			pal.Provide[core.PubSuber](&memory.PubSuber{}),
+			pal.Provide[core.DeadLetterQueue](&memory.DeadLetterQueue{}),
+		)
+	}
+
 	return pal.ProvideList(
 		pal.Provide(&nats.Client{}),
 		pal.Provide[core.PubSuber](&nats.PubSuber{}),
+		pal.Provide[core.DeadLetterQueue](&nats.DeadLetterQueue{}),
 	)
 }
+
+// ProvideEmbeddedNATS provides the embedded NATS server, the NATS client connects to it in-process.
+func ProvideEmbeddedNATS() pal.ServiceDef {
+	return pal.Provide(&nats.Server{})
+}
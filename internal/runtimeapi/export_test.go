@@ -0,0 +1,45 @@
+package runtimeapi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zhulik/fid/internal/core"
+)
+
+const ErrorTypeDeliveryFailed = errorTypeDeliveryFailed
+
+// InvocationSlots exposes invocationSlots of the given instance to tests.
+type InvocationSlots struct {
+	slots *invocationSlots
+}
+
+func NewInvocationSlots(function core.FunctionDefinition, id string, repo core.InstancesRepo) InvocationSlots {
+	return InvocationSlots{slots: newInvocationSlots(functionInstance{
+		FunctionDefinition: function,
+		id:                 id,
+		instancesRepo:      repo,
+		mu:                 &sync.Mutex{},
+	})}
+}
+
+func (s InvocationSlots) Acquire(ctx context.Context) error {
+	return s.slots.acquire(ctx)
+}
+
+func (s InvocationSlots) Release() {
+	s.slots.release()
+}
+
+func (s InvocationSlots) Start(ctx context.Context, requestID string, deadline time.Time, onTimeout func()) error {
+	return s.slots.start(ctx, requestID, deadline, onTimeout)
+}
+
+func (s InvocationSlots) TimedOut(requestID string) bool {
+	return s.slots.timedOut(requestID)
+}
+
+func (s InvocationSlots) Finish(ctx context.Context, requestID string) error {
+	return s.slots.finish(ctx, requestID)
+}
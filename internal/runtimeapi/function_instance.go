@@ -2,6 +2,7 @@ package runtimeapi
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/zhulik/fid/internal/core"
@@ -11,6 +12,9 @@ type functionInstance struct {
 	core.FunctionDefinition
 	id            string
 	instancesRepo core.InstancesRepo
+
+	// mu serializes updates of the instance's records, heartbeats put them again.
+	mu *sync.Mutex
 }
 
 func (fi functionInstance) add(ctx context.Context) error {
@@ -21,10 +25,37 @@ func (fi functionInstance) delete(ctx context.Context) error {
 	return fi.instancesRepo.Delete(ctx, fi, fi.id) //nolint:wrapcheck
 }
 
-func (fi functionInstance) busy(ctx context.Context, busy bool) error {
-	return fi.instancesRepo.SetBusy(ctx, fi, fi.id, busy) //nolint:wrapcheck
+func (fi functionInstance) heartbeat(ctx context.Context) error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	return fi.instancesRepo.Heartbeat(ctx, fi, fi.id) //nolint:wrapcheck
+}
+
+func (fi functionInstance) inFlight(ctx context.Context, inFlight int) error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	return fi.instancesRepo.SetInFlight(ctx, fi, fi.id, inFlight) //nolint:wrapcheck
 }
 
 func (fi functionInstance) executed(ctx context.Context) error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
 	return fi.instancesRepo.SetLastExecuted(ctx, fi, fi.id, time.Now()) //nolint:wrapcheck
 }
+
+func (fi functionInstance) initError(ctx context.Context, payload []byte) error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	return fi.instancesRepo.SetInitError(ctx, fi, fi.id, payload) //nolint:wrapcheck
+}
+
+func (fi functionInstance) unhealthy(ctx context.Context) error {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	return fi.instancesRepo.SetUnhealthy(ctx, fi, fi.id) //nolint:wrapcheck
+}
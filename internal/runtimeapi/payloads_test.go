@@ -0,0 +1,103 @@
+package runtimeapi_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/runtimeapi"
+)
+
+var _ = Describe("Offloaded payloads", Serial, func() {
+	var env environment
+	var key string
+
+	function := docker.Function{Name_: "offloaded", Timeout_: 5 * time.Second}
+
+	BeforeEach(func(ctx SpecContext) {
+		env = newEnvironment(ctx, function)
+		key = lo.Must(env.blobs.Put(ctx, []byte("payload")))
+	})
+
+	// invoke publishes an invocation which payload is offloaded.
+	invoke := func(ctx SpecContext, invocationType string) {
+		msg := nats.NewMsg(env.pubSuber.InvokeSubjectName(function))
+		msg.Header.Set(core.HeaderNameRequestID, "request")
+		msg.Header.Set(core.HeaderNameInvocationType, invocationType)
+		msg.Header.Set(core.HeaderNamePayloadRef, key)
+
+		lo.Must0(env.pubSuber.Publish(ctx, msg))
+	}
+
+	Context("when the invocation is synchronous", func() {
+		It("deletes the payload once it's picked up", func(ctx SpecContext) {
+			invoke(ctx, core.InvocationTypeRequestResponse)
+
+			recorder := env.do(ctx, httptest.NewRequest(http.MethodGet, "/2018-06-01/runtime/invocation/next", nil))
+			Expect(recorder.Body.String()).To(Equal("payload"))
+
+			_, err := env.blobs.Get(ctx, key)
+			Expect(err).To(MatchError(core.ErrKeyNotFound))
+		})
+	})
+
+	Context("when the invocation is asynchronous", func() {
+		It("deletes the payload once the invocation is handled", func(ctx SpecContext) {
+			invoke(ctx, core.InvocationTypeEvent)
+
+			requestID := env.next(ctx)
+			Expect(env.blobs.Get(ctx, key)).To(Equal([]byte("payload")))
+
+			Expect(env.do(ctx, post(invocationPath(requestID, "response"), "response")).Code).To(Equal(http.StatusOK))
+
+			_, err := env.blobs.Get(ctx, key)
+			Expect(err).To(MatchError(core.ErrKeyNotFound))
+		})
+	})
+
+	Context("when the payload is missing", func() {
+		BeforeEach(func(ctx SpecContext) {
+			lo.Must0(env.blobs.Delete(ctx, key))
+		})
+
+		next := func(ctx context.Context) int {
+			return env.do(ctx, httptest.NewRequest(http.MethodGet, "/2018-06-01/runtime/invocation/next", nil)).Code
+		}
+
+		It("fails synchronous invocations right away", func(ctx SpecContext) {
+			sub := lo.Must(env.pubSuber.Subscribe(ctx, env.pubSuber.ResponseStreamName(function),
+				[]string{env.pubSuber.ErrorSubjectName(function, "request")}, ""))
+			DeferCleanup(sub.Stop)
+
+			invoke(ctx, core.InvocationTypeRequestResponse)
+
+			Expect(next(ctx)).To(Equal(http.StatusInternalServerError))
+
+			var msg jetstream.Msg
+			Eventually(sub.C()).Should(Receive(&msg))
+			Expect(msg.Headers().Get(core.HeaderNameErrorType)).To(Equal(runtimeapi.ErrorTypeDeliveryFailed))
+		})
+
+		It("redelivers asynchronous invocations and frees the slot", func(ctx SpecContext) {
+			invoke(ctx, core.InvocationTypeEvent)
+
+			Expect(next(ctx)).To(Equal(http.StatusInternalServerError))
+
+			// Neither the slot nor the invocation is held until the deadline, so the invocation is picked up
+			// again right away.
+			retryCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			defer cancel()
+
+			Expect(next(retryCtx)).To(Equal(http.StatusInternalServerError))
+			Expect(retryCtx.Err()).ToNot(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,115 @@
+package runtimeapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
+	"github.com/zhulik/fid/internal/core"
+)
+
+// streamChunkSize is the maximum size of a single published chunk of a streamed response.
+const streamChunkSize = 32 * 1024
+
+// streamResponse relays a streamed response to the response subject as it is being written by the function.
+// The stream starts with a message carrying the response mode and the content type, followed by chunks, and
+// is terminated by a message with the stream end header. Errors happening after the function started
+// streaming are reported by the function in trailers and are forwarded with the end message.
+func (s *Server) streamResponse(c *gin.Context, subject string, logger *slog.Logger) {
+	ctx := c.Request.Context()
+
+	contentType := c.GetHeader(core.HeaderNameContentType)
+	if contentType == "" {
+		contentType = core.ContentTypeOctetStream
+	}
+
+	err := s.publishChunk(ctx, subject, nats.Header{
+		core.HeaderNameResponseMode: {core.ResponseModeStreaming},
+		core.HeaderNameContentType:  {contentType},
+	}, nil)
+	if err != nil {
+		c.Error(err)
+
+		return
+	}
+
+	end := nats.Header{core.HeaderNameStreamEnd: {"true"}}
+
+	var errorBody []byte
+
+	buf := make([]byte, streamChunkSize)
+
+	for {
+		n, readErr := c.Request.Body.Read(buf)
+		if n > 0 {
+			err = s.publishChunk(ctx, subject, nil, bytes.Clone(buf[:n]))
+			if err != nil {
+				c.Error(err)
+
+				return
+			}
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+
+		if readErr != nil {
+			// The caller is still waiting for the end of the stream, so it's terminated with an error.
+			logger.Error("Failed to read streamed response", "error", readErr)
+
+			end.Set(core.HeaderNameErrorType, "Runtime.StreamError")
+			errorBody = []byte(readErr.Error())
+
+			break
+		}
+	}
+
+	if errorType := c.Request.Trailer.Get(core.HeaderNameErrorType); errorType != "" {
+		end.Set(core.HeaderNameErrorType, errorType)
+		errorBody = decodeErrorBody(c.Request.Trailer.Get(core.HeaderNameErrorBody))
+	}
+
+	err = s.publishChunk(ctx, subject, end, errorBody)
+	if err != nil {
+		c.Error(err)
+
+		return
+	}
+
+	err = s.functionInstance.executed(ctx)
+	if err != nil {
+		c.Error(err)
+
+		return
+	}
+
+	logger.Debug("Streamed response sent")
+}
+
+func (s *Server) publishChunk(ctx context.Context, subject string, header nats.Header, data []byte) error {
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+
+	if header != nil {
+		msg.Header = header
+	}
+
+	return s.PubSuber.Publish(ctx, msg) //nolint:wrapcheck
+}
+
+// decodeErrorBody decodes the base64 encoded error body sent in trailers, the body is returned as is
+// if it's not encoded.
+func decodeErrorBody(body string) []byte {
+	decoded, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return []byte(body)
+	}
+
+	return decoded
+}
@@ -0,0 +1,69 @@
+package runtimeapi_test
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/core"
+)
+
+var _ = Describe("Streamed responses", Serial, func() {
+	var env environment
+
+	function := docker.Function{Name_: "streaming", Timeout_: 5 * time.Second}
+
+	BeforeEach(func(ctx SpecContext) {
+		env = newEnvironment(ctx, function)
+	})
+
+	stream := func(requestID string, body string) *http.Request {
+		request := post(invocationPath(requestID, "response"), body)
+		request.Header.Set(core.HeaderNameResponseMode, core.ResponseModeStreaming)
+		request.Header.Set(core.HeaderNameContentType, "text/plain")
+
+		return request
+	}
+
+	It("relays the streamed response to the invoker", func(ctx SpecContext) {
+		responses := env.invokeStream(ctx, function)
+
+		requestID := env.next(ctx)
+		Expect(env.do(ctx, stream(requestID, "streamed response")).Code).To(Equal(http.StatusOK))
+
+		var response *core.InvocationResponse
+		Eventually(responses).WithContext(ctx).Should(Receive(&response))
+		DeferCleanup(response.Body.Close)
+
+		Expect(response.Streaming).To(BeTrue())
+		Expect(response.ContentType).To(Equal("text/plain"))
+		Expect(io.ReadAll(response.Body)).To(Equal([]byte("streamed response")))
+	})
+
+	It("forwards errors reported in trailers", func(ctx SpecContext) {
+		responses := env.invokeStream(ctx, function)
+
+		requestID := env.next(ctx)
+
+		request := stream(requestID, "partial")
+		request.Trailer = http.Header{
+			core.HeaderNameErrorType: {"Function.Error"},
+			core.HeaderNameErrorBody: {base64.StdEncoding.EncodeToString([]byte("failed"))},
+		}
+
+		Expect(env.do(ctx, request).Code).To(Equal(http.StatusOK))
+
+		var response *core.InvocationResponse
+		Eventually(responses).WithContext(ctx).Should(Receive(&response))
+		DeferCleanup(response.Body.Close)
+
+		body, err := io.ReadAll(response.Body)
+		Expect(body).To(Equal([]byte("partial")))
+		Expect(err).To(MatchError(core.ErrFunctionErrored))
+		Expect(err.(*core.FunctionError).Payload).To(Equal([]byte("failed"))) //nolint:errorlint,forcetypeassert
+	})
+})
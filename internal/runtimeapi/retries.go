@@ -0,0 +1,88 @@
+package runtimeapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/payloads"
+)
+
+// failAsync redelivers a failed asynchronous invocation after a delay. When no retries are left,
+// the invocation is moved to the dead-letter queue and marked as failed.
+func (s *Server) failAsync(ctx context.Context, msg jetstream.Msg, errorPayload []byte, logger *slog.Logger) error {
+	metadata, err := msg.Metadata()
+	if err != nil {
+		return fmt.Errorf("failed to get invocation metadata: %w", err)
+	}
+
+	attempts := int(metadata.NumDelivered) //nolint:gosec
+	retryConfig := s.functionInstance.RetryConfig()
+
+	if attempts <= retryConfig.Retries {
+		delay := retryConfig.Delay(attempts)
+
+		err = msg.NakWithDelay(delay)
+		if err != nil {
+			return fmt.Errorf("failed to redeliver invocation: %w", err)
+		}
+
+		logger.Info("Invocation failed, retrying", "attempts", attempts, "delay", delay)
+
+		return nil
+	}
+
+	payload, err := payloads.Resolve(ctx, s.BlobStore, msg.Headers(), msg.Data())
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	requestID := msg.Headers().Get(core.HeaderNameRequestID)
+
+	err = s.DeadLetterQueue.Add(ctx, s.functionInstance, core.DeadLetter{
+		RequestID: requestID,
+		Payload:   payload,
+		Metadata:  invocationMetadata(msg.Headers()),
+		Error:     errorPayload,
+		Attempts:  attempts,
+		FailedAt:  time.Now(),
+	})
+	if err != nil {
+		// The invocation is not acknowledged, it's redelivered and moved to the queue once there is room.
+		logger.Error("Failed to move invocation to the dead-letter queue", "attempts", attempts, "error", err)
+
+		return fmt.Errorf("failed to add dead letter: %w", err)
+	}
+
+	// The dead letter keeps the error even if the invocation record has expired.
+	err = s.InvocationsRepo.Fail(ctx, requestID, errorPayload)
+	if err != nil && !errors.Is(err, core.ErrInvocationNotFound) {
+		return fmt.Errorf("failed to store error response: %w", err)
+	}
+
+	err = msg.Ack()
+	if err != nil {
+		return fmt.Errorf("failed to acknowledge invocation: %w", err)
+	}
+
+	// The dead letter keeps its own copy of the payload.
+	s.deletePayload(ctx, msg, logger)
+
+	logger.Info("Invocation failed, moved to the dead-letter queue", "attempts", attempts)
+
+	return nil
+}
+
+func invocationMetadata(header nats.Header) core.InvocationMetadata {
+	return core.InvocationMetadata{
+		TraceID:         header.Get(core.HeaderNameTraceID),
+		ClientContext:   header.Get(core.HeaderNameClientContext),
+		CognitoIdentity: header.Get(core.HeaderNameCognitoIdentity),
+		Principal:       header.Get(core.HeaderNamePrincipal),
+	}
+}
@@ -2,30 +2,55 @@ package runtimeapi
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	"github.com/zhulik/fid/internal/config"
 	"github.com/zhulik/fid/internal/core"
 	"github.com/zhulik/fid/internal/httpserver"
+	"github.com/zhulik/fid/internal/payloads"
+	"github.com/zhulik/fid/pkg/json"
+	"github.com/zhulik/fid/pkg/sdk"
 	"github.com/zhulik/pal"
 )
 
+// errorTypeDeliveryFailed is reported for invocations which could not be passed to the function.
+const errorTypeDeliveryFailed = "Runtime.DeliveryFailed"
+
 type Server struct {
 	*httpserver.Server
 
-	Config        *config.Config
-	Logger        *slog.Logger
-	PubSuber      core.PubSuber
-	FunctionsRepo core.FunctionsRepo
-	InstancesRepo core.InstancesRepo
-	Pal           *pal.Pal
+	Config          *config.Config
+	Logger          *slog.Logger
+	PubSuber        core.PubSuber
+	FunctionsRepo   core.FunctionsRepo
+	InstancesRepo   core.InstancesRepo
+	InvocationsRepo core.InvocationsRepo
+	DeadLetterQueue core.DeadLetterQueue
+	BlobStore       core.BlobStore
+	Pal             *pal.Pal
 
 	functionInstance functionInstance
+	slots            *invocationSlots
+
+	// asyncInvocations holds messages of in-flight asynchronous invocations by request IDs, their results
+	// are stored in the invocations repo instead of being published. The messages are acknowledged once
+	// handled, failed ones are redelivered.
+	asyncInvocations sync.Map
+
+	// unhealthy is set when the function reports an init error or an invocation times out, such instance
+	// does not receive events.
+	unhealthy atomic.Bool
 }
 
 // NewServer creates a new Server instance.
@@ -47,6 +72,7 @@ func (s *Server) Init(ctx context.Context) error {
 		FunctionDefinition: function,
 		id:                 s.Config.FunctionInstanceID,
 		instancesRepo:      s.InstancesRepo,
+		mu:                 &sync.Mutex{},
 	}
 
 	err = instance.add(ctx)
@@ -54,6 +80,9 @@ func (s *Server) Init(ctx context.Context) error {
 		return fmt.Errorf("failed to add function to instances repo: %w", err)
 	}
 
+	s.functionInstance = instance
+	s.slots = newInvocationSlots(instance)
+
 	// Mimicking the AWS Lambda runtime API for custom runtimes
 	s.Router.GET("/2018-06-01/runtime/invocation/next", s.NextHandler)
 	s.Router.POST("/2018-06-01/runtime/invocation/:requestID/response", s.ResponseHandler)
@@ -64,22 +93,76 @@ func (s *Server) Init(ctx context.Context) error {
 }
 
 func (s *Server) Run(ctx context.Context) error {
-	return s.RunServer(ctx) //nolint:wrapcheck
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	heartbeatErr := make(chan error, 1)
+
+	go func() {
+		heartbeatErr <- s.heartbeat(ctx)
+
+		cancel()
+	}()
+
+	err := s.RunServer(ctx)
+
+	cancel()
+
+	return errors.Join(err, <-heartbeatErr)
 }
 
+// heartbeat keeps the instance alive until ctx is done, heartbeats are sent a few times per lease TTL, so
+// a single failed heartbeat does not kill the instance. If the lease has expired, the instance is
+// considered dead, the error is returned to stop the runtime API.
+func (s *Server) heartbeat(ctx context.Context) error {
+	ticker := time.NewTicker(core.InstanceHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			err := s.functionInstance.heartbeat(ctx)
+			if errors.Is(err, core.ErrInstanceLeaseExpired) {
+				s.Logger.Error("Instance lease expired, shutting down", "error", err)
+
+				return err
+			}
+
+			if err != nil {
+				s.Logger.Error("Failed to send heartbeat", "error", err)
+			}
+		}
+	}
+}
+
+// Shutdown deletes the instance's records, they are already gone if its lease has expired.
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.functionInstance.delete(ctx)
+	err := s.functionInstance.delete(ctx)
+	if errors.Is(err, core.ErrInstanceNotFound) {
+		return nil
+	}
+
+	return err
 }
 
 func (s *Server) NextHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 	subject := s.PubSuber.InvokeSubjectName(s.functionInstance)
 
+	if s.unhealthy.Load() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "instance is unhealthy"})
+
+		return
+	}
+
 	s.Logger.Info("Function connected, waiting for events...")
 
 	streamName := s.PubSuber.FunctionStreamName(s.functionInstance)
 
-	err := s.functionInstance.busy(c.Request.Context(), false)
+	// The runtime polls with as many workers as the function's concurrency, extra polls wait for a slot.
+	err := s.slots.acquire(ctx)
 	if err != nil {
 		c.Error(err)
 
@@ -88,22 +171,101 @@ func (s *Server) NextHandler(c *gin.Context) {
 
 	msg, err := s.PubSuber.Next(ctx, streamName, []string{subject}, s.functionInstance.Name())
 	if err != nil {
+		s.slots.release()
 		c.Error(err)
 
 		return
 	}
 
-	msg.Ack() //nolint:errcheck
+	async := msg.Headers().Get(core.HeaderNameInvocationType) == core.InvocationTypeEvent
+	if !async {
+		msg.Ack() //nolint:errcheck
+	}
+
+	requestID := msg.Headers().Get(core.HeaderNameRequestID)
+
+	if async {
+		s.asyncInvocations.Store(requestID, msg)
+	}
+
+	// Handlers get the function's timeout from the moment the event is picked up, like in AWS Lambda.
+	// Synchronous invocations which waited in the queue may be given up by the gateway earlier.
+	deadline := time.Now().Add(s.functionInstance.Timeout())
+
+	err = s.slots.start(ctx, requestID, deadline, func() { s.invocationTimedOut(requestID) })
+	if err != nil {
+		s.deliveryFailed(c, msg, requestID, err)
+
+		return
+	}
 
-	s.Logger.Info("Event received", "requestID", msg.Headers()[core.HeaderNameRequestID][0])
+	s.Logger.Info("Event received", "requestID", requestID)
+
+	data, err := payloads.Resolve(ctx, s.BlobStore, msg.Headers(), msg.Data())
+	if err != nil {
+		s.deliveryFailed(c, msg, requestID, err)
+
+		return
+	}
+
+	// Synchronous invocations are never redelivered, asynchronous ones keep the payload until handled.
+	if !async {
+		s.deletePayload(ctx, msg, s.Logger)
+	}
 
 	for key, values := range msg.Headers() {
+		if key == core.HeaderNamePayloadRef {
+			continue
+		}
+
 		for _, value := range values {
 			c.Writer.Header().Add(key, value)
 		}
 	}
 
-	c.Data(http.StatusOK, core.ContentTypeJSON, msg.Data())
+	// Asynchronous invocations may wait in the queue, their deadline starts when they are picked up.
+	if msg.Headers().Get(core.HeaderNameRequestDeadline) == "" {
+		c.Writer.Header().Set(core.HeaderNameRequestDeadline, strconv.FormatInt(deadline.UnixMilli(), 10))
+	}
+
+	c.Data(http.StatusOK, core.ContentTypeJSON, data)
+}
+
+// deliveryFailed frees the slot of the invocation which could not be passed to the function and fails it
+// right away instead of letting it time out: synchronous invocations are failed with the error, asynchronous
+// ones are redelivered.
+func (s *Server) deliveryFailed(c *gin.Context, msg jetstream.Msg, requestID string, cause error) {
+	ctx := context.WithoutCancel(c.Request.Context())
+	logger := s.Logger.With("requestID", requestID)
+
+	c.Error(cause)
+
+	s.finish(c, requestID)
+
+	if _, async := s.asyncInvocations.LoadAndDelete(requestID); async {
+		err := msg.Nak()
+		if err != nil {
+			c.Error(fmt.Errorf("failed to nak invocation: %w", err))
+		}
+
+		return
+	}
+
+	payload, err := json.Marshal(sdk.Error{
+		ErrorMessage: cause.Error(),
+		ErrorType:    errorTypeDeliveryFailed,
+		StackTrace:   []string{},
+	})
+	if err != nil {
+		c.Error(err)
+
+		return
+	}
+
+	err = s.reportError(ctx, requestID, errorTypeDeliveryFailed, payload, logger)
+	if err != nil {
+		c.Error(err)
+	}
 }
 
 func (s *Server) ResponseHandler(c *gin.Context) {
@@ -115,8 +277,25 @@ func (s *Server) ResponseHandler(c *gin.Context) {
 		"subject", subject,
 	)
 
+	if s.slots.timedOut(requestID) {
+		rejectTimedOut(c, logger)
+
+		return
+	}
+
 	logger.Info("Sending response...")
 
+	defer s.finish(c, requestID)
+
+	invocation, async := s.asyncInvocations.LoadAndDelete(requestID)
+
+	// Results of asynchronous invocations are stored as a whole, so they are never streamed.
+	if !async && c.GetHeader(core.HeaderNameResponseMode) == core.ResponseModeStreaming {
+		s.streamResponse(c, subject, logger)
+
+		return
+	}
+
 	response, err := io.ReadAll(c.Request.Body)
 	if err != nil {
 		c.Error(err)
@@ -124,11 +303,42 @@ func (s *Server) ResponseHandler(c *gin.Context) {
 		return
 	}
 
+	err = s.functionInstance.executed(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+
+		return
+	}
+
+	if async {
+		err = s.InvocationsRepo.Succeed(c.Request.Context(), requestID, response)
+		if err != nil && !errors.Is(err, core.ErrInvocationNotFound) {
+			c.Error(err)
+
+			return
+		}
+
+		// Otherwise the invocation would be redelivered forever.
+		if err != nil {
+			logger.Warn("Invocation record expired, dropping the response")
+		}
+
+		msg := invocation.(jetstream.Msg) //nolint:forcetypeassert
+
+		// Unacknowledged invocations are redelivered, they still need the payload.
+		if msg.Ack() == nil {
+			s.deletePayload(c.Request.Context(), msg, logger)
+		}
+
+		logger.Debug("Response stored")
+
+		return
+	}
+
 	msg := nats.NewMsg(subject)
 	msg.Data = response
 
-	err = s.functionInstance.executed(c.Request.Context())
-	if err != nil {
+	if err := payloads.Offload(c.Request.Context(), s.BlobStore, msg); err != nil {
 		c.Error(err)
 
 		return
@@ -152,8 +362,16 @@ func (s *Server) ErrorHandler(c *gin.Context) {
 		"subject", subject,
 	)
 
+	if s.slots.timedOut(requestID) {
+		rejectTimedOut(c, logger)
+
+		return
+	}
+
 	logger.Info("Sending error response...")
 
+	defer s.finish(c, requestID)
+
 	response, err := io.ReadAll(c.Request.Body)
 	if err != nil {
 		c.Error(err)
@@ -161,10 +379,8 @@ func (s *Server) ErrorHandler(c *gin.Context) {
 		return
 	}
 
-	msg := nats.NewMsg(subject)
-	msg.Data = response
-
-	if err := s.PubSuber.Publish(c.Request.Context(), msg); err != nil {
+	err = s.reportError(c.Request.Context(), requestID, c.GetHeader(core.HeaderNameErrorType), response, logger)
+	if err != nil {
 		c.Error(err)
 
 		return
@@ -173,7 +389,103 @@ func (s *Server) ErrorHandler(c *gin.Context) {
 	logger.Info("Error response sent")
 }
 
-func (s *Server) InitErrorHandler(_ *gin.Context) {
-	// TODO: implement
-	panic("not implemented")
+// reportError fails the invocation: errors of asynchronous invocations are retried or moved to the
+// dead-letter queue, errors of synchronous ones are published to the invoker.
+func (s *Server) reportError(
+	ctx context.Context,
+	requestID string,
+	errorType string,
+	payload []byte,
+	logger *slog.Logger,
+) error {
+	if invocation, async := s.asyncInvocations.LoadAndDelete(requestID); async {
+		return s.failAsync(ctx, invocation.(jetstream.Msg), payload, logger) //nolint:forcetypeassert
+	}
+
+	msg := nats.NewMsg(s.PubSuber.ErrorSubjectName(s.functionInstance, requestID))
+	msg.Data = payload
+
+	if errorType != "" {
+		msg.Header.Set(core.HeaderNameErrorType, errorType)
+	}
+
+	err := payloads.Offload(ctx, s.BlobStore, msg)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	err = s.PubSuber.Publish(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("failed to publish error: %w", err)
+	}
+
+	return nil
+}
+
+// deletePayload deletes the offloaded payload of the handled invocation. It expires anyway, so failures are
+// only logged.
+func (s *Server) deletePayload(ctx context.Context, msg jetstream.Msg, logger *slog.Logger) {
+	err := payloads.Delete(ctx, s.BlobStore, msg.Headers())
+	if err != nil {
+		logger.Warn("Failed to delete invocation payload", "error", err)
+	}
+}
+
+// finish frees the slot of the invocation once its response or error is handled. The in-flight counter
+// is updated even if the function's runtime has disconnected, otherwise the instance would look busy.
+func (s *Server) finish(c *gin.Context, requestID string) {
+	err := s.slots.finish(context.WithoutCancel(c.Request.Context()), requestID)
+	if err != nil {
+		c.Error(err)
+	}
+}
+
+// InitErrorHandler records the init error against the instance, marks it as failed, so it does not receive
+// events and the scaler replaces it, and notifies listeners of the function's init error subject.
+func (s *Server) InitErrorHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.Error(err)
+
+		return
+	}
+
+	s.Logger.Error("Function initialization failed",
+		"errorType", c.GetHeader(core.HeaderNameErrorType),
+		"error", string(payload),
+	)
+
+	s.unhealthy.Store(true)
+
+	// Failed instances never free their slots, so they don't count as available.
+	err = s.functionInstance.inFlight(ctx, s.functionInstance.ScalingConfig().Concurrency)
+	if err != nil {
+		c.Error(err)
+
+		return
+	}
+
+	err = s.functionInstance.initError(ctx, payload)
+	if err != nil {
+		c.Error(err)
+
+		return
+	}
+
+	msg := nats.NewMsg(s.PubSuber.InitErrorSubjectName(s.functionInstance))
+	msg.Data = payload
+	msg.Header = nats.Header{
+		core.HeaderNameInstanceID: {s.functionInstance.id},
+	}
+
+	err = s.PubSuber.Broadcast(ctx, msg)
+	if err != nil {
+		c.Error(err)
+
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "OK"})
 }
@@ -0,0 +1,106 @@
+package runtimeapi_test
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/config"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/httpserver"
+	"github.com/zhulik/fid/internal/invocation"
+	"github.com/zhulik/fid/internal/runtimeapi"
+	"github.com/zhulik/fid/testhelpers"
+	"github.com/zhulik/pal"
+)
+
+// environment holds the runtime API server of a single instance of the function and the services it shares
+// with the gateway.
+type environment struct {
+	server   *runtimeapi.Server
+	invoker  core.Invoker
+	pubSuber core.PubSuber
+	blobs    core.BlobStore
+}
+
+// newEnvironment upserts the function and builds the runtime API server of its instance.
+func newEnvironment(ctx context.Context, function core.FunctionDefinition) environment {
+	p := testhelpers.NewMemoryPal(ctx,
+		pal.Provide[core.FunctionsRepo](&docker.FunctionsRepo{}),
+		pal.Provide[core.InstancesRepo](&docker.InstancesRepo{}),
+		invocation.Provide(),
+	)
+
+	functionsRepo := lo.Must(pal.Invoke[core.FunctionsRepo](ctx, p))
+	pubSuber := lo.Must(pal.Invoke[core.PubSuber](ctx, p))
+
+	lo.Must0(functionsRepo.Upsert(ctx, function))
+	lo.Must0(pubSuber.CreateOrUpdateFunctionStream(ctx, function))
+
+	cfg := &config.Config{FunctionName: function.Name(), FunctionInstanceID: "instance"}
+	logger := slog.New(slog.DiscardHandler)
+
+	server := &runtimeapi.Server{
+		Server:          &httpserver.Server{Config: cfg, Logger: logger},
+		Config:          cfg,
+		Logger:          logger,
+		PubSuber:        pubSuber,
+		FunctionsRepo:   functionsRepo,
+		InstancesRepo:   lo.Must(pal.Invoke[core.InstancesRepo](ctx, p)),
+		InvocationsRepo: lo.Must(pal.Invoke[core.InvocationsRepo](ctx, p)),
+		DeadLetterQueue: lo.Must(pal.Invoke[core.DeadLetterQueue](ctx, p)),
+		BlobStore:       lo.Must(pal.Invoke[core.BlobStore](ctx, p)),
+	}
+
+	lo.Must0(server.Server.Init(ctx))
+	lo.Must0(server.Init(ctx))
+
+	return environment{
+		server:   server,
+		invoker:  lo.Must(pal.Invoke[core.Invoker](ctx, p)),
+		pubSuber: pubSuber,
+		blobs:    server.BlobStore,
+	}
+}
+
+// do sends the request to the runtime API like the function's runtime does.
+func (e environment) do(ctx context.Context, request *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+
+	e.server.Router.ServeHTTP(recorder, request.WithContext(ctx))
+
+	return recorder
+}
+
+// next picks up the next invocation and returns its request ID.
+func (e environment) next(ctx context.Context) string {
+	recorder := e.do(ctx, httptest.NewRequest(http.MethodGet, "/2018-06-01/runtime/invocation/next", nil))
+
+	return recorder.Header().Get(core.HeaderNameRequestID)
+}
+
+func invocationPath(requestID string, result string) string {
+	return "/2018-06-01/runtime/invocation/" + requestID + "/" + result
+}
+
+func post(path string, body string) *http.Request {
+	return httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+}
+
+// invokeStream invokes the function in the background and returns the channel the response is sent to.
+func (e environment) invokeStream(ctx context.Context, function core.FunctionDefinition) <-chan *core.InvocationResponse { //nolint:lll
+	responses := make(chan *core.InvocationResponse, 1)
+
+	go func() {
+		defer GinkgoRecover()
+
+		responses <- lo.Must(e.invoker.InvokeStream(ctx, function, []byte("request"), core.InvocationMetadata{}))
+	}()
+
+	return responses
+}
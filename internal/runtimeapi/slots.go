@@ -0,0 +1,112 @@
+package runtimeapi
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zhulik/fid/internal/core"
+)
+
+// invocation is an in-flight invocation, timer fires when its deadline is exceeded.
+type invocation struct {
+	timer    *time.Timer
+	timedOut bool
+}
+
+// invocationSlots limits the amount of invocations the instance handles at once to the function's
+// concurrency, keeps the instance's in-flight counter up to date and watches deadlines of invocations.
+type invocationSlots struct {
+	instance functionInstance
+	slots    chan struct{}
+
+	// mu serializes changes of inFlight with updates of the counter, so the last update always wins.
+	mu       sync.Mutex
+	inFlight map[string]*invocation
+}
+
+func newInvocationSlots(instance functionInstance) *invocationSlots {
+	return &invocationSlots{
+		instance: instance,
+		slots:    make(chan struct{}, instance.ScalingConfig().Concurrency),
+		inFlight: map[string]*invocation{},
+	}
+}
+
+// acquire waits for a free slot. The slot must be either released or taken by an invocation with start.
+func (s *invocationSlots) acquire(ctx context.Context) error {
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to acquire invocation slot: %w", ctx.Err())
+	}
+}
+
+// release frees a slot which was acquired, but not taken by an invocation.
+func (s *invocationSlots) release() {
+	<-s.slots
+}
+
+// start records the invocation as in-flight, its slot is freed with finish, even if start fails. If the
+// invocation is not finished before the deadline, onTimeout is called and the slot is never freed: the
+// function's handler may still be running.
+func (s *invocationSlots) start(ctx context.Context, requestID string, deadline time.Time, onTimeout func()) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv := &invocation{}
+	inv.timer = time.AfterFunc(time.Until(deadline), func() {
+		s.mu.Lock()
+
+		// The invocation may be finished while the timer fires.
+		if s.inFlight[requestID] != inv {
+			s.mu.Unlock()
+
+			return
+		}
+
+		inv.timedOut = true
+		s.mu.Unlock()
+
+		onTimeout()
+	})
+
+	s.inFlight[requestID] = inv
+
+	return s.instance.inFlight(ctx, len(s.inFlight))
+}
+
+// timedOut returns true if the invocation has exceeded its deadline.
+func (s *invocationSlots) timedOut(requestID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, ok := s.inFlight[requestID]
+
+	return ok && inv.timedOut
+}
+
+// finish frees the slot of the invocation, unknown request IDs are ignored. Slots of timed out invocations
+// are not freed, core.ErrInvocationTimedOut is returned instead.
+func (s *invocationSlots) finish(ctx context.Context, requestID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, ok := s.inFlight[requestID]
+	if !ok {
+		return nil
+	}
+
+	if inv.timedOut {
+		return fmt.Errorf("%w: %s", core.ErrInvocationTimedOut, requestID)
+	}
+
+	inv.timer.Stop()
+
+	delete(s.inFlight, requestID)
+	s.release()
+
+	return s.instance.inFlight(ctx, len(s.inFlight))
+}
@@ -0,0 +1,129 @@
+package runtimeapi_test
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/runtimeapi"
+	"github.com/zhulik/fid/testhelpers"
+	"github.com/zhulik/pal"
+)
+
+var _ = Describe("invocationSlots", func() {
+	var slots runtimeapi.InvocationSlots
+	var repo core.InstancesRepo
+
+	function := docker.Function{Name_: "echo", Timeout_: time.Second, Concurrency: 2}
+
+	BeforeEach(func(ctx SpecContext) {
+		p := testhelpers.NewMemoryPal(ctx,
+			pal.Provide[core.InstancesRepo](&docker.InstancesRepo{}),
+		)
+
+		repo = lo.Must(pal.Invoke[core.InstancesRepo](ctx, p))
+		lo.Must0(repo.Add(ctx, function, "instance"))
+
+		slots = runtimeapi.NewInvocationSlots(function, "instance", repo)
+	})
+
+	inFlight := func(ctx context.Context) int {
+		return lo.Must(repo.Get(ctx, function, "instance")).InFlight()
+	}
+
+	// acquireNow acquires a slot unless all of them are taken.
+	acquireNow := func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		return slots.Acquire(ctx)
+	}
+
+	Describe("acquire", func() {
+		It("waits for a free slot when all of them are taken", func(ctx SpecContext) {
+			Expect(acquireNow(ctx)).To(Succeed())
+			Expect(acquireNow(ctx)).To(Succeed())
+
+			Expect(acquireNow(ctx)).To(MatchError(context.DeadlineExceeded))
+
+			slots.Release()
+
+			Expect(acquireNow(ctx)).To(Succeed())
+		})
+	})
+
+	Describe("start", func() {
+		It("records the invocation as in-flight", func(ctx SpecContext) {
+			lo.Must0(slots.Acquire(ctx))
+
+			Expect(slots.Start(ctx, "request", time.Now().Add(time.Second), func() {})).To(Succeed())
+
+			Expect(inFlight(ctx)).To(Equal(1))
+			Expect(slots.TimedOut("request")).To(BeFalse())
+		})
+	})
+
+	Describe("finish", func() {
+		BeforeEach(func(ctx SpecContext) {
+			lo.Must0(slots.Acquire(ctx))
+			lo.Must0(slots.Acquire(ctx))
+			lo.Must0(slots.Start(ctx, "request", time.Now().Add(time.Second), func() {}))
+		})
+
+		It("frees the invocation's slot", func(ctx SpecContext) {
+			Expect(slots.Finish(ctx, "request")).To(Succeed())
+
+			Expect(inFlight(ctx)).To(BeZero())
+			Expect(acquireNow(ctx)).To(Succeed())
+		})
+
+		Context("when the request ID is unknown", func() {
+			It("does nothing", func(ctx SpecContext) {
+				Expect(slots.Finish(ctx, "unknown")).To(Succeed())
+
+				Expect(inFlight(ctx)).To(Equal(1))
+				Expect(acquireNow(ctx)).To(MatchError(context.DeadlineExceeded))
+			})
+		})
+	})
+
+	Context("when the invocation exceeds its deadline", func() {
+		var timedOut chan struct{}
+
+		BeforeEach(func(ctx SpecContext) {
+			timedOut = make(chan struct{})
+
+			lo.Must0(slots.Acquire(ctx))
+			lo.Must0(slots.Acquire(ctx))
+			lo.Must0(slots.Start(ctx, "request", time.Now().Add(10*time.Millisecond), func() { close(timedOut) }))
+		})
+
+		It("calls onTimeout and keeps the slot taken", func(ctx SpecContext) {
+			Eventually(timedOut).Should(BeClosed())
+
+			Expect(slots.TimedOut("request")).To(BeTrue())
+			Expect(slots.Finish(ctx, "request")).To(MatchError(core.ErrInvocationTimedOut))
+
+			Expect(inFlight(ctx)).To(Equal(1))
+			Expect(acquireNow(ctx)).To(MatchError(context.DeadlineExceeded))
+		})
+	})
+
+	Context("when the invocation finishes before its deadline", func() {
+		It("does not call onTimeout", func(ctx SpecContext) {
+			var called atomic.Bool
+
+			lo.Must0(slots.Acquire(ctx))
+			lo.Must0(slots.Start(ctx, "request", time.Now().Add(10*time.Millisecond), func() { called.Store(true) }))
+
+			lo.Must0(slots.Finish(ctx, "request"))
+
+			Consistently(called.Load, 50*time.Millisecond).Should(BeFalse())
+		})
+	})
+})
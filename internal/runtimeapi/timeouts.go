@@ -0,0 +1,72 @@
+package runtimeapi
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/pkg/json"
+	"github.com/zhulik/fid/pkg/sdk"
+)
+
+const (
+	// errorTypeTimeout is the error type AWS Lambda reports for timed out invocations.
+	errorTypeTimeout = "Sandbox.Timedout"
+
+	// timeoutReportTimeout limits reporting of a timeout, it's not bound to any request.
+	timeoutReportTimeout = 10 * time.Second
+)
+
+// invocationTimedOut fails the invocation which exceeded its deadline and marks the instance unhealthy.
+// The function's handler may hang forever keeping its slot, so the instance stops receiving events and
+// the scaler replaces it, like AWS Lambda replaces sandboxes of timed out invocations.
+func (s *Server) invocationTimedOut(requestID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutReportTimeout)
+	defer cancel()
+
+	timeout := s.functionInstance.Timeout()
+
+	logger := s.Logger.With("requestID", requestID)
+	logger.Error("Invocation timed out, marking the instance unhealthy", "timeout", timeout)
+
+	s.unhealthy.Store(true)
+
+	payload, err := json.Marshal(sdk.Error{
+		ErrorMessage: fmt.Sprintf("%s %s Task timed out after %.2f seconds",
+			time.Now().UTC().Format(time.RFC3339), requestID, timeout.Seconds()),
+		ErrorType:  errorTypeTimeout,
+		StackTrace: []string{},
+	})
+	if err != nil {
+		logger.Error("Failed to marshal timeout error", "error", err)
+
+		return
+	}
+
+	err = s.reportError(ctx, requestID, errorTypeTimeout, payload, logger)
+	if err != nil {
+		logger.Error("Failed to report timeout", "error", err)
+	}
+
+	// Unhealthy instances never free their slots, so they don't count as available.
+	err = s.functionInstance.inFlight(ctx, s.functionInstance.ScalingConfig().Concurrency)
+	if err != nil {
+		logger.Error("Failed to update in-flight invocations", "error", err)
+	}
+
+	err = s.functionInstance.unhealthy(ctx)
+	if err != nil {
+		logger.Error("Failed to mark the instance unhealthy", "error", err)
+	}
+}
+
+// rejectTimedOut rejects responses and errors of invocations which have already timed out.
+func rejectTimedOut(c *gin.Context, logger *slog.Logger) {
+	logger.Warn("Response of a timed out invocation rejected")
+
+	c.JSON(http.StatusForbidden, gin.H{"error": core.ErrInvocationTimedOut.Error()})
+}
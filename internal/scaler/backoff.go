@@ -0,0 +1,43 @@
+package scaler
+
+import (
+	"time"
+)
+
+const (
+	initialBackoff = 5 * time.Second
+	maxBackoff     = 5 * time.Minute
+)
+
+// backoff delays scaling up after instance failures, the delay grows exponentially with every consecutive
+// failure and is reset once an instance handles an invocation.
+type backoff struct {
+	failures    int
+	lastFailure time.Time
+}
+
+func (b *backoff) fail() {
+	b.failures++
+	b.lastFailure = time.Now()
+}
+
+// succeed resets the backoff if the instance was active after the last failure.
+func (b *backoff) succeed(lastActivity time.Time) {
+	if b.failures > 0 && lastActivity.After(b.lastFailure) {
+		b.failures = 0
+	}
+}
+
+func (b *backoff) delay() time.Duration {
+	if b.failures == 0 {
+		return 0
+	}
+
+	delay := initialBackoff << min(b.failures-1, 16) //nolint:mnd
+
+	return min(delay, maxBackoff)
+}
+
+func (b *backoff) ready() bool {
+	return time.Since(b.lastFailure) >= b.delay()
+}
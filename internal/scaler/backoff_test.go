@@ -0,0 +1,71 @@
+package scaler_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/zhulik/fid/internal/scaler"
+)
+
+var _ = Describe("Backoff", func() {
+	var backoff *scaler.Backoff
+
+	BeforeEach(func() {
+		backoff = &scaler.Backoff{}
+	})
+
+	Context("when there were no failures", func() {
+		It("does not delay scaling", func() {
+			Expect(backoff.Delay()).To(BeZero())
+			Expect(backoff.Ready()).To(BeTrue())
+		})
+	})
+
+	Context("when instances fail", func() {
+		It("doubles the delay with every failure", func() {
+			backoff.Fail()
+			Expect(backoff.Delay()).To(Equal(5 * time.Second))
+
+			backoff.Fail()
+			Expect(backoff.Delay()).To(Equal(10 * time.Second))
+
+			backoff.Fail()
+			Expect(backoff.Delay()).To(Equal(20 * time.Second))
+		})
+
+		It("caps the delay", func() {
+			for range 100 {
+				backoff.Fail()
+			}
+
+			Expect(backoff.Delay()).To(Equal(5 * time.Minute))
+		})
+
+		It("is not ready right after a failure", func() {
+			backoff.Fail()
+
+			Expect(backoff.Ready()).To(BeFalse())
+		})
+	})
+
+	Describe("Succeed", func() {
+		BeforeEach(func() {
+			backoff.Fail()
+			backoff.Fail()
+		})
+
+		It("resets the backoff when an instance was active after the last failure", func() {
+			backoff.Succeed(time.Now().Add(time.Second))
+
+			Expect(backoff.Delay()).To(BeZero())
+			Expect(backoff.Ready()).To(BeTrue())
+		})
+
+		It("keeps the backoff when the activity was before the last failure", func() {
+			backoff.Succeed(time.Now().Add(-time.Minute))
+
+			Expect(backoff.Delay()).To(Equal(10 * time.Second))
+		})
+	})
+})
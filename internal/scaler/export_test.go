@@ -0,0 +1,34 @@
+package scaler
+
+import (
+	"context"
+	"time"
+)
+
+// Scaling decisions and the backoff are exported for tests, so they run without timers.
+
+func (s Scaler) ScaleOnDemand(ctx context.Context) error {
+	return s.scaleOnDemand(ctx)
+}
+
+func (s Scaler) ScaleDown(ctx context.Context) error {
+	return s.scaleDown(ctx)
+}
+
+type Backoff = backoff
+
+func (b *backoff) Fail() {
+	b.fail()
+}
+
+func (b *backoff) Succeed(lastActivity time.Time) {
+	b.succeed(lastActivity)
+}
+
+func (b *backoff) Delay() time.Duration {
+	return b.delay()
+}
+
+func (b *backoff) Ready() bool {
+	return b.ready()
+}
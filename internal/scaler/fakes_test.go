@@ -0,0 +1,126 @@
+package scaler_test
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/core"
+)
+
+// fakeBackend records instances added and stopped by the scaler, instances are not added while err is set.
+type fakeBackend struct {
+	core.ContainerBackend
+
+	mu      sync.Mutex
+	err     error
+	added   []string
+	stopped []string
+}
+
+func (b *fakeBackend) AddInstance(_ context.Context, _ core.FunctionDefinition) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.err != nil {
+		return "", b.err
+	}
+
+	id := uuid.NewString()
+	b.added = append(b.added, id)
+
+	return id, nil
+}
+
+func (b *fakeBackend) setErr(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.err = err
+}
+
+func (b *fakeBackend) addedCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.added)
+}
+
+func (b *fakeBackend) StopInstance(_ context.Context, instanceID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stopped = append(b.stopped, instanceID)
+
+	return nil
+}
+
+// fakeInstancesView returns a fixed list of instances.
+type fakeInstancesView struct {
+	instances []core.FunctionInstance
+}
+
+func (v *fakeInstancesView) List(_ core.FunctionDefinition) []core.FunctionInstance {
+	return v.instances
+}
+
+func (v *fakeInstancesView) Count(_ core.FunctionDefinition) int {
+	return len(v.instances)
+}
+
+func (v *fakeInstancesView) CountAvailable(_ core.FunctionDefinition) int {
+	return lo.SumBy(v.instances, core.AvailableSlots)
+}
+
+func (v *fakeInstancesView) LastInitError(_ core.FunctionDefinition) *core.InitError {
+	return nil
+}
+
+// fakeInstancesRepo records deleted instances.
+type fakeInstancesRepo struct {
+	core.InstancesRepo
+
+	deleted []string
+}
+
+func (r *fakeInstancesRepo) Delete(_ context.Context, _ core.FunctionDefinition, id string) error {
+	r.deleted = append(r.deleted, id)
+
+	return nil
+}
+
+// fakePubSuber reports a fixed amount of pending invocations, listeners receive messages sent to messages.
+type fakePubSuber struct {
+	core.PubSuber
+
+	pending  int
+	messages chan *nats.Msg
+}
+
+func (p *fakePubSuber) InvokeSubjectName(_ core.FunctionDefinition) string {
+	return "invoke"
+}
+
+func (p *fakePubSuber) InitErrorSubjectName(_ core.FunctionDefinition) string {
+	return "init-error"
+}
+
+func (p *fakePubSuber) Listen(_ context.Context, _ string) (<-chan *nats.Msg, error) {
+	return p.messages, nil
+}
+
+func (p *fakePubSuber) Pending(_ context.Context, _ core.FunctionDefinition) (int, error) {
+	return p.pending, nil
+}
+
+type fakeFunctionsRepo struct {
+	core.FunctionsRepo
+
+	function core.FunctionDefinition
+}
+
+func (r fakeFunctionsRepo) Get(_ context.Context, _ string) (core.FunctionDefinition, error) {
+	return r.function, nil
+}
@@ -2,22 +2,42 @@ package scaler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
+	"github.com/samber/lo"
 	"github.com/zhulik/fid/internal/config"
 	"github.com/zhulik/fid/internal/core"
 )
 
+const (
+	// checkInterval is how often the scaler reevaluates the state when no invocations arrive.
+	checkInterval = 5 * time.Second
+	// instanceStartTimeout is how long a freshly added instance is counted as available capacity
+	// before it registers itself in the instances repo.
+	instanceStartTimeout = 30 * time.Second
+)
+
 type Scaler struct { //nolint:recvcheck
 	Logger        *slog.Logger
 	FunctionsRepo core.FunctionsRepo
 	Config        *config.Config
 	Backend       core.ContainerBackend
 	InstancesRepo core.InstancesRepo
+	InstancesView core.InstancesView
+	PubSuber      core.PubSuber
 
 	function core.FunctionDefinition
+
+	// starting holds instances added by the scaler which have not registered themselves yet.
+	starting map[string]time.Time
+	// stopping holds instances stopped by the scaler which are still in the view.
+	stopping map[string]struct{}
+
+	backoff *backoff
 }
 
 func (s *Scaler) Init(ctx context.Context) error {
@@ -33,51 +53,267 @@ func (s *Scaler) Init(ctx context.Context) error {
 	s.Logger.Info("Scaler created")
 
 	s.function = function
+	s.starting = map[string]time.Time{}
+	s.stopping = map[string]struct{}{}
+	s.backoff = &backoff{}
 
 	return nil
 }
 
-// Run the scaler. Never returns nil error. When Shutdown is called, returns Stopped.
+// Run the scaler. Reacts on every invocation published to the function's stream and on init errors of
+// the function's instances, periodically reevaluates the state and stops idle instances. Scaling errors
+// are logged, but do not stop the scaler, missing instances are added by the loop.
 func (s Scaler) Run(ctx context.Context) error {
-	<-ctx.Done()
+	err := s.rescaleToConfig(ctx)
+	if err != nil {
+		s.Logger.Error("Failed to rescale to config", "error", err)
+	}
 
-	return nil
+	invocations, err := s.PubSuber.Listen(ctx, s.PubSuber.InvokeSubjectName(s.function))
+	if err != nil {
+		return fmt.Errorf("failed to listen for invocations: %w", err)
+	}
+
+	initErrors, err := s.PubSuber.Listen(ctx, s.PubSuber.InitErrorSubjectName(s.function))
+	if err != nil {
+		return fmt.Errorf("failed to listen for init errors: %w", err)
+	}
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-invocations:
+		case <-initErrors:
+		case <-ticker.C:
+			err := s.scaleDown(ctx)
+			if err != nil {
+				s.Logger.Error("Failed to scale down", "error", err)
+			}
+		}
+
+		err := s.scaleOnDemand(ctx)
+		if err != nil {
+			s.Logger.Error("Failed to scale", "error", err)
+		}
+	}
 }
 
-func (s Scaler) rescaleToConfig(ctx context.Context) error { //nolint:unused
-	instances, err := s.InstancesRepo.Count(ctx, s.function)
+// scaleOnDemand replaces failed instances and adds instances when there are pending invocations which
+// cannot be handled by free slots of running or starting instances or when there are less than
+// ScalingConfig.Min instances. The total amount of instances never exceeds ScalingConfig.Max. After
+// failures, new instances are added with an exponential backoff.
+func (s Scaler) scaleOnDemand(ctx context.Context) error {
+	instances := s.instances()
+
+	s.forgetStarted(instances)
+
+	instances, err := s.stopFailed(ctx, instances)
+	if err != nil {
+		return err
+	}
+
+	pending, err := s.PubSuber.Pending(ctx, s.function)
 	if err != nil {
-		return fmt.Errorf("failed to get instances: %w", err)
+		return fmt.Errorf("failed to get pending invocations: %w", err)
+	}
+
+	scaling := s.function.ScalingConfig()
+
+	// Starting instances are expected to take as many invocations as their concurrency allows.
+	available := lo.SumBy(instances, core.AvailableSlots) + len(s.starting)*scaling.Concurrency
+	total := len(instances) + len(s.starting)
+
+	// Every new instance takes up to Concurrency of the invocations which have no slot.
+	needed := (max(pending-available, 0) + scaling.Concurrency - 1) / scaling.Concurrency
+
+	toCreate := min(max(needed, scaling.Min-total), scaling.Max-total)
+	if toCreate <= 0 {
+		return nil
+	}
+
+	if !s.backoff.ready() {
+		s.Logger.Debug("Backing off after instance failures",
+			"failures", s.backoff.failures,
+			"delay", s.backoff.delay(),
+		)
+
+		return nil
+	}
+
+	s.Logger.Info("Scaling up",
+		"instances", len(instances),
+		"starting", len(s.starting),
+		"available", available,
+		"pending", pending,
+		"toCreate", toCreate,
+	)
+
+	for range toCreate {
+		_, err = s.scaleUp(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to scale up: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// instances returns the function's instances from the view except the ones being stopped, stopped
+// instances are forgotten once their records are deleted.
+func (s Scaler) instances() []core.FunctionInstance {
+	instances := s.InstancesView.List(s.function)
+
+	ids := lo.SliceToMap(instances, func(instance core.FunctionInstance) (string, struct{}) {
+		return instance.ID(), struct{}{}
+	})
+
+	for id := range s.stopping {
+		if _, ok := ids[id]; !ok {
+			delete(s.stopping, id)
+		}
+	}
+
+	return lo.Reject(instances, func(instance core.FunctionInstance, _ int) bool {
+		_, ok := s.stopping[instance.ID()]
+
+		return ok
+	})
+}
+
+// forgetStarted removes instances which registered themselves or did not manage to start in time
+// from the list of starting instances.
+func (s Scaler) forgetStarted(instances []core.FunctionInstance) {
+	for _, instance := range instances {
+		delete(s.starting, instance.ID())
+	}
+
+	for id, startedAt := range s.starting {
+		if time.Since(startedAt) > instanceStartTimeout {
+			s.Logger.Warn("Instance did not register in time", "instanceID", id)
+
+			delete(s.starting, id)
+		}
+	}
+}
+
+// stopFailed stops instances which reported init errors or were marked unhealthy and returns the rest. Only
+// init errors delay scaling up: instances marked unhealthy after a timed out invocation started fine, so
+// they are replaced right away.
+func (s Scaler) stopFailed(ctx context.Context, instances []core.FunctionInstance) ([]core.FunctionInstance, error) {
+	failed, healthy := lo.FilterReject(instances, func(instance core.FunctionInstance, _ int) bool {
+		return instance.Failed()
+	})
+
+	for _, instance := range healthy {
+		s.backoff.succeed(instance.LastExecuted())
+	}
+
+	for _, instance := range failed {
+		s.Logger.Warn("Stopping failed instance", "instanceID", instance.ID())
+
+		if instance.InitFailed() {
+			s.backoff.fail()
+		}
+
+		err := s.Backend.StopInstance(ctx, instance.ID())
+		if err != nil {
+			return nil, fmt.Errorf("failed to stop failed instance %s: %w", instance.ID(), err)
+		}
+
+		s.stopping[instance.ID()] = struct{}{}
+
+		// Do not wait for the runtime API to deregister, otherwise the failure is counted again.
+		err = s.InstancesRepo.Delete(ctx, s.function, instance.ID())
+		if err != nil && !errors.Is(err, core.ErrInstanceNotFound) {
+			return nil, fmt.Errorf("failed to delete failed instance %s: %w", instance.ID(), err)
+		}
 	}
 
+	return healthy, nil
+}
+
+// scaleDown stops instances which have been idle for longer than ScalingConfig.IdleTimeout, the amount of
+// instances never drops below ScalingConfig.Min. When Min is 0, the function scales to zero and is started
+// again by scaleOnDemand on the next invocation.
+func (s Scaler) scaleDown(ctx context.Context) error {
+	instances := s.instances()
+
+	scaling := s.function.ScalingConfig()
+
+	idle := lo.Filter(instances, func(instance core.FunctionInstance, _ int) bool {
+		return instance.InFlight() == 0 && time.Since(lastActivity(instance)) > scaling.IdleTimeout
+	})
+
+	return s.stopInstances(ctx, idle, len(instances)-scaling.Min)
+}
+
+// stopInstances stops up to limit instances, the ones with the oldest activity first.
+func (s Scaler) stopInstances(ctx context.Context, instances []core.FunctionInstance, limit int) error {
+	if limit <= 0 || len(instances) == 0 {
+		return nil
+	}
+
+	slices.SortFunc(instances, func(a, b core.FunctionInstance) int {
+		return lastActivity(a).Compare(lastActivity(b))
+	})
+
+	for _, instance := range instances[:min(limit, len(instances))] {
+		s.Logger.Info("Stopping idle instance",
+			"instanceID", instance.ID(),
+			"lastActivity", lastActivity(instance),
+		)
+
+		err := s.Backend.StopInstance(ctx, instance.ID())
+		if err != nil {
+			return fmt.Errorf("failed to stop instance %s: %w", instance.ID(), err)
+		}
+
+		s.stopping[instance.ID()] = struct{}{}
+	}
+
+	return nil
+}
+
+func (s Scaler) rescaleToConfig(ctx context.Context) error {
+	instances := s.InstancesView.Count(s.function)
+
 	switch {
 	case instances < s.function.ScalingConfig().Min:
 		toCreate := s.function.ScalingConfig().Min - instances
-		s.Logger.Info("No need to rescale to config",
+		s.Logger.Info("Rescaling to config",
 			"instances", instances,
 			"min", s.function.ScalingConfig().Min,
 			"toCreate", toCreate,
 		)
 
 		for range toCreate {
-			ctx, cancel := context.WithTimeout(ctx, time.Second)
-
-			_, err = s.scaleUp(ctx)
-
-			cancel()
-
+			_, err := s.scaleUp(ctx)
 			if err != nil {
 				return fmt.Errorf("failed to scale up: %w", err)
 			}
 		}
 	case instances > s.function.ScalingConfig().Max:
-		// TODO: implement
 		toKill := instances - s.function.ScalingConfig().Max
-		s.Logger.Info("No need to rescale to config",
+		s.Logger.Info("Rescaling to config",
 			"instances", instances,
 			"max", s.function.ScalingConfig().Max,
 			"toKill", toKill,
 		)
+
+		// Instances with in-flight invocations are left alone, the excess is removed by scaleDown once
+		// they become idle.
+		idle := lo.Filter(s.instances(), func(instance core.FunctionInstance, _ int) bool {
+			return instance.InFlight() == 0
+		})
+
+		err := s.stopInstances(ctx, idle, toKill)
+		if err != nil {
+			return err
+		}
 	default:
 		s.Logger.Info("No need to rescale to config",
 			"instances", instances,
@@ -89,7 +325,7 @@ func (s Scaler) rescaleToConfig(ctx context.Context) error { //nolint:unused
 	return nil
 }
 
-func (s Scaler) scaleUp(ctx context.Context) (string, error) { //nolint:unused
+func (s Scaler) scaleUp(ctx context.Context) (string, error) {
 	s.Logger.Info("Scaling up")
 
 	instanceID, err := s.Backend.AddInstance(ctx, s.function)
@@ -97,7 +333,19 @@ func (s Scaler) scaleUp(ctx context.Context) (string, error) { //nolint:unused
 		return "", fmt.Errorf("failed to add instance: %w", err)
 	}
 
+	s.starting[instanceID] = time.Now()
+
 	s.Logger.Info("Instance added", "instanceID", instanceID)
 
 	return instanceID, nil
 }
+
+// lastActivity returns the time of the last invocation handled by the instance, or its start time if it
+// has not handled any yet.
+func lastActivity(instance core.FunctionInstance) time.Time {
+	if instance.LastExecuted().After(instance.StartedAt()) {
+		return instance.LastExecuted()
+	}
+
+	return instance.StartedAt()
+}
@@ -0,0 +1,227 @@
+package scaler_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/backends/docker"
+	"github.com/zhulik/fid/internal/config"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/scaler"
+)
+
+var _ = Describe("Scaler", func() {
+	var function docker.Function
+	var backend *fakeBackend
+	var view *fakeInstancesView
+	var repo *fakeInstancesRepo
+	var pubSuber *fakePubSuber
+
+	newScaler := func(ctx SpecContext) *scaler.Scaler {
+		s := &scaler.Scaler{
+			Logger:        slog.New(slog.DiscardHandler),
+			FunctionsRepo: fakeFunctionsRepo{function: function},
+			Config:        &config.Config{FunctionName: function.Name()},
+			Backend:       backend,
+			InstancesRepo: repo,
+			InstancesView: view,
+			PubSuber:      pubSuber,
+		}
+
+		lo.Must0(s.Init(ctx))
+
+		return s
+	}
+
+	instance := func(id string, inFlight int, startedAt time.Time) docker.FunctionInstance {
+		return docker.FunctionInstance{
+			ID_:        id,
+			StartedAt_: startedAt,
+			InFlight_:  inFlight,
+			Function_:  function,
+		}
+	}
+
+	BeforeEach(func() {
+		function = docker.Function{
+			Name_:       "test",
+			MaxScale:    5,
+			Concurrency: 2,
+			IdleTimeout: time.Minute,
+		}
+		backend = &fakeBackend{}
+		view = &fakeInstancesView{}
+		repo = &fakeInstancesRepo{}
+		pubSuber = &fakePubSuber{}
+	})
+
+	Describe("Run", func() {
+		Context("when rescaling to config fails", func() {
+			BeforeEach(func() {
+				function.MinScale = 1
+				backend.setErr(errors.New("backend unavailable"))
+				pubSuber.messages = make(chan *nats.Msg)
+			})
+
+			It("keeps running and adds the instances later", func(ctx SpecContext) {
+				runCtx, cancel := context.WithCancel(ctx)
+				done := make(chan error)
+
+				go func() {
+					done <- newScaler(ctx).Run(runCtx)
+				}()
+
+				// The scaler listens after the initial rescale failed.
+				pubSuber.messages <- nats.NewMsg("invoke")
+				Expect(backend.addedCount()).To(BeZero())
+
+				backend.setErr(nil)
+				pubSuber.messages <- nats.NewMsg("invoke")
+
+				Eventually(backend.addedCount).Should(Equal(1))
+
+				cancel()
+				Eventually(done).Should(Receive(BeNil()))
+			})
+		})
+	})
+
+	Describe("ScaleOnDemand", func() {
+		Context("when there are less than min instances", func() {
+			BeforeEach(func() {
+				function.MinScale = 2
+			})
+
+			It("adds the missing instances", func(ctx SpecContext) {
+				Expect(newScaler(ctx).ScaleOnDemand(ctx)).To(Succeed())
+
+				Expect(backend.added).To(HaveLen(2))
+			})
+		})
+
+		Context("when pending invocations do not fit into free slots", func() {
+			BeforeEach(func() {
+				pubSuber.pending = 5
+				view.instances = []core.FunctionInstance{instance("busy", 2, time.Now())}
+			})
+
+			It("adds instances for the invocations without a slot", func(ctx SpecContext) {
+				Expect(newScaler(ctx).ScaleOnDemand(ctx)).To(Succeed())
+
+				Expect(backend.added).To(HaveLen(3))
+			})
+
+			It("counts starting instances as available", func(ctx SpecContext) {
+				s := newScaler(ctx)
+
+				Expect(s.ScaleOnDemand(ctx)).To(Succeed())
+				Expect(s.ScaleOnDemand(ctx)).To(Succeed())
+
+				Expect(backend.added).To(HaveLen(3))
+			})
+		})
+
+		Context("when pending invocations fit into free slots", func() {
+			BeforeEach(func() {
+				pubSuber.pending = 1
+				view.instances = []core.FunctionInstance{instance("idle", 0, time.Now())}
+			})
+
+			It("does not add instances", func(ctx SpecContext) {
+				Expect(newScaler(ctx).ScaleOnDemand(ctx)).To(Succeed())
+
+				Expect(backend.added).To(BeEmpty())
+			})
+		})
+
+		Context("when more instances are needed than max allows", func() {
+			BeforeEach(func() {
+				pubSuber.pending = 100
+			})
+
+			It("adds up to max instances", func(ctx SpecContext) {
+				Expect(newScaler(ctx).ScaleOnDemand(ctx)).To(Succeed())
+
+				Expect(backend.added).To(HaveLen(5))
+			})
+		})
+
+		Context("when an instance failed to initialize", func() {
+			BeforeEach(func() {
+				function.MinScale = 1
+
+				failed := instance("failed", 2, time.Now())
+				failed.Failed_ = true
+				failed.InitFailed_ = true
+
+				view.instances = []core.FunctionInstance{failed}
+			})
+
+			It("stops and deletes it", func(ctx SpecContext) {
+				Expect(newScaler(ctx).ScaleOnDemand(ctx)).To(Succeed())
+
+				Expect(backend.stopped).To(ConsistOf("failed"))
+				Expect(repo.deleted).To(ConsistOf("failed"))
+			})
+
+			It("backs off before replacing it", func(ctx SpecContext) {
+				Expect(newScaler(ctx).ScaleOnDemand(ctx)).To(Succeed())
+
+				Expect(backend.added).To(BeEmpty())
+			})
+		})
+
+		Context("when an instance is unhealthy", func() {
+			BeforeEach(func() {
+				function.MinScale = 1
+
+				unhealthy := instance("unhealthy", 2, time.Now())
+				unhealthy.Failed_ = true
+
+				view.instances = []core.FunctionInstance{unhealthy}
+			})
+
+			It("stops it and replaces it right away", func(ctx SpecContext) {
+				Expect(newScaler(ctx).ScaleOnDemand(ctx)).To(Succeed())
+
+				Expect(backend.stopped).To(ConsistOf("unhealthy"))
+				Expect(backend.added).To(HaveLen(1))
+			})
+		})
+	})
+
+	Describe("ScaleDown", func() {
+		BeforeEach(func() {
+			function.MinScale = 1
+		})
+
+		It("stops idle instances, the oldest first, but keeps min instances", func(ctx SpecContext) {
+			view.instances = []core.FunctionInstance{
+				instance("newer", 0, time.Now().Add(-5*time.Minute)),
+				instance("older", 0, time.Now().Add(-10*time.Minute)),
+			}
+
+			Expect(newScaler(ctx).ScaleDown(ctx)).To(Succeed())
+
+			Expect(backend.stopped).To(ConsistOf("older"))
+		})
+
+		It("does not stop busy or recently active instances", func(ctx SpecContext) {
+			view.instances = []core.FunctionInstance{
+				instance("busy", 1, time.Now().Add(-10*time.Minute)),
+				instance("active", 0, time.Now()),
+				instance("idle", 0, time.Now().Add(-10*time.Minute)),
+			}
+
+			Expect(newScaler(ctx).ScaleDown(ctx)).To(Succeed())
+
+			Expect(backend.stopped).To(ConsistOf("idle"))
+		})
+	})
+})
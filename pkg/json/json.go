@@ -33,3 +33,9 @@ func MarshalIndent(data any, prefix, indent string) ([]byte, error) {
 
 	return bytes, nil
 }
+
+type RawMessage = libJSON.RawMessage
+
+func Valid(data []byte) bool {
+	return libJSON.Valid(data)
+}
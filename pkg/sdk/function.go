@@ -63,9 +63,42 @@ func port() int {
 	return port
 }
 
+// concurrency is how many events the function may handle at once, the runtime API never hands out more.
+func concurrency() int {
+	concurrency := 1
+
+	concurrencyStr := os.Getenv("AWS_LAMBDA_MAX_CONCURRENCY")
+	if concurrencyStr != "" {
+		var err error
+
+		concurrency, err = strconv.Atoi(concurrencyStr)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	return max(concurrency, 1)
+}
+
+// Serve polls the runtime API for events with as many workers as the function's concurrency and handles them
+// until any of the workers fails.
 func Serve(handler Handler) error {
 	go server(handler)
 
+	workers := concurrency()
+	errs := make(chan error, workers)
+
+	for range workers {
+		go func() {
+			errs <- poll(handler)
+		}()
+	}
+
+	return <-errs
+}
+
+// poll fetches and handles events one by one until an error occurs.
+func poll(handler Handler) error {
 	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, nextURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
@@ -0,0 +1,496 @@
+package conformance
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive
+	. "github.com/onsi/gomega"    //nolint:revive
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/core"
+)
+
+const (
+	oneLevelKey = "namespace.key"
+	twoLevelKey = "namespace.key.subkey"
+	anotherKey  = "another.key"
+)
+
+// KV describes the behavior every core.KV implementation must follow. newKV is called before each spec,
+// the suite creates and deletes the "test" and "test2" buckets.
+func KV(name string, newKV func(ctx context.Context) core.KV) bool {
+	return Describe(name+" KV", Serial, func() {
+		var kv core.KV
+
+		BeforeEach(func(ctx SpecContext) {
+			kv = newKV(ctx)
+
+			lo.Must(kv.CreateBucket(ctx, "test"))
+			DeferCleanup(func(ctx SpecContext) { kv.DeleteBucket(ctx, "test") }) //nolint:errcheck
+		})
+
+		Describe("CreateBucket", func() {
+			Context("when bucket exists", func() {
+				It("does not return an error", func(ctx SpecContext) {
+					_, err := kv.CreateBucket(ctx, "test")
+
+					Expect(err).ToNot(HaveOccurred())
+				})
+			})
+
+			Context("when bucket does not exists", func() {
+				It("creates the bucket", func(ctx SpecContext) {
+					_, err := kv.CreateBucket(ctx, "test2")
+					Expect(err).NotTo(HaveOccurred())
+
+					lo.Must0(kv.DeleteBucket(ctx, "test2"))
+				})
+			})
+		})
+
+		Describe("DeleteBucket", func() {
+			Context("when bucket exists", func() {
+				It("deletes the bucket", func(ctx SpecContext) {
+					err := kv.DeleteBucket(ctx, "test")
+
+					Expect(err).ToNot(HaveOccurred())
+				})
+			})
+
+			Context("when bucket does not exists", func() {
+				It("returns an error", func(ctx SpecContext) {
+					err := kv.DeleteBucket(ctx, "test2")
+
+					Expect(err).To(MatchError(core.ErrBucketNotFound))
+				})
+			})
+		})
+
+		Describe("Bucket", func() {
+			Context("when bucket exists", func() {
+				It("returns a bucket", func(ctx SpecContext) {
+					bucket, err := kv.Bucket(ctx, "test")
+
+					Expect(err).ToNot(HaveOccurred())
+					Expect(bucket).ToNot(BeNil())
+				})
+			})
+
+			Context("when bucket does not exists", func() {
+				It("returns an error", func(ctx SpecContext) {
+					_, err := kv.Bucket(ctx, "test2")
+
+					Expect(err).To(MatchError(core.ErrBucketNotFound))
+				})
+			})
+		})
+
+		Describe("CreateBucketWithConfig", func() {
+			It("creates the bucket with the options", func(ctx SpecContext) {
+				_, err := kv.CreateBucketWithConfig(ctx, core.BucketConfig{
+					Name:     "test2",
+					TTL:      time.Hour,
+					History:  5,
+					MaxBytes: 1024 * 1024,
+					Replicas: 1,
+					Storage:  core.StorageTypeMemory,
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				lo.Must0(kv.DeleteBucket(ctx, "test2"))
+			})
+
+			Context("when bucket exists", func() {
+				It("updates the bucket keeping the entries", func(ctx SpecContext) {
+					bucket := lo.Must(kv.Bucket(ctx, "test"))
+					lo.Must0(bucket.Put(ctx, "key", []byte("some - value")))
+
+					_, err := kv.CreateBucketWithConfig(ctx, core.BucketConfig{Name: "test", TTL: time.Hour})
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(bucket.Get(ctx, "key")).To(Equal([]byte("some - value")))
+				})
+			})
+		})
+
+		Describe("key TTLs", func() {
+			var bucket core.KVBucket
+
+			Context("when the bucket allows key TTLs", func() {
+				BeforeEach(func(ctx SpecContext) {
+					bucket = lo.Must(kv.CreateBucketWithConfig(ctx, core.BucketConfig{Name: "test", AllowKeyTTL: true}))
+				})
+
+				It("expires keys created with a TTL", func(ctx SpecContext) {
+					events := lo.Must(bucket.Watch(ctx, "key"))
+
+					lo.Must(bucket.CreateWithTTL(ctx, "key", []byte("some - value"), time.Second))
+					lo.Must0(bucket.Put(ctx, "other", []byte("some - value")))
+
+					Eventually(events).WithContext(ctx).Should(Receive(HaveField("Type", core.KVEventSynced)))
+					Eventually(events).WithContext(ctx).Should(Receive(HaveField("Type", core.KVEventPut)))
+
+					Eventually(events).WithContext(ctx).WithTimeout(5 * time.Second).
+						Should(Receive(Equal(core.KVEvent{Type: core.KVEventDelete, Key: "key"})))
+
+					_, err := bucket.Get(ctx, "key")
+					Expect(err).To(MatchError(core.ErrKeyNotFound))
+					Expect(bucket.Get(ctx, "other")).To(Equal([]byte("some - value")))
+				})
+
+				It("expires keys put with a TTL", func(ctx SpecContext) {
+					lo.Must0(bucket.Put(ctx, "key", []byte("some - value")))
+					lo.Must0(bucket.PutWithTTL(ctx, "key", []byte("new - value"), time.Second))
+
+					Expect(bucket.Get(ctx, "key")).To(Equal([]byte("new - value")))
+
+					Eventually(func(ctx context.Context) error {
+						_, err := bucket.Get(ctx, "key")
+
+						return err
+					}).WithContext(ctx).WithTimeout(5 * time.Second).Should(MatchError(core.ErrKeyNotFound))
+				})
+			})
+
+			Context("when the bucket does not allow key TTLs", func() {
+				It("returns an error", func(ctx SpecContext) {
+					bucket = lo.Must(kv.Bucket(ctx, "test"))
+
+					_, err := bucket.CreateWithTTL(ctx, "key", []byte("some - value"), time.Second)
+					Expect(err).To(MatchError(core.ErrKeyTTLDisabled))
+
+					err = bucket.PutWithTTL(ctx, "key", []byte("some - value"), time.Second)
+					Expect(err).To(MatchError(core.ErrKeyTTLDisabled))
+				})
+			})
+		})
+
+		describeBucket(func() core.KV { return kv })
+	})
+}
+
+func describeBucket(getKV func() core.KV) bool {
+	return Describe("KVBucket", func() {
+		var bucket core.KVBucket
+
+		BeforeEach(func(ctx SpecContext) {
+			bucket = lo.Must(getKV().Bucket(ctx, "test"))
+
+			lo.Must(bucket.Create(ctx, "key", []byte("some - value")))
+			lo.Must(bucket.Create(ctx, oneLevelKey, []byte("some - value")))
+			lo.Must(bucket.Create(ctx, twoLevelKey, []byte("some - value")))
+			lo.Must(bucket.Create(ctx, anotherKey, []byte("some - value")))
+		})
+
+		Describe("Get", func() {
+			Context("when key exists", func() {
+				It("returns value", func(ctx SpecContext) {
+					value, err := bucket.Get(ctx, "key")
+
+					Expect(err).ToNot(HaveOccurred())
+					Expect(value).To(Equal([]byte("some - value")))
+				})
+			})
+
+			Context("when key does not exists", func() {
+				It("returns an error", func(ctx SpecContext) {
+					_, err := bucket.Get(ctx, "key2")
+
+					Expect(err).To(MatchError(core.ErrKeyNotFound))
+				})
+			})
+		})
+
+		Describe("GetEntry", func() {
+			Context("when key exists", func() {
+				It("returns the value and the sequence to update the key with", func(ctx SpecContext) {
+					entry, err := bucket.GetEntry(ctx, "key")
+
+					Expect(err).ToNot(HaveOccurred())
+					Expect(entry.Key).To(Equal("key"))
+					Expect(entry.Value).To(Equal([]byte("some - value")))
+
+					lo.Must(bucket.Update(ctx, "key", []byte("new - value"), entry.Sequence))
+				})
+			})
+
+			Context("when key does not exists", func() {
+				It("returns an error", func(ctx SpecContext) {
+					_, err := bucket.GetEntry(ctx, "key2")
+
+					Expect(err).To(MatchError(core.ErrKeyNotFound))
+				})
+			})
+		})
+
+		Describe("Keys", func() {
+			Context("when no filters passed", func() {
+				It("returns all keys in the bucket", func(ctx SpecContext) {
+					keys, err := bucket.Keys(ctx)
+
+					Expect(err).ToNot(HaveOccurred())
+					Expect(keys).To(ConsistOf([]string{
+						"key",
+						oneLevelKey,
+						twoLevelKey,
+						anotherKey,
+					}))
+				})
+			})
+
+			Context("when a filter is passed", func() {
+				It("returns all keys in the bucket filtered by specified filters", func(ctx SpecContext) {
+					keys, err := bucket.Keys(ctx, "namespace.>")
+
+					Expect(err).ToNot(HaveOccurred())
+					Expect(keys).To(ConsistOf([]string{
+						oneLevelKey,
+						twoLevelKey,
+					}))
+				})
+			})
+		})
+
+		Describe("Count", func() {
+			Context("when no filters passed", func() {
+				It("returns all keys in the bucket", func(ctx SpecContext) {
+					count, err := bucket.Count(ctx)
+
+					Expect(err).ToNot(HaveOccurred())
+					Expect(count).To(Equal(4))
+				})
+			})
+
+			Context("when a filter is passed", func() {
+				It("returns all keys in the bucket filtered by specified filters", func(ctx SpecContext) {
+					count, err := bucket.Count(ctx, "namespace.>")
+
+					Expect(err).ToNot(HaveOccurred())
+					Expect(count).To(Equal(2))
+				})
+			})
+		})
+
+		Describe("All", func() {
+			Context("when no filters passed", func() {
+				It("returns all values in the bucket", func(ctx SpecContext) {
+					list, err := bucket.All(ctx)
+
+					Expect(err).ToNot(HaveOccurred())
+					Expect(list).To(HaveLen(4))
+					Expect(list[0].Key).To(Equal("key"))
+					Expect(list[0].Value).To(Equal([]byte("some - value")))
+				})
+			})
+
+			Context("when a full key specified", func() {
+				It("returns all values in the bucket filtered by specified filters", func(ctx SpecContext) {
+					list, err := bucket.All(ctx, "key")
+
+					Expect(err).ToNot(HaveOccurred())
+					Expect(list).To(HaveLen(1))
+					Expect(list[0].Key).To(Equal("key"))
+					Expect(list[0].Value).To(Equal([]byte("some - value")))
+				})
+			})
+
+			Context("when a wildcards are used", func() {
+				Context("when * is used", func() {
+					It("returns all values in the bucket filtered by specified filters", func(ctx SpecContext) {
+						list, err := bucket.All(ctx, "namespace.*")
+
+						Expect(err).ToNot(HaveOccurred())
+						Expect(list).To(HaveLen(1))
+						Expect(list[0].Key).To(Equal(oneLevelKey))
+						Expect(list[0].Value).To(Equal([]byte("some - value")))
+					})
+				})
+
+				Context("when > is used", func() {
+					It("returns all values in the bucket filtered by specified filters", func(ctx SpecContext) {
+						list, err := bucket.All(ctx, "namespace.>")
+
+						Expect(err).ToNot(HaveOccurred())
+						Expect(list).To(HaveLen(2))
+						Expect(list[0].Key).To(Equal(oneLevelKey))
+						Expect(list[0].Value).To(Equal([]byte("some - value")))
+
+						Expect(list[1].Key).To(Equal(twoLevelKey))
+						Expect(list[1].Value).To(Equal([]byte("some - value")))
+					})
+				})
+
+				Context("when multiple filters are used", func() {
+					It("returns all values in the bucket filtered by specified filters", func(ctx SpecContext) {
+						list, err := bucket.All(ctx, "namespace.>", "another.*")
+
+						Expect(err).ToNot(HaveOccurred())
+						Expect(list).To(HaveLen(3))
+						Expect(list[0].Key).To(Equal(oneLevelKey))
+						Expect(list[0].Value).To(Equal([]byte("some - value")))
+
+						Expect(list[1].Key).To(Equal(twoLevelKey))
+						Expect(list[1].Value).To(Equal([]byte("some - value")))
+
+						Expect(list[2].Key).To(Equal(anotherKey))
+						Expect(list[2].Value).To(Equal([]byte("some - value")))
+					})
+				})
+			})
+		})
+
+		Describe("Put", func() {
+			Context("when key exists", func() {
+				It("updates the value", func(ctx SpecContext) {
+					err := bucket.Put(ctx, "key", []byte("new - value"))
+
+					Expect(err).ToNot(HaveOccurred())
+
+					value, err := bucket.Get(ctx, "key")
+
+					Expect(err).ToNot(HaveOccurred())
+					Expect(value).To(Equal([]byte("new - value")))
+				})
+			})
+
+			Context("when key does not exists", func() {
+				It("creates the value", func(ctx SpecContext) {
+					err := bucket.Put(ctx, "key2", []byte("new - value"))
+
+					Expect(err).ToNot(HaveOccurred())
+
+					value, err := bucket.Get(ctx, "key2")
+
+					Expect(err).ToNot(HaveOccurred())
+					Expect(value).To(Equal([]byte("new - value")))
+				})
+			})
+		})
+
+		Describe("Upsert", func() {
+			Context("when key exists", func() {
+				It("returns an error", func(ctx SpecContext) {
+					_, err := bucket.Create(ctx, "key", []byte("new - value"))
+
+					Expect(err).To(MatchError(core.ErrKeyExists))
+				})
+			})
+
+			Context("when key does not exists", func() {
+				It("creates the value", func(ctx SpecContext) {
+					_, err := bucket.Create(ctx, "key2", []byte("new - value"))
+
+					Expect(err).ToNot(HaveOccurred())
+
+					value, err := bucket.Get(ctx, "key2")
+
+					Expect(err).ToNot(HaveOccurred())
+					Expect(value).To(Equal([]byte("new - value")))
+				})
+			})
+		})
+
+		Describe("Update", func() {
+			Context("when the sequence is the last one", func() {
+				It("updates the value", func(ctx SpecContext) {
+					seq := lo.Must(bucket.Create(ctx, "key2", []byte("some - value")))
+
+					newSeq, err := bucket.Update(ctx, "key2", []byte("new - value"), seq)
+
+					Expect(err).ToNot(HaveOccurred())
+					Expect(newSeq).To(BeNumerically(">", seq))
+					Expect(bucket.Get(ctx, "key2")).To(Equal([]byte("new - value")))
+				})
+			})
+
+			Context("when the key was updated after the sequence", func() {
+				It("returns an error", func(ctx SpecContext) {
+					seq := lo.Must(bucket.Create(ctx, "key2", []byte("some - value")))
+					lo.Must(bucket.Update(ctx, "key2", []byte("new - value"), seq))
+
+					_, err := bucket.Update(ctx, "key2", []byte("newer - value"), seq)
+
+					Expect(err).To(MatchError(core.ErrWrongSequence))
+					Expect(bucket.Get(ctx, "key2")).To(Equal([]byte("new - value")))
+				})
+			})
+		})
+
+		Describe("Delete", func() {
+			Context("when key exists", func() {
+				It("deletes the key", func(ctx SpecContext) {
+					err := bucket.Delete(ctx, "key")
+					Expect(err).ToNot(HaveOccurred())
+
+					_, err = bucket.Get(ctx, "key")
+					Expect(err).To(MatchError(core.ErrKeyNotFound))
+				})
+			})
+
+			Context("when key does not exists", func() {
+				It("does not return an error", func(ctx SpecContext) {
+					err := bucket.Delete(ctx, "key2")
+
+					Expect(err).ToNot(HaveOccurred())
+				})
+			})
+		})
+
+		Describe("Watch", func() {
+			var events <-chan core.KVEvent
+
+			next := func(ctx context.Context) core.KVEvent {
+				var event core.KVEvent
+
+				Eventually(events).WithContext(ctx).Should(Receive(&event))
+
+				return event
+			}
+
+			Context("when a filter is passed", func() {
+				It("delivers existing entries, then changes of matching keys", func(ctx SpecContext) {
+					lo.Must0(bucket.Delete(ctx, twoLevelKey))
+
+					events = lo.Must(bucket.Watch(ctx, "namespace.>"))
+
+					Expect(next(ctx)).To(Equal(core.KVEvent{
+						Type: core.KVEventPut, Key: oneLevelKey, Value: []byte("some - value"),
+					}))
+					Expect(next(ctx)).To(Equal(core.KVEvent{Type: core.KVEventSynced}))
+
+					lo.Must0(bucket.Put(ctx, anotherKey, []byte("new - value")))
+					lo.Must0(bucket.Put(ctx, twoLevelKey, []byte("new - value")))
+					lo.Must0(bucket.Delete(ctx, oneLevelKey))
+
+					Expect(next(ctx)).To(Equal(core.KVEvent{
+						Type: core.KVEventPut, Key: twoLevelKey, Value: []byte("new - value"),
+					}))
+					Expect(next(ctx)).To(Equal(core.KVEvent{Type: core.KVEventDelete, Key: oneLevelKey}))
+				})
+			})
+
+			Context("when no filters passed", func() {
+				It("delivers all entries", func(ctx SpecContext) {
+					events = lo.Must(bucket.Watch(ctx))
+
+					keys := []string{}
+
+					for event := next(ctx); event.Type != core.KVEventSynced; event = next(ctx) {
+						keys = append(keys, event.Key)
+					}
+
+					Expect(keys).To(ConsistOf("key", oneLevelKey, twoLevelKey, anotherKey))
+				})
+			})
+
+			It("closes the channel when the context is done", func(ctx SpecContext) {
+				watchCtx, cancel := context.WithCancel(ctx)
+
+				events = lo.Must(bucket.Watch(watchCtx, "key"))
+				cancel()
+
+				Eventually(events).WithContext(ctx).Should(BeClosed())
+			})
+		})
+	})
+}
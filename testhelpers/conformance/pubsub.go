@@ -0,0 +1,354 @@
+package conformance
+
+import (
+	"context"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	. "github.com/onsi/ginkgo/v2" //nolint:revive
+	. "github.com/onsi/gomega"    //nolint:revive
+	"github.com/samber/lo"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/fidfile"
+	"github.com/zhulik/pal"
+)
+
+// Function is the function which streams are used by the PubSub suite, implementations backed by a shared
+// server should delete them after each spec.
+var Function = fidfile.Function{Name_: "conformance-function"} //nolint:gochecknoglobals
+
+// PubSub describes the behavior every core.PubSuber and core.DeadLetterQueue implementation must follow.
+// newPal is called before each spec, it must provide both.
+func PubSub(name string, newPal func(ctx context.Context) *pal.Pal) bool {
+	return Describe(name+" PubSub", Serial, func() {
+		var pubSuber core.PubSuber
+		var dlq core.DeadLetterQueue
+
+		BeforeEach(func(ctx SpecContext) {
+			p := newPal(ctx)
+
+			pubSuber = lo.Must(pal.Invoke[core.PubSuber](ctx, p))
+			dlq = lo.Must(pal.Invoke[core.DeadLetterQueue](ctx, p))
+
+			lo.Must0(pubSuber.CreateOrUpdateFunctionStream(ctx, Function))
+		})
+
+		invoke := func(ctx context.Context, data string) {
+			msg := nats.NewMsg(pubSuber.InvokeSubjectName(Function))
+			msg.Data = []byte(data)
+			msg.Header.Set(core.HeaderNameRequestID, data)
+
+			lo.Must0(pubSuber.Publish(ctx, msg))
+		}
+
+		// consume receives and acknowledges the next invocation.
+		consume := func(ctx context.Context) jetstream.Msg {
+			msg := lo.Must(pubSuber.Next(ctx, pubSuber.FunctionStreamName(Function),
+				[]string{pubSuber.InvokeSubjectName(Function)}, Function.Name()))
+
+			lo.Must0(msg.Ack())
+
+			return msg
+		}
+
+		Describe("CreateOrUpdateFunctionStream", func() {
+			It("updates existing streams", func(ctx SpecContext) {
+				Expect(pubSuber.CreateOrUpdateFunctionStream(ctx, Function)).To(Succeed())
+			})
+
+			It("changes the storage of empty streams", func(ctx SpecContext) {
+				memoryFunction := Function
+				memoryFunction.Stream = &fidfile.Stream{Storage: string(core.StorageTypeMemory)}
+
+				Expect(pubSuber.CreateOrUpdateFunctionStream(ctx, memoryFunction)).To(Succeed())
+			})
+
+			It("does not apply updates which drop stored messages", func(ctx SpecContext) {
+				invoke(ctx, "first")
+				invoke(ctx, "second")
+
+				smallFunction := Function
+				smallFunction.Stream = &fidfile.Stream{MaxMsgs: 1}
+
+				err := pubSuber.CreateOrUpdateFunctionStream(ctx, smallFunction)
+				Expect(err).To(MatchError(core.ErrUnsafeStreamUpdate))
+
+				Expect(pubSuber.Pending(ctx, Function)).To(Equal(2))
+
+				consume(ctx)
+				consume(ctx)
+			})
+
+			Context("when the stream discards new messages", func() {
+				BeforeEach(func(ctx SpecContext) {
+					fullFunction := Function
+					fullFunction.Stream = &fidfile.Stream{MaxMsgs: 1, Discard: string(core.DiscardNew)}
+
+					lo.Must0(pubSuber.CreateOrUpdateFunctionStream(ctx, fullFunction))
+				})
+
+				It("rejects invocations once it's full", func(ctx SpecContext) {
+					invoke(ctx, "first")
+
+					err := pubSuber.Publish(ctx, nats.NewMsg(pubSuber.InvokeSubjectName(Function)))
+					Expect(err).To(MatchError(core.ErrQueueFull))
+
+					Expect(consume(ctx).Data()).To(Equal([]byte("first")))
+				})
+			})
+		})
+
+		Describe("Publish", func() {
+			Context("when no stream matches the subject", func() {
+				It("returns an error", func(ctx SpecContext) {
+					err := pubSuber.Publish(ctx, nats.NewMsg("conformance.unknown"))
+
+					Expect(err).To(HaveOccurred())
+				})
+			})
+
+			Context("when responses are published", func() {
+				BeforeEach(func(ctx SpecContext) {
+					smallFunction := Function
+					smallFunction.Stream = &fidfile.Stream{MaxMsgs: 1}
+
+					lo.Must0(pubSuber.CreateOrUpdateFunctionStream(ctx, smallFunction))
+				})
+
+				It("does not evict queued invocations", func(ctx SpecContext) {
+					invoke(ctx, "first")
+
+					for range 3 {
+						msg := nats.NewMsg(pubSuber.ResponseSubjectName(Function, "first"))
+						msg.Data = []byte("chunk")
+
+						lo.Must0(pubSuber.Publish(ctx, msg))
+					}
+
+					Expect(pubSuber.Pending(ctx, Function)).To(Equal(1))
+					Expect(consume(ctx).Data()).To(Equal([]byte("first")))
+				})
+			})
+		})
+
+		Describe("Next", func() {
+			It("returns messages in the order they were published", func(ctx SpecContext) {
+				invoke(ctx, "first")
+				invoke(ctx, "second")
+
+				streamName := pubSuber.FunctionStreamName(Function)
+				subjects := []string{pubSuber.InvokeSubjectName(Function)}
+
+				msg := lo.Must(pubSuber.Next(ctx, streamName, subjects, Function.Name()))
+				Expect(msg.Subject()).To(Equal(pubSuber.InvokeSubjectName(Function)))
+				Expect(msg.Data()).To(Equal([]byte("first")))
+				Expect(msg.Headers().Get(core.HeaderNameRequestID)).To(Equal("first"))
+				Expect(msg.Ack()).To(Succeed())
+
+				msg = lo.Must(pubSuber.Next(ctx, streamName, subjects, Function.Name()))
+				Expect(msg.Data()).To(Equal([]byte("second")))
+				Expect(msg.Ack()).To(Succeed())
+			})
+
+			It("redelivers messages which are not acknowledged", func(ctx SpecContext) {
+				invoke(ctx, "first")
+
+				streamName := pubSuber.FunctionStreamName(Function)
+				subjects := []string{pubSuber.InvokeSubjectName(Function)}
+
+				msg := lo.Must(pubSuber.Next(ctx, streamName, subjects, Function.Name()))
+				Expect(msg.Nak()).To(Succeed())
+
+				msg = lo.Must(pubSuber.Next(ctx, streamName, subjects, Function.Name()))
+				Expect(msg.Data()).To(Equal([]byte("first")))
+
+				metadata := lo.Must(msg.Metadata())
+				Expect(metadata.NumDelivered).To(Equal(uint64(2)))
+				Expect(msg.Ack()).To(Succeed())
+			})
+
+			It("removes acknowledged messages from the stream", func(ctx SpecContext) {
+				invoke(ctx, "first")
+
+				Expect(consume(ctx).Data()).To(Equal([]byte("first")))
+
+				Eventually(func(ctx context.Context) (int, error) {
+					return pubSuber.Pending(ctx, Function)
+				}).WithContext(ctx).Should(Equal(0))
+			})
+		})
+
+		Describe("Pending", func() {
+			It("counts invocations which are not picked up", func(ctx SpecContext) {
+				invoke(ctx, "first")
+				invoke(ctx, "second")
+
+				Expect(pubSuber.Pending(ctx, Function)).To(Equal(2))
+
+				streamName := pubSuber.FunctionStreamName(Function)
+				subjects := []string{pubSuber.InvokeSubjectName(Function)}
+
+				msg := lo.Must(pubSuber.Next(ctx, streamName, subjects, Function.Name()))
+				DeferCleanup(func() { msg.Ack() }) //nolint:errcheck
+
+				Expect(pubSuber.Pending(ctx, Function)).To(Equal(1))
+			})
+		})
+
+		Describe("Subscribe", func() {
+			It("delivers messages published to the subjects", func(ctx SpecContext) {
+				sub := lo.Must(pubSuber.Subscribe(ctx, pubSuber.ResponseStreamName(Function),
+					[]string{pubSuber.ResponseSubjectName(Function, "*")}, ""))
+				DeferCleanup(sub.Stop)
+
+				for _, requestID := range []string{"first", "second"} {
+					msg := nats.NewMsg(pubSuber.ResponseSubjectName(Function, requestID))
+					msg.Data = []byte(requestID)
+
+					lo.Must0(pubSuber.Publish(ctx, msg))
+				}
+
+				for _, requestID := range []string{"first", "second"} {
+					var msg jetstream.Msg
+
+					Eventually(sub.C()).WithContext(ctx).Should(Receive(&msg))
+					Expect(msg.Data()).To(Equal([]byte(requestID)))
+					Expect(msg.Ack()).To(Succeed())
+				}
+			})
+		})
+
+		Describe("PublishWaitResponse", func() {
+			It("returns the response", func(ctx SpecContext) {
+				go func() {
+					defer GinkgoRecover()
+
+					request := consume(ctx)
+
+					response := nats.NewMsg(pubSuber.ResponseSubjectName(Function, string(request.Data())))
+					response.Data = []byte("response")
+
+					lo.Must0(pubSuber.Publish(ctx, response))
+				}()
+
+				msg := nats.NewMsg(pubSuber.InvokeSubjectName(Function))
+				msg.Data = []byte("request")
+
+				response, err := pubSuber.PublishWaitResponse(ctx, core.PublishWaitResponseInput{
+					Msg:      msg,
+					Stream:   pubSuber.ResponseStreamName(Function),
+					Subjects: []string{pubSuber.ResponseSubjectName(Function, "request")},
+					Timeout:  5 * time.Second,
+				})
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(response.Data()).To(Equal([]byte("response")))
+			})
+		})
+
+		Describe("Listen", func() {
+			It("observes stored messages without consuming them", func(ctx SpecContext) {
+				listenCtx, cancel := context.WithCancel(ctx)
+				DeferCleanup(cancel)
+
+				messages := lo.Must(pubSuber.Listen(listenCtx, pubSuber.InvokeSubjectName(Function)))
+
+				invoke(ctx, "first")
+
+				var observed *nats.Msg
+
+				Eventually(messages).WithContext(ctx).Should(Receive(&observed))
+				Expect(observed.Data).To(Equal([]byte("first")))
+
+				Expect(consume(ctx).Data()).To(Equal([]byte("first")))
+			})
+
+			It("observes broadcast messages", func(ctx SpecContext) {
+				listenCtx, cancel := context.WithCancel(ctx)
+				DeferCleanup(cancel)
+
+				messages := lo.Must(pubSuber.Listen(listenCtx, pubSuber.InitErrorSubjectName(Function)))
+
+				msg := nats.NewMsg(pubSuber.InitErrorSubjectName(Function))
+				msg.Data = []byte("init error")
+
+				lo.Must0(pubSuber.Broadcast(ctx, msg))
+
+				var observed *nats.Msg
+
+				Eventually(messages).WithContext(ctx).Should(Receive(&observed))
+				Expect(observed.Data).To(Equal([]byte("init error")))
+			})
+		})
+
+		describeDeadLetterQueue(func() core.DeadLetterQueue { return dlq })
+	})
+}
+
+func describeDeadLetterQueue(getDLQ func() core.DeadLetterQueue) bool {
+	return Describe("DeadLetterQueue", func() {
+		var dlq core.DeadLetterQueue
+
+		BeforeEach(func() {
+			dlq = getDLQ()
+		})
+
+		Describe("List", func() {
+			Context("when queue is empty", func() {
+				It("returns an empty list", func(ctx SpecContext) {
+					Expect(dlq.List(ctx, Function)).To(BeEmpty())
+				})
+			})
+
+			Context("when queue has letters", func() {
+				BeforeEach(func(ctx SpecContext) {
+					for _, requestID := range []string{"first", "second", "third"} {
+						lo.Must0(dlq.Add(ctx, Function, core.DeadLetter{
+							RequestID: requestID,
+							Payload:   []byte(`{"some":"payload"}`),
+							Metadata:  core.InvocationMetadata{TraceID: "some-trace-id"},
+							Error:     []byte(`{"errorMessage":"boom"}`),
+							Attempts:  3,
+							FailedAt:  time.Now(),
+						}))
+					}
+
+					lo.Must0(dlq.Delete(ctx, Function, 2))
+				})
+
+				It("returns the letters which are not deleted", func(ctx SpecContext) {
+					letters, err := dlq.List(ctx, Function)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(letters).To(HaveLen(2))
+					Expect(letters[0].ID).To(Equal(uint64(1)))
+					Expect(letters[0].RequestID).To(Equal("first"))
+					Expect(letters[0].Metadata.TraceID).To(Equal("some-trace-id"))
+					Expect(letters[1].ID).To(Equal(uint64(3)))
+					Expect(letters[1].RequestID).To(Equal("third"))
+				})
+			})
+		})
+
+		Describe("Get", func() {
+			Context("when letter does not exist", func() {
+				It("returns an error", func(ctx SpecContext) {
+					_, err := dlq.Get(ctx, Function, 42)
+
+					Expect(err).To(MatchError(core.ErrDeadLetterNotFound))
+				})
+			})
+		})
+
+		Describe("Delete", func() {
+			Context("when letter does not exist", func() {
+				It("returns an error", func(ctx SpecContext) {
+					err := dlq.Delete(ctx, Function, 42)
+
+					Expect(err).To(MatchError(core.ErrDeadLetterNotFound))
+				})
+			})
+		})
+	})
+}
@@ -2,22 +2,94 @@ package testhelpers
 
 import (
 	"context"
+	"os"
+	"sync"
 	"time"
 
+	natsServer "github.com/nats-io/nats-server/v2/server"
+
 	"github.com/samber/lo"
 	"github.com/zhulik/fid/internal/config"
+	"github.com/zhulik/fid/internal/core"
+	"github.com/zhulik/fid/internal/kv"
+	"github.com/zhulik/fid/internal/pubsub"
 	pubSubNats "github.com/zhulik/fid/internal/pubsub/nats"
 	"github.com/zhulik/pal"
 )
 
-//nolint:mnd
+// embeddedNATS is the NATS server shared by all tests of the package when NATS_URL is not set.
+var embeddedNATS struct { //nolint:gochecknoglobals
+	sync.Mutex
+
+	server   *natsServer.Server
+	storeDir string
+}
+
+// natsURL returns NATS_URL if it's set, otherwise it starts the embedded NATS server unless it's running
+// and returns its URL.
+func natsURL() string {
+	if url := os.Getenv(core.EnvNameNatsURL); url != "" {
+		return url
+	}
+
+	embeddedNATS.Lock()
+	defer embeddedNATS.Unlock()
+
+	if embeddedNATS.server == nil {
+		embeddedNATS.storeDir = lo.Must(os.MkdirTemp("", "fid-nats"))
+		embeddedNATS.server = lo.Must(pubSubNats.StartServer(&natsServer.Options{
+			Host:     "127.0.0.1",
+			Port:     natsServer.RANDOM_PORT,
+			StoreDir: embeddedNATS.storeDir,
+		}))
+	}
+
+	return embeddedNATS.server.ClientURL()
+}
+
+// StopNATS stops the embedded NATS server and removes its data. Suites which use NewPal call it after
+// all specs.
+func StopNATS() {
+	embeddedNATS.Lock()
+	defer embeddedNATS.Unlock()
+
+	if embeddedNATS.server == nil {
+		return
+	}
+
+	embeddedNATS.server.Shutdown()
+	embeddedNATS.server.WaitForShutdown()
+	lo.Must0(os.RemoveAll(embeddedNATS.storeDir))
+
+	embeddedNATS.server = nil
+}
+
+// NewPal builds and initializes a pal with the given services, config and a NATS client. The client connects
+// to NATS_URL if it's set, otherwise to an embedded NATS server.
 func NewPal(ctx context.Context, services ...pal.ServiceDef) *pal.Pal {
-	p := pal.New(
+	return newPal(ctx,
 		append(services,
-			pal.Provide(&config.Config{}),
+			pal.Provide(&config.Config{NATSURL: natsURL()}),
 			pal.Provide(&pubSubNats.Client{}),
 		)...,
-	).
+	)
+}
+
+// NewMemoryPal builds and initializes a pal with the given services, config and the memory broker's
+// PubSuber, DeadLetterQueue, KV and BlobStore. It does not need NATS.
+func NewMemoryPal(ctx context.Context, services ...pal.ServiceDef) *pal.Pal {
+	return newPal(ctx,
+		append(services,
+			pal.Provide(&config.Config{}),
+			pubsub.Provide(core.BrokerNameMemory),
+			kv.Provide(core.BrokerNameMemory),
+		)...,
+	)
+}
+
+//nolint:mnd
+func newPal(ctx context.Context, services ...pal.ServiceDef) *pal.Pal {
+	p := pal.New(services...).
 		InjectSlog().
 		InitTimeout(time.Second * 10).
 		HealthCheckTimeout(time.Second * 10).